@@ -0,0 +1,180 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/migtools/demystifier/lib/batch"
+	"github.com/migtools/demystifier/lib/history"
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// setupBatch implements the batch subcommand
+func setupBatch() (*flag.FlagSet, func() error) {
+	var (
+		urlsFile    string
+		workers     int
+		showPassing bool
+		historyDir  string
+		noHistory   bool
+	)
+
+	flags := newFlagSet("batch", "[URL|JOB_HISTORY_URL]...", "Parse many runs concurrently and report the results of each test across the runs.")
+	flags.StringVar(&urlsFile, "urls", "", "file with one log location per line, - for stdin")
+	flags.IntVar(&workers, "j", batch.DefaultWorkers, "number of runs fetched and parsed at the same time")
+	flags.BoolVar(&showPassing, "s", false, "also show the tests that passed in every run")
+	flags.StringVar(&historyDir, "history-dir", history.DefaultDir(), "folder of the run history")
+	flags.BoolVar(&noHistory, "no-history", false, "do not record the runs in the history")
+	addFetchFlags(flags)
+	addParseFlags(flags)
+	return flags, func() error {
+		if err := setupFetcher(); err != nil {
+			return err
+		}
+
+		locations, err := batchLocations(flags.Args(), urlsFile)
+		if err != nil {
+			return err
+		}
+		if len(locations) == 0 {
+			flags.Usage()
+			return errors.New("batch expects at least one log location")
+		}
+
+		log.WithFields(log.Fields{
+			"Runs":    len(locations),
+			"Workers": workers,
+		}).Info("Parsing runs")
+		results := batch.Run(locations, workers, func(location string) (*utils.TestRunData, error) {
+			return parseRun(resolveLocation(location))
+		})
+		logBatchErrors(results)
+
+		if !noHistory {
+			recordBatch(historyDir, results)
+		}
+		PrintBatchReport(results, batch.Aggregate(results), showPassing)
+		return nil
+	}
+}
+
+// logBatchErrors logs the runs that could not be parsed
+func logBatchErrors(results []batch.Result) {
+	for i := range results {
+		if results[i].Err != nil {
+			log.WithFields(log.Fields{
+				"location": results[i].Location,
+				"error":    results[i].Err,
+			}).Error("Error parsing run")
+		}
+	}
+}
+
+// recordBatch records the parsed runs in the history
+func recordBatch(historyDir string, results []batch.Result) {
+	for i := range results {
+		result := &results[i]
+		if result.Err != nil {
+			continue
+		}
+		recordRun(historyDir, result.Location, result.Data)
+	}
+}
+
+// batchLocations expands the job history pages and reads the locations file
+func batchLocations(args []string, urlsFile string) ([]string, error) {
+	locations := args
+	if urlsFile != "" {
+		file := os.Stdin
+		if urlsFile != "-" {
+			var err error
+			file, err = os.Open(urlsFile) // #nosec G304 -- the file is given by the user
+			if err != nil {
+				return nil, fmt.Errorf("error opening file: %v", err)
+			}
+			defer file.Close()
+		}
+		fromFile, err := batch.ReadLocations(file)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, fromFile...)
+	}
+
+	var expanded []string
+	for _, location := range locations {
+		if !batch.IsJobHistoryURL(location) {
+			expanded = append(expanded, location)
+			continue
+		}
+		runs, err := batch.FetchJobHistory(location)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, runs...)
+	}
+	return expanded, nil
+}
+
+// PrintBatchReport prints the results of each test across the runs
+func PrintBatchReport(results []batch.Result, aggregates []batch.TestAggregate, showPassing bool) {
+	parsed := 0
+	for i := range results {
+		if results[i].Err == nil {
+			parsed++
+		}
+	}
+	fmt.Printf("Parsed %d of %d runs\n", parsed, len(results))
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Test Name", "Runs", "Passed", "Failed", "Flaky", "Failed In"})
+	for i := range aggregates {
+		aggregate := &aggregates[i]
+		if !showPassing && aggregate.Failed == 0 && aggregate.Flaky == 0 {
+			continue
+		}
+		var failedIn []string
+		for _, result := range aggregate.Results {
+			if result.Verdict == utils.Failed {
+				failedIn = append(failedIn, runLabel(result))
+			}
+		}
+		t.AppendRow(table.Row{
+			aggregate.ShortName, len(aggregate.Results),
+			aggregate.Passed, aggregate.Failed, aggregate.Flaky,
+			strings.Join(failedIn, "\n"),
+		})
+	}
+	t.Render()
+}
+
+// runLabel names a run by its job and ID, or by its location for local files
+func runLabel(result batch.RunResult) string {
+	job := utils.GetJobInfo(result.Location)
+	if job.JobName == "" {
+		return result.Location
+	}
+	return job.JobName + "/" + job.RunID
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/migtools/demystifier/lib/cache"
+)
+
+const bytesPerMB = 1 << 20
+
+// cacheOptions are the cache flags shared by the commands fetching logs
+type cacheOptions struct {
+	dir       string
+	maxSizeMB int64
+	offline   bool
+	disabled  bool
+}
+
+var cacheOpts = cacheOptions{dir: cache.DefaultDir(), maxSizeMB: cache.DefaultMaxSize / bytesPerMB}
+
+// setupCache implements the cache subcommand
+func setupCache() (*flag.FlagSet, func() error) {
+	var (
+		maxSizeMB int64
+		olderThan time.Duration
+	)
+
+	flags := newFlagSet("cache", "list|prune|clear", "List or remove the downloaded logs.")
+	flags.StringVar(&cacheOpts.dir, "cache-dir", cacheOpts.dir, "folder of the downloaded logs cache")
+	flags.Int64Var(&maxSizeMB, "max-size", 0, "prune: evict the least recently used logs above this size in MB")
+	flags.DurationVar(&olderThan, "older-than", 0, "prune: remove the logs unused for this long, for example 720h")
+	return flags, func() error {
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return errors.New("cache expects exactly one action")
+		}
+
+		logCache, err := cache.Open(cacheOpts.dir)
+		if err != nil {
+			return err
+		}
+
+		switch flags.Arg(0) {
+		case "list":
+			entries, err := logCache.Entries()
+			if err != nil {
+				return err
+			}
+			PrintCacheEntries(logCache.Dir(), entries)
+		case "prune":
+			if maxSizeMB == 0 && olderThan == 0 {
+				return errors.New("prune expects -max-size or -older-than")
+			}
+			removed, err := logCache.Prune(maxSizeMB*bytesPerMB, olderThan)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Removed %d logs from %s\n", removed, logCache.Dir())
+		case "clear":
+			removed, err := logCache.Clear()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Removed %d logs from %s\n", removed, logCache.Dir())
+		default:
+			flags.Usage()
+			return fmt.Errorf("unknown cache action %q", flags.Arg(0))
+		}
+		return nil
+	}
+}
+
+// PrintCacheEntries prints the cached logs, most recently used first
+func PrintCacheEntries(dir string, entries []cache.Entry) {
+	var total int64
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"URL", "Size (KB)", "Fetched", "Last Used", "Finished"})
+	for i := range entries {
+		entry := &entries[i]
+		total += entry.Size
+		t.AppendRow(table.Row{
+			entry.URL, entry.Size / (1 << 10),
+			entry.FetchedAt.Format(time.DateTime), entry.LastUsed.Format(time.DateTime),
+			entry.Immutable,
+		})
+	}
+	t.Render()
+	fmt.Printf("%d logs, %.1f MB in %s\n", len(entries), float64(total)/bytesPerMB, dir)
+}
@@ -0,0 +1,305 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/migtools/demystifier/lib/config"
+	"github.com/migtools/demystifier/lib/flakechecker"
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// The exit codes, documented in the README for the CI scripts
+const (
+	// exitPassed is returned when all the tests passed, possibly after retries
+	exitPassed = 0
+	// exitFailed is returned when a test failed for another reason than a known flake
+	exitFailed = 1
+	// exitKnownFlakes is returned when every failed test hit a known flake
+	exitKnownFlakes = 2
+	// exitError is returned on usage, input and parsing errors
+	exitError = 3
+)
+
+// The errors of the commands whose exit code tells how the run went
+var (
+	errTestsFailed = errors.New("tests failed")
+	errKnownFlakes = errors.New("only known flakes failed")
+)
+
+// command is a subcommand of the CLI
+type command struct {
+	name    string
+	summary string
+	// setup creates the flag set of the command and returns the function
+	// running the command once the flags are parsed. It only registers the
+	// flags, the known flags of the config are listed with it.
+	setup func() (*flag.FlagSet, func() error)
+}
+
+// run parses the arguments of the command and runs it
+func (c command) run(args []string) error {
+	flags, run := c.setup()
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	return run()
+}
+
+// commands lists the subcommands in the order of the usage, summary is the
+// default one when the first argument is not a command name
+func commands() []command {
+	return []command{
+		{"summary", "report the failed attempts and a summary of a run (default)", setupSummary},
+		{"dump", "save the logs of every attempt of a run to a folder", setupDump},
+		{"flakes", "match the failed attempts of a run against the known flakes", setupFlakes},
+		{"patterns", "list the known flake patterns", setupPatterns},
+		{"compare", "report the differences between two runs", setupCompare},
+		{"diff-attempts", "compare the failed and passing attempts of flaky tests", setupDiffAttempts},
+		{"history", "report the pass, fail and flake rates of the recorded runs", setupHistory},
+		{"batch", "aggregate several runs", setupBatch},
+		{"crawl", "aggregate the recent runs of a Prow job", setupCrawl},
+		{"watch", "follow a running Prow job", setupWatch},
+		{"tui", "browse the tests, attempts and logs of a run in the terminal", setupTUI},
+		{"serve", "serve a JSON API and a web page analyzing runs", setupServe},
+		{"github-comment", "post the analysis of the failed jobs of a pull request as a comment", setupGitHubComment},
+		{"notify", "send the failures of runs to a Slack channel or a webhook", setupNotify},
+		{"metrics", "write the results of runs as Prometheus metrics", setupMetrics},
+		{"cache", "manage the downloaded logs cache", setupCache},
+		{"config", "show the settings of the config files", setupConfig},
+	}
+}
+
+// The global flags, registered by every command
+var (
+	debugMode bool
+	// flakePatternsDir is the folder of the flake patterns, the built-in ones are used when empty
+	flakePatternsDir string
+	// configFile is read after the user and repository config files
+	configFile string
+	profile    string
+)
+
+// settings are the config settings applied to the flags of the command
+var settings = &config.Effective{}
+
+// newFlagSet creates the flag set of a command with the global flags.
+// Parsing errors are returned, to exit with exitError rather than the
+// flag package exit code.
+func newFlagSet(name, arguments, description string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.BoolVar(&debugMode, "d", false, "debug mode")
+	flags.StringVar(&flakePatternsDir, "patterns", "", "folder of the flake pattern JSON files, the built-in patterns when empty")
+	flags.StringVar(&configFile, "config", "", "config file, read after the user config and the "+config.LocalFile+" of the repository")
+	flags.StringVar(&profile, "profile", "", "config profile, the default profile of the config files when empty")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s\n\n", strings.TrimSpace(os.Args[0]+" "+name+" [options] "+arguments))
+		fmt.Fprintln(flags.Output(), description)
+		fmt.Fprintln(flags.Output())
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// knownFlags are the flag names of every command, the config settings are
+// checked against them
+var knownFlags map[string]bool
+
+// listFlags returns the flag names of every command. Registering the flags
+// sets them to their defaults, listFlags runs before parsing the arguments.
+func listFlags() map[string]bool {
+	names := map[string]bool{}
+	for _, cmd := range commands() {
+		flags, _ := cmd.setup()
+		flags.VisitAll(func(f *flag.Flag) {
+			names[f.Name] = true
+		})
+	}
+	return names
+}
+
+// parseFlags parses the arguments of a command, then sets the flags not
+// given from the config files and applies the global flags
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if knownFlags == nil {
+		knownFlags = listFlags()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := applyConfig(flags); err != nil {
+		return err
+	}
+	if debugMode {
+		log.SetLevel(log.DebugLevel)
+	}
+	return nil
+}
+
+// applyConfig sets the flags of a command which were not given on the
+// command line from the settings of the selected profile
+func applyConfig(flags *flag.FlagSet) error {
+	paths := config.DefaultPaths()
+	if configFile != "" {
+		if _, err := os.Stat(configFile); err != nil {
+			return fmt.Errorf("error reading config: %v", err)
+		}
+		paths = append(paths, configFile)
+	}
+	loaded, err := config.Load(paths...)
+	if err != nil {
+		return err
+	}
+	effective, err := loaded.Resolve(profile)
+	if err != nil {
+		return err
+	}
+
+	given := givenFlags(flags)
+	for _, setting := range effective.Settings {
+		if flags.Lookup(setting.Name) == nil && !knownFlags[setting.Name] {
+			return fmt.Errorf("error in config %s: unknown setting %s, it is not a flag of any command", setting.Source, setting.Name)
+		}
+		// the settings of the other commands are skipped
+		if given[setting.Name] || setting.Name == "config" || setting.Name == "profile" || flags.Lookup(setting.Name) == nil {
+			continue
+		}
+		if err := flags.Set(setting.Name, setting.Value); err != nil {
+			return fmt.Errorf("error in config %s: invalid value %q for %s: %v", setting.Source, setting.Value, setting.Name, err)
+		}
+		log.WithFields(log.Fields{
+			"Setting": setting.Name,
+			"Value":   setting.Value,
+			"Source":  setting.Source,
+		}).Debug("Using config")
+	}
+	settings = effective
+	return nil
+}
+
+// givenFlags returns the names of the flags given on the command line
+func givenFlags(flags *flag.FlagSet) map[string]bool {
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	return given
+}
+
+// resolveLocation applies the URL rules of the config to a log location
+// given on the command line, then resolves the Prow URLs
+func resolveLocation(location string) string {
+	return utils.GeneratesLogURL(settings.ResolveURL(location))
+}
+
+// printUsage prints the commands and the exit codes
+func printUsage(output io.Writer) {
+	fmt.Fprintf(output, "Usage: %s [command] [options] [arguments]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands() {
+		fmt.Fprintf(output, "  %-14s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(output, "\nRun '%s help COMMAND' or '%s COMMAND -h' for the options of a command.\n", os.Args[0], os.Args[0])
+	fmt.Fprintf(output, "\nExit codes:\n  %d  all the tests passed\n  %d  tests failed\n  %d  only known flakes failed\n  %d  usage, input or parsing error\n",
+		exitPassed, exitFailed, exitKnownFlakes, exitError)
+}
+
+// findCommand returns the command to run and its arguments
+func findCommand(args []string) (command, []string) {
+	all := commands()
+	if len(args) > 0 {
+		for _, cmd := range all {
+			if cmd.name == args[0] {
+				return cmd, args[1:]
+			}
+		}
+	}
+	return all[0], args
+}
+
+// exitCode maps the error returned by a command to the exit code
+func exitCode(err error) int {
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitPassed
+	case errors.Is(err, errTestsFailed):
+		return exitFailed
+	case errors.Is(err, errKnownFlakes):
+		return exitKnownFlakes
+	default:
+		return exitError
+	}
+}
+
+// matchFlakes returns the flake patterns found in the logs, and whether one
+// of them is a known flake rather than an error to skip
+func matchFlakes(logs string) ([]flakechecker.FlakePattern, bool, error) {
+	var (
+		flakes      []flakechecker.FlakePattern
+		shouldRetry bool
+		err         error
+	)
+	if flakePatternsDir != "" {
+		flakes, shouldRetry, err = flakechecker.CheckIfFlakeOccurred(logs, flakePatternsDir)
+	} else {
+		flakes, shouldRetry, err = flakechecker.KnownFlakes(logs)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error loading the flake patterns: %v", err)
+	}
+	return flakes, shouldRetry, nil
+}
+
+// runResult tells how a run went, from the last attempt of its failed tests.
+//
+// Returns:
+//   - nil when no test failed, flaky tests passed in the end.
+//   - errKnownFlakes when the logs of every failed test match a known flake, the
+//     patterns of errors to skip do not count.
+//   - errTestsFailed otherwise, or an error loading the patterns.
+func runResult(testData *utils.TestRunData) error {
+	failed, knownFlakes := 0, 0
+	for i := range testData.TestRun {
+		thisTest := &testData.TestRun[i]
+		if thisTest.Verdict() != utils.Failed {
+			continue
+		}
+		failed++
+		lastAttempt := &thisTest.Attempt[len(thisTest.Attempt)-1]
+		_, knownFlake, err := matchFlakes(strings.Join(lastAttempt.Logs, "\n"))
+		if err != nil {
+			return err
+		}
+		if knownFlake {
+			knownFlakes++
+		}
+	}
+	switch {
+	case failed == 0:
+		return nil
+	case knownFlakes == failed:
+		return errKnownFlakes
+	default:
+		return errTestsFailed
+	}
+}
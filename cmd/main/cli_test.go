@@ -0,0 +1,298 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/config"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+const (
+	knownFlakeLog = "Error copying image: writing blob: uploading layer chunked: received unexpected HTTP status: 500 Internal Server Error"
+	skipErrorLog  = "received EOF, stopping recv loop"
+)
+
+func testWithAttempts(name string, attempts ...[]string) utils.IndividualTestRunData {
+	test := utils.IndividualTestRunData{Name: name, ShortName: name}
+	for i, logs := range attempts {
+		status := utils.Failed
+		if logs == nil {
+			status = utils.Passed
+		}
+		test.Attempt = append(test.Attempt, utils.AttemptData{AttemptNo: i, Logs: logs, Status: utils.EventStatus{Status: status}})
+	}
+	return test
+}
+
+func TestRunResult(t *testing.T) {
+	tests := []struct {
+		name        string
+		tests       []utils.IndividualTestRunData
+		patternsDir string
+		want        error
+		wantCode    int
+	}{
+		{
+			name:     "All passed",
+			tests:    []utils.IndividualTestRunData{testWithAttempts("backup", nil)},
+			wantCode: exitPassed,
+		},
+		{
+			name:     "Flaky test passed on retry",
+			tests:    []utils.IndividualTestRunData{testWithAttempts("backup", []string{"timeout"}, nil)},
+			wantCode: exitPassed,
+		},
+		{
+			name: "Real failure",
+			tests: []utils.IndividualTestRunData{
+				testWithAttempts("backup", []string{knownFlakeLog}),
+				testWithAttempts("restore", []string{"restore failed"}),
+			},
+			want:     errTestsFailed,
+			wantCode: exitFailed,
+		},
+		{
+			name:     "Only known flakes",
+			tests:    []utils.IndividualTestRunData{testWithAttempts("backup", []string{"timeout"}, []string{"STEP: backup", knownFlakeLog})},
+			want:     errKnownFlakes,
+			wantCode: exitKnownFlakes,
+		},
+		{
+			name:        "Known flakes of a patterns folder",
+			tests:       []utils.IndividualTestRunData{testWithAttempts("backup", []string{knownFlakeLog})},
+			patternsDir: "../../lib/flakechecker/patterns",
+			want:        errKnownFlakes,
+			wantCode:    exitKnownFlakes,
+		},
+		{
+			name:     "Error to skip is not a flake",
+			tests:    []utils.IndividualTestRunData{testWithAttempts("backup", []string{skipErrorLog})},
+			want:     errTestsFailed,
+			wantCode: exitFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flakePatternsDir = tt.patternsDir
+			defer func() { flakePatternsDir = "" }()
+
+			err := runResult(&utils.TestRunData{TestRun: tt.tests})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("runResult() = %v, want %v", err, tt.want)
+			}
+			if code := exitCode(err); code != tt.wantCode {
+				t.Errorf("exitCode() = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+// isolateConfig keeps the user config and the config of the repository out
+// of a test, the commands read them when parsing their flags
+func isolateConfig(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Error getting the current folder: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("Error changing folder: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(dir); err != nil {
+			t.Errorf("Error changing folder: %v", err)
+		}
+	})
+}
+
+// runCommand runs the named command with the arguments
+func runCommand(name string, args ...string) error {
+	cmd, args := findCommand(append([]string{name}, args...))
+	return cmd.run(args)
+}
+
+func TestExitCode(t *testing.T) {
+	isolateConfig(t)
+	if code := exitCode(flag.ErrHelp); code != exitPassed {
+		t.Errorf("exitCode(help) = %d, want %d", code, exitPassed)
+	}
+	if code := exitCode(runCommand("summary", "-unknown")); code != exitError {
+		t.Errorf("exitCode(unknown flag) = %d, want %d", code, exitError)
+	}
+	if code := exitCode(runCommand("summary", "-no-history", "does-not-exist.txt")); code != exitError {
+		t.Errorf("exitCode(missing log) = %d, want %d", code, exitError)
+	}
+	// without location the log is read from stdin
+	stdin, err := os.Open(fixture.BuildLog)
+	if err != nil {
+		t.Fatalf("Error opening log file: %v", err)
+	}
+	defer stdin.Close()
+	defer func(previous *os.File) { os.Stdin = previous }(os.Stdin)
+	os.Stdin = stdin
+	if code := exitCode(runCommand("summary", "-no-history")); code != exitFailed {
+		t.Errorf("exitCode(log on stdin) = %d, want %d", code, exitFailed)
+	}
+	// the report of a single run is not merged into every run of a batch
+	if err := runCommand("batch", "-json-report", "report.json", "a.txt", "b.txt"); err == nil || !strings.Contains(err.Error(), "-json-report") {
+		t.Errorf("batch -json-report error = %v", err)
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantName string
+		wantArgs int
+	}{
+		{name: "No arguments", wantName: "summary"},
+		{name: "Summary flags", args: []string{"-s", "build-log.txt"}, wantName: "summary", wantArgs: 2},
+		{name: "Command", args: []string{"flakes", "build-log.txt"}, wantName: "flakes", wantArgs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, args := findCommand(tt.args)
+			if cmd.name != tt.wantName || len(args) != tt.wantArgs {
+				t.Errorf("findCommand() = %s %v, want %s with %d arguments", cmd.name, args, tt.wantName, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestListFlags(t *testing.T) {
+	flags := listFlags()
+	for _, name := range []string{"d", "anchor-tags", "history-dir", "allowed-hosts", "webhook-url"} {
+		if !flags[name] {
+			t.Errorf("listFlags() misses %s", name)
+		}
+	}
+	if flags["unknown"] {
+		t.Errorf("listFlags() has the unknown flag")
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	isolateConfig(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `defaults:
+  min-delta: 1m
+  patterns: ./flakes
+  gzip: true
+url-rules:
+  - match: '^aws/(\d+)$'
+    replace: https://prow.example.com/aws/$1/build-log.txt
+profiles:
+  oadp-aws:
+    min-delta: 2m
+    threshold: 50
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Error writing config: %v", err)
+	}
+	typo := filepath.Join(t.TempDir(), "typo.yaml")
+	if err := os.WriteFile(typo, []byte("defaults:\n  min-detla: 1m\n"), 0600); err != nil {
+		t.Fatalf("Error writing config: %v", err)
+	}
+	defer func() {
+		flakePatternsDir, configFile, profile = "", "", ""
+		settings = &config.Effective{}
+	}()
+
+	tests := []struct {
+		name          string
+		args          []string
+		wantMinDelta  time.Duration
+		wantThreshold float64
+		wantPatterns  string
+		wantErr       bool
+	}{
+		{
+			name:          "Defaults",
+			args:          []string{"-config", path},
+			wantMinDelta:  time.Minute,
+			wantThreshold: 10,
+			wantPatterns:  "./flakes",
+		},
+		{
+			name:          "Profile and flags",
+			args:          []string{"-config", path, "-profile", "oadp-aws", "-patterns", "/tmp/flakes"},
+			wantMinDelta:  2 * time.Minute,
+			wantThreshold: 50,
+			wantPatterns:  "/tmp/flakes",
+		},
+		{
+			name:          "Flag overriding the profile",
+			args:          []string{"-config", path, "-profile", "oadp-aws", "-min-delta", "30s"},
+			wantMinDelta:  30 * time.Second,
+			wantThreshold: 50,
+			wantPatterns:  "./flakes",
+		},
+		{
+			name:    "Unknown profile",
+			args:    []string{"-config", path, "-profile", "oadp-gcp"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown setting",
+			args:    []string{"-config", typo},
+			wantErr: true,
+		},
+		{
+			name:    "Missing config",
+			args:    []string{"-config", path + ".missing"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				minDelta  time.Duration
+				threshold float64
+			)
+			flags := newFlagSet("test", "", "")
+			flags.DurationVar(&minDelta, "min-delta", 0, "")
+			flags.Float64Var(&threshold, "threshold", 10, "")
+			err := parseFlags(flags, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFlags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if minDelta != tt.wantMinDelta || threshold != tt.wantThreshold || flakePatternsDir != tt.wantPatterns {
+				t.Errorf("parseFlags() set %v, %v, %s, want %v, %v, %s",
+					minDelta, threshold, flakePatternsDir, tt.wantMinDelta, tt.wantThreshold, tt.wantPatterns)
+			}
+			if got := resolveLocation("aws/42"); got != "https://prow.example.com/aws/42/build-log.txt" {
+				t.Errorf("resolveLocation() = %s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/migtools/demystifier/lib/compare"
+)
+
+// setupCompare implements the compare subcommand
+func setupCompare() (*flag.FlagSet, func() error) {
+	var (
+		minDelta         time.Duration
+		threshold        float64
+		showStillFailing bool
+	)
+
+	flags := newFlagSet("compare", "BASE_URL HEAD_URL", "Report the tests that newly fail, newly pass, changed flakiness or got slower in HEAD_URL.")
+	flags.DurationVar(&minDelta, "min-delta", compare.DefaultMinDelta, "minimum duration increase reported as a regression")
+	flags.Float64Var(&threshold, "threshold", compare.DefaultRatio*100, "minimum duration increase, in percent, reported as a regression")
+	flags.BoolVar(&showStillFailing, "s", false, "also show the tests failing in both runs")
+	addFetchFlags(flags)
+	addParseFlags(flags)
+	return flags, func() error {
+		if err := setupFetcher(); err != nil {
+			return err
+		}
+		if flags.NArg() != 2 {
+			flags.Usage()
+			return errors.New("compare expects exactly two log locations")
+		}
+
+		base, err := parseRun(resolveLocation(flags.Arg(0)))
+		if err != nil {
+			return err
+		}
+		head, err := parseRun(resolveLocation(flags.Arg(1)))
+		if err != nil {
+			return err
+		}
+
+		report := compare.Compare(base, head, compare.Options{
+			MinDelta: minDelta,
+			Ratio:    threshold / 100,
+		})
+		PrintCompareReport(report, showStillFailing)
+		if len(report.NewlyFailing) > 0 {
+			return errTestsFailed
+		}
+		return nil
+	}
+}
+
+// PrintCompareReport prints the differences between two runs
+func PrintCompareReport(report *compare.Report, showStillFailing bool) {
+	printChanges("Newly failing tests", report.NewlyFailing)
+	printChanges("Newly passing tests", report.NewlyPassing)
+	if showStillFailing {
+		printChanges("Tests failing in both runs", report.StillFailing)
+	}
+	printChanges("Tests with changed flakiness", report.FlakinessChanged)
+	printChanges("Duration regressions", report.DurationRegressions)
+	printChanges("Added tests", report.Added)
+	printChanges("Removed tests", report.Removed)
+
+	if !report.HasRegressions() {
+		fmt.Println("No regressions found")
+	}
+}
+
+func printChanges(title string, changes []compare.TestChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", title)
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Test Name", "Location", "Base", "Head", "Base Attempts", "Head Attempts", "Base Time", "Head Time", "Difference"})
+	for i := range changes {
+		change := &changes[i]
+		t.AppendRow(table.Row{
+			change.ShortName, change.Name,
+			change.BaseVerdict, change.HeadVerdict,
+			change.BaseAttempts, change.HeadAttempts,
+			change.BaseDuration, change.HeadDuration, change.DurationDelta(),
+		})
+	}
+	t.Render()
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/migtools/demystifier/lib/config"
+)
+
+// setupConfig implements the config command
+func setupConfig() (*flag.FlagSet, func() error) {
+	flags := newFlagSet("config show", "",
+		"Print the config files read, the selected profile and the flag values and URL rules it sets.")
+	return flags, func() error {
+		if flags.NArg() == 0 || flags.Arg(0) != "show" {
+			flags.Usage()
+			return errors.New("config expects the show action")
+		}
+		// the flags usually follow the action, the config is applied again with them
+		if err := parseFlags(flags, flags.Args()[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 0 {
+			flags.Usage()
+			return errors.New("config show expects no arguments")
+		}
+
+		PrintSettings(settings, givenFlags(flags), flags)
+		return nil
+	}
+}
+
+// PrintSettings prints the effective settings, the global flags given on the
+// command line override the config ones
+func PrintSettings(effective *config.Effective, given map[string]bool, flags *flag.FlagSet) {
+	if len(effective.Files) == 0 {
+		fmt.Println("No config file found")
+	} else {
+		fmt.Printf("Config files: %s\n", strings.Join(effective.Files, ", "))
+	}
+	if effective.Profile != "" {
+		fmt.Printf("Profile: %s\n", effective.Profile)
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Setting", "Value", "Source"})
+	for _, setting := range effective.Settings {
+		if !given[setting.Name] {
+			t.AppendRow(table.Row{setting.Name, setting.Value, setting.Source})
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name != "config" && f.Name != "profile" {
+			t.AppendRow(table.Row{f.Name, f.Value.String(), "command line"})
+		}
+	})
+	t.SortBy([]table.SortBy{{Name: "Setting"}})
+	t.Render()
+
+	if len(effective.URLRules) == 0 {
+		return
+	}
+	fmt.Println("URL rules:")
+	rules := table.NewWriter()
+	rules.SetOutputMirror(os.Stdout)
+	rules.AppendHeader(table.Row{"Match", "Replace"})
+	for _, rule := range effective.URLRules {
+		rules.AppendRow(table.Row{rule.Match.String(), rule.Replace})
+	}
+	rules.Render()
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/migtools/demystifier/lib/batch"
+	"github.com/migtools/demystifier/lib/crawl"
+	"github.com/migtools/demystifier/lib/history"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultCrawlRuns = 10
+
+// setupCrawl implements the crawl subcommand
+func setupCrawl() (*flag.FlagSet, func() error) {
+	var (
+		limit       int
+		workers     int
+		showPassing bool
+		gcswebURL   string
+		historyDir  string
+		noHistory   bool
+	)
+
+	flags := newFlagSet("crawl", "JOB_NAME|JOB_HISTORY_URL", "List the recent runs of a Prow job from its bucket and report the results of each test across the runs.")
+	flags.IntVar(&limit, "n", defaultCrawlRuns, "number of most recent finished runs to parse, 0 for all")
+	flags.IntVar(&workers, "j", batch.DefaultWorkers, "number of runs fetched and parsed at the same time")
+	flags.BoolVar(&showPassing, "s", false, "also show the tests that passed in every run")
+	flags.StringVar(&gcswebURL, "gcsweb", crawl.DefaultGCSWebURL, "gcsweb folder of the Prow results bucket")
+	flags.StringVar(&historyDir, "history-dir", history.DefaultDir(), "folder of the run history")
+	flags.BoolVar(&noHistory, "no-history", false, "do not record the runs in the history")
+	addFetchFlags(flags)
+	addParseFlags(flags)
+	return flags, func() error {
+		if err := setupFetcher(); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return errors.New("crawl expects exactly one job name")
+		}
+
+		crawler := crawl.New()
+		crawler.GCSWebURL = gcswebURL
+		crawler.Workers = workers
+		jobName := crawl.JobName(flags.Arg(0))
+		log.WithFields(log.Fields{
+			"Job": jobName,
+		}).Info("Listing runs")
+		runs, err := crawler.ListRuns(jobName, limit)
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			fmt.Printf("No finished runs of %s\n", jobName)
+			return nil
+		}
+		PrintCrawledRuns(runs)
+
+		locations := make([]string, 0, len(runs))
+		for _, run := range runs {
+			locations = append(locations, run.BuildLogURL)
+		}
+		results := batch.Run(locations, workers, parseRun)
+		logBatchErrors(results)
+		if !noHistory {
+			recordBatch(historyDir, results)
+		}
+		PrintBatchReport(results, batch.Aggregate(results), showPassing)
+		return nil
+	}
+}
+
+// PrintCrawledRuns prints the runs found in the bucket
+func PrintCrawledRuns(runs []crawl.Run) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Run ID", "Finished", "Result"})
+	for _, run := range runs {
+		t.AppendRow(table.Row{run.ID, run.Finished.Time().UTC().Format(time.DateTime), run.Finished.Result})
+	}
+	t.Render()
+}
@@ -18,210 +18,432 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/migtools/demystifier/lib/dump"
+	"github.com/migtools/demystifier/lib/filter"
+	"github.com/migtools/demystifier/lib/gaps"
+	"github.com/migtools/demystifier/lib/history"
+	"github.com/migtools/demystifier/lib/input"
+	"github.com/migtools/demystifier/lib/oadp"
+	"github.com/migtools/demystifier/lib/summary"
 	"github.com/migtools/demystifier/lib/utils"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/term"
 )
 
-const saveFolderPerm = 0750
+// number of longest silent gaps reported per attempt
+const topGaps = 5
 
-func parseLogFile(logFile string) (*utils.TestRunData, error) {
-	testRunDataPtr, err := utils.GetRunDataFromLog(logFile)
+// The formats of the summary
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
 
+// DumpTestsToFolder saves the logs of every attempt to a destination folder,
+// one folder per suite, test and attempt, with an index of the files
+func DumpTestsToFolder(testData *utils.TestRunData, folder string, compress bool) error {
+	index, err := dump.Write(testData, folder, dump.Options{Gzip: compress})
 	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err,
-		}).Fatal("Error")
-		return nil, err
+		return fmt.Errorf("error dumping logs to folder: %v", err)
 	}
+	log.WithFields(log.Fields{
+		"Folder": folder,
+		"Tests":  len(index.Tests),
+		"Index":  filepath.Join(folder, dump.IndexHTMLFile),
+	}).Info("Logs saved")
+	return nil
+}
 
-	err = utils.SetIndividualTestsFromLog(testRunDataPtr, "It")
-
+// PrintTestSummary prints the summary of tests, one table per group
+func PrintTestSummary(testData *utils.TestRunData, opts summary.Options) error {
+	groups, err := summary.Build(testData, opts)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err,
-		}).Fatal("Error")
-		return nil, err
+		return err
 	}
-
-	return testRunDataPtr, nil
-}
-
-// DumpTestsToFolder saves logs to a destination folder
-func DumpTestsToFolder(testData *utils.TestRunData, folder string) {
-	mkdirErr := os.MkdirAll(folder, saveFolderPerm)
-	if mkdirErr != nil {
-		log.WithFields(log.Fields{
-			"error": mkdirErr,
-		}).Fatal("Error creating dir")
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = summary.DefaultColumns
 	}
-	for i := range testData.TestRun {
-		thisRun := &testData.TestRun[i]
-		for j := range thisRun.Attempt {
-			thisAttempt := &thisRun.Attempt[j]
-			err := thisAttempt.DumpLogsToFileWithPrefixes(j, folder, thisAttempt.Name, ": ")
-			if err != nil {
-				log.WithFields(log.Fields{
-					"error": err,
-				}).Fatal("Error dumping logs to file")
+	header := table.Row{}
+	for _, column := range columns {
+		header = append(header, summary.Header(column))
+	}
+
+	fmt.Println("Test Summary Table:")
+	for _, group := range groups {
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		if opts.GroupBy != "" && opts.GroupBy != summary.GroupNone {
+			title := group.Title
+			if title == "" {
+				title = "(no " + opts.GroupBy + ")"
+			}
+			t.SetTitle(title)
+		}
+		t.AppendHeader(header)
+		for i := range group.Rows {
+			row := table.Row{}
+			for _, column := range columns {
+				row = append(row, group.Rows[i].Value(column))
 			}
+			t.AppendRow(row)
 		}
+		t.Render()
 	}
+	return nil
 }
 
-// PrintTestSummary prints the summary of tests
-func PrintTestSummary(testData *utils.TestRunData) {
-	// Define a struct to hold the summary data
-	type TestSummary struct {
-		Name           string
-		NumAttempts    int
-		NumFailed      int
-		TotalRunTime   time.Duration
-		NumOver1Second int
-		AverageRunTime time.Duration
-	}
-
-	// Initialize a slice to hold the summary data for each test run
-	var summaries []TestSummary
+// testResult is a test of the JSON summary
+type testResult struct {
+	Name       string   `json:"name"`
+	ShortName  string   `json:"shortName"`
+	Suite      string   `json:"suite,omitempty"`
+	Containers []string `json:"containers,omitempty"`
+	Labels     []string `json:"labels,omitempty"`
+	Verdict    string   `json:"verdict"`
+	Attempts   int      `json:"attempts"`
+	Failed     int      `json:"failed"`
+	Duration   float64  `json:"durationSeconds"`
+}
 
-	// Loop through each test run to collect summary data
+// PrintTestSummaryJSON prints the verdict, attempts and duration of each test as JSON
+func PrintTestSummaryJSON(testData *utils.TestRunData) error {
+	results := make([]testResult, 0, len(testData.TestRun))
 	for i := range testData.TestRun {
-		var numAttempts, failedAttempts, numOver1Second int
-		totalRunTime := time.Duration(0)
 		thisTest := &testData.TestRun[i]
+		result := testResult{
+			Name:       thisTest.Name,
+			ShortName:  thisTest.ShortName,
+			Suite:      thisTest.Suite,
+			Containers: thisTest.Containers,
+			Labels:     thisTest.Labels,
+			Verdict:    thisTest.Verdict(),
+			Attempts:   len(thisTest.Attempt),
+		}
 		for j := range thisTest.Attempt {
-			// Increment the number of attempts
-			numAttempts++
-			thisAttempt := &thisTest.Attempt[j]
-			// If the attempt failed, increment the failed attempts counter
-			if thisAttempt.Status.Status == "FAILED" {
-				failedAttempts++
-			}
-
-			// If the duration is greater than 1 second, increment the counter
-			if thisAttempt.Duration > time.Second {
-				numOver1Second++
+			if thisTest.Attempt[j].Status.Status == utils.Failed {
+				result.Failed++
 			}
+			result.Duration += thisTest.Attempt[j].Duration.Seconds()
+		}
+		results = append(results, result)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
 
-			// Add the duration to the total run time
-			totalRunTime += thisAttempt.Duration
+// PrintAttemptEvents prints the Velero events of an attempt
+func PrintAttemptEvents(attempt *utils.AttemptData) {
+	for i := range attempt.Events {
+		event := &attempt.Events[i]
+		phases := make([]string, 0, len(event.Phases))
+		for _, transition := range event.Phases {
+			phases = append(phases, transition.Phase)
+		}
+		fields := log.Fields{
+			"Kind":     event.Kind,
+			"Name":     event.Name,
+			"Phases":   strings.Join(phases, " -> "),
+			"Duration": event.Duration,
+			"Items":    fmt.Sprintf("%d/%d", event.ItemsDone, event.ItemsTotal),
+			"Status":   event.Status.Status,
+		}
+		if event.Describe != nil {
+			fields["Warnings"] = len(event.Describe.Warnings)
+			fields["Errors"] = len(event.Describe.Errors)
+		}
+		if event.Status.Status == utils.Passed {
+			log.WithFields(fields).Info("  Velero event")
+		} else {
+			log.WithFields(fields).Warn("  Velero event")
 		}
 
-		// Calculate the average run time based on durations over 1 second
-		var averageRunTime time.Duration
-		if numOver1Second > 0 {
-			averageRunTime = totalRunTime / time.Duration(numOver1Second)
+		if event.Describe == nil {
+			continue
 		}
+		printDescribeMessages(event.Describe.Warnings, "    Velero warning: ", log.InfoLevel)
+		printDescribeMessages(event.Describe.Errors, "    Velero error: ", log.WarnLevel)
+	}
+}
 
-		// Append the summary data to the slice
-		summaries = append(summaries, TestSummary{
-			Name:           thisTest.ShortName,
-			NumAttempts:    numAttempts,
-			NumFailed:      failedAttempts,
-			TotalRunTime:   totalRunTime,
-			NumOver1Second: numOver1Second,
-			AverageRunTime: averageRunTime,
-		})
+// printDescribeMessages logs the describe messages of an event grouped by
+// namespace and kind
+func printDescribeMessages(messages []utils.DescribeMessage, prefix string, level log.Level) {
+	groups := oadp.GroupMessages(messages)
+	namespaces := make([]string, 0, len(groups))
+	for namespace := range groups {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		kinds := make([]string, 0, len(groups[namespace]))
+		for kind := range groups[namespace] {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			for _, message := range groups[namespace][kind] {
+				log.WithFields(log.Fields{
+					"Namespace": namespace,
+					"Kind":      kind,
+					"Resource":  message.Resource,
+				}).Log(level, prefix+message.Message)
+			}
+		}
 	}
+}
 
-	// Sort by avg time
-	sort.Slice(summaries, func(i, j int) bool {
-		return summaries[i].AverageRunTime < summaries[j].AverageRunTime
-	})
+// PrintGapsReport prints where the time went inside an attempt
+func PrintGapsReport(testName string, attempt *utils.AttemptData) {
+	report := gaps.Analyze(attempt, topGaps)
 
-	// Print the summary table
-	fmt.Println("Test Summary Table:")
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Test Name", "Num Attempts", "Num Failed", "Average Run Time"})
-	for _, summary := range summaries {
-		t.AppendRows([]table.Row{
-			{summary.Name, summary.NumAttempts, summary.NumFailed, summary.AverageRunTime},
-		})
-	}
-	t.Render()
+	fmt.Printf("Gaps and stalls for %s (attempt %d, %v, %v spent polling):\n",
+		testName, report.AttemptNo, report.Duration, report.PollingTime)
+
+	if len(report.Polls) > 0 {
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Repeated Message", "Count", "First Seen", "Last Seen", "Total Wait"})
+		for _, poll := range report.Polls {
+			t.AppendRow(table.Row{poll.Message, poll.Count,
+				poll.FirstSeen.Format(time.TimeOnly), poll.LastSeen.Format(time.TimeOnly), poll.TotalWait})
+		}
+		t.Render()
+	}
+
+	if len(report.Gaps) > 0 {
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Silent Gap", "From", "Last Line Before", "First Line After"})
+		for _, gap := range report.Gaps {
+			t.AppendRow(table.Row{gap.Duration, gap.Start.Format(time.TimeOnly), gap.From, gap.To})
+		}
+		t.Render()
+	}
 }
 
 func main() {
 	log.SetLevel(log.InfoLevel)
 
-	log.WithFields(log.Fields{
-		">>> start_demystifier_timestamp": time.Now().Unix(),
-	}).Info("Test Demystifier starts its journey")
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			os.Exit(runHelp(args[1:]))
+		}
+	}
+	cmd, args := findCommand(args)
+	err := cmd.run(args)
+	code := exitCode(err)
+	switch code {
+	case exitError:
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Error")
+	case exitFailed, exitKnownFlakes:
+		log.WithFields(log.Fields{
+			"exit_code": code,
+		}).Warn("Run " + err.Error())
+	}
+	os.Exit(code)
+}
 
+// runHelp prints the usage of the CLI or of a command, returning the exit code
+func runHelp(args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return exitPassed
+	}
+	for _, cmd := range commands() {
+		if cmd.name == args[0] {
+			return exitCode(cmd.run([]string{"-h"}))
+		}
+	}
+	printUsage(os.Stderr)
+	return exitError
+}
+
+// setupSummary implements the summary command, reporting the failed attempts of a run
+func setupSummary() (*flag.FlagSet, func() error) {
 	var (
 		logLocation      string
 		showPassing      bool
 		timeStamps       bool
-		debugMode        bool
+		showGaps         bool
 		dumpLogsToFolder string
+		historyDir       string
+		noHistory        bool
+		output           string
+		compress         bool
 	)
 
-	flag.BoolVar(&timeStamps, "t", false, "whether to include timestamps in the output (shorthand)")
-	flag.BoolVar(&showPassing, "s", false, "show all tests even those passing")
-	flag.BoolVar(&debugMode, "d", false, "debug mode")
-	flag.StringVar(&dumpLogsToFolder, "f", "", "dump logs to folder")
+	flags := newFlagSet("summary", "[URL|PATH|-]",
+		"Report the failed attempts of a run and print a summary of its tests. The log is read from stdin with - or without location.")
+	flags.BoolVar(&timeStamps, "t", false, "include the start time of the attempts in the output")
+	flags.BoolVar(&showPassing, "s", false, "show all tests even those passing")
+	flags.BoolVar(&showGaps, "g", false, "show gaps and stalls analysis for the printed attempts")
+	flags.StringVar(&dumpLogsToFolder, "f", "", "also dump the logs to this folder, like the dump command")
+	flags.BoolVar(&compress, "gzip", false, "compress the files of the attempts dumped with -f")
+	flags.StringVar(&historyDir, "history-dir", history.DefaultDir(), "folder of the run history")
+	flags.BoolVar(&noHistory, "no-history", false, "do not record the run in the history")
+	flags.StringVar(&output, "output", outputText, "format of the summary, "+outputText+" or "+outputJSON)
+	addFetchFlags(flags)
+	addParseFlags(flags)
+	addReportFlag(flags)
+	addFilterFlag(flags)
+	addSummaryFlags(flags)
+
+	return flags, func() error {
+		testFilter, err := filter.Parse(filterExpression)
+		if err != nil {
+			return err
+		}
+		opts := summaryOptions()
+		if err := opts.Validate(); err != nil {
+			return err
+		}
+		if output != outputText && output != outputJSON {
+			return fmt.Errorf("unknown output format %q", output)
+		}
+		if err := setupFetcher(); err != nil {
+			return err
+		}
+		if flags.NArg() > 1 {
+			flags.Usage()
+			return errors.New("summary expects at most one log location")
+		}
 
-	flag.Parse()
+		log.WithFields(log.Fields{
+			">>> start_demystifier_timestamp": time.Now().Unix(),
+		}).Info("Test Demystifier starts its journey")
+
+		if flags.NArg() > 0 {
+			logLocation = resolveLocation(flags.Arg(0))
+		} else {
+			// without location the log is piped, a terminal would wait forever
+			if term.IsTerminal(int(os.Stdin.Fd())) {
+				flags.Usage()
+				return errors.New("summary expects a log location, or the log on stdin")
+			}
+			logLocation = input.Stdin
+		}
 
-	if debugMode {
-		log.SetLevel(log.DebugLevel)
-	}
+		log.WithFields(log.Fields{
+			">>> location": logLocation,
+		}).Info("Using log from")
 
-	if len(flag.Args()) > 0 {
-		logLocation = utils.GeneratesLogURL(flag.Arg(0))
-	}
+		testData, err := parseRun(logLocation)
+		if err != nil {
+			return err
+		}
+		if !noHistory {
+			recordRun(historyDir, logLocation, testData)
+		}
+		testData = testFilter.Apply(testData)
+
+		for i := range testData.TestRun {
+			failedAttempts := 0 // Initialize counter for failed attempts in this test run
+			thisTest := &testData.TestRun[i]
+			for j := range thisTest.Attempt {
+				thisAttempt := &thisTest.Attempt[j]
+				fields := log.Fields{
+					"Name": thisTest.ShortName,
+					"No":   thisAttempt.AttemptNo,
+					"Time": thisAttempt.Duration,
+				}
+				if timeStamps && !thisAttempt.StartTime.IsZero() {
+					fields["Start"] = thisAttempt.StartTime.Format(time.RFC3339)
+				}
 
-	log.WithFields(log.Fields{
-		">>> location": logLocation,
-	}).Info("Using log from")
+				// If the attempt failed or showPassing is true, log the attempt
+				if thisAttempt.Status.Status == utils.Failed {
+					log.WithFields(fields).Error("Failed attempt run")
+					// Increment the counter if the attempt failed
+					if thisAttempt.Status.Status == utils.Failed {
+						failedAttempts++
+					}
+				} else if showPassing {
+					log.WithFields(fields).Info("Pass attempt run")
+				} else {
+					continue
+				}
 
-	testData, _ := parseLogFile(logLocation)
+				PrintAttemptEvents(thisAttempt)
 
-	for i := range testData.TestRun {
-		failedAttempts := 0 // Initialize counter for failed attempts in this test run
-		thisTest := &testData.TestRun[i]
-		for j := range thisTest.Attempt {
-			thisAttempt := &thisTest.Attempt[j]
-			fields := log.Fields{
-				"Name": thisTest.ShortName,
-				"No":   thisAttempt.AttemptNo,
-				"Time": thisAttempt.Duration,
+				if showGaps {
+					PrintGapsReport(thisTest.ShortName, thisAttempt)
+				}
 			}
 
-			// If the attempt failed or showPassing is true, log the attempt
-			if thisAttempt.Status.Status == utils.Failed {
-				log.WithFields(fields).Error("Failed attempt run")
-				// Increment the counter if the attempt failed
-				if thisAttempt.Status.Status == utils.Failed {
-					failedAttempts++
-				}
-			} else if showPassing {
-				log.WithFields(fields).Info("Pass attempt run")
+			// Summary for this test run
+			if failedAttempts > 0 {
+				log.WithFields(log.Fields{
+					"Name":   thisTest.Name,
+					"Failed": failedAttempts,
+				}).Info("Test Summary")
 			}
 		}
-
-		// Summary for this test run
-		if failedAttempts > 0 {
-			log.WithFields(log.Fields{
-				"Name":   thisTest.Name,
-				"Failed": failedAttempts,
-			}).Info("Test Summary")
+		if dumpLogsToFolder != "" {
+			if err := DumpTestsToFolder(testData, dumpLogsToFolder, compress); err != nil {
+				return err
+			}
 		}
+		if output == outputJSON {
+			if err := PrintTestSummaryJSON(testData); err != nil {
+				return err
+			}
+		} else if err := PrintTestSummary(testData, opts); err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			">>> end_demystifier_timestamp": time.Now().Unix(),
+		}).Info("Test Demystifier finishes its journey")
+		return runResult(testData)
 	}
-	if dumpLogsToFolder != "" {
-		DumpTestsToFolder(testData, dumpLogsToFolder)
-		os.Exit(0)
-	}
-	PrintTestSummary(testData)
+}
 
-	log.WithFields(log.Fields{
-		">>> end_demystifier_timestamp": time.Now().Unix(),
-	}).Info("Test Demystifier finishes its journey")
+// setupDump implements the dump command
+func setupDump() (*flag.FlagSet, func() error) {
+	var compress bool
+
+	flags := newFlagSet("dump", "URL|PATH FOLDER",
+		"Save the logs of every attempt of a run to FOLDER/SUITE/TEST/attempt-N, with an index.html and index.json of the files.")
+	flags.BoolVar(&compress, "gzip", false, "compress the files of the attempts")
+	addFetchFlags(flags)
+	addParseFlags(flags)
+	addReportFlag(flags)
+	addFilterFlag(flags)
+	return flags, func() error {
+		testFilter, err := filter.Parse(filterExpression)
+		if err != nil {
+			return err
+		}
+		if err := setupFetcher(); err != nil {
+			return err
+		}
+		if flags.NArg() != 2 {
+			flags.Usage()
+			return errors.New("dump expects a log location and a folder")
+		}
+
+		testData, err := parseRun(resolveLocation(flags.Arg(0)))
+		if err != nil {
+			return err
+		}
+		testData = testFilter.Apply(testData)
+		return DumpTestsToFolder(testData, flags.Arg(1), compress)
+	}
 }
@@ -0,0 +1,126 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/migtools/demystifier/lib/diff"
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// setupDiffAttempts implements the diff-attempts subcommand
+func setupDiffAttempts() (*flag.FlagSet, func() error) {
+	var (
+		testName    string
+		showPassing bool
+	)
+
+	flags := newFlagSet("diff-attempts", "URL", "Compare the failed attempt of each flaky test with its passing retry.")
+	flags.StringVar(&testName, "test", "", "only compare the tests whose name contains this string")
+	flags.BoolVar(&showPassing, "s", false, "also show the lines only found in the passing attempt")
+	addFetchFlags(flags)
+	addParseFlags(flags)
+	addReportFlag(flags)
+	return flags, func() error {
+		if err := setupFetcher(); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return errors.New("diff-attempts expects exactly one log location")
+		}
+
+		testData, err := parseRun(resolveLocation(flags.Arg(0)))
+		if err != nil {
+			return err
+		}
+
+		compared := 0
+		for i := range testData.TestRun {
+			thisTest := &testData.TestRun[i]
+			if testName != "" && !strings.Contains(thisTest.ShortName, testName) && !strings.Contains(thisTest.Name, testName) {
+				continue
+			}
+			failing, passing := diff.FindFlakyPair(thisTest)
+			if failing == nil {
+				if testName != "" && thisTest.Verdict() == utils.Failed {
+					log.WithFields(log.Fields{
+						"Name": thisTest.ShortName,
+					}).Warn("Test never passed, nothing to compare with")
+				}
+				continue
+			}
+			PrintAttemptDiff(thisTest, diff.CompareAttempts(failing, passing), showPassing)
+			compared++
+		}
+
+		if compared == 0 {
+			log.Info("No flaky test with a passing retry found")
+		}
+		return nil
+	}
+}
+
+// PrintAttemptDiff prints the differences between a failed attempt and its passing retry
+func PrintAttemptDiff(test *utils.IndividualTestRunData, result *diff.AttemptDiff, showPassing bool) {
+	fmt.Printf("=== %s (%s)\n", test.ShortName, test.Name)
+	fmt.Printf("Failing attempt %d took %v, passing attempt %d took %v (%+v)\n",
+		result.Failing.AttemptNo, result.Failing.Duration,
+		result.Passing.AttemptNo, result.Passing.Duration, result.DurationDelta)
+
+	if len(result.PhasesOnlyFailing) > 0 {
+		fmt.Printf("Velero phases only in the failing attempt: %s\n", strings.Join(result.PhasesOnlyFailing, ", "))
+	}
+	if len(result.PhasesOnlyPassing) > 0 {
+		fmt.Printf("Velero phases only in the passing attempt: %s\n", strings.Join(result.PhasesOnlyPassing, ", "))
+	}
+
+	if len(result.PhaseDeltas) > 0 {
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Kind", "Phase", "Failing", "Passing", "Difference"})
+		for _, delta := range result.PhaseDeltas {
+			t.AppendRow(table.Row{delta.Kind, delta.Phase, delta.Failing, delta.Passing, delta.Delta})
+		}
+		t.Render()
+	}
+
+	for _, message := range result.WarningsOnlyFailing {
+		fmt.Printf("Velero warning only in the failing attempt: [%s %s] %s\n", message.Namespace, message.Kind, message.Message)
+	}
+	for _, message := range result.ErrorsOnlyFailing {
+		fmt.Printf("Velero error only in the failing attempt: [%s %s] %s\n", message.Namespace, message.Kind, message.Message)
+	}
+
+	fmt.Println("Log lines only in the failing attempt:")
+	for _, line := range result.Lines {
+		switch {
+		case line.Op == diff.OnlyFailing:
+			fmt.Printf("%s %s\n", diff.OnlyFailing, line.Line)
+		case line.Op == diff.OnlyPassing && showPassing:
+			fmt.Printf("%s %s\n", diff.OnlyPassing, line.Line)
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+
+	"github.com/migtools/demystifier/lib/cache"
+	"github.com/migtools/demystifier/lib/fetch"
+	"github.com/migtools/demystifier/lib/input"
+	log "github.com/sirupsen/logrus"
+)
+
+// fetchOpts are the download settings shared by the commands fetching logs
+var fetchOpts fetch.Options
+
+// addFetchFlags registers the download and cache flags
+func addFetchFlags(flags *flag.FlagSet) {
+	flags.DurationVar(&fetchOpts.Timeout, "timeout", fetch.DefaultTimeout, "timeout of each download attempt")
+	flags.IntVar(&fetchOpts.Retries, "retries", fetch.DefaultRetries, "retries on network errors and 5xx responses, 0 to disable them")
+	flags.StringVar(&fetchOpts.ProxyURL, "proxy", "", "proxy URL, instead of the HTTP_PROXY and HTTPS_PROXY variables")
+	flags.StringVar(&fetchOpts.CABundle, "ca-bundle", "", "PEM file with extra trusted certificate authorities")
+
+	flags.StringVar(&cacheOpts.dir, "cache-dir", cacheOpts.dir, "folder of the downloaded logs cache")
+	flags.Int64Var(&cacheOpts.maxSizeMB, "cache-size", cacheOpts.maxSizeMB, "size of the cache in MB above which the least recently used logs are evicted")
+	flags.BoolVar(&cacheOpts.offline, "offline", false, "only use the logs already in the cache")
+	flags.BoolVar(&cacheOpts.disabled, "no-cache", false, "always download the logs")
+}
+
+// setupFetcher applies the download flags, once they are parsed
+func setupFetcher() error {
+	fetcher, err := fetch.New(fetchOpts)
+	if err != nil {
+		return err
+	}
+	fetch.SetDefault(fetcher)
+	return nil
+}
+
+// readLog reads a log from stdin, a file, a folder, an archive or a URL,
+// remote logs go through the cache
+func readLog(ctx context.Context, location string) (*input.Source, error) {
+	if !fetch.IsRemote(location) {
+		return input.Read(location, os.Stdin)
+	}
+	content, err := getRemote(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	return input.FromBytes(location, content)
+}
+
+// getRemote downloads a file, through the cache unless it is disabled
+func getRemote(ctx context.Context, location string) ([]byte, error) {
+	if cacheOpts.disabled && !cacheOpts.offline {
+		return fetch.Default().GetContext(ctx, location)
+	}
+	logCache, err := cache.Open(cacheOpts.dir)
+	if err != nil {
+		return nil, err
+	}
+	logCache.Offline = cacheOpts.offline
+	logCache.MaxSize = cacheOpts.maxSizeMB * bytesPerMB
+	return logCache.GetContext(ctx, location)
+}
+
+// readRemoteReport returns the first Ginkgo JSON report found next to a
+// remote build log, nil when the job did not upload one
+func readRemoteReport(ctx context.Context, logLocation string) *input.Source {
+	for _, location := range input.ReportLocations(logLocation) {
+		content, err := getRemote(ctx, location)
+		var statusErr *fetch.StatusError
+		switch {
+		case err == nil:
+			return &input.Source{Name: location, Content: content}
+		case errors.Is(err, cache.ErrNotCached), errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		default:
+			log.WithFields(log.Fields{
+				"location": location,
+				"error":    err,
+			}).Warn("Error fetching the JSON report")
+		}
+	}
+	return nil
+}
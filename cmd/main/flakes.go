@@ -0,0 +1,122 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/migtools/demystifier/lib/filter"
+	"github.com/migtools/demystifier/lib/flakechecker"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// setupFlakes implements the flakes command
+func setupFlakes() (*flag.FlagSet, func() error) {
+	flags := newFlagSet("flakes", "URL|PATH",
+		"Match the logs of the failed attempts of a run against the flake patterns. "+
+			"Exits with 2 when every failed test hit a known flake.")
+	addFetchFlags(flags)
+	addParseFlags(flags)
+	addReportFlag(flags)
+	addFilterFlag(flags)
+	return flags, func() error {
+		testFilter, err := filter.Parse(filterExpression)
+		if err != nil {
+			return err
+		}
+		if err := setupFetcher(); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return errors.New("flakes expects exactly one log location")
+		}
+
+		testData, err := parseRun(resolveLocation(flags.Arg(0)))
+		if err != nil {
+			return err
+		}
+		testData = testFilter.Apply(testData)
+		if err := PrintFlakes(testData); err != nil {
+			return err
+		}
+		return runResult(testData)
+	}
+}
+
+// PrintFlakes prints the flake patterns found in each failed attempt
+func PrintFlakes(testData *utils.TestRunData) error {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Test Name", "Attempt", "Verdict", "Known Flake", "Issue"})
+	failedAttempts := 0
+	for i := range testData.TestRun {
+		thisTest := &testData.TestRun[i]
+		for j := range thisTest.Attempt {
+			thisAttempt := &thisTest.Attempt[j]
+			if thisAttempt.Status.Status != utils.Failed {
+				continue
+			}
+			failedAttempts++
+			flakes, _, err := matchFlakes(strings.Join(thisAttempt.Logs, "\n"))
+			if err != nil {
+				return err
+			}
+			if len(flakes) == 0 {
+				t.AppendRow(table.Row{thisTest.ShortName, thisAttempt.AttemptNo, thisTest.Verdict(), "-", "-"})
+			}
+			for _, flake := range flakes {
+				t.AppendRow(table.Row{thisTest.ShortName, thisAttempt.AttemptNo, thisTest.Verdict(), flake.Description, flake.Issue})
+			}
+		}
+	}
+	if failedAttempts == 0 {
+		fmt.Println("No failed attempts")
+		return nil
+	}
+	t.Render()
+	return nil
+}
+
+// setupPatterns implements the patterns command
+func setupPatterns() (*flag.FlagSet, func() error) {
+	flags := newFlagSet("patterns", "", "List the flake patterns matched by the flakes command and the exit code.")
+	return flags, func() error {
+		if flags.NArg() != 0 {
+			flags.Usage()
+			return errors.New("patterns expects no arguments")
+		}
+
+		patterns, err := flakechecker.Patterns(flakePatternsDir)
+		if err != nil {
+			return fmt.Errorf("error loading the flake patterns: %v", err)
+		}
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Description", "Issue", "Search Pattern", "Retry"})
+		for _, pattern := range patterns {
+			t.AppendRow(table.Row{pattern.Description, pattern.Issue, pattern.StringSearchPattern, !pattern.SkipRetry})
+		}
+		t.Render()
+		return nil
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/migtools/demystifier/lib/batch"
+	"github.com/migtools/demystifier/lib/flakechecker"
+	"github.com/migtools/demystifier/lib/github"
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// githubTokenVariable holds the token posting the comment, it is not a flag
+// to keep it out of the process list
+const githubTokenVariable = "GITHUB_TOKEN"
+
+// setupGitHubComment implements the github-comment subcommand
+func setupGitHubComment() (*flag.FlagSet, func() error) {
+	var (
+		repo         string
+		pr           int
+		botComment   string
+		post         bool
+		apiURL       string
+		failureLines int
+		workers      int
+	)
+
+	flags := newFlagSet("github-comment", "[JOB_URL...]",
+		"Compose a markdown analysis of the failed Prow jobs of a pull request, with their failed and flaky tests and known issues. "+
+			"The job URLs are given as arguments or read from the openshift-ci bot comment with -bot-comment. "+
+			"The analysis is printed, or posted with -post as a single comment of the pull request, updated on the next runs. "+
+			"Posting needs a token in "+githubTokenVariable+".")
+	flags.StringVar(&repo, "repo", "", "owner/name of the repository, found in the job URLs when empty")
+	flags.IntVar(&pr, "pr", 0, "number of the pull request, found in the job URLs when 0")
+	flags.StringVar(&botComment, "bot-comment", "", "file holding the openshift-ci bot comment listing the failed jobs, - for stdin")
+	flags.BoolVar(&post, "post", false, "post or update the analysis comment of the pull request rather than printing it")
+	flags.StringVar(&apiURL, "github-api", github.DefaultAPIURL, "GitHub REST API, for GitHub Enterprise or tests")
+	flags.IntVar(&failureLines, "failure-lines", github.DefaultFailureLines, "lines of failure details shown per failed test, -1 to hide them")
+	flags.IntVar(&workers, "j", batch.DefaultWorkers, "number of jobs fetched and parsed at the same time")
+	addFetchFlags(flags)
+	addParseFlags(flags)
+	return flags, func() error {
+		if err := setupFetcher(); err != nil {
+			return err
+		}
+
+		locations := flags.Args()
+		if botComment != "" {
+			text, err := readBotComment(botComment)
+			if err != nil {
+				return err
+			}
+			locations = append(locations, github.ExtractJobURLs(text)...)
+		}
+		if len(locations) == 0 {
+			flags.Usage()
+			return errors.New("github-comment expects at least one job URL")
+		}
+		if repo == "" || pr == 0 {
+			foundRepo, foundPR, ok := github.PullRequest(locations[0])
+			if !ok && post {
+				return fmt.Errorf("no pull request found in %s, use -repo and -pr", locations[0])
+			}
+			if repo == "" {
+				repo = foundRepo
+			}
+			if pr == 0 {
+				pr = foundPR
+			}
+		}
+		token := os.Getenv(githubTokenVariable)
+		if post {
+			if err := github.ValidateRepo(repo); err != nil {
+				return err
+			}
+			if token == "" {
+				return fmt.Errorf("posting the analysis needs a GitHub token in %s", githubTokenVariable)
+			}
+		}
+
+		results := batch.Run(locations, workers, func(location string) (*utils.TestRunData, error) {
+			return parseRun(resolveLocation(location))
+		})
+		logBatchErrors(results)
+		comment := github.Compose(results, github.Options{
+			KnownFlakes: func(logs string) []flakechecker.FlakePattern {
+				flakes, _, err := matchFlakes(logs)
+				if err != nil {
+					log.WithFields(log.Fields{"error": err}).Warn("Known flakes not checked")
+					return nil
+				}
+				return flakes
+			},
+			FailureLines: failureLines,
+		})
+		if !post {
+			fmt.Print(comment)
+			return nil
+		}
+
+		client := github.NewClient(apiURL, token, &http.Client{Timeout: fetchOpts.Timeout})
+		posted, created, err := github.UpsertComment(client, repo, pr, comment)
+		if err != nil {
+			return err
+		}
+		action := "Updated"
+		if created {
+			action = "Created"
+		}
+		log.WithFields(log.Fields{
+			"Repository": repo,
+			"PR":         pr,
+			"URL":        posted.HTMLURL,
+		}).Info(action + " the analysis comment")
+		return nil
+	}
+}
+
+// readBotComment reads the bot comment from a file or stdin
+func readBotComment(location string) (string, error) {
+	var (
+		content []byte
+		err     error
+	)
+	if location == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(location) // #nosec G304 -- the file is given by the user
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading bot comment: %v", err)
+	}
+	return string(content), nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/migtools/demystifier/lib/history"
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultHistoryRuns = 20
+
+// recordRun stores the parsed run in the history, failures only warn
+func recordRun(historyDir, logLocation string, testData *utils.TestRunData) {
+	store, err := history.Open(historyDir)
+	if err == nil {
+		_, err = store.Record(utils.GetJobInfo(logLocation), testData)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("Could not record the run in the history")
+	}
+}
+
+// setupHistory implements the history subcommand
+func setupHistory() (*flag.FlagSet, func() error) {
+	var (
+		historyDir  string
+		filter      history.Filter
+		testName    string
+		showPassing bool
+	)
+
+	flags := newFlagSet("history", "", "Report per test pass, fail and flake rates and durations over the recorded runs.")
+	flags.StringVar(&historyDir, "dir", history.DefaultDir(), "folder of the run history")
+	flags.IntVar(&filter.Last, "n", defaultHistoryRuns, "number of most recent runs to look at, 0 for all")
+	flags.StringVar(&filter.JobName, "job", "", "only runs of jobs whose name contains this text")
+	flags.StringVar(&filter.Platform, "platform", "", "only runs on this platform, for example aws")
+	flags.StringVar(&filter.OCPVersion, "ocp", "", "only runs on this OCP version, for example 4.14")
+	flags.StringVar(&testName, "test", "", "only tests whose name contains this text")
+	flags.BoolVar(&showPassing, "s", false, "also show the tests that always passed")
+	return flags, func() error {
+		store, err := history.Open(historyDir)
+		if err != nil {
+			return err
+		}
+		runs, err := store.Runs(filter)
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			fmt.Printf("No runs recorded in %s\n", store.Dir())
+			return nil
+		}
+
+		var stats []history.TestStats
+		for _, testStats := range history.Stats(runs) {
+			if testName != "" && !strings.Contains(testStats.ShortName, testName) && !strings.Contains(testStats.Name, testName) {
+				continue
+			}
+			if !showPassing && testStats.Failed == 0 && testStats.Flaky == 0 {
+				continue
+			}
+			stats = append(stats, testStats)
+		}
+		PrintHistory(runs, stats)
+		return nil
+	}
+}
+
+// PrintHistory prints the trend of each test over the runs
+func PrintHistory(runs []history.RunRecord, stats []history.TestStats) {
+	fmt.Printf("%d runs from %s to %s\n", len(runs),
+		runs[len(runs)-1].StartedAt.Format(time.DateOnly), runs[0].StartedAt.Format(time.DateOnly))
+	if len(stats) == 0 {
+		fmt.Println("No failing or flaky tests")
+		return
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Test Name", "Runs", "Passed", "Failed", "Flaky", "Skipped", "Fail Rate", "Flake Rate", "P50", "P90", "Max", "First Seen Failing"})
+	for i := range stats {
+		testStats := &stats[i]
+		firstFailing := "-"
+		if !testStats.FirstSeenFailing.IsZero() {
+			firstFailing = testStats.FirstSeenFailing.Format(time.DateOnly)
+		}
+		t.AppendRow(table.Row{
+			testStats.ShortName, testStats.Runs, testStats.Passed, testStats.Failed, testStats.Flaky, testStats.Skipped,
+			fmt.Sprintf("%.0f%%", testStats.FailRate()*100), fmt.Sprintf("%.0f%%", testStats.FlakeRate()*100),
+			testStats.P50, testStats.P90, testStats.Max, firstFailing,
+		})
+	}
+	t.Render()
+}
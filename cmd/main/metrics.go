@@ -0,0 +1,88 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/migtools/demystifier/lib/batch"
+	"github.com/migtools/demystifier/lib/metrics"
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// setupMetrics implements the metrics subcommand
+func setupMetrics() (*flag.FlagSet, func() error) {
+	var (
+		urlsFile string
+		output   string
+		workers  int
+	)
+
+	flags := newFlagSet("metrics", "[URL|JOB_HISTORY_URL]...",
+		"Write the results of runs as Prometheus metrics labelled by job, platform and OCP version: "+
+			"test durations, attempts, failures and flakes, known flake matches by issue and suite totals. "+
+			"The metrics are printed, or written with -o to a file read by the node exporter textfile collector.")
+	flags.StringVar(&urlsFile, "urls", "", "file with one log location per line, - for stdin")
+	flags.StringVar(&output, "o", "", "file the metrics are written to, such as a .prom file of the textfile collector folder, stdout when empty")
+	flags.IntVar(&workers, "j", batch.DefaultWorkers, "number of runs fetched and parsed at the same time")
+	addFetchFlags(flags)
+	addParseFlags(flags)
+	return flags, func() error {
+		if err := setupFetcher(); err != nil {
+			return err
+		}
+
+		locations, err := batchLocations(flags.Args(), urlsFile)
+		if err != nil {
+			return err
+		}
+		if len(locations) == 0 {
+			flags.Usage()
+			return errors.New("metrics expects at least one log location")
+		}
+
+		results := batch.Run(locations, workers, func(location string) (*utils.TestRunData, error) {
+			return parseRun(resolveLocation(location))
+		})
+		logBatchErrors(results)
+		collector := metrics.New(metrics.Options{KnownFlakes: summaryOptions().KnownFlakes})
+		observed := 0
+		for i := range results {
+			if results[i].Err == nil && collector.Observe(results[i].Job, results[i].Data) {
+				observed++
+			}
+		}
+		if observed == 0 {
+			return errors.New("no run could be parsed")
+		}
+
+		if output == "" {
+			return collector.WriteText(os.Stdout)
+		}
+		if err := collector.WriteFile(output); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"Runs": observed,
+			"File": output,
+		}).Info("Wrote the metrics")
+		return nil
+	}
+}
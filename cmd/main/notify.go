@@ -0,0 +1,142 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/migtools/demystifier/lib/batch"
+	"github.com/migtools/demystifier/lib/notify"
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// setupNotify implements the notify subcommand
+func setupNotify() (*flag.FlagSet, func() error) {
+	var (
+		urlsFile      string
+		webhookURL    string
+		payloadFormat string
+		templateFile  string
+		title         string
+		flaky         bool
+		dedupWindow   time.Duration
+		stateFile     string
+		always        bool
+		workers       int
+	)
+
+	flags := newFlagSet("notify", "[URL|JOB_HISTORY_URL]...",
+		"Report the failed tests of runs, grouped by failure signature, as a Slack Block Kit message or a generic JSON webhook payload. "+
+			"The payload is posted to -webhook-url, or printed when it is empty. "+
+			"A failure already notified within -dedup-window is not notified again.")
+	flags.StringVar(&urlsFile, "urls", "", "file with one log location per line, - for stdin")
+	flags.StringVar(&webhookURL, "webhook-url", "", "URL receiving the payload, such as a Slack incoming webhook, the payload is printed when empty")
+	flags.StringVar(&payloadFormat, "payload", notify.FormatSlack, "payload format, one of "+strings.Join(notify.Formats(), ", "))
+	flags.StringVar(&templateFile, "template", "", "Go template of the payload executed on the report, instead of -payload")
+	flags.StringVar(&title, "title", "Test failures", "title of the notification")
+	flags.BoolVar(&flaky, "flaky", false, "also notify the tests which passed on a retry")
+	flags.DurationVar(&dedupWindow, "dedup-window", notify.DefaultWindow, "time during which a failure is not notified again, 0 to notify every failure")
+	flags.StringVar(&stateFile, "state-file", notify.DefaultStateFile(), "file remembering the notified failures")
+	flags.BoolVar(&always, "always", false, "notify even when there is no new failure")
+	flags.IntVar(&workers, "j", batch.DefaultWorkers, "number of runs fetched and parsed at the same time")
+	addFetchFlags(flags)
+	addParseFlags(flags)
+	return flags, func() error {
+		if err := setupFetcher(); err != nil {
+			return err
+		}
+
+		render := func(report *notify.Report) ([]byte, error) { return notify.Payload(report, payloadFormat) }
+		if templateFile != "" {
+			text, err := os.ReadFile(templateFile) // #nosec G304 -- the file is given by the user
+			if err != nil {
+				return fmt.Errorf("error reading template: %v", err)
+			}
+			tmpl, err := notify.ParseTemplate(templateFile, string(text))
+			if err != nil {
+				return err
+			}
+			render = func(report *notify.Report) ([]byte, error) { return notify.Render(tmpl, report) }
+		} else if _, err := notify.Payload(&notify.Report{}, payloadFormat); err != nil {
+			return err
+		}
+
+		locations, err := batchLocations(flags.Args(), urlsFile)
+		if err != nil {
+			return err
+		}
+		if len(locations) == 0 {
+			flags.Usage()
+			return errors.New("notify expects at least one log location")
+		}
+
+		var dedup *notify.Dedup
+		if dedupWindow > 0 && webhookURL != "" {
+			if dedup, err = notify.OpenDedup(stateFile, dedupWindow); err != nil {
+				return err
+			}
+		}
+
+		results := batch.Run(locations, workers, func(location string) (*utils.TestRunData, error) {
+			return parseRun(resolveLocation(location))
+		})
+		logBatchErrors(results)
+		report := notify.Build(results, notify.Options{
+			Title:       title,
+			Flaky:       flaky,
+			KnownFlakes: summaryOptions().KnownFlakes,
+		})
+		now := time.Now()
+		if dedup != nil {
+			dedup.Filter(report, now)
+		}
+		if len(report.Failures) == 0 && !always {
+			log.WithFields(log.Fields{
+				"Runs":       report.Runs,
+				"Suppressed": report.Suppressed,
+			}).Info("Nothing new to notify")
+			return nil
+		}
+
+		payload, err := render(report)
+		if err != nil {
+			return err
+		}
+		if webhookURL == "" {
+			fmt.Println(string(payload))
+			return nil
+		}
+		if err := notify.Send(&http.Client{Timeout: fetchOpts.Timeout}, webhookURL, payload); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"Failures":   len(report.Failures),
+			"Suppressed": report.Suppressed,
+		}).Info("Sent the notification")
+		if dedup != nil {
+			return dedup.Mark(report, now)
+		}
+		return nil
+	}
+}
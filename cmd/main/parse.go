@@ -0,0 +1,205 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/migtools/demystifier/lib/fetch"
+	"github.com/migtools/demystifier/lib/input"
+	"github.com/migtools/demystifier/lib/oadp"
+	"github.com/migtools/demystifier/lib/parser"
+	"github.com/migtools/demystifier/lib/summary"
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// The parsing flags of the commands parsing logs
+var (
+	// logFormat is the parser of the logs, detected when empty
+	logFormat string
+	// reportLocation is the Ginkgo JSON report, looked for next to the build log when empty
+	reportLocation string
+	noReport       bool
+	// anchorTags are the Ginkgo node types of the tests, separated by commas
+	anchorTags string
+	// filterExpression selects the tests reported
+	filterExpression string
+	// summaryColumns, summarySort and summaryGroupBy lay out the summary table
+	summaryColumns string
+	summarySort    string
+	summaryGroupBy string
+)
+
+// addParseFlags registers the parsing flags
+func addParseFlags(flags *flag.FlagSet) {
+	// the report of a single run is only given to the commands parsing one, see addReportFlag
+	reportLocation = ""
+	flags.StringVar(&logFormat, "format", "", "log format, one of "+strings.Join(parser.Formats(), ", ")+", detected when empty")
+	flags.BoolVar(&noReport, "no-json-report", false, "only parse the build log, even when a Ginkgo JSON report is found")
+	addAnchorTagsFlag(flags)
+}
+
+// addAnchorTagsFlag registers the anchor tags flag, watch only parses the
+// Ginkgo output and registers it alone
+func addAnchorTagsFlag(flags *flag.FlagSet) {
+	flags.StringVar(&anchorTags, "anchor-tags", parser.DefaultAnchorTag, "Ginkgo node types of the tests, separated by commas, for example It,Entry")
+}
+
+// addReportFlag registers the Ginkgo JSON report flag of the commands parsing
+// a single run, the report would otherwise be merged into every run
+func addReportFlag(flags *flag.FlagSet) {
+	flags.StringVar(&reportLocation, "json-report", "", "Ginkgo JSON report of the run, a file or a URL, looked for next to the build log when empty")
+}
+
+// parseRun fetches and parses a run, the Ginkgo JSON report of the run is
+// preferred to the build log for the test states, durations and retries
+func parseRun(logFile string) (*utils.TestRunData, error) {
+	return parseRunContext(context.Background(), logFile)
+}
+
+// parseRunContext is parseRun, stopping the downloads and the parsing when
+// the context is done
+func parseRunContext(ctx context.Context, logFile string) (*utils.TestRunData, error) {
+	source, err := readLog(ctx, logFile)
+	if err != nil {
+		return nil, err
+	}
+
+	testRunDataPtr, err := parser.Parse(ctx, bytes.NewReader(source.Content), parser.Options{
+		Format:     logFormat,
+		AnchorTags: splitList(anchorTags),
+		Logger:     log.StandardLogger(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := findReport(ctx, logFile, source)
+	if err != nil {
+		return nil, err
+	}
+	if report != nil {
+		reportRun, err := parser.Parse(ctx, bytes.NewReader(report.Content), parser.Options{
+			Format:     parser.FormatGinkgoJSON,
+			AnchorTags: splitList(anchorTags),
+			Logger:     log.StandardLogger(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", report.Name, err)
+		}
+		logReportMismatches(report.Name, parser.CompareReport(reportRun, testRunDataPtr))
+		testRunDataPtr = parser.MergeReport(reportRun, testRunDataPtr)
+	}
+
+	oadp.SetEventsFromTestRun(testRunDataPtr)
+
+	return testRunDataPtr, nil
+}
+
+// addFilterFlag registers the test filter flag
+func addFilterFlag(flags *flag.FlagSet) {
+	flags.StringVar(&filterExpression, "filter", "",
+		"only the tests matching all the terms, for example 'status=failed|flaky name~CSI duration>5m', "+
+			"with the fields name, status, suite, label, focus, duration and attempts")
+}
+
+// addSummaryFlags registers the layout flags of the summary table
+func addSummaryFlags(flags *flag.FlagSet) {
+	flags.StringVar(&summaryColumns, "columns", strings.Join(summary.DefaultColumns, ","),
+		"columns of the summary table, separated by commas, among "+strings.Join(summary.Columns(), ", "))
+	flags.StringVar(&summarySort, "sort", strings.Join(summary.DefaultSort, ","),
+		"columns sorting the summary table, separated by commas, a - prefix sorts in descending order, for example -failed,name")
+	flags.StringVar(&summaryGroupBy, "group-by", summary.GroupNone,
+		"one summary table per "+summary.GroupSuite+" file or Ginkgo "+summary.GroupContainer+", or "+summary.GroupNone)
+}
+
+// summaryOptions returns the layout of the summary table, the known flake
+// issues are found with the flake patterns
+func summaryOptions() summary.Options {
+	return summary.Options{
+		Columns: splitList(summaryColumns),
+		SortBy:  splitList(summarySort),
+		GroupBy: summaryGroupBy,
+		KnownFlakes: func(logs string) []string {
+			flakes, _, err := matchFlakes(logs)
+			if err != nil {
+				log.WithFields(log.Fields{"error": err}).Warn("Known flakes not checked")
+				return nil
+			}
+			var issues []string
+			for _, flake := range flakes {
+				issues = append(issues, flake.Issue)
+			}
+			return issues
+		},
+	}
+}
+
+// splitList splits a flag holding a list separated by commas
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// findReport returns the report given with -json-report, or the one found
+// next to the build log
+func findReport(ctx context.Context, logFile string, source *input.Source) (*input.Source, error) {
+	switch {
+	case noReport:
+		return nil, nil
+	case reportLocation != "":
+		return readLog(ctx, reportLocation)
+	case source.Report != nil:
+		return source.Report, nil
+	case fetch.IsRemote(logFile) && !strings.HasSuffix(logFile, ".json"):
+		return readRemoteReport(ctx, logFile), nil
+	default:
+		return nil, nil
+	}
+}
+
+// logReportMismatches reports the tests on which the JSON report and the build log disagree
+func logReportMismatches(reportName string, mismatches []parser.Mismatch) {
+	if len(mismatches) == 0 {
+		log.WithFields(log.Fields{
+			"report": reportName,
+		}).Info("Using the JSON report, it agrees with the build log")
+		return
+	}
+	for _, mismatch := range mismatches {
+		log.WithFields(log.Fields{
+			"Name":   mismatch.ShortName,
+			"Field":  mismatch.Field,
+			"Report": mismatch.Report,
+			"Log":    mismatch.Log,
+		}).Warn("JSON report and build log disagree")
+	}
+	log.WithFields(log.Fields{
+		"report":     reportName,
+		"mismatches": len(mismatches),
+	}).Warn("Using the JSON report")
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/migtools/demystifier/lib/history"
+	"github.com/migtools/demystifier/lib/metrics"
+	"github.com/migtools/demystifier/lib/server"
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultServeAddress = "localhost:8080"
+	// serveHeaderTimeout bounds the time to read the headers of a request,
+	// the analyses themselves can take minutes
+	serveHeaderTimeout = 10 * time.Second
+	serveShutdownDelay = 10 * time.Second
+)
+
+// setupServe implements the serve subcommand
+func setupServe() (*flag.FlagSet, func() error) {
+	var (
+		address      string
+		historyDir   string
+		noHistory    bool
+		maxRuns      int
+		allowLocal   bool
+		allowedHosts string
+		workers      int
+		noMetrics    bool
+	)
+
+	flags := newFlagSet("serve", "",
+		"Serve a JSON API and a web page analyzing runs, backed by the logs cache and the run history. "+
+			"See the README for the endpoints.")
+	flags.StringVar(&address, "addr", defaultServeAddress, "address to listen on, :8080 for every interface")
+	flags.StringVar(&historyDir, "history-dir", history.DefaultDir(), "folder of the run history")
+	flags.BoolVar(&noHistory, "no-history", false, "do not record the analyzed runs nor answer the test histories")
+	flags.IntVar(&maxRuns, "max-runs", server.DefaultMaxRuns, "number of analyzed runs kept in memory")
+	flags.BoolVar(&allowLocal, "allow-local", false, "let the clients analyze the files of the server, not only URLs")
+	flags.StringVar(&allowedHosts, "allowed-hosts", strings.Join(server.DefaultAllowedHosts, ","), "hosts of the URLs the clients can analyze, separated by commas")
+	flags.IntVar(&workers, "j", server.DefaultMaxAnalyses, "number of runs fetched and parsed at the same time")
+	flags.BoolVar(&noMetrics, "no-metrics", false, "do not serve the metrics of the analyzed runs on /metrics")
+	addFetchFlags(flags)
+	addParseFlags(flags)
+	return flags, func() error {
+		if err := setupFetcher(); err != nil {
+			return err
+		}
+		if flags.NArg() != 0 {
+			flags.Usage()
+			return errors.New("serve expects no argument")
+		}
+
+		knownFlakes := summaryOptions().KnownFlakes
+		opts := server.Options{
+			Analyze: func(ctx context.Context, location string) (*utils.TestRunData, error) {
+				return parseRunContext(ctx, resolveLocation(location))
+			},
+			KnownFlakes:  knownFlakes,
+			MaxRuns:      maxRuns,
+			AllowLocal:   allowLocal,
+			AllowedHosts: splitList(allowedHosts),
+			MaxAnalyses:  workers,
+		}
+		if !noMetrics {
+			opts.Metrics = metrics.New(metrics.Options{KnownFlakes: knownFlakes})
+		}
+		if !noHistory {
+			store, err := history.Open(historyDir)
+			if err != nil {
+				return err
+			}
+			opts.History = store
+		}
+
+		httpServer := &http.Server{
+			Addr:              address,
+			Handler:           server.New(opts),
+			ReadHeaderTimeout: serveHeaderTimeout,
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownDelay)
+			defer cancel()
+			_ = httpServer.Shutdown(shutdownCtx)
+		}()
+
+		log.WithFields(log.Fields{
+			"address": "http://" + address,
+		}).Info("Serving")
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("error serving: %v", err)
+		}
+		return nil
+	}
+}
@@ -21,13 +21,15 @@ import (
 	"io"
 	"os"
 	"testing"
-)
 
-const logFile = "../../tests/testdata/buildlog/build-log.txt"
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/summary"
+)
 
 func TestPrintTestSummary(t *testing.T) {
 	type args struct {
 		logFile string
+		opts    summary.Options
 	}
 	tests := []struct {
 		name string
@@ -37,51 +39,51 @@ func TestPrintTestSummary(t *testing.T) {
 		{
 			name: "Test with build-log.txt",
 			args: args{
-				logFile: logFile,
+				logFile: fixture.BuildLog,
 			},
 			want: `Test Summary Table:
-+-------------------------------------------------------------------------------+--------------+------------+------------------+
-| TEST NAME                                                                     | NUM ATTEMPTS | NUM FAILED | AVERAGE RUN TIME |
-+-------------------------------------------------------------------------------+--------------+------------+------------------+
-| Should succeed                                                                |            1 |          0 |           5.044s |
-| AWS Without Region And S3ForcePathStyle true should fail                      |            1 |          0 |          20.036s |
-| Should succeed                                                                |            1 |          0 |          20.071s |
-| HTTP_PROXY set                                                                |            1 |          0 |          35.243s |
-| NO_PROXY set                                                                  |            1 |          0 |          35.291s |
-| unsupportedOverrides should succeed                                           |            1 |          0 |        1m20.133s |
-| Adding CSI plugin                                                             |            1 |          0 |        1m20.133s |
-| Provider plugin                                                               |            1 |          0 |        1m20.136s |
-| AWS With Region And S3ForcePathStyle should succeed                           |            1 |          0 |        1m20.138s |
-| Adding Velero custom plugin                                                   |            1 |          0 |        1m20.139s |
-| Set restic node selector                                                      |            1 |          0 |         1m20.14s |
-| AWS Without Region No S3ForcePathStyle with BackupImages false should succeed |            1 |          0 |        1m20.141s |
-| NoDefaultBackupLocation                                                       |            1 |          0 |        1m20.141s |
-| Default velero CR, test carriage return                                       |            1 |          0 |        1m20.141s |
-| Default velero CR                                                             |            1 |          0 |        1m20.142s |
-| DPA CR with bsl and vsl                                                       |            1 |          0 |        1m20.143s |
-| Enable tolerations                                                            |            1 |          0 |        1m20.148s |
-| Adding Velero resource allocations                                            |            1 |          0 |        1m20.153s |
-| Default velero CR with restic disabled                                        |            1 |          0 |        1m20.172s |
-| HTTPS_PROXY set                                                               |            1 |          0 |         2m5.099s |
-| Mongo application KOPIA                                                       |            1 |          0 |        2m31.823s |
-| MySQL application KOPIA                                                       |            1 |          0 |         2m36.65s |
-| MySQL application RESTIC                                                      |            1 |          0 |        2m46.649s |
-| Mongo application RESTIC                                                      |            1 |          0 |        2m51.694s |
-| MySQL application CSI                                                         |            2 |          1 |         3m8.943s |
-| Config unset                                                                  |            1 |          0 |        3m31.199s |
-| Mongo application CSI                                                         |            1 |          0 |        3m36.749s |
-| MySQL application DATAMOVER                                                   |            1 |          0 |        4m16.949s |
-| Mongo application DATAMOVER                                                   |            1 |          0 |        4m17.239s |
-| Mongo application DATAMOVER                                                   |            1 |          0 |        4m36.933s |
-| Mongo application BlockDevice DATAMOVER                                       |            1 |          0 |         5m6.999s |
-| MySQL application two Vol CSI                                                 |            3 |          3 |        6m16.036s |
-+-------------------------------------------------------------------------------+--------------+------------+------------------+
++-----------------------------------------------------------------------------------+--------------+------------+------------------+
+| TEST NAME                                                                         | NUM ATTEMPTS | NUM FAILED | AVERAGE RUN TIME |
++-----------------------------------------------------------------------------------+--------------+------------+------------------+
+| Should succeed (DPA / Restic Deletion test)                                       |            1 |          0 |           5.044s |
+| AWS Without Region And S3ForcePathStyle true should fail                          |            1 |          0 |          20.036s |
+| Should succeed (DPA / Kopia Deletion test)                                        |            1 |          0 |          20.071s |
+| HTTP_PROXY set                                                                    |            1 |          0 |          35.243s |
+| NO_PROXY set                                                                      |            1 |          0 |          35.291s |
+| Adding CSI plugin                                                                 |            1 |          0 |        1m20.133s |
+| unsupportedOverrides should succeed                                               |            1 |          0 |        1m20.133s |
+| Provider plugin                                                                   |            1 |          0 |        1m20.136s |
+| AWS With Region And S3ForcePathStyle should succeed                               |            1 |          0 |        1m20.138s |
+| Adding Velero custom plugin                                                       |            1 |          0 |        1m20.139s |
+| Set restic node selector                                                          |            1 |          0 |         1m20.14s |
+| Default velero CR, test carriage return                                           |            1 |          0 |        1m20.141s |
+| NoDefaultBackupLocation                                                           |            1 |          0 |        1m20.141s |
+| AWS Without Region No S3ForcePathStyle with BackupImages false should succeed     |            1 |          0 |        1m20.141s |
+| Default velero CR                                                                 |            1 |          0 |        1m20.142s |
+| DPA CR with bsl and vsl                                                           |            1 |          0 |        1m20.143s |
+| Enable tolerations                                                                |            1 |          0 |        1m20.148s |
+| Adding Velero resource allocations                                                |            1 |          0 |        1m20.153s |
+| Default velero CR with restic disabled                                            |            1 |          0 |        1m20.172s |
+| HTTPS_PROXY set                                                                   |            1 |          0 |         2m5.099s |
+| MySQL application two Vol CSI                                                     |            3 |          3 |         2m5.345s |
+| Mongo application KOPIA                                                           |            1 |          0 |        2m31.823s |
+| MySQL application KOPIA                                                           |            1 |          0 |         2m36.65s |
+| MySQL application RESTIC                                                          |            1 |          0 |        2m46.649s |
+| Mongo application RESTIC                                                          |            1 |          0 |        2m51.694s |
+| MySQL application CSI                                                             |            2 |          1 |         3m8.943s |
+| Config unset                                                                      |            1 |          0 |        3m31.199s |
+| Mongo application CSI                                                             |            1 |          0 |        3m36.749s |
+| MySQL application DATAMOVER                                                       |            1 |          0 |        4m16.949s |
+| Mongo application DATAMOVER (Backup and restore applications and run must-gather) |            1 |          0 |        4m17.239s |
+| Mongo application DATAMOVER (Backup and restore applications)                     |            1 |          0 |        4m36.933s |
+| Mongo application BlockDevice DATAMOVER                                           |            1 |          0 |         5m6.999s |
++-----------------------------------------------------------------------------------+--------------+------------+------------------+
 `,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			testData, err := parseLogFile(tt.args.logFile)
+			testData, err := parseRun(tt.args.logFile)
 			if err != nil {
 				t.Errorf("Error parsing log file: %v", err)
 			}
@@ -89,7 +91,9 @@ func TestPrintTestSummary(t *testing.T) {
 			r, w, _ := os.Pipe()
 			os.Stdout = w
 
-			PrintTestSummary(testData)
+			if err := PrintTestSummary(testData, tt.args.opts); err != nil {
+				t.Errorf("PrintTestSummary() error = %v", err)
+			}
 
 			outC := make(chan string)
 			// copy the output in a separate goroutine so printing can't block indefinitely
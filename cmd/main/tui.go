@@ -0,0 +1,95 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/migtools/demystifier/lib/filter"
+	"github.com/migtools/demystifier/lib/flakechecker"
+	"github.com/migtools/demystifier/lib/tui"
+	log "github.com/sirupsen/logrus"
+)
+
+// setupTUI implements the tui command
+func setupTUI() (*flag.FlagSet, func() error) {
+	flags := newFlagSet("tui", "URL|PATH",
+		"Browse the tests and attempts of a run and their logs in the terminal. "+
+			"Press / to search the logs, f to jump to the next failure, z to fold the repeated lines "+
+			"and o to open the issue of the known flake found in the attempt.")
+	addFetchFlags(flags)
+	addParseFlags(flags)
+	addReportFlag(flags)
+	addFilterFlag(flags)
+	return flags, func() error {
+		testFilter, err := filter.Parse(filterExpression)
+		if err != nil {
+			return err
+		}
+		if err := setupFetcher(); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return errors.New("tui expects exactly one log location")
+		}
+
+		testData, err := parseRun(resolveLocation(flags.Arg(0)))
+		if err != nil {
+			return err
+		}
+		testData = testFilter.Apply(testData)
+
+		// the log messages would be drawn over the screen
+		output := log.StandardLogger().Out
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(output)
+		return tui.Run(os.Stdin, os.Stdout, testData, tui.Options{
+			KnownFlakes: func(logs string) []flakechecker.FlakePattern {
+				flakes, _, err := matchFlakes(logs)
+				if err != nil {
+					return nil
+				}
+				return flakes
+			},
+			OpenURL: openURL,
+		})
+	}
+}
+
+// openURL opens a URL in the default browser, without waiting for it
+func openURL(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() { _ = cmd.Wait() }()
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/migtools/demystifier/lib/fetch"
+	"github.com/migtools/demystifier/lib/history"
+	"github.com/migtools/demystifier/lib/oadp"
+	"github.com/migtools/demystifier/lib/utils"
+	"github.com/migtools/demystifier/lib/watch"
+	log "github.com/sirupsen/logrus"
+)
+
+// setupWatch implements the watch subcommand
+func setupWatch() (*flag.FlagSet, func() error) {
+	var (
+		showPassing bool
+		historyDir  string
+		noHistory   bool
+	)
+
+	flags := newFlagSet("watch", "URL", "Follow the build log of a running Prow job and report each attempt as soon as it ends.")
+	interval := flags.Duration("interval", watch.DefaultInterval, "time between two polls of the build log")
+	flags.BoolVar(&showPassing, "s", false, "also show the attempts that passed")
+	flags.StringVar(&historyDir, "history-dir", history.DefaultDir(), "folder of the run history")
+	flags.BoolVar(&noHistory, "no-history", false, "do not record the run in the history")
+	addAnchorTagsFlag(flags)
+	addFetchFlags(flags)
+	addSummaryFlags(flags)
+	return flags, func() error {
+		opts := summaryOptions()
+		if err := opts.Validate(); err != nil {
+			return err
+		}
+		if err := setupFetcher(); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return errors.New("watch expects exactly one URL")
+		}
+		logLocation := resolveLocation(flags.Arg(0))
+		if !fetch.IsRemote(logLocation) {
+			return fmt.Errorf("watch expects the URL of a build log, got %s", logLocation)
+		}
+
+		// The run parsed so far is still reported on Ctrl-C
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		watcher := watch.New()
+		watcher.Interval = *interval
+		watcher.AnchorTags = splitList(anchorTags)
+		watcher.OnAttempt = func(test *utils.IndividualTestRunData, attempt *utils.AttemptData) {
+			PrintWatchedAttempt(test, attempt, showPassing)
+		}
+		log.WithFields(log.Fields{
+			">>> location": logLocation,
+		}).Info("Watching log from")
+		testData, err := watcher.Watch(ctx, logLocation)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+
+		oadp.SetEventsFromTestRun(testData)
+		if !noHistory && err == nil {
+			recordRun(historyDir, logLocation, testData)
+		}
+		if summaryErr := PrintTestSummary(testData, opts); summaryErr != nil {
+			return summaryErr
+		}
+		if err != nil {
+			return fmt.Errorf("watch interrupted before the end of the job: %v", err)
+		}
+		return runResult(testData)
+	}
+}
+
+// PrintWatchedAttempt reports an attempt that just ended, with the known
+// flakes found in the logs of a failed one
+func PrintWatchedAttempt(test *utils.IndividualTestRunData, attempt *utils.AttemptData, showPassing bool) {
+	fields := log.Fields{
+		"Name": test.ShortName,
+		"No":   attempt.AttemptNo,
+		"Time": attempt.Duration,
+	}
+	if attempt.Status.Status != utils.Failed {
+		if showPassing {
+			log.WithFields(fields).Info("Pass attempt run")
+		}
+		return
+	}
+	log.WithFields(fields).Error("Failed attempt run")
+
+	flakes, _, err := matchFlakes(strings.Join(attempt.Logs, "\n"))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("Error checking the known flakes")
+		return
+	}
+	for _, flake := range flakes {
+		log.WithFields(log.Fields{
+			"Name":  test.ShortName,
+			"Issue": flake.Issue,
+		}).Warn(flake.Description)
+	}
+}
@@ -2,11 +2,15 @@ module github.com/migtools/demystifier
 
 go 1.21.4
 
-require github.com/sirupsen/logrus v1.9.3
+require (
+	github.com/jedib0t/go-pretty/v6 v6.5.8
+	github.com/sirupsen/logrus v1.9.3
+	golang.org/x/sys v0.18.0
+	golang.org/x/term v0.18.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
-	github.com/jedib0t/go-pretty/v6 v6.5.8 // indirect
 	github.com/mattn/go-runewidth v0.0.15 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
-	golang.org/x/sys v0.17.0 // indirect
 )
@@ -0,0 +1,81 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fixture gives the tests the sample build log of tests/testdata, an
+// OADP e2e run of 32 tests with a failed test, a flaky test and the velero
+// errors of a known flake
+package fixture
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/migtools/demystifier/lib/parser"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// Counts of the sample build log
+const (
+	// TestCount is the number of tests
+	TestCount = 32
+	// AttemptCount is the number of attempts of the tests, the flaky and failed tests are retried
+	AttemptCount = 35
+)
+
+// BuildLog is the path of the sample build log, valid from the folder of any package
+var BuildLog = buildLogPath()
+
+func buildLogPath() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "tests", "testdata", "buildlog", "build-log.txt")
+}
+
+// Read returns the content of the sample build log
+func Read(t testing.TB) []byte {
+	t.Helper()
+	content, err := os.ReadFile(BuildLog)
+	if err != nil {
+		t.Fatalf("Error reading log file: %v", err)
+	}
+	return content
+}
+
+// Parse returns the parsed sample build log
+func Parse(t testing.TB) *utils.TestRunData {
+	t.Helper()
+	file, err := os.Open(BuildLog)
+	if err != nil {
+		t.Fatalf("Error opening log file: %v", err)
+	}
+	defer file.Close()
+	run, err := parser.Parse(context.Background(), file, parser.Options{})
+	if err != nil {
+		t.Fatalf("Error parsing log file: %v", err)
+	}
+	return run
+}
+
+// CountAttempts returns the number of attempts of the tests of a run
+func CountAttempts(run *utils.TestRunData) int {
+	count := 0
+	for i := range run.TestRun {
+		count += len(run.TestRun[i].Attempt)
+	}
+	return count
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package batch fetches and parses many test runs concurrently
+package batch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// DefaultWorkers is the number of runs fetched and parsed at the same time
+const DefaultWorkers = 4
+
+// ParseFunc fetches and parses the run found at a location
+type ParseFunc func(location string) (*utils.TestRunData, error)
+
+// Result is the outcome of a run of the batch
+type Result struct {
+	Location string
+	Job      utils.JobInfo
+	Data     *utils.TestRunData
+	Err      error
+}
+
+// Run parses the locations with a pool of workers.
+// A run that fails, or panics, only sets the Err of its Result.
+//
+// Parameters:
+//   - locations: the log locations, local or remote.
+//   - workers: the maximum number of runs parsed at the same time, DefaultWorkers when not positive.
+//   - parse: the function fetching and parsing a single run.
+//
+// Returns:
+//   - []Result in the order of the locations.
+func Run(locations []string, workers int, parse ParseFunc) []Result {
+	results := make([]Result, len(locations))
+	Each(len(locations), workers, func(i int) {
+		results[i] = runOne(locations[i], parse)
+	})
+	return results
+}
+
+// Each calls fn with every index from 0 to n-1, from a pool of workers,
+// and returns once all the calls returned
+//
+// Parameters:
+//   - n: the number of calls.
+//   - workers: the maximum number of calls at the same time, DefaultWorkers when not positive.
+//   - fn: the function called with each index.
+func Each(n, workers int, fn func(i int)) {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+func runOne(location string, parse ParseFunc) (result Result) {
+	result = Result{Location: location, Job: utils.GetJobInfo(location)}
+	defer func() {
+		if r := recover(); r != nil {
+			result.Data = nil
+			result.Err = fmt.Errorf("error parsing %s: %v", location, r)
+		}
+	}()
+	result.Data, result.Err = parse(location)
+	return result
+}
+
+// ReadLocations reads one location per line, skipping empty lines and # comments
+func ReadLocations(r io.Reader) ([]string, error) {
+	var locations []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		locations = append(locations, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading locations: %v", err)
+	}
+	return locations, nil
+}
+
+// RunResult is the result of a test in one run of the batch
+type RunResult struct {
+	Location string
+	RunID    string
+	Verdict  string
+	Attempts int
+	Duration time.Duration
+}
+
+// TestAggregate groups the results of a test across the runs
+type TestAggregate struct {
+	Name      string
+	ShortName string
+	Passed    int
+	Failed    int
+	Flaky     int
+	Results   []RunResult
+}
+
+// Aggregate groups the results by test, matching the tests by their Name.
+// The tests failing in the most runs come first, then the flakiest ones.
+func Aggregate(results []Result) []TestAggregate {
+	byName := make(map[string]*TestAggregate)
+	var order []string
+
+	for i := range results {
+		result := &results[i]
+		if result.Err != nil || result.Data == nil {
+			continue
+		}
+		for j := range result.Data.TestRun {
+			test := &result.Data.TestRun[j]
+			aggregate, found := byName[test.Name]
+			if !found {
+				aggregate = &TestAggregate{Name: test.Name, ShortName: test.ShortName}
+				byName[test.Name] = aggregate
+				order = append(order, test.Name)
+			}
+
+			runResult := RunResult{
+				Location: result.Location,
+				RunID:    result.Job.RunID,
+				Verdict:  test.Verdict(),
+				Attempts: len(test.Attempt),
+			}
+			if len(test.Attempt) > 0 {
+				runResult.Duration = test.Attempt[len(test.Attempt)-1].Duration
+			}
+			switch runResult.Verdict {
+			case utils.Failed:
+				aggregate.Failed++
+			case utils.Flaky:
+				aggregate.Flaky++
+			default:
+				aggregate.Passed++
+			}
+			aggregate.Results = append(aggregate.Results, runResult)
+		}
+	}
+
+	aggregates := make([]TestAggregate, 0, len(order))
+	for _, name := range order {
+		aggregates = append(aggregates, *byName[name])
+	}
+	sort.SliceStable(aggregates, func(i, j int) bool {
+		if aggregates[i].Failed != aggregates[j].Failed {
+			return aggregates[i].Failed > aggregates[j].Failed
+		}
+		return aggregates[i].Flaky > aggregates[j].Flaky
+	})
+	return aggregates
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batch
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+const (
+	jobHistoryFile = "../../tests/testdata/jobhistory/job-history.html"
+	urlsFile       = "../../tests/testdata/jobhistory/urls.txt"
+)
+
+func parseLog(location string) (*utils.TestRunData, error) {
+	testData, err := utils.GetRunDataFromLog(location)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.SetIndividualTestsFromLog(testData, "It"); err != nil {
+		return nil, err
+	}
+	return testData, nil
+}
+
+func TestRunIsolatesErrors(t *testing.T) {
+	file, err := os.Open(urlsFile)
+	if err != nil {
+		t.Fatalf("Error opening locations: %v", err)
+	}
+	defer file.Close()
+	locations, err := ReadLocations(file)
+	if err != nil {
+		t.Fatalf("Error reading locations: %v", err)
+	}
+	if len(locations) != 2 {
+		t.Fatalf("Expected 2 locations, got %v", locations)
+	}
+	locations = append(locations, "panic")
+
+	var running, maxRunning int32
+	results := Run(append(locations, locations[0]), 2, func(location string) (*utils.TestRunData, error) {
+		now := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if now <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, now) {
+				break
+			}
+		}
+		if location == "panic" {
+			panic("unexpected log")
+		}
+		return parseLog(location)
+	})
+
+	if maxRunning > 2 {
+		t.Errorf("Expected at most 2 runs parsed at the same time, got %d", maxRunning)
+	}
+	tests := []struct {
+		name    string
+		result  Result
+		wantErr bool
+	}{
+		{name: "Valid log", result: results[0]},
+		{name: "Missing log", result: results[1], wantErr: true},
+		{name: "Panicking parser", result: results[2], wantErr: true},
+		{name: "Valid log again", result: results[3]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.result.Err != nil) != tt.wantErr {
+				t.Errorf("Err = %v, wantErr %v", tt.result.Err, tt.wantErr)
+			}
+			if !tt.wantErr && (tt.result.Data == nil || len(tt.result.Data.TestRun) == 0) {
+				t.Errorf("Expected parsed tests for %s", tt.result.Location)
+			}
+		})
+	}
+
+	aggregates := Aggregate(results)
+	if len(aggregates) != len(results[0].Data.TestRun) {
+		t.Fatalf("Expected %d tests, got %d", len(results[0].Data.TestRun), len(aggregates))
+	}
+	first := aggregates[0]
+	if first.ShortName != "MySQL application two Vol CSI" || first.Failed != 2 || len(first.Results) != 2 {
+		t.Errorf("Expected the failing test first with 2 failed runs, got %+v", first)
+	}
+	if second := aggregates[1]; second.Flaky != 2 {
+		t.Errorf("Expected the flaky test second with 2 flaky runs, got %+v", second)
+	}
+}
+
+func TestParseJobHistory(t *testing.T) {
+	page, err := os.ReadFile(jobHistoryFile)
+	if err != nil {
+		t.Fatalf("Error reading job history: %v", err)
+	}
+	locations, err := ParseJobHistory(page, "https://prow.ci.openshift.org/job-history/gs/test-platform-results/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic")
+	if err != nil {
+		t.Fatalf("Error parsing job history: %v", err)
+	}
+	want := []string{
+		"https://prow.ci.openshift.org/view/gs/test-platform-results/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic/1767186600720076801",
+		"https://prow.ci.openshift.org/view/gs/test-platform-results/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic/1767186600720076800",
+	}
+	if len(locations) != len(want) {
+		t.Fatalf("ParseJobHistory() = %v, want %v", locations, want)
+	}
+	for i := range want {
+		if locations[i] != want[i] {
+			t.Errorf("ParseJobHistory()[%d] = %s, want %s", i, locations[i], want[i])
+		}
+	}
+
+	if _, err := ParseJobHistory([]byte("<html></html>"), ""); err == nil {
+		t.Errorf("Expected an error for a page without builds")
+	}
+}
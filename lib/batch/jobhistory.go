@@ -0,0 +1,88 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/migtools/demystifier/lib/fetch"
+)
+
+// ProwURL is the Prow instance the job history links are relative to
+const ProwURL = "https://prow.ci.openshift.org"
+
+// pendingResult is the result of the builds still running
+const pendingResult = "PENDING"
+
+var allBuildsRegex = regexp.MustCompile(`(?s)var allBuilds = (\[.*?\]);`)
+
+// jobHistoryBuild is a build listed in the Prow job history page
+type jobHistoryBuild struct {
+	SpyglassLink string
+	ID           string
+	Result       string
+}
+
+// IsJobHistoryURL returns whether the location is a Prow job history page
+func IsJobHistoryURL(location string) bool {
+	return strings.Contains(location, "/job-history/")
+}
+
+// FetchJobHistory downloads a Prow job history page and returns its finished runs
+func FetchJobHistory(pageURL string) ([]string, error) {
+	page, err := fetch.Default().Get(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJobHistory(page, pageURL)
+}
+
+// ParseJobHistory returns the Prow URLs of the finished runs listed in a
+// job history page, the links are resolved against the page URL.
+func ParseJobHistory(page []byte, pageURL string) ([]string, error) {
+	matches := allBuildsRegex.FindSubmatch(page)
+	if matches == nil {
+		return nil, errors.New("error parsing job history: no builds found in the page")
+	}
+	var builds []jobHistoryBuild
+	if err := json.Unmarshal(matches[1], &builds); err != nil {
+		return nil, fmt.Errorf("error parsing job history: %v", err)
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil || base.Host == "" {
+		base, _ = url.Parse(ProwURL)
+	}
+
+	var locations []string
+	for _, build := range builds {
+		if build.Result == pendingResult || build.SpyglassLink == "" {
+			continue
+		}
+		link, err := base.Parse(build.SpyglassLink)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing job history link %q: %v", build.SpyglassLink, err)
+		}
+		locations = append(locations, link.String())
+	}
+	return locations, nil
+}
@@ -0,0 +1,367 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cache keeps the fetched logs on disk, keyed by their URL
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/migtools/demystifier/lib/fetch"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+const (
+	// DefaultMaxSize is the size of the cache above which the least recently used entries are evicted
+	DefaultMaxSize = 1 << 30
+
+	cacheDirPerm = 0o750
+	bodySuffix   = ".body"
+	entrySuffix  = ".json"
+)
+
+// ErrNotCached is returned in offline mode for the URLs missing from the cache
+var ErrNotCached = errors.New("not in the cache")
+
+// Entry is the metadata of a cached URL
+type Entry struct {
+	URL          string
+	ETag         string
+	LastModified string
+	Size         int64
+	FetchedAt    time.Time
+	LastUsed     time.Time
+	Immutable    bool // the run finished, the content will not change anymore
+}
+
+// Cache is a folder holding the body and the metadata of each cached URL
+type Cache struct {
+	dir     string
+	MaxSize int64
+	Offline bool
+	Client  fetch.HTTPClient
+}
+
+// DefaultDir returns $XDG_CACHE_HOME/demystifier, or the user cache folder
+func DefaultDir() string {
+	if cacheHome := os.Getenv("XDG_CACHE_HOME"); cacheHome != "" {
+		return filepath.Join(cacheHome, "demystifier")
+	}
+	cacheHome, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "demystifier")
+	}
+	return filepath.Join(cacheHome, "demystifier")
+}
+
+// Open creates the cache folder if needed and returns the cache
+func Open(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, cacheDirPerm); err != nil {
+		return nil, fmt.Errorf("error creating cache folder: %v", err)
+	}
+	return &Cache{dir: dir, MaxSize: DefaultMaxSize, Client: fetch.Default()}, nil
+}
+
+// Dir returns the folder of the cache
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Get returns the content of the URL, from the cache when possible.
+// Entries of finished runs are returned without any request, the others are
+// revalidated with their ETag and Last-Modified headers.
+//
+// Parameters:
+//   - location: the URL to fetch.
+//
+// Returns:
+//   - []byte with the content of the URL.
+//   - error if the URL can not be fetched, ErrNotCached in offline mode.
+func (c *Cache) Get(location string) ([]byte, error) {
+	return c.GetContext(context.Background(), location)
+}
+
+// GetContext is Get, stopping the requests when the context is done
+func (c *Cache) GetContext(ctx context.Context, location string) ([]byte, error) {
+	entry, body, cached := c.load(location)
+	if cached && (entry.Immutable || c.Offline) {
+		c.touch(entry)
+		return body, nil
+	}
+	if c.Offline {
+		return nil, fmt.Errorf("error opening URL %s: %w", location, ErrNotCached)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("error opening URL: %v", err)
+	}
+	if cached {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error opening URL: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case cached && resp.StatusCode == http.StatusNotModified:
+	case resp.StatusCode == http.StatusOK:
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error reading HTTP response body: %v", err)
+		}
+		if body, err = fetch.Decode(body); err != nil {
+			return nil, err
+		}
+		entry = &Entry{
+			URL:          location,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Size:         int64(len(body)),
+			FetchedAt:    time.Now(),
+		}
+	default:
+		return nil, &fetch.StatusError{URL: location, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	entry.Immutable = c.runFinished(ctx, location)
+	if err := c.store(entry, body); err != nil {
+		return nil, err
+	}
+	if _, err := c.evict(c.MaxSize); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// runFinished returns whether the Prow run holding the URL wrote its finished.json
+func (c *Cache) runFinished(ctx context.Context, location string) bool {
+	runFolder := utils.RunFolder(location)
+	if runFolder == "" {
+		return false
+	}
+	finishedURL := runFolder + utils.FinishedFile
+	if location == finishedURL {
+		return true
+	}
+	if entry, _, cached := c.load(finishedURL); cached && entry.Immutable {
+		return true
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, finishedURL, http.NoBody)
+	if err != nil {
+		return false
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false
+	}
+	_ = c.store(&Entry{URL: finishedURL, Size: int64(len(body)), FetchedAt: time.Now(), Immutable: true}, body)
+	return true
+}
+
+// Entries returns the cached URLs, most recently used first
+func (c *Cache) Entries() ([]Entry, error) {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*"+entrySuffix))
+	if err != nil {
+		return nil, fmt.Errorf("error listing cache: %v", err)
+	}
+	entries := make([]Entry, 0, len(files))
+	for _, file := range files {
+		content, err := os.ReadFile(file) // #nosec G304 -- files listed from the cache folder
+		if err != nil {
+			return nil, fmt.Errorf("error reading cache entry: %v", err)
+		}
+		var entry Entry
+		if err := json.Unmarshal(content, &entry); err != nil {
+			return nil, fmt.Errorf("error decoding cache entry %s: %v", filepath.Base(file), err)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// Prune removes the entries unused for longer than maxAge, then the least
+// recently used ones until the cache fits in maxSize. Zero values disable a limit.
+func (c *Cache) Prune(maxSize int64, maxAge time.Duration) (int, error) {
+	removed := 0
+	if maxAge > 0 {
+		entries, err := c.Entries()
+		if err != nil {
+			return 0, err
+		}
+		for i := range entries {
+			if time.Since(entries[i].LastUsed) > maxAge {
+				if err := c.Remove(entries[i].URL); err != nil {
+					return removed, err
+				}
+				removed++
+			}
+		}
+	}
+	if maxSize > 0 {
+		evicted, err := c.evict(maxSize)
+		removed += evicted
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// Clear removes every entry
+func (c *Cache) Clear() (int, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return 0, err
+	}
+	for i := range entries {
+		if err := c.Remove(entries[i].URL); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
+
+// Remove deletes the entry of a URL
+func (c *Cache) Remove(location string) error {
+	base := filepath.Join(c.dir, key(location))
+	for _, path := range []string{base + entrySuffix, base + bodySuffix} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing cache entry: %v", err)
+		}
+	}
+	return nil
+}
+
+// evict removes the least recently used entries above maxSize
+func (c *Cache) evict(maxSize int64) (int, error) {
+	if maxSize <= 0 {
+		return 0, nil
+	}
+	entries, err := c.Entries()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	removed := 0
+	for i := range entries {
+		total += entries[i].Size
+		if total <= maxSize {
+			continue
+		}
+		if err := c.Remove(entries[i].URL); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (c *Cache) load(location string) (*Entry, []byte, bool) {
+	base := filepath.Join(c.dir, key(location))
+	content, err := os.ReadFile(base + entrySuffix) // #nosec G304 -- path derived from a hash
+	if err != nil {
+		return nil, nil, false
+	}
+	var entry Entry
+	if err := json.Unmarshal(content, &entry); err != nil || entry.URL != location {
+		return nil, nil, false
+	}
+	body, err := os.ReadFile(base + bodySuffix) // #nosec G304 -- path derived from a hash
+	if err != nil || int64(len(body)) != entry.Size {
+		return nil, nil, false
+	}
+	return &entry, body, true
+}
+
+func (c *Cache) store(entry *Entry, body []byte) error {
+	base := filepath.Join(c.dir, key(entry.URL))
+	if err := writeFile(base+bodySuffix, body); err != nil {
+		return err
+	}
+	entry.LastUsed = time.Now()
+	content, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding cache entry: %v", err)
+	}
+	return writeFile(base+entrySuffix, content)
+}
+
+// touch records the use of an entry, failing to do so only affects eviction
+func (c *Cache) touch(entry *Entry) {
+	entry.LastUsed = time.Now()
+	if content, err := json.MarshalIndent(entry, "", "  "); err == nil {
+		_ = writeFile(filepath.Join(c.dir, key(entry.URL))+entrySuffix, content)
+	}
+}
+
+// writeFile replaces a file through a temporary file of its own, created
+// with the 0600 mode, so that concurrent writers of the same entry never
+// rename a partial file
+func writeFile(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error writing cache: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing cache: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing cache: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing cache: %v", err)
+	}
+	return nil
+}
+
+func key(location string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(location)))
+	return hex.EncodeToString(sum[:])
+}
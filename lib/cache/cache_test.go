@@ -0,0 +1,208 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	runningLog  = "/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic/1002/artifacts/e2e-test-aws-periodic/e2e/build-log.txt"
+	finishedLog = "/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic/1001/artifacts/e2e-test-aws-periodic/e2e/build-log.txt"
+	finished    = "/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic/1001/finished.json"
+)
+
+// server counts the full downloads and the revalidations of each path
+type server struct {
+	*httptest.Server
+	mu           sync.Mutex
+	content      map[string]string
+	downloads    map[string]int
+	revalidation map[string]int
+}
+
+func newServer(t *testing.T) *server {
+	s := &server{
+		content: map[string]string{
+			runningLog:  "running log",
+			finishedLog: "finished log",
+			finished:    `{"passed":true}`,
+		},
+		downloads:    make(map[string]int),
+		revalidation: make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		content, found := s.content[r.URL.Path]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		etag := `"` + content + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			s.revalidation[r.URL.Path]++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		s.downloads[r.URL.Path]++
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestGet(t *testing.T) {
+	srv := newServer(t)
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening cache: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		for _, path := range []string{runningLog, finishedLog} {
+			body, err := c.Get(srv.URL + path)
+			if err != nil {
+				t.Fatalf("Error getting %s: %v", path, err)
+			}
+			if string(body) != srv.content[path] {
+				t.Errorf("Get(%s) = %q, want %q", path, body, srv.content[path])
+			}
+		}
+	}
+
+	tests := []struct {
+		name             string
+		path             string
+		wantDownloads    int
+		wantRevalidation int
+	}{
+		{name: "Running job is revalidated", path: runningLog, wantDownloads: 1, wantRevalidation: 2},
+		{name: "Finished job is not fetched again", path: finishedLog, wantDownloads: 1},
+		{name: "finished.json is fetched once", path: finished, wantDownloads: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if srv.downloads[tt.path] != tt.wantDownloads || srv.revalidation[tt.path] != tt.wantRevalidation {
+				t.Errorf("downloads/revalidations = %d/%d, want %d/%d",
+					srv.downloads[tt.path], srv.revalidation[tt.path], tt.wantDownloads, tt.wantRevalidation)
+			}
+		})
+	}
+
+	// The running job log changed on the server
+	srv.mu.Lock()
+	srv.content[runningLog] = "running log, more lines"
+	srv.mu.Unlock()
+	if body, err := c.Get(srv.URL + runningLog); err != nil || string(body) != "running log, more lines" {
+		t.Errorf("Expected the updated log, got %q, %v", body, err)
+	}
+
+	c.Offline = true
+	if body, err := c.Get(srv.URL + finishedLog); err != nil || string(body) != "finished log" {
+		t.Errorf("Expected the cached log offline, got %q, %v", body, err)
+	}
+	if _, err := c.Get(srv.URL + "/missing"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("Expected ErrNotCached offline, got %v", err)
+	}
+}
+
+func TestConcurrentGet(t *testing.T) {
+	srv := newServer(t)
+	dir := t.TempDir()
+	c, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Error opening cache: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if body, err := c.Get(srv.URL + finishedLog); err != nil || string(body) != "finished log" {
+				errs <- fmt.Errorf("Get() = %q, %v", body, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(leftovers) != 0 {
+		t.Errorf("Temporary files left in the cache: %v", leftovers)
+	}
+}
+
+func TestGetError(t *testing.T) {
+	srv := newServer(t)
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening cache: %v", err)
+	}
+	if _, err := c.Get(srv.URL + "/missing"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected a 404 error, got %v", err)
+	}
+	if entries, _ := c.Entries(); len(entries) != 0 {
+		t.Errorf("Expected errors not to be cached, got %+v", entries)
+	}
+}
+
+func TestEvictionAndPrune(t *testing.T) {
+	srv := newServer(t)
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening cache: %v", err)
+	}
+	c.MaxSize = int64(len("running log") + len("finished log") + len(`{"passed":true}`))
+
+	if _, err := c.Get(srv.URL + runningLog); err != nil {
+		t.Fatalf("Error getting log: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := c.Get(srv.URL + finishedLog); err != nil {
+		t.Fatalf("Error getting log: %v", err)
+	}
+	entries, err := c.Entries()
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("Expected 3 entries within the size limit, got %d, %v", len(entries), err)
+	}
+
+	// The oldest entry goes first
+	removed, err := c.Prune(int64(len("finished log")+len(`{"passed":true}`)), 0)
+	if err != nil || removed != 1 {
+		t.Fatalf("Prune() = %d, %v, want 1 removed", removed, err)
+	}
+	if _, _, cached := c.load(srv.URL + runningLog); cached {
+		t.Errorf("Expected the least recently used entry to be evicted")
+	}
+
+	if removed, err := c.Clear(); err != nil || removed != 2 {
+		t.Errorf("Clear() = %d, %v, want 2 removed", removed, err)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package compare reports the differences between two test runs
+package compare
+
+import (
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// Default thresholds for the duration regressions
+const (
+	DefaultMinDelta = 30 * time.Second
+	DefaultRatio    = 0.2
+)
+
+// Options tune what is reported as a duration regression.
+// A test regressed when its duration grew by more than MinDelta
+// and by more than Ratio of its base duration.
+type Options struct {
+	MinDelta time.Duration
+	Ratio    float64
+}
+
+// DefaultOptions returns the default thresholds, a zero threshold reports
+// every duration increase
+func DefaultOptions() Options {
+	return Options{MinDelta: DefaultMinDelta, Ratio: DefaultRatio}
+}
+
+// TestChange is the result of the same test in both runs
+type TestChange struct {
+	Name         string
+	ShortName    string
+	BaseVerdict  string // empty when the test is not in the base run
+	HeadVerdict  string // empty when the test is not in the head run
+	BaseAttempts int
+	HeadAttempts int
+	BaseDuration time.Duration
+	HeadDuration time.Duration
+}
+
+// DurationDelta returns how much longer the test took in the head run
+func (c *TestChange) DurationDelta() time.Duration {
+	return c.HeadDuration - c.BaseDuration
+}
+
+// Report lists the tests whose result changed between the base and head runs
+type Report struct {
+	NewlyFailing        []TestChange
+	NewlyPassing        []TestChange
+	StillFailing        []TestChange
+	FlakinessChanged    []TestChange
+	DurationRegressions []TestChange
+	Added               []TestChange
+	Removed             []TestChange
+}
+
+// Compare matches the tests of two runs by their Name and reports the
+// regressions of the head run compared to the base run.
+//
+// Parameters:
+//   - base: the reference run, for example the last run on master.
+//   - head: the run to check, for example the run of a pull request.
+//   - opts: thresholds of the duration regressions, see DefaultOptions.
+//
+// Returns:
+//   - *Report with the tests that newly fail, newly pass, still fail,
+//     changed flakiness, regressed in duration, were added or removed.
+func Compare(base, head *utils.TestRunData, opts Options) *Report {
+	report := &Report{}
+	baseTests := make(map[string]*utils.IndividualTestRunData)
+	for i := range base.TestRun {
+		baseTests[base.TestRun[i].Name] = &base.TestRun[i]
+	}
+	headTests := make(map[string]bool)
+
+	for i := range head.TestRun {
+		headTest := &head.TestRun[i]
+		headTests[headTest.Name] = true
+		change := TestChange{
+			Name:         headTest.Name,
+			ShortName:    headTest.ShortName,
+			HeadVerdict:  headTest.Verdict(),
+			HeadAttempts: len(headTest.Attempt),
+			HeadDuration: lastAttemptDuration(headTest),
+		}
+
+		baseTest, found := baseTests[headTest.Name]
+		if !found {
+			report.Added = append(report.Added, change)
+			continue
+		}
+		change.BaseVerdict = baseTest.Verdict()
+		change.BaseAttempts = len(baseTest.Attempt)
+		change.BaseDuration = lastAttemptDuration(baseTest)
+
+		switch {
+		case change.HeadVerdict == utils.Failed && change.BaseVerdict == utils.Failed:
+			report.StillFailing = append(report.StillFailing, change)
+		case change.HeadVerdict == utils.Failed:
+			report.NewlyFailing = append(report.NewlyFailing, change)
+		case change.BaseVerdict == utils.Failed:
+			report.NewlyPassing = append(report.NewlyPassing, change)
+		case change.HeadVerdict != change.BaseVerdict || change.HeadAttempts != change.BaseAttempts:
+			report.FlakinessChanged = append(report.FlakinessChanged, change)
+		}
+
+		delta := change.DurationDelta()
+		if delta > opts.MinDelta && float64(delta) > float64(change.BaseDuration)*opts.Ratio {
+			report.DurationRegressions = append(report.DurationRegressions, change)
+		}
+	}
+
+	for i := range base.TestRun {
+		baseTest := &base.TestRun[i]
+		if headTests[baseTest.Name] {
+			continue
+		}
+		report.Removed = append(report.Removed, TestChange{
+			Name:         baseTest.Name,
+			ShortName:    baseTest.ShortName,
+			BaseVerdict:  baseTest.Verdict(),
+			BaseAttempts: len(baseTest.Attempt),
+			BaseDuration: lastAttemptDuration(baseTest),
+		})
+	}
+
+	return report
+}
+
+// HasRegressions returns whether the head run is worse than the base run
+func (r *Report) HasRegressions() bool {
+	return len(r.NewlyFailing) > 0 || len(r.DurationRegressions) > 0
+}
+
+// lastAttemptDuration is the duration of the attempt that decided the verdict
+func lastAttemptDuration(test *utils.IndividualTestRunData) time.Duration {
+	if len(test.Attempt) == 0 {
+		return 0
+	}
+	return test.Attempt[len(test.Attempt)-1].Duration
+}
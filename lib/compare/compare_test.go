@@ -0,0 +1,125 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compare
+
+import (
+	"testing"
+	"time"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+func newTest(name string, durations []time.Duration, statuses ...string) utils.IndividualTestRunData {
+	test := utils.IndividualTestRunData{Name: name, ShortName: name}
+	for i, duration := range durations {
+		attempt := utils.AttemptData{AttemptNo: i, Name: name, Duration: duration}
+		if i < len(statuses) {
+			attempt.Status.Status = statuses[i]
+		}
+		test.Attempt = append(test.Attempt, attempt)
+	}
+	return test
+}
+
+func names(changes []TestChange) []string {
+	var result []string
+	for _, change := range changes {
+		result = append(result, change.Name)
+	}
+	return result
+}
+
+func TestCompare(t *testing.T) {
+	minute := []time.Duration{time.Minute}
+	base := &utils.TestRunData{TestRun: []utils.IndividualTestRunData{
+		newTest("stable", minute),
+		newTest("breaks", minute),
+		newTest("fixed", minute, utils.Failed),
+		newTest("broken", minute, utils.Failed),
+		newTest("becomes flaky", minute),
+		newTest("slower", minute),
+		newTest("removed", minute),
+	}}
+	head := &utils.TestRunData{TestRun: []utils.IndividualTestRunData{
+		newTest("stable", []time.Duration{time.Minute + 10*time.Second}),
+		newTest("breaks", minute, utils.Failed),
+		newTest("fixed", minute),
+		newTest("broken", minute, utils.Failed),
+		newTest("becomes flaky", []time.Duration{time.Minute, time.Minute}, utils.Failed),
+		newTest("slower", []time.Duration{2 * time.Minute}),
+		newTest("added", minute),
+	}}
+
+	report := Compare(base, head, DefaultOptions())
+
+	tests := []struct {
+		name    string
+		changes []TestChange
+		want    []string
+	}{
+		{name: "NewlyFailing", changes: report.NewlyFailing, want: []string{"breaks"}},
+		{name: "NewlyPassing", changes: report.NewlyPassing, want: []string{"fixed"}},
+		{name: "StillFailing", changes: report.StillFailing, want: []string{"broken"}},
+		{name: "FlakinessChanged", changes: report.FlakinessChanged, want: []string{"becomes flaky"}},
+		{name: "DurationRegressions", changes: report.DurationRegressions, want: []string{"slower"}},
+		{name: "Added", changes: report.Added, want: []string{"added"}},
+		{name: "Removed", changes: report.Removed, want: []string{"removed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := names(tt.changes)
+			if len(got) != len(tt.want) {
+				t.Fatalf("%s = %v, want %v", tt.name, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+				}
+			}
+		})
+	}
+
+	if !report.HasRegressions() {
+		t.Errorf("Expected the head run to have regressions")
+	}
+	if report.FlakinessChanged[0].BaseVerdict != utils.Passed || report.FlakinessChanged[0].HeadVerdict != utils.Flaky {
+		t.Errorf("Unexpected flakiness change %+v", report.FlakinessChanged[0])
+	}
+
+	// zero thresholds report every duration increase
+	report = Compare(base, head, Options{})
+	if got := names(report.DurationRegressions); len(got) != 2 || got[0] != "stable" || got[1] != "slower" {
+		t.Errorf("DurationRegressions without thresholds = %v, want [stable slower]", got)
+	}
+}
+
+func TestCompareSameRun(t *testing.T) {
+	testData := fixture.Parse(t)
+	if got := fixture.CountAttempts(testData); got != fixture.AttemptCount {
+		t.Fatalf("Expected %d attempts, got %d", fixture.AttemptCount, got)
+	}
+
+	report := Compare(testData, testData, DefaultOptions())
+	if report.HasRegressions() || len(report.NewlyPassing) > 0 || len(report.FlakinessChanged) > 0 ||
+		len(report.Added) > 0 || len(report.Removed) > 0 {
+		t.Errorf("Expected no changes comparing a run with itself, got %+v", report)
+	}
+	if got := names(report.StillFailing); len(got) != 1 {
+		t.Errorf("Expected the failing test to still fail, got %v", got)
+	}
+}
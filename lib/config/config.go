@@ -0,0 +1,397 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config reads the settings shared by a team from YAML files.
+//
+// A config file sets defaults for the command line flags, by flag name, and
+// named profiles overriding them:
+//
+//	profile: oadp-aws
+//	defaults:
+//	  patterns: ./flakes
+//	  anchor-tags: [It, Entry]
+//	url-rules:
+//	  - match: '^aws/(\d+)$'
+//	    replace: https://prow.ci.openshift.org/view/gs/test-platform-results/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic/$1
+//	profiles:
+//	  oadp-aws:
+//	    job: e2e-test-aws
+//	    min-delta: 2m
+//
+// The flags given on the command line override the config.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// LocalFile is the config file of a repository, looked for from the
+	// current folder up to the root
+	LocalFile = ".demystifier.yaml"
+	// urlRulesKey is the setting holding the URL resolution rules
+	urlRulesKey = "url-rules"
+)
+
+// ErrUnknownProfile is returned when the selected profile is in no config file
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// URLRule rewrites the log locations given on the command line matching a
+// regular expression, Replace may use the $1 groups of the match
+type URLRule struct {
+	Match   *regexp.Regexp
+	Replace string
+}
+
+// Profile is a set of flag values and URL rules
+type Profile struct {
+	Settings map[string]string
+	URLRules []URLRule
+}
+
+// Config is the content of the config files, the later files override the
+// earlier ones
+type Config struct {
+	// Files are the config files read
+	Files []string
+	// Profile is the profile used when none is selected
+	Profile  string
+	Defaults Profile
+	Profiles map[string]Profile
+	// sources tells which file set each default and profile setting
+	sources map[string]string
+}
+
+// Setting is an effective setting and where it comes from
+type Setting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// Effective are the settings of a profile merged with the defaults
+type Effective struct {
+	Profile  string
+	Files    []string
+	Settings []Setting
+	URLRules []URLRule
+}
+
+// DefaultPaths returns the user config file, then the config file of the
+// repository holding the current folder when there is one
+func DefaultPaths() []string {
+	var paths []string
+	if configHome, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(configHome, "demystifier", "config.yaml"))
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return paths
+	}
+	for {
+		local := filepath.Join(dir, LocalFile)
+		if _, err := os.Stat(local); err == nil {
+			return append(paths, local)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return paths
+		}
+		dir = parent
+	}
+}
+
+// Load reads the config files in order, the missing ones are skipped.
+//
+// Parameters:
+//   - paths: the config files, a later file overrides the settings of the earlier ones.
+//
+// Returns:
+//   - *Config with the merged content, empty when no file exists.
+//   - error if a file can not be read or is not a valid config.
+func Load(paths ...string) (*Config, error) {
+	config := &Config{
+		Defaults: Profile{Settings: map[string]string{}},
+		Profiles: map[string]Profile{},
+		sources:  map[string]string{},
+	}
+	for _, path := range paths {
+		content, err := os.ReadFile(path) // #nosec G304 -- the config files are chosen by the user
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading config: %v", err)
+		}
+		if err := config.merge(path, string(content)); err != nil {
+			return nil, fmt.Errorf("error in config %s: %v", path, err)
+		}
+		config.Files = append(config.Files, path)
+	}
+	return config, nil
+}
+
+// topLevelKeys are the keys of a config file, merged in this order whatever
+// their order in the file
+var topLevelKeys = []string{"profile", "defaults", urlRulesKey, "profiles"}
+
+// merge adds the content of a config file
+func (c *Config) merge(path, content string) error {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		return err
+	}
+	if len(document.Content) == 0 {
+		return nil
+	}
+	if err := checkKeys(&document); err != nil {
+		return err
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return errors.New("expected a mapping at the top level")
+	}
+
+	values := map[string]*yaml.Node{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key := root.Content[i].Value
+		if !contains(topLevelKeys, key) {
+			return fmt.Errorf("unknown key %q, flag values go under defaults or a profile", key)
+		}
+		values[key] = root.Content[i+1]
+	}
+	for _, key := range topLevelKeys {
+		value, found := values[key]
+		if !found {
+			continue
+		}
+		switch key {
+		case "profile":
+			if value.Kind != yaml.ScalarNode {
+				return errors.New("profile must be a profile name")
+			}
+			c.Profile = value.Value
+		case "defaults":
+			if err := c.mergeProfile(&c.Defaults, "", path, value); err != nil {
+				return fmt.Errorf("defaults: %v", err)
+			}
+		case urlRulesKey:
+			rules, err := decodeURLRules(value)
+			if err != nil {
+				return err
+			}
+			// The top level rules are tried before the ones of defaults
+			c.Defaults.URLRules = append(rules, c.Defaults.URLRules...)
+		case "profiles":
+			if value.Kind != yaml.MappingNode {
+				return errors.New("profiles must map the profile names to their settings")
+			}
+			for i := 0; i+1 < len(value.Content); i += 2 {
+				name := value.Content[i].Value
+				profile, found := c.Profiles[name]
+				if !found {
+					profile = Profile{Settings: map[string]string{}}
+				}
+				if err := c.mergeProfile(&profile, name, path, value.Content[i+1]); err != nil {
+					return fmt.Errorf("profile %s: %v", name, err)
+				}
+				c.Profiles[name] = profile
+			}
+		}
+	}
+	return nil
+}
+
+// checkKeys rejects the duplicate keys of the mappings, yaml.v3 only does
+// when decoding into Go maps and structs
+func checkKeys(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		seen := map[string]bool{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if seen[key.Value] {
+				return fmt.Errorf("line %d: duplicate key %q", key.Line, key.Value)
+			}
+			seen[key.Value] = true
+		}
+	}
+	for _, child := range node.Content {
+		if err := checkKeys(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contains(items []string, item string) bool {
+	for _, candidate := range items {
+		if candidate == item {
+			return true
+		}
+	}
+	return false
+}
+
+// isNull tells whether a node is an empty value, such as "defaults:"
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+// mergeProfile adds the settings of a profile, the items of a sequence are
+// joined with commas like in the flags taking lists. Every scalar is kept as
+// written, the flags parse them.
+func (c *Config) mergeProfile(profile *Profile, name, path string, value *yaml.Node) error {
+	if isNull(value) {
+		return nil
+	}
+	if value.Kind != yaml.MappingNode {
+		return errors.New("expected flag names and their values")
+	}
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key, setting := value.Content[i].Value, value.Content[i+1]
+		if key == urlRulesKey {
+			rules, err := decodeURLRules(setting)
+			if err != nil {
+				return err
+			}
+			// The rules of a later file are tried first
+			profile.URLRules = append(rules, profile.URLRules...)
+			continue
+		}
+		switch setting.Kind {
+		case yaml.ScalarNode:
+			if isNull(setting) {
+				profile.Settings[key] = ""
+			} else {
+				profile.Settings[key] = setting.Value
+			}
+		case yaml.SequenceNode:
+			items := make([]string, 0, len(setting.Content))
+			for _, item := range setting.Content {
+				if item.Kind != yaml.ScalarNode {
+					return fmt.Errorf("%s: expected a list of values", key)
+				}
+				items = append(items, item.Value)
+			}
+			profile.Settings[key] = strings.Join(items, ",")
+		default:
+			return fmt.Errorf("%s: expected a value or a list of values", key)
+		}
+		c.sources[sourceKey(name, key)] = path
+	}
+	return nil
+}
+
+// urlRule is a URL rule as written in a config file
+type urlRule struct {
+	Match   string `yaml:"match"`
+	Replace string `yaml:"replace"`
+}
+
+func decodeURLRules(value *yaml.Node) ([]URLRule, error) {
+	if value.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("%s: expected a list of rules", urlRulesKey)
+	}
+	rules := make([]URLRule, 0, len(value.Content))
+	for i, item := range value.Content {
+		var rule urlRule
+		if item.Kind != yaml.MappingNode || item.Decode(&rule) != nil || rule.Match == "" || rule.Replace == "" {
+			return nil, fmt.Errorf("%s: rule %d must have match and replace", urlRulesKey, i+1)
+		}
+		for j := 0; j < len(item.Content); j += 2 {
+			if field := item.Content[j].Value; field != "match" && field != "replace" {
+				return nil, fmt.Errorf("%s: rule %d: unknown key %q", urlRulesKey, i+1, field)
+			}
+		}
+		pattern, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %v", urlRulesKey, i+1, err)
+		}
+		rules = append(rules, URLRule{Match: pattern, Replace: rule.Replace})
+	}
+	return rules, nil
+}
+
+func sourceKey(profile, setting string) string {
+	return profile + "/" + setting
+}
+
+// Resolve merges a profile with the defaults.
+//
+// Parameters:
+//   - profile: the selected profile, the default profile of the config when empty.
+//
+// Returns:
+//   - *Effective with the settings sorted by name, the profile ones overriding the defaults.
+//   - ErrUnknownProfile when the profile is in no config file.
+func (c *Config) Resolve(profile string) (*Effective, error) {
+	if profile == "" {
+		profile = c.Profile
+	}
+	effective := &Effective{Profile: profile, Files: c.Files}
+	values := map[string]Setting{}
+	for name, value := range c.Defaults.Settings {
+		values[name] = Setting{Name: name, Value: value, Source: c.sources[sourceKey("", name)]}
+	}
+	effective.URLRules = c.Defaults.URLRules
+	if profile != "" {
+		selected, found := c.Profiles[profile]
+		if !found {
+			return nil, fmt.Errorf("%w %q", ErrUnknownProfile, profile)
+		}
+		for name, value := range selected.Settings {
+			values[name] = Setting{Name: name, Value: value, Source: c.sources[sourceKey(profile, name)] + " (" + profile + ")"}
+		}
+		effective.URLRules = append(append([]URLRule(nil), selected.URLRules...), c.Defaults.URLRules...)
+	}
+
+	for _, setting := range values {
+		effective.Settings = append(effective.Settings, setting)
+	}
+	sort.Slice(effective.Settings, func(i, j int) bool {
+		return effective.Settings[i].Name < effective.Settings[j].Name
+	})
+	return effective, nil
+}
+
+// Lookup returns the value of a setting
+func (e *Effective) Lookup(name string) (string, bool) {
+	for _, setting := range e.Settings {
+		if setting.Name == name {
+			return setting.Value, true
+		}
+	}
+	return "", false
+}
+
+// ResolveURL applies the first URL rule matching a location, the location
+// is returned as is when none does
+func (e *Effective) ResolveURL(location string) string {
+	for _, rule := range e.URLRules {
+		if rule.Match.MatchString(location) {
+			return rule.Match.ReplaceAllString(location, rule.Replace)
+		}
+	}
+	return location
+}
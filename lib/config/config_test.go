@@ -0,0 +1,219 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadValues(t *testing.T) {
+	content := `# team settings
+defaults:
+  threshold: 50 # percent
+  retries: 0
+  no-cache: true
+  filter: 'name~it''s'
+  title: "x: #y"
+  anchor-tags: [It, 'Entry']
+  columns:
+    - name
+    - failed
+  proxy:
+`
+	path := writeConfig(t, t.TempDir(), "config.yaml", content)
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := map[string]string{
+		"threshold":   "50",
+		"retries":     "0",
+		"no-cache":    "true",
+		"filter":      "name~it's",
+		"title":       "x: #y",
+		"anchor-tags": "It,Entry",
+		"columns":     "name,failed",
+		"proxy":       "",
+	}
+	if !reflect.DeepEqual(config.Defaults.Settings, want) {
+		t.Errorf("Load() settings = %v, want %v", config.Defaults.Settings, want)
+	}
+}
+
+func TestURLRulesOrder(t *testing.T) {
+	// the top level rules are tried first, whatever the order of the keys
+	content := `url-rules:
+  - match: '^(\d+)$'
+    replace: top/$1
+defaults:
+  url-rules:
+    - match: '^(\d+)$'
+      replace: defaults/$1
+`
+	path := writeConfig(t, t.TempDir(), "config.yaml", content)
+	for i := 0; i < 10; i++ {
+		config, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		effective, err := config.Resolve("")
+		if err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+		if got := effective.ResolveURL("42"); got != "top/42" {
+			t.Fatalf("ResolveURL() = %s, want top/42", got)
+		}
+	}
+}
+
+const (
+	userConfig = `profile: oadp-aws
+defaults:
+  patterns: /home/user/flakes
+  anchor-tags: [It, Entry]
+url-rules:
+  - match: '^aws/(\d+)$'
+    replace: https://prow.example.com/aws/$1
+profiles:
+  oadp-aws:
+    platform: aws
+    min-delta: 2m
+  oadp-azure:
+    platform: azure
+`
+	localConfig = `defaults:
+  patterns: ./flakes
+profiles:
+  oadp-aws:
+    min-delta: 5m
+    url-rules:
+      - match: '^(\d+)$'
+        replace: https://prow.example.com/aws/$1
+`
+)
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Error writing config: %v", err)
+	}
+	return path
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	user := writeConfig(t, dir, "config.yaml", userConfig)
+	local := writeConfig(t, dir, LocalFile, localConfig)
+
+	config, err := Load(user, filepath.Join(dir, "missing.yaml"), local)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(config.Files, []string{user, local}) {
+		t.Errorf("Load() read %v", config.Files)
+	}
+
+	tests := []struct {
+		name         string
+		profile      string
+		wantSettings []Setting
+		wantURLs     map[string]string
+		wantErr      error
+	}{
+		{
+			name: "Default profile",
+			wantSettings: []Setting{
+				{Name: "anchor-tags", Value: "It,Entry", Source: user},
+				{Name: "min-delta", Value: "5m", Source: local + " (oadp-aws)"},
+				{Name: "patterns", Value: "./flakes", Source: local},
+				{Name: "platform", Value: "aws", Source: user + " (oadp-aws)"},
+			},
+			wantURLs: map[string]string{
+				"aws/42":        "https://prow.example.com/aws/42",
+				"42":            "https://prow.example.com/aws/42",
+				"build-log.txt": "build-log.txt",
+			},
+		},
+		{
+			name:    "Selected profile",
+			profile: "oadp-azure",
+			wantSettings: []Setting{
+				{Name: "anchor-tags", Value: "It,Entry", Source: user},
+				{Name: "patterns", Value: "./flakes", Source: local},
+				{Name: "platform", Value: "azure", Source: user + " (oadp-azure)"},
+			},
+			wantURLs: map[string]string{
+				"aws/42": "https://prow.example.com/aws/42",
+				"42":     "42",
+			},
+		},
+		{
+			name:    "Unknown profile",
+			profile: "oadp-gcp",
+			wantErr: ErrUnknownProfile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			effective, err := config.Resolve(tt.profile)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(effective.Settings, tt.wantSettings) {
+				t.Errorf("Resolve() settings = %v, want %v", effective.Settings, tt.wantSettings)
+			}
+			for location, want := range tt.wantURLs {
+				if got := effective.ResolveURL(location); got != want {
+					t.Errorf("ResolveURL(%s) = %s, want %s", location, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "Unknown key", content: "patterns: ./flakes\n"},
+		{name: "Nested setting", content: "defaults:\n  compare:\n    min-delta: 1m\n"},
+		{name: "Rule without replacement", content: "url-rules:\n  - match: abc\n"},
+		{name: "Invalid rule pattern", content: "url-rules:\n  - match: '('\n    replace: x\n"},
+		{name: "Top level sequence", content: "- a\n"},
+		{name: "Unknown rule key", content: "url-rules:\n  - match: abc\n    replace: x\n    replce: y\n"},
+		{name: "Duplicate key", content: "defaults:\n  patterns: a\n  patterns: b\n"},
+		{name: "Tab indentation", content: "defaults:\n\tpatterns: a\n"},
+		{name: "Unterminated flow sequence", content: "defaults:\n  anchor-tags: [It, Entry\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, t.TempDir(), "config.yaml", tt.content)
+			if _, err := Load(path); err == nil {
+				t.Errorf("Load() expected an error")
+			}
+		})
+	}
+}
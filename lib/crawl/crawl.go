@@ -0,0 +1,252 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package crawl lists the runs of a Prow job from its GCS bucket through gcsweb
+package crawl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/migtools/demystifier/lib/batch"
+	"github.com/migtools/demystifier/lib/fetch"
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultGCSWebURL is the gcsweb folder of the bucket holding the Prow results
+const DefaultGCSWebURL = "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/test-platform-results/"
+
+const (
+	bucketPrefix = "gs://test-platform-results/"
+	buildLogFile = "build-log.txt"
+)
+
+var (
+	hrefRegex     = regexp.MustCompile(`href="([^"]+)"`)
+	runEntryRegex = regexp.MustCompile(`(?:^|/)(\d+)(?:/|\.txt)$`)
+	stepNameRegex = regexp.MustCompile(`e2e-[a-z0-9-]+$`)
+)
+
+// Finished is the content of the finished.json written by Prow at the end of a run
+type Finished struct {
+	Timestamp int64  `json:"timestamp"`
+	Passed    bool   `json:"passed"`
+	Result    string `json:"result"`
+	Revision  string `json:"revision"`
+}
+
+// Time returns when the run finished
+func (f *Finished) Time() time.Time {
+	return time.Unix(f.Timestamp, 0)
+}
+
+// Run is a finished run of a job
+type Run struct {
+	JobName     string
+	ID          string
+	URL         string // gcsweb folder of the run
+	BuildLogURL string
+	Finished    Finished
+}
+
+// Crawler reads the job folders through gcsweb
+type Crawler struct {
+	GCSWebURL string
+	Client    fetch.HTTPClient
+	// Workers is the number of runs looked up at the same time, batch.DefaultWorkers when not positive
+	Workers int
+}
+
+// New returns a Crawler of the default gcsweb instance
+func New() *Crawler {
+	return &Crawler{
+		GCSWebURL: DefaultGCSWebURL,
+		Client:    fetch.Default(),
+	}
+}
+
+// JobName returns the job name of a job history URL, Prow URL or plain job name
+func JobName(location string) string {
+	if !strings.Contains(location, "/") {
+		return location
+	}
+	return utils.GetJobInfo(strings.TrimSuffix(location, "/")).JobName
+}
+
+// ListRuns returns the most recent finished runs of a job, newest first.
+// Runs without a finished.json are still running and are skipped, as are
+// the runs that can not be read, with a warning.
+//
+// Parameters:
+//   - jobName: the Prow job name, pull request jobs are listed from pr-logs/directory.
+//   - limit: the maximum number of runs returned, 0 for all of them.
+//
+// Returns:
+//   - []Run with the gcsweb folder, build log URL and finished.json of each run.
+//   - error if the job folder can not be listed.
+func (c *Crawler) ListRuns(jobName string, limit int) ([]Run, error) {
+	if jobName == "" {
+		return nil, errors.New("error listing runs: empty job name")
+	}
+	jobFolder := c.GCSWebURL + "logs/" + jobName + "/"
+	if strings.HasPrefix(jobName, "pull-") {
+		jobFolder = c.GCSWebURL + "pr-logs/directory/" + jobName + "/"
+	}
+
+	ids, err := c.listRunIDs(jobFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	// the runs are looked up by chunks of the missing number of runs, as
+	// some of them are still running
+	var runs []Run
+	for next := 0; next < len(ids) && (limit <= 0 || len(runs) < limit); {
+		count := len(ids) - next
+		if limit > 0 && limit-len(runs) < count {
+			count = limit - len(runs)
+		}
+		chunk := make([]*Run, count)
+		batch.Each(count, c.Workers, func(i int) {
+			run, err := c.finishedRun(jobFolder, jobName, ids[next+i])
+			if err != nil {
+				log.WithFields(log.Fields{
+					"Job":   jobName,
+					"Run":   ids[next+i],
+					"error": err,
+				}).Warn("Skipping run")
+				return
+			}
+			chunk[i] = run
+		})
+		next += count
+		for _, run := range chunk {
+			if run != nil {
+				runs = append(runs, *run)
+			}
+		}
+	}
+	return runs, nil
+}
+
+// finishedRun returns a run of a job, nil when it is still running
+func (c *Crawler) finishedRun(jobFolder, jobName, id string) (*Run, error) {
+	runFolder := jobFolder + id + "/"
+	if strings.HasPrefix(jobName, "pull-") {
+		var err error
+		if runFolder, err = c.pullRunFolder(jobFolder + id + ".txt"); err != nil {
+			return nil, err
+		}
+	}
+
+	run := &Run{
+		JobName:     jobName,
+		ID:          id,
+		URL:         runFolder,
+		BuildLogURL: runFolder + "artifacts/" + stepNameRegex.FindString(jobName) + "/e2e/" + buildLogFile,
+	}
+	found, err := c.getJSON(runFolder+utils.FinishedFile, &run.Finished)
+	if err != nil || !found {
+		return nil, err
+	}
+	return run, nil
+}
+
+// listRunIDs returns the run IDs of a job folder listing, newest first
+func (c *Crawler) listRunIDs(folder string) ([]string, error) {
+	page, found, err := c.get(folder)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("error listing runs: %s not found", folder)
+	}
+
+	seen := make(map[string]bool)
+	var ids []string
+	for _, match := range hrefRegex.FindAllStringSubmatch(string(page), -1) {
+		if matches := runEntryRegex.FindStringSubmatch(match[1]); matches != nil && !seen[matches[1]] {
+			seen[matches[1]] = true
+			ids = append(ids, matches[1])
+		}
+	}
+
+	// Prow build IDs grow over time
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.ParseUint(ids[i], 10, 64)
+		b, _ := strconv.ParseUint(ids[j], 10, 64)
+		return a > b
+	})
+	return ids, nil
+}
+
+// pullRunFolder reads the gs:// link that pr-logs/directory keeps for each run
+func (c *Crawler) pullRunFolder(linkURL string) (string, error) {
+	content, found, err := c.get(linkURL)
+	if err != nil {
+		return "", err
+	}
+	link := strings.TrimSpace(string(content))
+	if !found || !strings.HasPrefix(link, bucketPrefix) {
+		return "", fmt.Errorf("error reading run link %s", linkURL)
+	}
+	return c.GCSWebURL + strings.TrimSuffix(strings.TrimPrefix(link, bucketPrefix), "/") + "/", nil
+}
+
+func (c *Crawler) getJSON(location string, value interface{}) (bool, error) {
+	content, found, err := c.get(location)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := json.Unmarshal(content, value); err != nil {
+		return false, fmt.Errorf("error decoding %s: %v", location, err)
+	}
+	return true, nil
+}
+
+// get returns the body of the location, found is false when it does not exist
+func (c *Crawler) get(location string) (body []byte, found bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, location, http.NoBody)
+	if err != nil {
+		return nil, false, fmt.Errorf("error opening URL: %v", err)
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("error opening URL: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, &fetch.StatusError{URL: location, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading HTTP response body: %v", err)
+	}
+	return body, true, nil
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crawl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+const (
+	gcswebFolder = "../../tests/testdata/gcsweb"
+)
+
+// newGCSWeb serves the fixture bucket, every build log is the same fixture
+// and the broken paths answer an internal error
+func newGCSWeb(t *testing.T, broken ...string) *Crawler {
+	files := http.FileServer(http.Dir(gcswebFolder))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range broken {
+			if strings.HasSuffix(r.URL.Path, path) {
+				http.Error(w, "backend error", http.StatusInternalServerError)
+				return
+			}
+		}
+		if strings.HasSuffix(r.URL.Path, "/"+buildLogFile) {
+			http.ServeFile(w, r, fixture.BuildLog)
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return &Crawler{GCSWebURL: server.URL + "/gcs/test-platform-results/", Client: server.Client()}
+}
+
+func TestListRuns(t *testing.T) {
+	crawler := newGCSWeb(t)
+
+	tests := []struct {
+		name       string
+		jobName    string
+		limit      int
+		wantIDs    []string
+		wantResult []string
+		wantPath   string
+	}{
+		{
+			name:       "Periodic job skips the running build",
+			jobName:    "periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic",
+			wantIDs:    []string{"1767186600720076801", "1767186600720076800"},
+			wantResult: []string{"FAILURE", "SUCCESS"},
+			wantPath:   "/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic/1767186600720076801/artifacts/e2e-test-aws-periodic/e2e/build-log.txt",
+		},
+		{
+			name:       "Limit",
+			jobName:    "periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic",
+			limit:      1,
+			wantIDs:    []string{"1767186600720076801"},
+			wantResult: []string{"FAILURE"},
+			wantPath:   "/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic/1767186600720076801/artifacts/e2e-test-aws-periodic/e2e/build-log.txt",
+		},
+		{
+			name:       "Pull request job follows the run links",
+			jobName:    "pull-ci-openshift-oadp-operator-master-4.14-e2e-test-aws",
+			wantIDs:    []string{"1757841603164114944"},
+			wantResult: []string{"FAILURE"},
+			wantPath:   "/pr-logs/pull/openshift_oadp-operator/1330/pull-ci-openshift-oadp-operator-master-4.14-e2e-test-aws/1757841603164114944/artifacts/e2e-test-aws/e2e/build-log.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, err := crawler.ListRuns(tt.jobName, tt.limit)
+			if err != nil {
+				t.Fatalf("Error listing runs: %v", err)
+			}
+			if len(runs) != len(tt.wantIDs) {
+				t.Fatalf("Expected %d runs, got %+v", len(tt.wantIDs), runs)
+			}
+			for i, run := range runs {
+				if run.ID != tt.wantIDs[i] || run.Finished.Result != tt.wantResult[i] {
+					t.Errorf("Run %d = %s %s, want %s %s", i, run.ID, run.Finished.Result, tt.wantIDs[i], tt.wantResult[i])
+				}
+			}
+			if want := crawler.GCSWebURL + strings.TrimPrefix(tt.wantPath, "/"); runs[0].BuildLogURL != want {
+				t.Errorf("BuildLogURL = %s, want %s", runs[0].BuildLogURL, want)
+			}
+
+			testData, err := utils.GetRunDataFromLog(runs[0].BuildLogURL)
+			if err != nil {
+				t.Fatalf("Error fetching build log: %v", err)
+			}
+			if err := utils.SetIndividualTestsFromLog(testData, "It"); err != nil || len(testData.TestRun) == 0 {
+				t.Errorf("Expected tests in the build log, got %v", err)
+			}
+			if job := utils.GetJobInfo(runs[0].BuildLogURL); job.JobName != tt.jobName || job.RunID != tt.wantIDs[0] {
+				t.Errorf("Expected the job metadata in the build log URL, got %+v", job)
+			}
+		})
+	}
+
+	if _, err := crawler.ListRuns("periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-gcp", 0); err == nil {
+		t.Errorf("Expected an error for an unknown job")
+	}
+}
+
+func TestListRunsSkipsBrokenRuns(t *testing.T) {
+	crawler := newGCSWeb(t, "/1767186600720076801/finished.json")
+	crawler.Workers = 1
+
+	runs, err := crawler.ListRuns("periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic", 1)
+	if err != nil {
+		t.Fatalf("Error listing runs: %v", err)
+	}
+	if len(runs) != 1 || runs[0].ID != "1767186600720076800" {
+		t.Errorf("Expected the run after the broken one, got %+v", runs)
+	}
+}
+
+func TestJobName(t *testing.T) {
+	tests := []struct {
+		location string
+		want     string
+	}{
+		{location: "periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic", want: "periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic"},
+		{location: "https://prow.ci.openshift.org/job-history/gs/test-platform-results/pr-logs/directory/pull-ci-openshift-oadp-operator-master-4.14-e2e-test-aws", want: "pull-ci-openshift-oadp-operator-master-4.14-e2e-test-aws"},
+		{location: "https://prow.ci.openshift.org/job-history/gs/test-platform-results/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic/", want: "periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := JobName(tt.location); got != tt.want {
+				t.Errorf("JobName() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package diff compares a failed attempt with its passing retry
+package diff
+
+import (
+	"sort"
+	"time"
+
+	"github.com/migtools/demystifier/lib/oadp"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// Operations of a LineDiff
+const (
+	Equal       = "="
+	OnlyFailing = "-"
+	OnlyPassing = "+"
+)
+
+// LineDiff is a single line of the aligned attempt logs
+type LineDiff struct {
+	Op   string
+	Line string // original line, from the failing attempt when Op is Equal
+}
+
+// PhaseDelta is the time spent in a Velero phase by both attempts
+type PhaseDelta struct {
+	Kind    string
+	Phase   string
+	Failing time.Duration
+	Passing time.Duration
+	Delta   time.Duration
+}
+
+// AttemptDiff is the difference between a failing and a passing attempt
+type AttemptDiff struct {
+	Failing       *utils.AttemptData
+	Passing       *utils.AttemptData
+	DurationDelta time.Duration
+	Lines         []LineDiff
+	// Velero phases, as "Kind: Phase", reached by only one of the attempts
+	PhasesOnlyFailing []string
+	PhasesOnlyPassing []string
+	PhaseDeltas       []PhaseDelta
+	// velero describe warnings and errors reported by the failing attempt only
+	WarningsOnlyFailing []utils.DescribeMessage
+	ErrorsOnlyFailing   []utils.DescribeMessage
+}
+
+// FindFlakyPair returns the last failing attempt followed by a passing one.
+// Both are nil when the test never passed after a failure.
+func FindFlakyPair(test *utils.IndividualTestRunData) (failing, passing *utils.AttemptData) {
+	for i := 1; i < len(test.Attempt); i++ {
+		if test.Attempt[i-1].Status.Status == utils.Failed && test.Attempt[i].Status.Status != utils.Failed {
+			return &test.Attempt[i-1], &test.Attempt[i]
+		}
+	}
+	return nil, nil
+}
+
+// CompareAttempts aligns the logs of two attempts of the same test and
+// reports what only happened in the failing one.
+// Lines are compared after normalizing variable tokens such as UUIDs,
+// pod name suffixes and timestamps.
+//
+// Parameters:
+//   - failing: the failed attempt.
+//   - passing: the passing attempt to compare it with, usually its retry.
+//
+// Returns:
+//   - *AttemptDiff with the aligned lines, the Velero phases reached by only
+//     one of the attempts and the time spent in each phase by both.
+func CompareAttempts(failing, passing *utils.AttemptData) *AttemptDiff {
+	result := &AttemptDiff{
+		Failing:       failing,
+		Passing:       passing,
+		DurationDelta: failing.Duration - passing.Duration,
+		Lines:         DiffLines(failing.Logs, passing.Logs),
+	}
+
+	failingPhases := phaseSet(failing)
+	passingPhases := phaseSet(passing)
+	result.PhasesOnlyFailing = difference(failingPhases, passingPhases)
+	result.PhasesOnlyPassing = difference(passingPhases, failingPhases)
+	result.PhaseDeltas = phaseDeltas(failing, passing)
+
+	var failingWarnings, passingWarnings, failingErrors, passingErrors []utils.DescribeMessage
+	for _, event := range failing.Events {
+		if event.Describe != nil {
+			failingWarnings = append(failingWarnings, event.Describe.Warnings...)
+			failingErrors = append(failingErrors, event.Describe.Errors...)
+		}
+	}
+	for _, event := range passing.Events {
+		if event.Describe != nil {
+			passingWarnings = append(passingWarnings, event.Describe.Warnings...)
+			passingErrors = append(passingErrors, event.Describe.Errors...)
+		}
+	}
+	result.WarningsOnlyFailing, _ = oadp.DiffMessages(failingWarnings, passingWarnings)
+	result.ErrorsOnlyFailing, _ = oadp.DiffMessages(failingErrors, passingErrors)
+
+	return result
+}
+
+// DiffLines aligns two sequences of log lines using their longest common
+// subsequence, comparing the normalized lines.
+func DiffLines(failing, passing []string) []LineDiff {
+	a := normalizeAll(failing)
+	b := normalizeAll(passing)
+
+	// The common prefix and suffix do not need the quadratic table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var result []LineDiff
+	for i := 0; i < prefix; i++ {
+		result = append(result, LineDiff{Op: Equal, Line: failing[i]})
+	}
+
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+	lcs := make([][]int32, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(midA) && j < len(midB) {
+		switch {
+		case midA[i] == midB[j]:
+			result = append(result, LineDiff{Op: Equal, Line: failing[prefix+i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			result = append(result, LineDiff{Op: OnlyFailing, Line: failing[prefix+i]})
+			i++
+		default:
+			result = append(result, LineDiff{Op: OnlyPassing, Line: passing[prefix+j]})
+			j++
+		}
+	}
+	for ; i < len(midA); i++ {
+		result = append(result, LineDiff{Op: OnlyFailing, Line: failing[prefix+i]})
+	}
+	for ; j < len(midB); j++ {
+		result = append(result, LineDiff{Op: OnlyPassing, Line: passing[prefix+j]})
+	}
+
+	for k := len(failing) - suffix; k < len(failing); k++ {
+		result = append(result, LineDiff{Op: Equal, Line: failing[k]})
+	}
+
+	return result
+}
+
+func normalizeAll(lines []string) []string {
+	normalized := make([]string, len(lines))
+	for i, line := range lines {
+		normalized[i] = utils.NormalizeLine(line)
+	}
+	return normalized
+}
+
+func phaseSet(attempt *utils.AttemptData) map[string]bool {
+	phases := make(map[string]bool)
+	for _, event := range attempt.Events {
+		for _, transition := range event.Phases {
+			phases[event.Kind+": "+transition.Phase] = true
+		}
+	}
+	return phases
+}
+
+func difference(first, second map[string]bool) []string {
+	var result []string
+	for phase := range first {
+		if !second[phase] {
+			result = append(result, phase)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+type phaseKey struct {
+	kind  string
+	phase string
+}
+
+func phaseDeltas(failing, passing *utils.AttemptData) []PhaseDelta {
+	deltas := make(map[phaseKey]*PhaseDelta)
+	var order []phaseKey
+
+	collect := func(attempt *utils.AttemptData, isFailing bool) {
+		for i := range attempt.Events {
+			event := &attempt.Events[i]
+			for _, transition := range event.Phases {
+				key := phaseKey{kind: event.Kind, phase: transition.Phase}
+				if deltas[key] == nil {
+					deltas[key] = &PhaseDelta{Kind: key.kind, Phase: key.phase}
+					order = append(order, key)
+				}
+			}
+			for phase, duration := range oadp.PhaseDurations(event) {
+				key := phaseKey{kind: event.Kind, phase: phase}
+				if isFailing {
+					deltas[key].Failing += duration
+				} else {
+					deltas[key].Passing += duration
+				}
+			}
+		}
+	}
+	collect(failing, true)
+	collect(passing, false)
+
+	result := make([]PhaseDelta, 0, len(order))
+	for _, key := range order {
+		delta := deltas[key]
+		delta.Delta = delta.Failing - delta.Passing
+		result = append(result, *delta)
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/oadp"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+func TestDiffLines(t *testing.T) {
+	failing := []string{
+		"2024/02/14 19:48:57 Creating backup mysql-csi-e2e-fc83d856-cb71-11ee-a3a2-0a580a813019 for case mysql-csi-e2e",
+		"2024/02/14 19:49:07 backup phase: InProgress",
+		"2024/02/14 19:49:17 backup phase: WaitingForPluginOperationsPartiallyFailed",
+		"2024/02/14 19:51:17 backup phase: PartiallyFailed",
+		"2024/02/14 19:51:18 Deleting VolumeSnapshot",
+	}
+	passing := []string{
+		"2024/02/14 19:52:59 Creating backup mysql-csi-e2e-8964018a-cb72-11ee-a3a2-0a580a813019 for case mysql-csi-e2e",
+		"2024/02/14 19:53:09 backup phase: InProgress",
+		"2024/02/14 19:53:39 backup phase: Completed",
+		"2024/02/14 19:54:24 Creating restore mysql-csi-e2e-8964018f-cb72-11ee-a3a2-0a580a813019 for case mysql-csi-e2e",
+		"2024/02/14 19:55:10 Deleting VolumeSnapshot",
+	}
+
+	got := DiffLines(failing, passing)
+	want := []LineDiff{
+		{Op: Equal, Line: failing[0]},
+		{Op: Equal, Line: failing[1]},
+		{Op: OnlyFailing, Line: failing[2]},
+		{Op: OnlyFailing, Line: failing[3]},
+		{Op: OnlyPassing, Line: passing[2]},
+		{Op: OnlyPassing, Line: passing[3]},
+		{Op: Equal, Line: failing[4]},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffLines() = %v, want %v", got, want)
+	}
+}
+
+func TestCompareAttempts(t *testing.T) {
+	testData := fixture.Parse(t)
+	if got := fixture.CountAttempts(testData); got != fixture.AttemptCount {
+		t.Fatalf("Expected %d attempts, got %d", fixture.AttemptCount, got)
+	}
+	oadp.SetEventsFromTestRun(testData)
+
+	var failing, passing *utils.AttemptData
+	for i := range testData.TestRun {
+		if testData.TestRun[i].Verdict() == utils.Flaky {
+			failing, passing = FindFlakyPair(&testData.TestRun[i])
+		}
+	}
+	if failing == nil || passing == nil {
+		t.Fatal("Expected a flaky test with a failing and a passing attempt")
+	}
+	if failing.AttemptNo != 0 || passing.AttemptNo != 1 {
+		t.Errorf("Expected attempts 0 and 1, got %d and %d", failing.AttemptNo, passing.AttemptNo)
+	}
+
+	result := CompareAttempts(failing, passing)
+
+	wantOnlyFailing := []string{"Backup: PartiallyFailed", "Backup: WaitingForPluginOperationsPartiallyFailed"}
+	if !reflect.DeepEqual(result.PhasesOnlyFailing, wantOnlyFailing) {
+		t.Errorf("PhasesOnlyFailing = %v, want %v", result.PhasesOnlyFailing, wantOnlyFailing)
+	}
+	wantOnlyPassing := []string{"Backup: Completed", "Backup: WaitingForPluginOperations", "Restore: Completed"}
+	if !reflect.DeepEqual(result.PhasesOnlyPassing, wantOnlyPassing) {
+		t.Errorf("PhasesOnlyPassing = %v, want %v", result.PhasesOnlyPassing, wantOnlyPassing)
+	}
+
+	foundDelta := false
+	for _, delta := range result.PhaseDeltas {
+		if delta.Kind == oadp.Backup && delta.Phase == "WaitingForPluginOperationsPartiallyFailed" {
+			foundDelta = true
+			if delta.Failing != 2*time.Minute || delta.Passing != 0 || delta.Delta != 2*time.Minute {
+				t.Errorf("Unexpected WaitingForPluginOperationsPartiallyFailed durations %+v", delta)
+			}
+		}
+	}
+	if !foundDelta {
+		t.Errorf("Expected the time spent waiting for plugin operations in the phase deltas")
+	}
+
+	foundFailure := false
+	for _, line := range result.Lines {
+		if line.Op == Equal && strings.Contains(line.Line, "backup phase: PartiallyFailed") {
+			t.Errorf("The failed backup phase should not be common to both attempts")
+		}
+		if line.Op == OnlyFailing && strings.Contains(line.Line, "backup phase: PartiallyFailed") {
+			foundFailure = true
+		}
+	}
+	if !foundFailure {
+		t.Errorf("Expected the failed backup phase only in the failing attempt")
+	}
+}
@@ -0,0 +1,383 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dump saves the logs of a run to a folder, laid out as
+//
+//	index.json
+//	index.html
+//	<suite>/<test>/attempt-<N>/attempt.log
+//	                           setup.log
+//	                           teardown.log
+//	                           failure.log
+//	                           events.json
+//
+// The setup, teardown, failure and events files are only written when the
+// attempt has some.
+package dump
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// The files of an attempt
+const (
+	AttemptFile  = "attempt.log"
+	SetupFile    = "setup.log"
+	TeardownFile = "teardown.log"
+	FailureFile  = "failure.log"
+	EventsFile   = "events.json"
+)
+
+// The index files of the dump
+const (
+	IndexFile     = "index.json"
+	IndexHTMLFile = "index.html"
+)
+
+const (
+	dirPerm  = 0750
+	filePerm = 0640
+	// maxNameLength bounds the file names, far below the 255 bytes of most filesystems
+	maxNameLength = 80
+	// hashLength is the number of hexadecimal digits of the hashes added to the names
+	hashLength = 10
+	// maxFailureLines bounds a failure detail without its location line
+	maxFailureLines = 200
+)
+
+var (
+	// unsafeCharsRegex are the characters replaced in the file names
+	unsafeCharsRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+	// teardownEnterRegex and teardownExitRegex delimit the teardown nodes run after a spec
+	teardownEnterRegex = regexp.MustCompile(`> Enter \[(AfterEach|JustAfterEach|AfterAll|DeferCleanup)[^\]]*\]`)
+	teardownExitRegex  = regexp.MustCompile(`< Exit \[(AfterEach|JustAfterEach|AfterAll|DeferCleanup)[^\]]*\]`)
+	// failureRegex starts the failure detail printed by Ginkgo
+	failureRegex = regexp.MustCompile(`^\s*\[(FAILED|PANICKED|TIMEDOUT|INTERRUPTED)\]`)
+	// failureLocationRegex ends a failure detail
+	failureLocationRegex = regexp.MustCompile(`^\s*In \[[^\]]+\] at:`)
+	// nodeRegex is the entry or exit of a Ginkgo node, which ends a failure detail
+	nodeRegex = regexp.MustCompile(`^\s*[<>] (Enter|Exit) \[`)
+)
+
+// Options are the settings of a dump
+type Options struct {
+	// Gzip compresses the files of the attempts, adding .gz to their names
+	Gzip bool
+}
+
+// Index lists the tests and the files of a dump
+type Index struct {
+	Tests []Test `json:"tests"`
+}
+
+// Test is a test of the index
+type Test struct {
+	Name      string `json:"name"`
+	ShortName string `json:"shortName"`
+	Suite     string `json:"suite,omitempty"`
+	Verdict   string `json:"verdict"`
+	// Path is the folder of the test, relative to the dump folder
+	Path     string    `json:"path"`
+	Attempts []Attempt `json:"attempts"`
+}
+
+// Attempt is an attempt of the index
+type Attempt struct {
+	Number   int     `json:"number"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"durationSeconds"`
+	// Path is the folder of the attempt, relative to the dump folder
+	Path string `json:"path"`
+	// Files are the files of the attempt, relative to the dump folder
+	Files  []string `json:"files"`
+	Events int      `json:"events,omitempty"`
+}
+
+// Write saves the logs of every attempt of a run, with an index of the files.
+//
+// Parameters:
+//   - testData: the parsed run, with its Velero events.
+//   - folder: the destination, created when missing.
+//   - opts: the dump settings.
+//
+// Returns:
+//   - *Index of the files written, also saved as index.json and index.html.
+//   - error if a file could not be written.
+func Write(testData *utils.TestRunData, folder string, opts Options) (*Index, error) {
+	if err := os.MkdirAll(folder, dirPerm); err != nil {
+		return nil, fmt.Errorf("error creating dir: %v", err)
+	}
+
+	index := &Index{Tests: []Test{}}
+	suites := newNamer()
+	tests := map[string]*namer{}
+	for i := range testData.TestRun {
+		thisTest := &testData.TestRun[i]
+		suiteName := "no-suite"
+		if thisTest.Suite != "" {
+			suiteName = filepath.Base(thisTest.Suite)
+		}
+		suiteDir := suites.name(thisTest.Suite, suiteName)
+		if tests[suiteDir] == nil {
+			tests[suiteDir] = newNamer()
+		}
+		entry := Test{
+			Name:      thisTest.Name,
+			ShortName: thisTest.ShortName,
+			Suite:     thisTest.Suite,
+			Verdict:   thisTest.Verdict(),
+			Path:      path.Join(suiteDir, tests[suiteDir].name(thisTest.Name, thisTest.ShortName)),
+		}
+		for j := range thisTest.Attempt {
+			attempt, err := writeAttempt(folder, entry.Path, &thisTest.Attempt[j], opts)
+			if err != nil {
+				return nil, err
+			}
+			entry.Attempts = append(entry.Attempts, attempt)
+		}
+		index.Tests = append(index.Tests, entry)
+	}
+
+	if err := writeIndex(folder, index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// writeAttempt saves the files of an attempt in the attempt-N folder of its test
+func writeAttempt(folder, testPath string, thisAttempt *utils.AttemptData, opts Options) (Attempt, error) {
+	attempt := Attempt{
+		Number:   thisAttempt.AttemptNo,
+		Status:   thisAttempt.Status.Status,
+		Duration: thisAttempt.Duration.Seconds(),
+		Path:     path.Join(testPath, fmt.Sprintf("attempt-%d", thisAttempt.AttemptNo)),
+		Events:   len(thisAttempt.Events),
+	}
+	if attempt.Status == "" {
+		attempt.Status = utils.Passed
+	}
+	if err := os.MkdirAll(filepath.Join(folder, filepath.FromSlash(attempt.Path)), dirPerm); err != nil {
+		return attempt, fmt.Errorf("error creating dir: %v", err)
+	}
+
+	files := []struct {
+		name  string
+		lines []string
+	}{
+		{AttemptFile, thisAttempt.Logs},
+		{SetupFile, thisAttempt.SetupLogs},
+		{TeardownFile, TeardownLogs(thisAttempt.Logs)},
+		{FailureFile, FailureDetails(thisAttempt.Logs)},
+	}
+	for _, file := range files {
+		if len(file.lines) == 0 && file.name != AttemptFile {
+			continue
+		}
+		name, err := writeFile(folder, path.Join(attempt.Path, file.name), opts, func(w io.Writer) error {
+			return writeLines(w, file.lines)
+		})
+		if err != nil {
+			return attempt, err
+		}
+		attempt.Files = append(attempt.Files, name)
+	}
+
+	if len(thisAttempt.Events) > 0 {
+		name, err := writeFile(folder, path.Join(attempt.Path, EventsFile), opts, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(thisAttempt.Events)
+		})
+		if err != nil {
+			return attempt, err
+		}
+		attempt.Files = append(attempt.Files, name)
+	}
+	return attempt, nil
+}
+
+// writeFile creates a file of the dump, compressed with the gzip option, and
+// returns its name relative to the dump folder
+func writeFile(folder, name string, opts Options, write func(w io.Writer) error) (string, error) {
+	if opts.Gzip {
+		name += ".gz"
+	}
+	file, err := os.OpenFile(filepath.Join(folder, filepath.FromSlash(name)), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filePerm)
+	if err != nil {
+		return "", fmt.Errorf("error creating log file: %v", err)
+	}
+	defer file.Close()
+
+	var w io.Writer = file
+	var compressor *gzip.Writer
+	if opts.Gzip {
+		compressor = gzip.NewWriter(file)
+		w = compressor
+	}
+	if err := write(w); err != nil {
+		return "", fmt.Errorf("error writing %s: %v", name, err)
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return "", fmt.Errorf("error writing %s: %v", name, err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("error writing %s: %v", name, err)
+	}
+	return name, nil
+}
+
+func writeLines(w io.Writer, lines []string) error {
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeIndex saves the index as JSON and HTML
+func writeIndex(folder string, index *Index) error {
+	if _, err := writeFile(folder, IndexFile, Options{}, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(index)
+	}); err != nil {
+		return err
+	}
+	_, err := writeFile(folder, IndexHTMLFile, Options{}, func(w io.Writer) error {
+		return indexTemplate.Execute(w, index)
+	})
+	return err
+}
+
+// TeardownLogs returns the lines of the teardown nodes of an attempt,
+// AfterEach for example
+func TeardownLogs(logs []string) []string {
+	var teardown []string
+	inTeardown := false
+	for _, line := range logs {
+		if teardownEnterRegex.MatchString(line) {
+			inTeardown = true
+		}
+		if inTeardown {
+			teardown = append(teardown, line)
+			inTeardown = !teardownExitRegex.MatchString(line)
+		}
+	}
+	return teardown
+}
+
+// FailureDetails returns the failures reported by Ginkgo in the logs of an
+// attempt, from the [FAILED] line to the location of the failure, separated
+// by empty lines
+func FailureDetails(logs []string) []string {
+	var details []string
+	inFailure, lines := false, 0
+	for _, line := range logs {
+		switch {
+		case failureRegex.MatchString(line):
+			if len(details) > 0 {
+				details = append(details, "")
+			}
+			inFailure, lines = true, 0
+		case !inFailure:
+			continue
+		case nodeRegex.MatchString(line) || lines >= maxFailureLines:
+			inFailure = false
+			continue
+		}
+		details = append(details, line)
+		lines++
+		if failureLocationRegex.MatchString(line) {
+			inFailure = false
+		}
+	}
+	return details
+}
+
+// SafeName returns a file name made of the letters, digits, dots, dashes and
+// underscores of a name, the other characters are replaced by underscores.
+// A hash of the name is added when it is too long, or has no such character.
+func SafeName(name string) string {
+	safe := strings.Trim(unsafeCharsRegex.ReplaceAllString(name, "_"), "._-")
+	if safe != "" && len(safe) <= maxNameLength {
+		return safe
+	}
+	if safe == "" {
+		return hashOf(name)
+	}
+	return withSuffix(safe, hashOf(name))
+}
+
+func hashOf(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])[:hashLength]
+}
+
+// namer gives distinct file names to the entries of a folder
+type namer struct {
+	// keys are the entries using each name
+	keys map[string]string
+	// names are the names given to each entry
+	names map[string]string
+}
+
+func newNamer() *namer {
+	return &namer{keys: map[string]string{}, names: map[string]string{}}
+}
+
+// name returns the file name of an entry, the safe name of its text followed
+// by a hash of its key when another entry has the same safe name
+func (n *namer) name(key, text string) string {
+	if name, found := n.names[key]; found {
+		return name
+	}
+	base := SafeName(text)
+	name := base
+	for i := 0; n.keys[name] != ""; i++ {
+		seed := key
+		if i > 0 {
+			seed = fmt.Sprintf("%s#%d", key, i)
+		}
+		name = withSuffix(base, hashOf(seed))
+	}
+	n.keys[name] = key
+	n.names[key] = name
+	return name
+}
+
+// withSuffix adds a suffix to a safe name, shortening the name to keep it
+// under the maximum length
+func withSuffix(name, suffix string) string {
+	if len(name)+len(suffix)+1 > maxNameLength {
+		name = strings.TrimRight(name[:maxNameLength-len(suffix)-1], "._-")
+	}
+	return name + "-" + suffix
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dump
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/oadp"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+func TestSafeName(t *testing.T) {
+	long := strings.Repeat("Backup and restore ", 10)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "MySQL application CSI", want: "MySQL_application_CSI"},
+		{name: "../../etc/passwd", want: "etc_passwd"},
+		{name: "Default velero CR, test carriage return", want: "Default_velero_CR_test_carriage_return"},
+		{name: "example.com/backup.TestRun", want: "example.com_backup.TestRun"},
+		{name: "日本", want: hashOf("日本")},
+		{name: long, want: strings.Repeat("Backup_and_restore_", 3) + "Backup_and_r-" + hashOf(long)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SafeName(tt.name)
+			if got != tt.want {
+				t.Errorf("SafeName() = %s, want %s", got, tt.want)
+			}
+			if len(got) > maxNameLength {
+				t.Errorf("SafeName() is %d bytes long", len(got))
+			}
+		})
+	}
+
+	names := newNamer()
+	first, second := names.name("a_test.go:10", "Should succeed"), names.name("a_test.go:20", "Should succeed")
+	if first != "Should_succeed" || second != "Should_succeed-"+hashOf("a_test.go:20") || names.name("a_test.go:10", "Should succeed") != first {
+		t.Errorf("namer gave %s and %s", first, second)
+	}
+}
+
+func TestNodeLogs(t *testing.T) {
+	logs := []string{
+		"  > Enter [It] Backup - /test.go:20 @ 02/14/24 12:00:01.000",
+		"2024/02/14 12:00:02 Creating backup",
+		"  [FAILED] Expected",
+		"      <bool>: false",
+		"  to be true",
+		"  In [It] at: /test.go:25 @ 02/14/24 12:00:05.000",
+		"  < Exit [It] Backup - /test.go:20 @ 02/14/24 12:00:05.000 (4s)",
+		"  > Enter [AfterEach] Backup - /test.go:30 @ 02/14/24 12:00:05.000",
+		"2024/02/14 12:00:05 Deleting backup",
+		"  [PANICKED] Test Panicked",
+		"  < Exit [AfterEach] Backup - /test.go:30 @ 02/14/24 12:00:06.000 (1s)",
+		"  > Enter [DeferCleanup (Each)] Backup - /test.go:35 @ 02/14/24 12:00:06.000",
+		"  < Exit [DeferCleanup (Each)] Backup - /test.go:35 @ 02/14/24 12:00:06.000 (0s)",
+		"------------------------------",
+	}
+
+	wantFailures := []string{
+		"  [FAILED] Expected",
+		"      <bool>: false",
+		"  to be true",
+		"  In [It] at: /test.go:25 @ 02/14/24 12:00:05.000",
+		"",
+		"  [PANICKED] Test Panicked",
+	}
+	if got := FailureDetails(logs); !reflect.DeepEqual(got, wantFailures) {
+		t.Errorf("FailureDetails() = %q, want %q", got, wantFailures)
+	}
+	if got := TeardownLogs(logs); !reflect.DeepEqual(got, logs[7:13]) {
+		t.Errorf("TeardownLogs() = %q, want %q", got, logs[7:13])
+	}
+}
+
+func TestWrite(t *testing.T) {
+	run := fixture.Parse(t)
+	oadp.SetEventsFromTestRun(run)
+
+	for _, compress := range []bool{false, true} {
+		folder := t.TempDir()
+		index, err := Write(run, folder, Options{Gzip: compress})
+		if err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if len(index.Tests) != len(run.TestRun) {
+			t.Fatalf("Write() indexed %d tests, want %d", len(index.Tests), len(run.TestRun))
+		}
+
+		paths := map[string]bool{}
+		var failed *Test
+		for i := range index.Tests {
+			test := &index.Tests[i]
+			if paths[test.Path] {
+				t.Errorf("Write() used %s twice", test.Path)
+			}
+			paths[test.Path] = true
+			if test.ShortName == "MySQL application two Vol CSI" {
+				failed = test
+			}
+			for _, attempt := range test.Attempts {
+				for _, name := range attempt.Files {
+					if _, err := os.Stat(filepath.Join(folder, name)); err != nil {
+						t.Errorf("Write() indexed a missing file: %v", err)
+					}
+				}
+			}
+		}
+		if failed == nil || len(failed.Attempts) != 3 || failed.Path != "backup_restore_suite_test.go/MySQL_application_two_Vol_CSI" {
+			t.Fatalf("Write() indexed the failed test as %+v", failed)
+		}
+
+		suffix := ""
+		if compress {
+			suffix = ".gz"
+		}
+		attempt := failed.Attempts[2]
+		wantFiles := []string{AttemptFile + suffix, TeardownFile + suffix, FailureFile + suffix}
+		var gotFiles []string
+		for _, name := range attempt.Files {
+			gotFiles = append(gotFiles, filepath.Base(name))
+		}
+		if attempt.Status != utils.Failed || !reflect.DeepEqual(gotFiles, wantFiles) {
+			t.Errorf("Write() attempt %s with %v, want %s with %v", attempt.Status, gotFiles, utils.Failed, wantFiles)
+		}
+
+		failure := readFile(t, filepath.Join(folder, attempt.Path, FailureFile+suffix), compress)
+		if !strings.HasPrefix(failure, "  [FAILED] No known FLAKE found") || !strings.Contains(failure, "In [It] at:") {
+			t.Errorf("Write() saved the failure %q", failure)
+		}
+
+		var saved Index
+		if err := json.Unmarshal([]byte(readFile(t, filepath.Join(folder, IndexFile), false)), &saved); err != nil {
+			t.Fatalf("Error reading the index: %v", err)
+		}
+		if !reflect.DeepEqual(&saved, index) {
+			t.Errorf("Write() saved a different index")
+		}
+		if html := readFile(t, filepath.Join(folder, IndexHTMLFile), false); !strings.Contains(html, `href="`+attempt.Files[2]+`"`) {
+			t.Errorf("index.html does not link %s", attempt.Files[2])
+		}
+	}
+}
+
+func readFile(t *testing.T, name string, compressed bool) string {
+	t.Helper()
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("Error opening %s: %v", name, err)
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if compressed {
+		if r, err = gzip.NewReader(file); err != nil {
+			t.Fatalf("Error reading %s: %v", name, err)
+		}
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v", name, err)
+	}
+	return string(content)
+}
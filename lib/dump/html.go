@@ -0,0 +1,61 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dump
+
+import (
+	"html/template"
+	"path"
+)
+
+// indexTemplate is the index.html page, linking the files of every attempt
+var indexTemplate = template.Must(template.New(IndexHTMLFile).Funcs(template.FuncMap{
+	"base": path.Base,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Test logs</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+.FAILED { color: #b00; }
+.FLAKY { color: #b60; }
+.PASSED { color: #070; }
+</style>
+</head>
+<body>
+<h1>Test logs</h1>
+<table>
+<tr><th>Test</th><th>Suite</th><th>Verdict</th><th>Attempts</th></tr>
+{{- range .Tests}}
+<tr>
+<td title="{{.Name}}">{{.ShortName}}</td>
+<td>{{base .Suite}}</td>
+<td class="{{.Verdict}}">{{.Verdict}}</td>
+<td>
+{{- range .Attempts}}
+<div>#{{.Number}} <span class="{{.Status}}">{{.Status}}</span> {{printf "%.1fs" .Duration}}:
+{{- range .Files}} <a href="{{.}}">{{base .}}</a>{{end}}</div>
+{{- end}}
+</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
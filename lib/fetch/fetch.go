@@ -0,0 +1,291 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fetch downloads the logs and artifacts over HTTP
+package fetch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults of the fetcher options
+const (
+	DefaultTimeout    = 2 * time.Minute
+	DefaultRetries    = 3
+	DefaultBackoff    = time.Second
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// HTTPClient sends the requests, *http.Client implements it
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Getter downloads the content of a URL
+type Getter interface {
+	Get(location string) ([]byte, error)
+}
+
+// StatusError is returned for the responses without a 2xx status
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("error opening URL %s: %s", e.URL, e.Status)
+}
+
+// Options configure a Fetcher, zero durations use the defaults
+type Options struct {
+	Timeout    time.Duration // of each attempt, including reading the body
+	Retries    int           // attempts after the first one, on network errors and 5xx responses, 0 disables them
+	Backoff    time.Duration // wait before the first retry, doubled on each retry
+	MaxBackoff time.Duration
+	ProxyURL   string // overrides the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables
+	CABundle   string // PEM file with extra trusted certificate authorities
+	Client     HTTPClient
+}
+
+// Fetcher sends the requests with timeouts and retries
+type Fetcher struct {
+	client     HTTPClient
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	sleep      func(ctx context.Context, d time.Duration) error
+}
+
+// New returns a Fetcher for the options
+//
+// Parameters:
+//   - opts: the timeouts, retries and transport settings, see Options.
+//
+// Returns:
+//   - *Fetcher sending the requests.
+//   - error if the proxy URL or the CA bundle is invalid.
+func New(opts Options) (*Fetcher, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.MaxBackoff == 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+
+	client := opts.Client
+	if client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if opts.ProxyURL != "" {
+			proxy, err := url.Parse(opts.ProxyURL)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing proxy URL: %v", err)
+			}
+			transport.Proxy = http.ProxyURL(proxy)
+		}
+		if opts.CABundle != "" {
+			pool, err := loadCABundle(opts.CABundle)
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		}
+		client = &http.Client{Transport: transport, Timeout: opts.Timeout}
+	}
+
+	return &Fetcher{
+		client:     client,
+		retries:    opts.Retries,
+		backoff:    opts.Backoff,
+		maxBackoff: opts.MaxBackoff,
+		sleep:      sleep,
+	}, nil
+}
+
+// sleep waits for a duration, or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path) // #nosec G304 -- the file is given by the user
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA bundle: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("error reading CA bundle: no certificate found in %s", path)
+	}
+	return pool, nil
+}
+
+// Do sends a request without body, retrying on network errors and 5xx responses.
+// The other responses are returned as they are, the caller checks their status.
+func (f *Fetcher) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		return nil, errors.New("error sending request: only requests without body can be retried")
+	}
+
+	wait := f.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := f.client.Do(req.Clone(req.Context()))
+		retryable := err != nil || resp.StatusCode >= http.StatusInternalServerError
+		if !retryable || attempt >= f.retries || req.Context().Err() != nil {
+			if err != nil {
+				return nil, fmt.Errorf("error opening URL: %v", err)
+			}
+			return resp, nil
+		}
+
+		if err == nil {
+			// Drain the body so the connection is reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		log.WithFields(log.Fields{
+			"url":     req.URL.String(),
+			"attempt": attempt + 1,
+			"wait":    wait,
+		}).Debug("Retrying request")
+		if err := f.sleep(req.Context(), wait); err != nil {
+			return nil, fmt.Errorf("error opening URL: %v", err)
+		}
+		wait *= 2
+		if wait > f.maxBackoff {
+			wait = f.maxBackoff
+		}
+	}
+}
+
+// Get downloads the content of a URL, gzip content is decompressed.
+//
+// Returns:
+//   - []byte with the content of the URL.
+//   - error, a *StatusError for the responses without a 2xx status.
+func (f *Fetcher) Get(location string) ([]byte, error) {
+	return f.GetContext(context.Background(), location)
+}
+
+// GetContext is Get, stopping the download and the retries when the context is done
+func (f *Fetcher) GetContext(ctx context.Context, location string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("error opening URL: %v", err)
+	}
+	resp, err := f.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, &StatusError{URL: location, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading HTTP response body: %v", err)
+	}
+	return Decode(body)
+}
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Decode decompresses gzip content, GCS serves some artifacts gzipped without
+// Content-Encoding, and returns the other content unchanged.
+func Decode(body []byte) ([]byte, error) {
+	if !bytes.HasPrefix(body, gzipMagic) {
+		return body, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error reading gzip content: %v", err)
+	}
+	defer reader.Close()
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading gzip content: %v", err)
+	}
+	return decoded, nil
+}
+
+// IsRemote returns whether the location is an HTTP URL
+func IsRemote(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+var (
+	defaultMu      sync.RWMutex
+	defaultFetcher *Fetcher
+)
+
+// Default returns the fetcher used by the package level helpers, see SetDefault
+func Default() *Fetcher {
+	defaultMu.RLock()
+	fetcher := defaultFetcher
+	defaultMu.RUnlock()
+	if fetcher != nil {
+		return fetcher
+	}
+
+	// The default options are always valid
+	fetcher, _ = New(Options{Retries: DefaultRetries})
+	defaultMu.Lock()
+	if defaultFetcher == nil {
+		defaultFetcher = fetcher
+	}
+	fetcher = defaultFetcher
+	defaultMu.Unlock()
+	return fetcher
+}
+
+// SetDefault replaces the fetcher used by the package level helpers
+func SetDefault(fetcher *Fetcher) {
+	defaultMu.Lock()
+	defaultFetcher = fetcher
+	defaultMu.Unlock()
+}
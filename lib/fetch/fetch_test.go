@@ -0,0 +1,246 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fetch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const logLine = "2024/02/14 12:39:51 Backup phase: Completed\n"
+
+func gzipped(t *testing.T, content string) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		t.Fatalf("Error compressing: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Error compressing: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// newFetcher returns a fetcher that does not wait between the retries
+func newFetcher(t *testing.T, opts Options) (*Fetcher, *[]time.Duration) {
+	fetcher, err := New(opts)
+	if err != nil {
+		t.Fatalf("Error creating fetcher: %v", err)
+	}
+	var waits []time.Duration
+	fetcher.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return fetcher, &waits
+}
+
+func TestGet(t *testing.T) {
+	var flakyCalls, missingCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/build-log.txt":
+			_, _ = w.Write([]byte(logLine))
+		case "/build-log.txt.gz":
+			_, _ = w.Write(gzipped(t, logLine))
+		case "/flaky":
+			if atomic.AddInt32(&flakyCalls, 1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(logLine))
+		case "/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			atomic.AddInt32(&missingCalls, 1)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		want       string
+		wantStatus int
+		wantWaits  []time.Duration
+	}{
+		{name: "Plain log", path: "/build-log.txt", want: logLine},
+		{name: "Gzip log", path: "/build-log.txt.gz", want: logLine},
+		{name: "Retries on 5xx", path: "/flaky", want: logLine, wantWaits: []time.Duration{time.Second, 2 * time.Second}},
+		{name: "Gives up on 5xx", path: "/down", wantStatus: http.StatusServiceUnavailable, wantWaits: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+		{name: "No retry on 404", path: "/missing", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher, waits := newFetcher(t, Options{Retries: DefaultRetries, MaxBackoff: 3 * time.Second})
+			got, err := fetcher.Get(server.URL + tt.path)
+
+			var statusErr *StatusError
+			if tt.wantStatus != 0 {
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus {
+					t.Fatalf("Expected a %d StatusError, got %v", tt.wantStatus, err)
+				}
+			} else if err != nil || string(got) != tt.want {
+				t.Fatalf("Get() = %q, %v, want %q", got, err, tt.want)
+			}
+			if len(*waits) != len(tt.wantWaits) {
+				t.Fatalf("waits = %v, want %v", *waits, tt.wantWaits)
+			}
+			for i := range tt.wantWaits {
+				if (*waits)[i] != tt.wantWaits[i] {
+					t.Errorf("waits = %v, want %v", *waits, tt.wantWaits)
+				}
+			}
+		})
+	}
+	if missingCalls != 1 {
+		t.Errorf("Expected a single request for a 404, got %d", missingCalls)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	fetcher, waits := newFetcher(t, Options{Timeout: 50 * time.Millisecond, Retries: 1})
+	if _, err := fetcher.Get(server.URL); err == nil {
+		t.Fatalf("Expected a timeout error")
+	}
+	if len(*waits) != 1 {
+		t.Errorf("Expected the timeout to be retried once, got %v", *waits)
+	}
+}
+
+func TestRetriesAndCancel(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	withoutRetries, waits := newFetcher(t, Options{})
+	if _, err := withoutRetries.Get(server.URL); err == nil {
+		t.Fatalf("Expected a 503 error")
+	}
+	if calls != 1 || len(*waits) != 0 {
+		t.Errorf("Expected a single request without retries, got %d requests and waits %v", calls, *waits)
+	}
+
+	// the backoff is cut short by the cancellation of the request
+	fetcher, err := New(Options{Retries: 1, Backoff: time.Hour})
+	if err != nil {
+		t.Fatalf("Error creating fetcher: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, http.NoBody)
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+	start := time.Now()
+	if _, err := fetcher.Do(req); err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("Do() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Do() waited %v after the cancellation", elapsed)
+	}
+}
+
+type fakeClient struct {
+	requests []string
+}
+
+func (c *fakeClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests = append(c.requests, req.URL.String())
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Body:       http.NoBody,
+	}, nil
+}
+
+func TestInjectedClient(t *testing.T) {
+	client := &fakeClient{}
+	fetcher, _ := newFetcher(t, Options{Client: client})
+	if _, err := fetcher.Get("https://example.com/build-log.txt"); err != nil {
+		t.Fatalf("Error fetching: %v", err)
+	}
+	if len(client.requests) != 1 || client.requests[0] != "https://example.com/build-log.txt" {
+		t.Errorf("Expected the request to go through the injected client, got %v", client.requests)
+	}
+}
+
+func TestProxyAndCABundle(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(logLine))
+	}))
+	defer tlsServer.Close()
+
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+	if err := os.WriteFile(caBundle, certificate, 0o600); err != nil {
+		t.Fatalf("Error writing CA bundle: %v", err)
+	}
+
+	withoutCA, _ := newFetcher(t, Options{})
+	if _, err := withoutCA.Get(tlsServer.URL); err == nil {
+		t.Errorf("Expected an unknown authority error without the CA bundle")
+	}
+	withCA, _ := newFetcher(t, Options{CABundle: caBundle})
+	if got, err := withCA.Get(tlsServer.URL); err != nil || string(got) != logLine {
+		t.Errorf("Get() with the CA bundle = %q, %v", got, err)
+	}
+	if _, err := New(Options{CABundle: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Errorf("Expected an error for a missing CA bundle")
+	}
+
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		_, _ = w.Write([]byte("through the proxy\n"))
+	}))
+	defer proxy.Close()
+
+	viaProxy, _ := newFetcher(t, Options{ProxyURL: proxy.URL})
+	got, err := viaProxy.Get("http://gcsweb.invalid/build-log.txt")
+	if err != nil || !strings.HasPrefix(string(got), "through the proxy") {
+		t.Fatalf("Get() through the proxy = %q, %v", got, err)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://gcsweb.invalid/build-log.txt" {
+		t.Errorf("Expected the proxy to receive the request, got %v", proxied)
+	}
+}
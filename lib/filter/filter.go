@@ -0,0 +1,325 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package filter selects the tests of a run with expressions such as
+//
+//	status=failed|flaky suite=backup_restore_suite_test.go name~CSI duration>5m
+//
+// The terms of an expression are separated by spaces and must all match.
+// A term is a field, an operator and a value, quoted when it has spaces:
+//
+//   - name: the short or full name of the test.
+//   - status: the verdict of the test, one of failed, flaky, passed or skipped.
+//   - suite: the source file of a Ginkgo spec, its path or file name, the package of a go test.
+//   - label: one of the Ginkgo labels of the spec.
+//   - focus: the texts of the containers and of the spec, as matched by ginkgo --focus.
+//   - duration: the total duration of the attempts, for example 5m.
+//   - attempts: the number of attempts.
+//
+// The text fields support = and != with alternatives separated by |, and
+// the ~ and !~ regular expression matches. The numbers support =, !=, <,
+// <=, > and >=.
+package filter
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// The fields of the terms
+const (
+	FieldName     = "name"
+	FieldStatus   = "status"
+	FieldSuite    = "suite"
+	FieldLabel    = "label"
+	FieldFocus    = "focus"
+	FieldDuration = "duration"
+	FieldAttempts = "attempts"
+)
+
+// operators are sorted so the two characters ones are found first
+var operators = []string{"!=", "!~", "<=", ">=", "=", "~", "<", ">"}
+
+// statuses maps the status values to the verdicts
+var statuses = map[string]string{
+	"failed":  utils.Failed,
+	"flaky":   utils.Flaky,
+	"passed":  utils.Passed,
+	"skipped": utils.Skipped,
+}
+
+// SyntaxError is returned for an invalid term
+type SyntaxError struct {
+	Term   string
+	Reason string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid filter %q: %s", e.Term, e.Reason)
+}
+
+// Filter matches the tests matching all its terms
+type Filter struct {
+	expression string
+	terms      []term
+}
+
+type term struct {
+	field    string
+	operator string
+	// values are the alternatives of = and !=
+	values  []string
+	pattern *regexp.Regexp
+	number  int64
+}
+
+// Parse compiles a filter expression, an empty expression matches every test.
+//
+// Parameters:
+//   - expression: the terms separated by spaces.
+//
+// Returns:
+//   - *Filter to apply to the runs.
+//   - *SyntaxError for an unknown field or operator, or an invalid value.
+func Parse(expression string) (*Filter, error) {
+	tokens, err := split(expression)
+	if err != nil {
+		return nil, err
+	}
+	filter := &Filter{expression: strings.TrimSpace(expression)}
+	for _, token := range tokens {
+		parsed, err := parseTerm(token)
+		if err != nil {
+			return nil, err
+		}
+		filter.terms = append(filter.terms, parsed)
+	}
+	return filter, nil
+}
+
+// split splits an expression on the spaces outside quotes, removing the quotes
+func split(expression string) ([]string, error) {
+	var (
+		tokens  []string
+		current strings.Builder
+		quote   rune
+		inToken bool
+	)
+	for _, char := range expression {
+		switch {
+		case quote != 0 && char == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(char)
+		case char == '"' || char == '\'':
+			quote, inToken = char, true
+		case char == ' ' || char == '\t' || char == '\n':
+			if inToken {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteRune(char)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, &SyntaxError{Term: expression, Reason: "unterminated quote"}
+	}
+	if inToken {
+		tokens = append(tokens, current.String())
+	}
+	return tokens, nil
+}
+
+func parseTerm(token string) (term, error) {
+	end := 0
+	for end < len(token) && token[end] >= 'a' && token[end] <= 'z' {
+		end++
+	}
+	parsed := term{field: token[:end]}
+	for _, operator := range operators {
+		if strings.HasPrefix(token[end:], operator) {
+			parsed.operator = operator
+			break
+		}
+	}
+	if parsed.field == "" || parsed.operator == "" {
+		return parsed, &SyntaxError{Term: token, Reason: "expected a field, an operator and a value"}
+	}
+	value := token[end+len(parsed.operator):]
+	if value == "" {
+		return parsed, &SyntaxError{Term: token, Reason: "missing value"}
+	}
+
+	switch parsed.field {
+	case FieldName, FieldSuite, FieldLabel, FieldFocus, FieldStatus:
+		switch parsed.operator {
+		case "=", "!=":
+			parsed.values = strings.Split(value, "|")
+		case "~", "!~":
+			if parsed.field == FieldStatus {
+				return parsed, &SyntaxError{Term: token, Reason: "status only supports = and !="}
+			}
+			pattern, err := regexp.Compile(value)
+			if err != nil {
+				return parsed, &SyntaxError{Term: token, Reason: err.Error()}
+			}
+			parsed.pattern = pattern
+		default:
+			return parsed, &SyntaxError{Term: token, Reason: parsed.field + " only supports =, !=, ~ and !~"}
+		}
+		if parsed.field == FieldStatus {
+			for i, status := range parsed.values {
+				verdict, found := statuses[strings.ToLower(status)]
+				if !found {
+					return parsed, &SyntaxError{Term: token, Reason: "status must be failed, flaky, passed or skipped"}
+				}
+				parsed.values[i] = verdict
+			}
+		}
+	case FieldDuration:
+		if parsed.operator == "~" || parsed.operator == "!~" {
+			return parsed, &SyntaxError{Term: token, Reason: "duration does not support regular expressions"}
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return parsed, &SyntaxError{Term: token, Reason: err.Error()}
+		}
+		parsed.number = int64(duration)
+	case FieldAttempts:
+		if parsed.operator == "~" || parsed.operator == "!~" {
+			return parsed, &SyntaxError{Term: token, Reason: "attempts does not support regular expressions"}
+		}
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return parsed, &SyntaxError{Term: token, Reason: "attempts must be a number"}
+		}
+		parsed.number = number
+	default:
+		return parsed, &SyntaxError{Term: token, Reason: "unknown field " + parsed.field}
+	}
+	return parsed, nil
+}
+
+// String returns the expression of the filter
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expression
+}
+
+// Empty tells whether the filter matches every test
+func (f *Filter) Empty() bool {
+	return f == nil || len(f.terms) == 0
+}
+
+// Match tells whether a test matches all the terms, a nil filter matches every test
+func (f *Filter) Match(test *utils.IndividualTestRunData) bool {
+	if f == nil {
+		return true
+	}
+	for i := range f.terms {
+		if !f.terms[i].match(test) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns a copy of a run with the matching tests only, the full logs
+// are kept
+func (f *Filter) Apply(testRunData *utils.TestRunData) *utils.TestRunData {
+	if f.Empty() {
+		return testRunData
+	}
+	filtered := &utils.TestRunData{FullLogs: testRunData.FullLogs}
+	for i := range testRunData.TestRun {
+		if f.Match(&testRunData.TestRun[i]) {
+			filtered.TestRun = append(filtered.TestRun, testRunData.TestRun[i])
+		}
+	}
+	return filtered
+}
+
+func (t *term) match(test *utils.IndividualTestRunData) bool {
+	switch t.field {
+	case FieldDuration:
+		var total time.Duration
+		for i := range test.Attempt {
+			total += test.Attempt[i].Duration
+		}
+		return compare(int64(total), t.number, t.operator)
+	case FieldAttempts:
+		return compare(int64(len(test.Attempt)), t.number, t.operator)
+	}
+
+	var candidates []string
+	switch t.field {
+	case FieldName:
+		candidates = []string{test.ShortName, test.Name}
+	case FieldStatus:
+		candidates = []string{test.Verdict()}
+	case FieldSuite:
+		candidates = []string{test.Suite, filepath.Base(test.Suite)}
+		if t.pattern != nil {
+			candidates = candidates[:1]
+		}
+	case FieldLabel:
+		candidates = test.Labels
+	case FieldFocus:
+		candidates = []string{test.FullText()}
+	}
+	matched := false
+	for _, candidate := range candidates {
+		if t.pattern != nil {
+			matched = matched || t.pattern.MatchString(candidate)
+			continue
+		}
+		for _, value := range t.values {
+			matched = matched || candidate == value || (t.field == FieldLabel && strings.EqualFold(candidate, value))
+		}
+	}
+	if t.operator == "!=" || t.operator == "!~" {
+		return !matched
+	}
+	return matched
+}
+
+func compare(value, reference int64, operator string) bool {
+	switch operator {
+	case "=":
+		return value == reference
+	case "!=":
+		return value != reference
+	case "<":
+		return value < reference
+	case "<=":
+		return value <= reference
+	case ">":
+		return value > reference
+	default:
+		return value >= reference
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/migtools/demystifier/internal/fixture"
+)
+
+func TestFilter(t *testing.T) {
+	run := fixture.Parse(t)
+
+	tests := []struct {
+		name       string
+		expression string
+		want       []string
+	}{
+		{
+			name:       "Failed CSI tests",
+			expression: "status=failed name~CSI",
+			want:       []string{"MySQL application two Vol CSI"},
+		},
+		{
+			name:       "Flaky or failed",
+			expression: "status=FLAKY|failed",
+			want:       []string{"MySQL application CSI", "MySQL application two Vol CSI"},
+		},
+		{
+			name:       "Retried tests",
+			expression: "attempts>1",
+			want:       []string{"MySQL application CSI", "MySQL application two Vol CSI"},
+		},
+		{
+			name:       "Suite file name and duration",
+			expression: "suite=subscription_suite_test.go duration>=2m",
+			want:       []string{"HTTPS_PROXY set", "Config unset"},
+		},
+		{
+			name:       "Label",
+			expression: "label=IBMCloud name!~'^AWS'",
+			want:       []string{"unsupportedOverrides should succeed"},
+		},
+		{
+			name:       "Quoted focus",
+			expression: `focus~"Kopia Deletion test Should"`,
+			want:       []string{"Should succeed"},
+		},
+		{
+			name:       "Suite path regular expression and exact name",
+			expression: "suite~must-gather name=/go/src/github.com/openshift/oadp-operator/tests/e2e/must-gather_suite_test.go:76",
+			want:       []string{"Mongo application DATAMOVER"},
+		},
+		{
+			name:       "No match",
+			expression: "status=skipped",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := Parse(tt.expression)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			var got []string
+			for _, test := range filter.Apply(run).TestRun {
+				got = append(got, test.ShortName)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply(%s) = %q, want %q", tt.expression, got, tt.want)
+			}
+		})
+	}
+
+	empty, err := Parse("  ")
+	if err != nil || !empty.Empty() || len(empty.Apply(run).TestRun) != len(run.TestRun) {
+		t.Errorf("Parse() of an empty expression = %v, %v, want a filter matching every test", empty, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"CSI",
+		"name=",
+		"owner=me",
+		"status=broken",
+		"status~fail",
+		"duration>5 minutes",
+		"duration~5m",
+		"attempts>=two",
+		"label>1",
+		"name~(",
+		"name='CSI",
+	}
+	for _, expression := range tests {
+		t.Run(expression, func(t *testing.T) {
+			var syntaxErr *SyntaxError
+			if _, err := Parse(expression); !errors.As(err, &syntaxErr) {
+				t.Errorf("Parse() error = %v, want a syntax error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package flakechecker
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+)
+
+// embeddedPatterns are the default flake patterns, built into the binary so
+// they are found whatever the working directory is
+//
+//go:embed patterns/*.json
+var embeddedPatterns embed.FS
+
+// KnownFlakes checks the input against the built-in flake patterns.
+// It behaves like CheckIfFlakeOccurred with the default patterns directory.
+func KnownFlakes(input string) (flakePatterns []FlakePattern, shouldRetry bool, err error) {
+	patterns, err := loadEmbeddedPatterns()
+	if err != nil {
+		return nil, false, err
+	}
+
+	flakePatterns, shouldRetry = matchPatterns(input, patterns)
+	return flakePatterns, shouldRetry, nil
+}
+
+func loadEmbeddedPatterns() (patterns []FlakePattern, err error) {
+	patternFiles, err := fs.Glob(embeddedPatterns, "patterns/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range patternFiles {
+		patternData, err := embeddedPatterns.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var filePatterns []FlakePattern
+		if err := json.Unmarshal(patternData, &filePatterns); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, filePatterns...)
+	}
+	return patterns, nil
+}
+
+// Patterns returns the flake patterns of a directory, the built-in ones when
+// no directory is given
+func Patterns(patternsDir ...string) ([]FlakePattern, error) {
+	if len(patternsDir) > 0 && patternsDir[0] != "" {
+		return loadPatterns(patternsDir[0])
+	}
+	return loadEmbeddedPatterns()
+}
@@ -0,0 +1,68 @@
+package flakechecker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKnownFlakes(t *testing.T) {
+	onDisk, err := loadPatterns("patterns")
+	if err != nil {
+		t.Fatalf("Error loading patterns: %v", err)
+	}
+	embedded, err := loadEmbeddedPatterns()
+	if err != nil {
+		t.Fatalf("Error loading embedded patterns: %v", err)
+	}
+	if len(embedded) == 0 || len(embedded) != len(onDisk) {
+		t.Fatalf("Expected the %d patterns of the patterns folder, got %d", len(onDisk), len(embedded))
+	}
+
+	tests := []struct {
+		name            string
+		input           string
+		wantPatterns    int
+		wantShouldRetry bool
+	}{
+		{
+			name:            "Known flake",
+			input:           "Error copying image: writing blob: uploading layer chunked: received unexpected HTTP status: 500 Internal Server Error",
+			wantPatterns:    1,
+			wantShouldRetry: true,
+		},
+		{
+			name:         "Error to skip",
+			input:        "received EOF, stopping recv loop",
+			wantPatterns: 1,
+		},
+		{
+			name:  "No flake",
+			input: "Backup phase: Completed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flakes, shouldRetry, err := KnownFlakes(tt.input)
+			if err != nil {
+				t.Fatalf("Error checking flakes: %v", err)
+			}
+			if len(flakes) != tt.wantPatterns || shouldRetry != tt.wantShouldRetry {
+				t.Errorf("KnownFlakes() = %d patterns, shouldRetry %v, want %d, %v", len(flakes), shouldRetry, tt.wantPatterns, tt.wantShouldRetry)
+			}
+		})
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	embedded, err := Patterns()
+	if err != nil {
+		t.Fatalf("Error loading the built-in patterns: %v", err)
+	}
+	fromDir, err := Patterns("patterns")
+	if err != nil {
+		t.Fatalf("Error loading the patterns folder: %v", err)
+	}
+	if len(embedded) == 0 || !reflect.DeepEqual(embedded, fromDir) {
+		t.Errorf("Patterns() = %v, want the patterns folder %v", embedded, fromDir)
+	}
+}
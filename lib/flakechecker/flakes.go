@@ -43,6 +43,13 @@ func CheckIfFlakeOccurred(input string, patternsDir ...string) (flakePatterns []
         return nil, false, err
     }
 
+    flakePatterns, shouldRetry = matchPatterns(input, patterns)
+    return flakePatterns, shouldRetry, nil
+}
+
+// matchPatterns returns the patterns found in the input string, along with a
+// boolean indicating if retry should occur
+func matchPatterns(input string, patterns []FlakePattern) (flakePatterns []FlakePattern, shouldRetry bool) {
     for _, pattern := range patterns {
         if strings.Contains(input, pattern.StringSearchPattern) {
             flakePatterns = append(flakePatterns, pattern)
@@ -51,8 +58,7 @@ func CheckIfFlakeOccurred(input string, patternsDir ...string) (flakePatterns []
             }
         }
     }
-
-    return flakePatterns, shouldRetry, nil
+    return flakePatterns, shouldRetry
 }
 
 // loadPatterns loads flake patterns from JSON files in the specified subfolder.
@@ -0,0 +1,160 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gaps reports where the time went inside a single attempt
+package gaps
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// minPollCount is the number of consecutive identical messages
+// needed before they are treated as a polling loop
+const minPollCount = 2
+
+var timePrefixRegex = regexp.MustCompile(`^\s*\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} `)
+
+// Gap is a period of time in which the attempt did not log anything
+type Gap struct {
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	From     string // last line logged before the gap
+	To       string // first line logged after the gap
+}
+
+// Poll is a message repeated by a waiting loop, collapsed into one entry
+type Poll struct {
+	Message   string
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// TotalWait is the time from the first occurrence of the message
+	// until a different message was logged, summed over all loops
+	TotalWait time.Duration
+}
+
+// Report is the gaps and stalls analysis of a single attempt
+type Report struct {
+	Name        string
+	AttemptNo   int
+	Duration    time.Duration
+	PollingTime time.Duration
+	Gaps        []Gap
+	Polls       []Poll
+}
+
+type timedLine struct {
+	time    time.Time
+	message string
+}
+
+// Analyze builds the gaps and stalls report for an attempt.
+// Only lines carrying their own timestamp are taken into account.
+//
+// Parameters:
+//   - attempt: the attempt to analyze, with LogTimes populated by the parser.
+//   - topN: maximum number of gaps to report, all of them when 0 or less.
+//
+// Returns:
+//   - *Report with the longest silent gaps and the collapsed polling loops,
+//     both sorted from the most to the least time consuming.
+func Analyze(attempt *utils.AttemptData, topN int) *Report {
+	report := &Report{
+		Name:      attempt.Name,
+		AttemptNo: attempt.AttemptNo,
+		Duration:  attempt.Duration,
+	}
+
+	var lines []timedLine
+	for i := range attempt.Logs {
+		if i >= len(attempt.LogTimes) || attempt.LogTimes[i].IsZero() {
+			continue
+		}
+		lines = append(lines, timedLine{
+			time:    attempt.LogTimes[i],
+			message: normalizeMessage(attempt.Logs[i]),
+		})
+	}
+
+	polls := make(map[string]*Poll)
+	var pollOrder []string
+
+	for i := 0; i < len(lines); {
+		j := i + 1
+		for j < len(lines) && lines[j].message == lines[i].message {
+			j++
+		}
+
+		if j-i >= minPollCount {
+			// The loop lasts until something else is logged
+			loopEnd := lines[j-1].time
+			if j < len(lines) {
+				loopEnd = lines[j].time
+			}
+			poll, found := polls[lines[i].message]
+			if !found {
+				poll = &Poll{Message: lines[i].message, FirstSeen: lines[i].time}
+				polls[lines[i].message] = poll
+				pollOrder = append(pollOrder, lines[i].message)
+			}
+			poll.Count += j - i
+			poll.LastSeen = lines[j-1].time
+			poll.TotalWait += loopEnd.Sub(lines[i].time)
+			report.PollingTime += loopEnd.Sub(lines[i].time)
+		}
+
+		// Time between two different messages is a silent gap,
+		// the time between repeated messages belongs to the poll
+		if j < len(lines) {
+			report.Gaps = append(report.Gaps, Gap{
+				Start:    lines[j-1].time,
+				End:      lines[j].time,
+				Duration: lines[j].time.Sub(lines[j-1].time),
+				From:     lines[j-1].message,
+				To:       lines[j].message,
+			})
+		}
+		i = j
+	}
+
+	for _, message := range pollOrder {
+		report.Polls = append(report.Polls, *polls[message])
+	}
+
+	sort.SliceStable(report.Gaps, func(i, j int) bool {
+		return report.Gaps[i].Duration > report.Gaps[j].Duration
+	})
+	if topN > 0 && len(report.Gaps) > topN {
+		report.Gaps = report.Gaps[:topN]
+	}
+
+	sort.SliceStable(report.Polls, func(i, j int) bool {
+		return report.Polls[i].TotalWait > report.Polls[j].TotalWait
+	})
+
+	return report
+}
+
+// normalizeMessage strips the timestamp prefix and surrounding spaces
+func normalizeMessage(line string) string {
+	return strings.TrimSpace(timePrefixRegex.ReplaceAllString(line, ""))
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gaps
+
+import (
+	"testing"
+	"time"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+func TestAnalyze(t *testing.T) {
+	testData := fixture.Parse(t)
+	if got := fixture.CountAttempts(testData); got != fixture.AttemptCount {
+		t.Fatalf("Expected %d attempts, got %d", fixture.AttemptCount, got)
+	}
+
+	var attempt *utils.AttemptData
+	for i := range testData.TestRun {
+		if testData.TestRun[i].ShortName == "MySQL application two Vol CSI" {
+			attempt = &testData.TestRun[i].Attempt[0]
+		}
+	}
+	if attempt == nil {
+		t.Fatal("MySQL application two Vol CSI not found")
+	}
+
+	if len(attempt.LogTimes) != len(attempt.Logs) {
+		t.Fatalf("Expected %d log times, got %d", len(attempt.Logs), len(attempt.LogTimes))
+	}
+
+	report := Analyze(attempt, 3)
+
+	if len(report.Polls) == 0 {
+		t.Fatal("Expected polling loops to be found")
+	}
+	poll := report.Polls[0]
+	if poll.Message != "backup phase: WaitingForPluginOperationsPartiallyFailed" {
+		t.Errorf("Expected the stuck backup to be the longest poll, got %q", poll.Message)
+	}
+	if poll.Count != 27 {
+		t.Errorf("Expected 27 polling messages, got %d", poll.Count)
+	}
+	if poll.TotalWait != 4*time.Minute+30*time.Second {
+		t.Errorf("Expected 4m30s of polling, got %v", poll.TotalWait)
+	}
+
+	if len(report.Gaps) != 3 {
+		t.Fatalf("Expected 3 gaps, got %d", len(report.Gaps))
+	}
+	if report.Gaps[0].Duration != 40*time.Second+732*time.Millisecond {
+		t.Errorf("Expected the longest gap to be 40.732s, got %v", report.Gaps[0].Duration)
+	}
+	for i := 1; i < len(report.Gaps); i++ {
+		if report.Gaps[i].Duration > report.Gaps[i-1].Duration {
+			t.Errorf("Gaps are not sorted: %v after %v", report.Gaps[i].Duration, report.Gaps[i-1].Duration)
+		}
+	}
+}
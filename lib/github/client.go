@@ -0,0 +1,250 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package github composes the analysis of the failed Prow jobs of a pull
+// request and keeps it in a single comment of the pull request
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/migtools/demystifier/lib/fetch"
+)
+
+const (
+	// DefaultAPIURL is the GitHub REST API
+	DefaultAPIURL = "https://api.github.com"
+	// commentsPerPage is the largest page of comments GitHub returns
+	commentsPerPage = 100
+)
+
+// repoRegex is an owner/name repository
+var repoRegex = regexp.MustCompile(`^[A-Za-z0-9-]+/[A-Za-z0-9._-]+$`)
+
+// User is a GitHub account
+type User struct {
+	Login string `json:"login"`
+	// Type is User, or Bot for the GitHub Apps and GitHub Actions
+	Type string `json:"type"`
+}
+
+// botType is the type of the accounts of the GitHub Apps
+const botType = "Bot"
+
+// Comment is a comment of a pull request
+type Comment struct {
+	ID      int64  `json:"id"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+	User    User   `json:"user"`
+}
+
+// API are the calls of the GitHub REST API on the comments of a pull request,
+// *Client implements it
+type API interface {
+	AuthenticatedUser() (*User, error)
+	Comments(repo string, pr int) ([]Comment, error)
+	CreateComment(repo string, pr int, body string) (*Comment, error)
+	UpdateComment(repo string, id int64, body string) (*Comment, error)
+}
+
+// APIError is returned for the responses without a 2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("GitHub API error %d: %s", e.StatusCode, e.Message)
+}
+
+// Client calls the GitHub REST API
+type Client struct {
+	baseURL string
+	token   string
+	client  fetch.HTTPClient
+}
+
+// NewClient returns a client of the API at baseURL, DefaultAPIURL when empty,
+// authenticated with the token when not empty
+func NewClient(baseURL, token string, client fetch.HTTPClient) *Client {
+	if baseURL == "" {
+		baseURL = DefaultAPIURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), token: token, client: client}
+}
+
+// ValidateRepo checks that a repository is given as owner/name
+func ValidateRepo(repo string) error {
+	if !repoRegex.MatchString(repo) {
+		return fmt.Errorf("invalid repository %q, expected owner/name", repo)
+	}
+	return nil
+}
+
+// AuthenticatedUser returns the account of the token
+func (c *Client) AuthenticatedUser() (*User, error) {
+	var user User
+	if err := c.call(http.MethodGet, "/user", nil, &user); err != nil {
+		return nil, fmt.Errorf("error reading the user of the token: %w", err)
+	}
+	return &user, nil
+}
+
+// Comments returns every comment of a pull request, oldest first
+func (c *Client) Comments(repo string, pr int) ([]Comment, error) {
+	var comments []Comment
+	for page := 1; ; page++ {
+		var pageComments []Comment
+		path := fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=%d&page=%d", repo, pr, commentsPerPage, page)
+		if err := c.call(http.MethodGet, path, nil, &pageComments); err != nil {
+			return nil, fmt.Errorf("error listing comments: %v", err)
+		}
+		comments = append(comments, pageComments...)
+		if len(pageComments) < commentsPerPage {
+			return comments, nil
+		}
+	}
+}
+
+// CreateComment adds a comment to a pull request
+func (c *Client) CreateComment(repo string, pr int, body string) (*Comment, error) {
+	var comment Comment
+	if err := c.call(http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/comments", repo, pr), map[string]string{"body": body}, &comment); err != nil {
+		return nil, fmt.Errorf("error creating comment: %v", err)
+	}
+	return &comment, nil
+}
+
+// UpdateComment replaces the body of a comment
+func (c *Client) UpdateComment(repo string, id int64, body string) (*Comment, error) {
+	var comment Comment
+	if err := c.call(http.MethodPatch, "/repos/"+repo+"/issues/comments/"+strconv.FormatInt(id, 10), map[string]string{"body": body}, &comment); err != nil {
+		return nil, fmt.Errorf("error updating comment: %v", err)
+	}
+	return &comment, nil
+}
+
+// call sends a request with a JSON body when in is not nil and decodes the
+// JSON response into out
+func (c *Client) call(method, path string, in, out interface{}) error {
+	body := io.Reader(http.NoBody)
+	if in != nil {
+		content, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(content)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading HTTP response body: %v", err)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(content, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = resp.Status
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: apiErr.Message}
+	}
+	return json.Unmarshal(content, out)
+}
+
+// UpsertComment keeps a single analysis comment on a pull request: the
+// comment holding the Marker written by the user of the token is updated, or
+// created when there is none. The comments of the other users holding the
+// Marker, such as quotes of the analysis, are left alone. The installation
+// tokens of the GitHub Apps, such as the GITHUB_TOKEN of GitHub Actions, are
+// not allowed to read their user, the comments of any bot are updated then.
+//
+// Parameters:
+//   - api: the GitHub API, see NewClient.
+//   - repo: the owner/name of the repository.
+//   - pr: the number of the pull request.
+//   - body: the comment, starting with the Marker, see Compose.
+//
+// Returns:
+//   - *Comment that was written.
+//   - bool true when the comment was created rather than updated.
+//   - error if a call to the API fails.
+func UpsertComment(api API, repo string, pr int, body string) (*Comment, bool, error) {
+	user, err := api.AuthenticatedUser()
+	var apiErr *APIError
+	switch {
+	case err == nil:
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden:
+		user = nil
+	default:
+		return nil, false, err
+	}
+	comments, err := api.Comments(repo, pr)
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range comments {
+		if !strings.Contains(comments[i].Body, Marker) || !writtenBy(&comments[i], user) {
+			continue
+		}
+		if comments[i].Body == body {
+			return &comments[i], false, nil
+		}
+		comment, err := api.UpdateComment(repo, comments[i].ID, body)
+		return comment, false, err
+	}
+	comment, err := api.CreateComment(repo, pr, body)
+	return comment, true, err
+}
+
+// writtenBy returns whether a comment was written by the user of the token,
+// or by a bot when the user is not known
+func writtenBy(comment *Comment, user *User) bool {
+	if user == nil {
+		return comment.User.Type == botType
+	}
+	// GitHub logins are case insensitive
+	return strings.EqualFold(comment.User.Login, user.Login)
+}
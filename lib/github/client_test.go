@@ -0,0 +1,189 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGitHub serves the comments endpoints of the GitHub REST API
+type fakeGitHub struct {
+	mu    sync.Mutex
+	token string
+	login string
+	// installation tokens cannot read their user, their comments are written by a bot
+	installation bool
+	comments     []Comment
+	nextID       int64
+	calls        []string
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, r.Method+" "+r.URL.Path)
+	if r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"message": "Bad credentials"}`)
+		return
+	}
+
+	var request struct {
+		Body string `json:"body"`
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/user" && f.installation:
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/user":
+		_ = json.NewEncoder(w).Encode(User{Login: f.login, Type: "User"})
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/openshift/oadp-operator/issues/1266/comments":
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		start := min((page-1)*perPage, len(f.comments))
+		_ = json.NewEncoder(w).Encode(f.comments[start:min(start+perPage, len(f.comments))])
+	case r.Method == http.MethodPost && r.URL.Path == "/repos/openshift/oadp-operator/issues/1266/comments":
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		f.nextID++
+		comment := Comment{ID: f.nextID, Body: request.Body, HTMLURL: fmt.Sprintf("https://github.example.com/c/%d", f.nextID), User: User{Login: f.login, Type: "User"}}
+		if f.installation {
+			comment.User.Type = botType
+		}
+		f.comments = append(f.comments, comment)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(comment)
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/repos/openshift/oadp-operator/issues/comments/"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/repos/openshift/oadp-operator/issues/comments/"), 10, 64)
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		for i := range f.comments {
+			if f.comments[i].ID == id {
+				f.comments[i].Body = request.Body
+				_ = json.NewEncoder(w).Encode(f.comments[i])
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	}
+}
+
+func TestUpsertComment(t *testing.T) {
+	fake := &fakeGitHub{token: "secret", login: "demystifier-bot"}
+	// more comments than a page, the analysis comment is on the second page
+	for i := 0; i < commentsPerPage+5; i++ {
+		fake.nextID++
+		comment := Comment{ID: fake.nextID, Body: "/retest", User: User{Login: "reviewer"}}
+		switch i {
+		case 1:
+			// a user quoting the analysis
+			comment.Body = "> " + Marker + "\n> old analysis\nWhy?"
+		case commentsPerPage + 2:
+			comment.Body = Marker + "\nold analysis"
+			comment.User.Login = "Demystifier-Bot"
+		}
+		fake.comments = append(fake.comments, comment)
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := NewClient(server.URL+"/", "secret", nil)
+
+	comment, created, err := UpsertComment(client, "openshift/oadp-operator", 1266, Marker+"\nnew analysis")
+	if err != nil {
+		t.Fatalf("UpsertComment() error = %v", err)
+	}
+	if created || comment.ID != commentsPerPage+3 || fake.comments[commentsPerPage+2].Body != Marker+"\nnew analysis" ||
+		!strings.HasPrefix(fake.comments[1].Body, "> "+Marker) {
+		t.Errorf("UpsertComment() = %+v, created %v, want the comment %d updated", comment, created, commentsPerPage+3)
+	}
+	wantCalls := []string{
+		"GET /user",
+		"GET /repos/openshift/oadp-operator/issues/1266/comments",
+		"GET /repos/openshift/oadp-operator/issues/1266/comments",
+		fmt.Sprintf("PATCH /repos/openshift/oadp-operator/issues/comments/%d", commentsPerPage+3),
+	}
+	if strings.Join(fake.calls, "\n") != strings.Join(wantCalls, "\n") {
+		t.Errorf("Calls = %q, want %q", fake.calls, wantCalls)
+	}
+
+	// the same analysis is not written again
+	fake.calls = nil
+	if _, created, err = UpsertComment(client, "openshift/oadp-operator", 1266, Marker+"\nnew analysis"); err != nil || created || len(fake.calls) != 3 {
+		t.Errorf("UpsertComment() of the same body created %v, calls %q, error %v", created, fake.calls, err)
+	}
+
+	// a pull request where only another user wrote the marker gets a new comment
+	fake.comments = fake.comments[:2]
+	comment, created, err = UpsertComment(client, "openshift/oadp-operator", 1266, Marker+"\nfirst analysis")
+	if err != nil || !created || len(fake.comments) != 3 || comment.HTMLURL == "" || !strings.HasPrefix(fake.comments[1].Body, "> "+Marker) {
+		t.Errorf("UpsertComment() = %+v, created %v, error %v, want a new comment", comment, created, err)
+	}
+
+	_, _, err = UpsertComment(NewClient(server.URL, "wrong", nil), "openshift/oadp-operator", 1266, Marker)
+	if err == nil || !strings.Contains(err.Error(), "GitHub API error 401: Bad credentials") {
+		t.Errorf("UpsertComment() with a wrong token error = %v", err)
+	}
+}
+
+func TestUpsertCommentInstallationToken(t *testing.T) {
+	fake := &fakeGitHub{token: "secret", login: "github-actions[bot]", installation: true}
+	fake.comments = []Comment{
+		{ID: 1, Body: "> " + Marker + "\n> old analysis", User: User{Login: "reviewer", Type: "User"}},
+		{ID: 2, Body: Marker + "\nold analysis", User: User{Login: "github-actions[bot]", Type: botType}},
+	}
+	fake.nextID = 2
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	comment, created, err := UpsertComment(NewClient(server.URL, "secret", nil), "openshift/oadp-operator", 1266, Marker+"\nnew analysis")
+	if err != nil || created || comment.ID != 2 || fake.comments[1].Body != Marker+"\nnew analysis" || !strings.HasPrefix(fake.comments[0].Body, "> "+Marker) {
+		t.Errorf("UpsertComment() = %+v, created %v, error %v, want the comment of the bot updated", comment, created, err)
+	}
+
+	// the comments of the users are never updated
+	fake.comments = fake.comments[:1]
+	if _, created, err = UpsertComment(NewClient(server.URL, "secret", nil), "openshift/oadp-operator", 1266, Marker+"\nnew analysis"); err != nil || !created || len(fake.comments) != 2 {
+		t.Errorf("UpsertComment() created %v, error %v, want a new comment", created, err)
+	}
+}
+
+func TestValidateRepo(t *testing.T) {
+	tests := []struct {
+		repo    string
+		wantErr bool
+	}{
+		{"openshift/oadp-operator", false},
+		{"migtools/demystifier", false},
+		{"oadp-operator", true},
+		{"openshift/oadp-operator/issues", true},
+		{"../etc/passwd", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateRepo(tt.repo); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateRepo(%q) error = %v, wantErr %v", tt.repo, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/migtools/demystifier/lib/batch"
+	"github.com/migtools/demystifier/lib/dump"
+	"github.com/migtools/demystifier/lib/flakechecker"
+	"github.com/migtools/demystifier/lib/summary"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+const (
+	// Marker identifies the analysis comment among the comments of a pull request
+	Marker = "<!-- demystifier -->"
+	// DefaultFailureLines bounds the failure details shown for a failed test
+	DefaultFailureLines = 20
+	// maxCommentLength stays below the 65536 characters GitHub accepts
+	maxCommentLength = 65000
+)
+
+var (
+	// prowURLRegex is a Prow job link, as in the table of the openshift-ci bot comment
+	prowURLRegex = regexp.MustCompile("https://prow\\.[^/\\s]+/view/[^\\s()\\[\\]|<>\"'`]+")
+	// pullRegex is the org_repo and number of a pull request in a Prow URL
+	pullRegex = regexp.MustCompile(`/pull/([A-Za-z0-9-]+)_([^/]+)/(\d+)/`)
+	// backticksRegex are the runs of backticks, longer fences are needed around them
+	backticksRegex = regexp.MustCompile("`{3,}")
+)
+
+// Options are the settings of the composed comment
+type Options struct {
+	// KnownFlakes returns the flake patterns found in the logs of an attempt, nil to skip them
+	KnownFlakes func(logs string) []flakechecker.FlakePattern
+	// FailureLines bounds the failure details of each failed test, DefaultFailureLines when 0, negative to hide them
+	FailureLines int
+}
+
+// ExtractJobURLs returns the Prow job links of a text, such as the comment of
+// the openshift-ci bot listing the failed jobs, in their order and without duplicates
+func ExtractJobURLs(text string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, url := range prowURLRegex.FindAllString(text, -1) {
+		url = strings.TrimRight(url, ".,;")
+		if !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// PullRequest returns the owner/name repository and the number of the pull
+// request tested by a Prow job, ok is false for the jobs not run on a pull request
+func PullRequest(location string) (repo string, number int, ok bool) {
+	matches := pullRegex.FindStringSubmatch(location)
+	if matches == nil {
+		return "", 0, false
+	}
+	number, err := strconv.Atoi(matches[3])
+	if err != nil {
+		return "", 0, false
+	}
+	return matches[1] + "/" + matches[2], number, true
+}
+
+// testIssues is a failed or flaky test of the comment
+type testIssues struct {
+	name     string
+	attempts int
+	failed   int
+	issues   []flakechecker.FlakePattern
+	// knownFlake is set when a pattern which is worth a retry was found
+	knownFlake bool
+	details    []string
+}
+
+// jobAnalysis is a job of the comment
+type jobAnalysis struct {
+	result *batch.Result
+	failed []testIssues
+	flaky  []testIssues
+}
+
+// Compose writes the analysis of the jobs as a markdown comment starting
+// with the Marker: a verdict, a table of the jobs, then the failed and flaky
+// tests of each job with their known issues and failure details.
+//
+// Parameters:
+//   - results: the parsed jobs, see batch.Run.
+//   - opts: the known flakes and the length of the failure details.
+//
+// Returns:
+//   - string with the markdown comment, shortened to the length GitHub accepts.
+func Compose(results []batch.Result, opts Options) string {
+	if opts.FailureLines == 0 {
+		opts.FailureLines = DefaultFailureLines
+	}
+	jobs := make([]jobAnalysis, 0, len(results))
+	for i := range results {
+		jobs = append(jobs, analyzeJob(&results[i], opts))
+	}
+
+	comment := render(jobs, true)
+	if len(comment) > maxCommentLength {
+		comment = render(jobs, false)
+	}
+	if len(comment) > maxCommentLength {
+		const truncated = "\n\n_The analysis is too long and was truncated._\n"
+		comment = strings.ToValidUTF8(comment[:maxCommentLength-len(truncated)], "") + truncated
+	}
+	return comment
+}
+
+func analyzeJob(result *batch.Result, opts Options) jobAnalysis {
+	job := jobAnalysis{result: result}
+	if result.Data == nil {
+		return job
+	}
+	names := summary.DisplayNames(result.Data)
+	for i := range result.Data.TestRun {
+		thisTest := &result.Data.TestRun[i]
+		verdict := thisTest.Verdict()
+		if verdict != utils.Failed && verdict != utils.Flaky {
+			continue
+		}
+		test := testIssues{name: names[i], attempts: len(thisTest.Attempt)}
+		seen := map[string]bool{}
+		for j := range thisTest.Attempt {
+			attempt := &thisTest.Attempt[j]
+			if attempt.Status.Status != utils.Failed {
+				continue
+			}
+			test.failed++
+			test.details = dump.FailureDetails(attempt.Logs)
+			if opts.KnownFlakes == nil {
+				continue
+			}
+			for _, pattern := range opts.KnownFlakes(strings.Join(attempt.Logs, "\n")) {
+				if !pattern.SkipRetry {
+					test.knownFlake = true
+				}
+				if !seen[pattern.Issue] {
+					seen[pattern.Issue] = true
+					test.issues = append(test.issues, pattern)
+				}
+			}
+		}
+		if opts.FailureLines < 0 {
+			test.details = nil
+		} else if len(test.details) > opts.FailureLines {
+			test.details = append(test.details[:opts.FailureLines:opts.FailureLines], "...")
+		}
+		if verdict == utils.Failed {
+			job.failed = append(job.failed, test)
+		} else {
+			job.flaky = append(job.flaky, test)
+		}
+	}
+	return job
+}
+
+// render writes the comment, with the failure details or without them
+func render(jobs []jobAnalysis, withDetails bool) string {
+	var b strings.Builder
+	b.WriteString(Marker + "\n## Demystifier analysis\n\n")
+	b.WriteString(verdict(jobs) + "\n\n")
+
+	b.WriteString("| Job | Failed | Flaky | Known issues |\n|-----|--------|-------|--------------|\n")
+	for i := range jobs {
+		job := &jobs[i]
+		if job.result.Data == nil {
+			fmt.Fprintf(&b, "| %s | could not be analyzed: %s | | |\n", jobLink(job.result), escapeCell(fmt.Sprint(job.result.Err)))
+			continue
+		}
+		var issues []flakechecker.FlakePattern
+		for _, test := range append(append([]testIssues{}, job.failed...), job.flaky...) {
+			issues = append(issues, test.issues...)
+		}
+		fmt.Fprintf(&b, "| %s | %d | %d | %s |\n", jobLink(job.result), len(job.failed), len(job.flaky), issueLinks(issues))
+	}
+
+	for i := range jobs {
+		job := &jobs[i]
+		if len(job.failed) == 0 && len(job.flaky) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s\n", jobLink(job.result))
+		writeTests(&b, "Failed", job.failed, withDetails)
+		writeTests(&b, "Flaky", job.flaky, withDetails)
+	}
+	return b.String()
+}
+
+// verdict tells whether a /retest is worth it
+func verdict(jobs []jobAnalysis) string {
+	failed, knownFlakes, unanalyzed := 0, 0, 0
+	for i := range jobs {
+		if jobs[i].result.Data == nil {
+			unanalyzed++
+		}
+		for _, test := range jobs[i].failed {
+			failed++
+			if test.knownFlake {
+				knownFlakes++
+			}
+		}
+	}
+	var sentences []string
+	switch {
+	case failed == 0:
+		sentences = append(sentences, ":white_check_mark: No test failed in the analyzed jobs.")
+	case knownFlakes == failed:
+		sentences = append(sentences, fmt.Sprintf(":repeat: The %d failed tests hit known flakes, a `/retest` should help.", failed))
+	default:
+		sentences = append(sentences, fmt.Sprintf(":x: %d of the %d failed tests did not hit a known flake.", failed-knownFlakes, failed))
+	}
+	if unanalyzed > 0 {
+		sentences = append(sentences, fmt.Sprintf(":warning: %d jobs could not be analyzed.", unanalyzed))
+	}
+	return strings.Join(sentences, " ")
+}
+
+func writeTests(b *strings.Builder, title string, tests []testIssues, withDetails bool) {
+	if len(tests) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n**%s**\n\n| Test | Failed attempts | Known issues |\n|------|-----------------|--------------|\n", title)
+	for _, test := range tests {
+		fmt.Fprintf(b, "| %s | %d of %d | %s |\n", escapeCell(test.name), test.failed, test.attempts, issueLinks(test.issues))
+	}
+	if !withDetails {
+		return
+	}
+	for _, test := range tests {
+		if len(test.details) == 0 {
+			continue
+		}
+		content := strings.Join(test.details, "\n")
+		fence := "```"
+		for _, backticks := range backticksRegex.FindAllString(content, -1) {
+			if len(backticks) >= len(fence) {
+				fence = backticks + "`"
+			}
+		}
+		fmt.Fprintf(b, "\n<details><summary>%s</summary>\n\n%s\n%s\n%s\n\n</details>\n",
+			escapeHTML(test.name), fence, content, fence)
+	}
+}
+
+// jobLink links the job to its location, named after its Prow job when known
+func jobLink(result *batch.Result) string {
+	name := result.Job.JobName
+	if name == "" {
+		name = result.Location
+	}
+	if result.Job.RunID != "" && result.Job.JobName != "" {
+		name += " #" + result.Job.RunID
+	}
+	if !strings.HasPrefix(result.Location, "https://") && !strings.HasPrefix(result.Location, "http://") {
+		return escapeCell(name)
+	}
+	return "[" + escapeCell(name) + "](" + result.Location + ")"
+}
+
+// issueLinks links the issues of the known flakes, without duplicates
+func issueLinks(issues []flakechecker.FlakePattern) string {
+	var links []string
+	seen := map[string]bool{}
+	for _, issue := range issues {
+		if issue.Issue == "" || seen[issue.Issue] {
+			continue
+		}
+		seen[issue.Issue] = true
+		text := issue.Issue[strings.LastIndex(issue.Issue, "/")+1:]
+		links = append(links, fmt.Sprintf("[%s](%s \"%s\")", escapeCell(text), issue.Issue, strings.ReplaceAll(escapeCell(issue.Description), `"`, `'`)))
+	}
+	if len(links) == 0 {
+		return "-"
+	}
+	return strings.Join(links, ", ")
+}
+
+// escapeCell keeps a text on a single table cell
+func escapeCell(text string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ", "\r", "").Replace(text)
+}
+
+func escapeHTML(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/batch"
+	"github.com/migtools/demystifier/lib/flakechecker"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+const (
+	jobURL = "https://prow.ci.openshift.org/view/gs/test-platform-results/pr-logs/pull/openshift_oadp-operator/1266/pull-ci-openshift-oadp-operator-master-4.13-e2e-test-azure/1767186600720076800"
+)
+
+func TestExtractJobURLs(t *testing.T) {
+	botComment := "@user: The following tests **failed**, say `/retest` to rerun all failed tests:\n\n" +
+		"Test name | Commit | Details | Required | Rerun command\n" +
+		"--- | --- | --- | --- | ---\n" +
+		"ci/prow/4.13-e2e-test-azure | 1a2b3c | [link](" + jobURL + ") | true | `/test 4.13-e2e-test-azure`\n" +
+		"ci/prow/4.14-e2e-test-aws | 1a2b3c | [link](https://prow.ci.openshift.org/view/gs/test-platform-results/pr-logs/pull/openshift_oadp-operator/1266/pull-ci-openshift-oadp-operator-master-4.14-e2e-test-aws/1767186600720076801) | true | `/test 4.14-e2e-test-aws`\n" +
+		"\nFull PR test history. Your PR dashboard. See " + jobURL + ".\n"
+
+	want := []string{
+		jobURL,
+		"https://prow.ci.openshift.org/view/gs/test-platform-results/pr-logs/pull/openshift_oadp-operator/1266/pull-ci-openshift-oadp-operator-master-4.14-e2e-test-aws/1767186600720076801",
+	}
+	if got := ExtractJobURLs(botComment); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractJobURLs() = %q, want %q", got, want)
+	}
+
+	repo, number, ok := PullRequest(jobURL)
+	if repo != "openshift/oadp-operator" || number != 1266 || !ok {
+		t.Errorf("PullRequest() = %s, %d, %v", repo, number, ok)
+	}
+	if _, _, ok = PullRequest("https://prow.ci.openshift.org/view/gs/test-platform-results/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws/1"); ok {
+		t.Errorf("PullRequest() of a periodic job is ok")
+	}
+}
+
+func TestCompose(t *testing.T) {
+	results := []batch.Result{
+		{Location: jobURL, Job: utils.GetJobInfo(jobURL), Data: fixture.Parse(t)},
+		{Location: "https://prow.ci.openshift.org/view/gs/missing", Err: errors.New("error opening URL: 404 | Not Found")},
+	}
+	knownFlakes := func(logs string) []flakechecker.FlakePattern {
+		if strings.Contains(logs, "backup=openshift-adp/mysql-csi-e2e") {
+			return []flakechecker.FlakePattern{{Issue: "https://github.com/openshift/oadp-operator/issues/1234", Description: `Velero "pods" not ready`}}
+		}
+		return nil
+	}
+
+	comment := Compose(results, Options{KnownFlakes: knownFlakes, FailureLines: 3})
+	for _, want := range []string{
+		Marker + "\n## Demystifier analysis\n",
+		":x: 1 of the 1 failed tests did not hit a known flake. :warning: 1 jobs could not be analyzed.",
+		"| [pull-ci-openshift-oadp-operator-master-4.13-e2e-test-azure #1767186600720076800](" + jobURL + ") | 1 | 1 | [1234](https://github.com/openshift/oadp-operator/issues/1234 \"Velero 'pods' not ready\") |",
+		"| [https://prow.ci.openshift.org/view/gs/missing](https://prow.ci.openshift.org/view/gs/missing) | could not be analyzed: error opening URL: 404 \\| Not Found | | |",
+		"**Failed**\n\n| Test | Failed attempts | Known issues |\n|------|-----------------|--------------|\n| MySQL application two Vol CSI | 3 of 3 | - |\n",
+		"| MySQL application CSI | 1 of 2 | [1234]",
+		"<details><summary>MySQL application two Vol CSI</summary>\n\n```\n",
+		"\n...\n```\n\n</details>\n",
+	} {
+		if !strings.Contains(comment, want) {
+			t.Errorf("Compose() misses %q in\n%s", want, comment)
+		}
+	}
+
+	if comment = Compose(results[:1], Options{FailureLines: -1}); strings.Contains(comment, "<details>") {
+		t.Errorf("Compose() without failure lines shows details:\n%s", comment)
+	}
+}
+
+func TestComposeLimits(t *testing.T) {
+	failedAttempt := func(logs ...string) []utils.AttemptData {
+		return []utils.AttemptData{{Status: utils.EventStatus{Status: utils.Failed}, Logs: logs}}
+	}
+	run := &utils.TestRunData{TestRun: []utils.IndividualTestRunData{
+		{Name: "a", ShortName: "quota | exceeded", Attempt: failedAttempt("[FAILED] got", "```go", "x := 1", "```", "In [It] at: a.go:1")},
+	}}
+	results := []batch.Result{{Location: "/tmp/build-log.txt", Data: run}}
+	knownFlakes := func(string) []flakechecker.FlakePattern {
+		return []flakechecker.FlakePattern{{Issue: "https://issues.example.com/7", Description: "Quota"}}
+	}
+
+	comment := Compose(results, Options{KnownFlakes: knownFlakes})
+	for _, want := range []string{
+		":repeat: The 1 failed tests hit known flakes, a `/retest` should help.",
+		"\n### /tmp/build-log.txt\n",
+		"| quota \\| exceeded | 1 of 1 |",
+		"\n````\n[FAILED] got\n```go\nx := 1\n```\nIn [It] at: a.go:1\n````\n",
+	} {
+		if !strings.Contains(comment, want) {
+			t.Errorf("Compose() misses %q in\n%s", want, comment)
+		}
+	}
+
+	// long details are dropped, then the comment is truncated
+	long := make([]string, 0, 5000)
+	for i := 0; i < 5000; i++ {
+		long = append(long, "[FAILED] "+strings.Repeat("é", 10))
+	}
+	run.TestRun[0].Attempt = failedAttempt(long...)
+	if comment = Compose(results, Options{FailureLines: 5000}); len(comment) > maxCommentLength || strings.Contains(comment, "<details>") {
+		t.Errorf("Compose() of long details is %d long", len(comment))
+	}
+	for i := 0; i < 2000; i++ {
+		run.TestRun = append(run.TestRun, utils.IndividualTestRunData{Name: strings.Repeat("n", 40), ShortName: strings.Repeat("é", 40), Attempt: failedAttempt()})
+	}
+	comment = Compose(results, Options{})
+	if len(comment) > maxCommentLength || !strings.HasSuffix(comment, "_The analysis is too long and was truncated._\n") || !strings.HasPrefix(comment, Marker) {
+		t.Errorf("Compose() of many tests is %d long, ending with %q", len(comment), comment[len(comment)-60:])
+	}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package history records parsed test runs on disk and reports trends over them
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+const (
+	storeDirPerm = 0o750
+	runsFolder   = "runs"
+)
+
+// AttemptRecord is an attempt of a test, without its logs
+type AttemptRecord struct {
+	Status    string
+	StartTime time.Time
+	Duration  time.Duration
+}
+
+// TestRecord is the result of a test in a recorded run
+type TestRecord struct {
+	Name      string
+	ShortName string
+	Verdict   string
+	Attempts  []AttemptRecord
+}
+
+// Duration is the duration of the attempt that decided the verdict
+func (t *TestRecord) Duration() time.Duration {
+	if len(t.Attempts) == 0 {
+		return 0
+	}
+	return t.Attempts[len(t.Attempts)-1].Duration
+}
+
+// RunRecord is a test run stored in the history
+type RunRecord struct {
+	Job        utils.JobInfo
+	StartedAt  time.Time
+	RecordedAt time.Time
+	Tests      []TestRecord
+}
+
+// Filter selects the recorded runs, empty fields match every run
+type Filter struct {
+	JobName    string
+	Platform   string
+	OCPVersion string
+	Last       int // only the Last most recent runs, 0 for all of them
+}
+
+// Store is a folder holding one JSON file per recorded run
+type Store struct {
+	dir string
+}
+
+// DefaultDir returns the folder used when no history folder is configured
+func DefaultDir() string {
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, "demystifier", "history")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "demystifier", "history")
+	}
+	return filepath.Join(home, ".local", "share", "demystifier", "history")
+}
+
+// Open creates the store folder if needed and returns the store
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, runsFolder), storeDirPerm); err != nil {
+		return nil, fmt.Errorf("error creating history folder: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Dir returns the folder of the store
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// NewRunRecord summarizes a parsed test run, dropping the logs
+func NewRunRecord(job utils.JobInfo, data *utils.TestRunData) *RunRecord {
+	run := &RunRecord{Job: job, RecordedAt: time.Now()}
+	for i := range data.TestRun {
+		test := &data.TestRun[i]
+		record := TestRecord{
+			Name:      test.Name,
+			ShortName: test.ShortName,
+			Verdict:   test.Verdict(),
+		}
+		for j := range test.Attempt {
+			attempt := &test.Attempt[j]
+			status := attempt.Status.Status
+			if status == "" {
+				status = utils.Passed
+			}
+			record.Attempts = append(record.Attempts, AttemptRecord{
+				Status:    status,
+				StartTime: attempt.StartTime,
+				Duration:  attempt.Duration,
+			})
+			if !attempt.StartTime.IsZero() && (run.StartedAt.IsZero() || attempt.StartTime.Before(run.StartedAt)) {
+				run.StartedAt = attempt.StartTime
+			}
+		}
+		run.Tests = append(run.Tests, record)
+	}
+	if run.StartedAt.IsZero() {
+		run.StartedAt = run.RecordedAt
+	}
+	if run.Job.RunID == "" {
+		run.Job.RunID = localRunID(data)
+	}
+	return run
+}
+
+// Record stores a parsed test run. Recording the same run again replaces it.
+//
+// Parameters:
+//   - job: the metadata of the job, see utils.GetJobInfo.
+//   - data: the parsed test run.
+//
+// Returns:
+//   - *RunRecord that was written.
+//   - error if the record can not be written.
+func (s *Store) Record(job utils.JobInfo, data *utils.TestRunData) (*RunRecord, error) {
+	run := NewRunRecord(job, data)
+	content, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding run: %v", err)
+	}
+
+	if err := writeFile(filepath.Join(s.dir, runsFolder, recordFileName(&run.Job)), content); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// writeFile replaces a file through a temporary file of its own, created
+// with the 0600 permissions, so that the runs recorded at the same time never
+// share one and the readers never see a partial file
+func writeFile(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error writing run: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing run: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing run: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing run: %v", err)
+	}
+	return nil
+}
+
+// Runs returns the recorded runs matching the filter, most recent first
+func (s *Store) Runs(filter Filter) ([]RunRecord, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, runsFolder, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing runs: %v", err)
+	}
+
+	var runs []RunRecord
+	for _, file := range files {
+		content, err := os.ReadFile(file) // #nosec G304 -- files listed from the store folder
+		if err != nil {
+			return nil, fmt.Errorf("error reading run: %v", err)
+		}
+		var run RunRecord
+		if err := json.Unmarshal(content, &run); err != nil {
+			return nil, fmt.Errorf("error decoding run %s: %v", filepath.Base(file), err)
+		}
+		if filter.matches(&run) {
+			runs = append(runs, run)
+		}
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	if filter.Last > 0 && len(runs) > filter.Last {
+		runs = runs[:filter.Last]
+	}
+	return runs, nil
+}
+
+func (f *Filter) matches(run *RunRecord) bool {
+	return (f.JobName == "" || strings.Contains(run.Job.JobName, f.JobName)) &&
+		(f.Platform == "" || run.Job.Platform == f.Platform) &&
+		(f.OCPVersion == "" || run.Job.OCPVersion == f.OCPVersion)
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+func recordFileName(job *utils.JobInfo) string {
+	name := job.RunID
+	if job.JobName != "" {
+		name = job.JobName + "_" + job.RunID
+	}
+	return unsafeFileChars.ReplaceAllString(name, "_") + ".json"
+}
+
+// localRunID identifies runs that do not come from Prow by their content:
+// their log, or their tests for the runs parsed from a Ginkgo JSON report,
+// which have no log
+func localRunID(data *utils.TestRunData) string {
+	hash := sha256.New()
+	if data.FullLogs != "" {
+		hash.Write([]byte(data.FullLogs))
+	} else {
+		for i := range data.TestRun {
+			test := &data.TestRun[i]
+			fmt.Fprintf(hash, "%s\x00%s\x00", test.Name, test.Suite)
+			for j := range test.Attempt {
+				attempt := &test.Attempt[j]
+				fmt.Fprintf(hash, "%d\x00%s\x00%d\x00%s\x00%s\x00", attempt.AttemptNo, attempt.StartTime.Format(time.RFC3339Nano),
+					attempt.Duration, attempt.Status.Status, strings.Join(attempt.Logs, "\n"))
+			}
+		}
+	}
+	return "local-" + hex.EncodeToString(hash.Sum(nil))[:12]
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+func newRun(start time.Time, duration time.Duration, statuses ...string) *utils.TestRunData {
+	test := utils.IndividualTestRunData{Name: "backup_restore.go:10", ShortName: "backup restore"}
+	for i, status := range statuses {
+		test.Attempt = append(test.Attempt, utils.AttemptData{
+			AttemptNo: i,
+			StartTime: start,
+			Duration:  duration,
+			Status:    utils.EventStatus{Status: status},
+		})
+	}
+	return &utils.TestRunData{TestRun: []utils.IndividualTestRunData{test}}
+}
+
+func TestStoreAndStats(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening store: %v", err)
+	}
+
+	day := func(d int) time.Time { return time.Date(2024, 2, d, 10, 0, 0, 0, time.UTC) }
+	awsJob := utils.JobInfo{JobName: "periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic", Platform: "aws", OCPVersion: "4.14"}
+	runs := []struct {
+		id   string
+		job  utils.JobInfo
+		data *utils.TestRunData
+	}{
+		{id: "1", job: awsJob, data: newRun(day(1), time.Minute, "")},
+		{id: "2", job: awsJob, data: newRun(day(2), 2*time.Minute, utils.Failed)},
+		{id: "3", job: awsJob, data: newRun(day(3), 3*time.Minute, utils.Failed, "")},
+		{id: "4", job: awsJob, data: newRun(day(4), 4*time.Minute, utils.Failed)},
+		{id: "5", job: utils.JobInfo{JobName: "periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-azure-periodic", Platform: "azure", OCPVersion: "4.14"},
+			data: newRun(day(5), 5*time.Minute, utils.Failed)},
+	}
+	for _, run := range runs {
+		run.job.RunID = run.id
+		if _, err := store.Record(run.job, run.data); err != nil {
+			t.Fatalf("Error recording run %s: %v", run.id, err)
+		}
+	}
+	// Recording a run again replaces it
+	if _, err := store.Record(utils.JobInfo{JobName: awsJob.JobName, RunID: "1", Platform: "aws", OCPVersion: "4.14"}, runs[0].data); err != nil {
+		t.Fatalf("Error recording run again: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		filter           Filter
+		wantRuns         int
+		wantFailed       int
+		wantFlaky        int
+		wantP50          time.Duration
+		wantMax          time.Duration
+		wantFirstFailing time.Time
+	}{
+		{name: "All runs", filter: Filter{}, wantRuns: 5, wantFailed: 3, wantFlaky: 1, wantP50: 3 * time.Minute, wantMax: 5 * time.Minute, wantFirstFailing: day(2)},
+		{name: "Platform", filter: Filter{Platform: "aws"}, wantRuns: 4, wantFailed: 2, wantFlaky: 1, wantP50: 2 * time.Minute, wantMax: 4 * time.Minute, wantFirstFailing: day(2)},
+		{name: "Last runs", filter: Filter{Last: 2}, wantRuns: 2, wantFailed: 2, wantP50: 4 * time.Minute, wantMax: 5 * time.Minute, wantFirstFailing: day(4)},
+		{name: "Job name", filter: Filter{JobName: "azure", OCPVersion: "4.14"}, wantRuns: 1, wantFailed: 1, wantP50: 5 * time.Minute, wantMax: 5 * time.Minute, wantFirstFailing: day(5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := store.Runs(tt.filter)
+			if err != nil {
+				t.Fatalf("Error reading runs: %v", err)
+			}
+			stats := Stats(records)
+			if len(stats) != 1 {
+				t.Fatalf("Expected stats for one test, got %d", len(stats))
+			}
+			got := stats[0]
+			if got.Runs != tt.wantRuns || got.Failed != tt.wantFailed || got.Flaky != tt.wantFlaky {
+				t.Errorf("Runs/Failed/Flaky = %d/%d/%d, want %d/%d/%d", got.Runs, got.Failed, got.Flaky, tt.wantRuns, tt.wantFailed, tt.wantFlaky)
+			}
+			if got.P50 != tt.wantP50 || got.Max != tt.wantMax {
+				t.Errorf("P50/Max = %v/%v, want %v/%v", got.P50, got.Max, tt.wantP50, tt.wantMax)
+			}
+			if !got.FirstSeenFailing.Equal(tt.wantFirstFailing) {
+				t.Errorf("FirstSeenFailing = %v, want %v", got.FirstSeenFailing, tt.wantFirstFailing)
+			}
+		})
+	}
+}
+
+func TestRecordLocalLog(t *testing.T) {
+	testData := fixture.Parse(t)
+	if got := fixture.CountAttempts(testData); got != fixture.AttemptCount {
+		t.Fatalf("Expected %d attempts, got %d", fixture.AttemptCount, got)
+	}
+
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening store: %v", err)
+	}
+	run, err := store.Record(utils.GetJobInfo(fixture.BuildLog), testData)
+	if err != nil {
+		t.Fatalf("Error recording run: %v", err)
+	}
+	if run.Job.RunID == "" || run.StartedAt.IsZero() {
+		t.Errorf("Expected a local run ID and a start time, got %+v", run.Job)
+	}
+	if len(run.Tests) != len(testData.TestRun) {
+		t.Errorf("Expected %d tests, got %d", len(testData.TestRun), len(run.Tests))
+	}
+
+	records, err := store.Runs(Filter{})
+	if err != nil {
+		t.Fatalf("Error reading runs: %v", err)
+	}
+	if len(records) != 1 || len(records[0].Tests) != len(testData.TestRun) {
+		t.Fatalf("Expected the recorded run back, got %d runs", len(records))
+	}
+	for _, stats := range Stats(records) {
+		if stats.Runs != 1 || stats.Passed+stats.Failed+stats.Flaky != 1 {
+			t.Errorf("Unexpected stats %+v", stats)
+		}
+	}
+}
+
+func TestRecordLocalReports(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening store: %v", err)
+	}
+	// the runs parsed from Ginkgo JSON reports have no log
+	start := time.Date(2024, 2, 14, 19, 0, 0, 0, time.UTC)
+	ids := map[string]bool{}
+	for _, data := range []*utils.TestRunData{
+		newRun(start, time.Minute, utils.Failed),
+		newRun(start.Add(time.Hour), time.Minute, utils.Passed),
+	} {
+		run, err := store.Record(utils.GetJobInfo("report.json"), data)
+		if err != nil {
+			t.Fatalf("Error recording run: %v", err)
+		}
+		ids[run.Job.RunID] = true
+	}
+	records, err := store.Runs(Filter{})
+	if err != nil {
+		t.Fatalf("Error reading runs: %v", err)
+	}
+	if len(ids) != 2 || len(records) != 2 {
+		t.Errorf("Expected two local runs, got the IDs %v and %d runs", ids, len(records))
+	}
+}
+
+func TestRecordConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Error opening store: %v", err)
+	}
+	job := utils.JobInfo{JobName: "periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic", RunID: "1"}
+	data := newRun(time.Date(2024, 2, 14, 19, 0, 0, 0, time.UTC), time.Minute, utils.Failed, "")
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Record(job, data)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Error recording the same run concurrently: %v", err)
+		}
+	}
+	files, err := os.ReadDir(filepath.Join(dir, runsFolder))
+	if err != nil || len(files) != 1 {
+		t.Errorf("Expected a single run file, got %d files, error %v", len(files), err)
+	}
+}
+
+func TestStatsSkipped(t *testing.T) {
+	var runs []RunRecord
+	for i, verdict := range []string{utils.Skipped, utils.Failed, utils.Skipped, utils.Passed} {
+		runs = append(runs, RunRecord{
+			StartedAt: time.Date(2024, 2, i+1, 10, 0, 0, 0, time.UTC),
+			Tests: []TestRecord{{
+				Name:     "backup_restore.go:10",
+				Verdict:  verdict,
+				Attempts: []AttemptRecord{{Status: verdict, Duration: time.Duration(i) * time.Minute}},
+			}},
+		})
+	}
+	got := Stats(runs)[0]
+	if got.Runs != 4 || got.Skipped != 2 || got.Passed != 1 || got.Failed != 1 {
+		t.Errorf("Runs/Skipped/Passed/Failed = %d/%d/%d/%d, want 4/2/1/1", got.Runs, got.Skipped, got.Passed, got.Failed)
+	}
+	if got.FailRate() != 0.5 || got.P50 != time.Minute || got.Max != 3*time.Minute {
+		t.Errorf("FailRate/P50/Max = %v/%v/%v, want the skipped runs left out", got.FailRate(), got.P50, got.Max)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"sort"
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// TestStats is the trend of a test over the recorded runs
+type TestStats struct {
+	Name             string
+	ShortName        string
+	Runs             int
+	Passed           int
+	Failed           int
+	Flaky            int
+	Skipped          int // runs where the test did not run, left out of the rates and durations
+	P50              time.Duration
+	P90              time.Duration
+	Max              time.Duration
+	FirstSeenFailing time.Time // start of the oldest run where the test failed, zero if it never failed
+	LastSeen         time.Time
+}
+
+// executed returns the number of runs where the test was not skipped
+func (s *TestStats) executed() int {
+	return s.Runs - s.Skipped
+}
+
+// FailRate returns the share of the runs executing the test where it failed
+func (s *TestStats) FailRate() float64 {
+	if s.executed() == 0 {
+		return 0
+	}
+	return float64(s.Failed) / float64(s.executed())
+}
+
+// FlakeRate returns the share of the runs executing the test where it passed after a retry
+func (s *TestStats) FlakeRate() float64 {
+	if s.executed() == 0 {
+		return 0
+	}
+	return float64(s.Flaky) / float64(s.executed())
+}
+
+// Stats aggregates the results of each test over the runs.
+// Tests are matched by their Name and sorted by fail rate, then flake rate.
+//
+// Parameters:
+//   - runs: the recorded runs, see Store.Runs.
+//
+// Returns:
+//   - []TestStats with one entry per test found in the runs.
+func Stats(runs []RunRecord) []TestStats {
+	byName := make(map[string]*TestStats)
+	durations := make(map[string][]time.Duration)
+	var order []string
+
+	for i := range runs {
+		run := &runs[i]
+		for j := range run.Tests {
+			test := &run.Tests[j]
+			stats, found := byName[test.Name]
+			if !found {
+				stats = &TestStats{Name: test.Name, ShortName: test.ShortName}
+				byName[test.Name] = stats
+				order = append(order, test.Name)
+			}
+
+			stats.Runs++
+			switch test.Verdict {
+			case utils.Failed:
+				stats.Failed++
+				if stats.FirstSeenFailing.IsZero() || run.StartedAt.Before(stats.FirstSeenFailing) {
+					stats.FirstSeenFailing = run.StartedAt
+				}
+			case utils.Flaky:
+				stats.Flaky++
+			case utils.Skipped:
+				stats.Skipped++
+			default:
+				stats.Passed++
+			}
+			if run.StartedAt.After(stats.LastSeen) {
+				stats.LastSeen = run.StartedAt
+			}
+			if test.Verdict != utils.Skipped {
+				durations[test.Name] = append(durations[test.Name], test.Duration())
+			}
+		}
+	}
+
+	result := make([]TestStats, 0, len(order))
+	for _, name := range order {
+		stats := byName[name]
+		testDurations := durations[name]
+		sort.Slice(testDurations, func(i, j int) bool { return testDurations[i] < testDurations[j] })
+		stats.P50 = Percentile(testDurations, 50)
+		stats.P90 = Percentile(testDurations, 90)
+		stats.Max = Percentile(testDurations, 100)
+		result = append(result, *stats)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].FailRate() != result[j].FailRate() {
+			return result[i].FailRate() > result[j].FailRate()
+		}
+		return result[i].FlakeRate() > result[j].FlakeRate()
+	})
+	return result
+}
+
+// Percentile returns the nearest-rank percentile of sorted durations
+func Percentile(sorted []time.Duration, percent int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (percent*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
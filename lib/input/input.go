@@ -0,0 +1,322 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package input finds the build log in stdin, files, folders and archives,
+// together with the Ginkgo JSON report written next to it
+package input
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// Stdin is the location reading the log from the standard input
+	Stdin = "-"
+	// BuildLogName is the name of the logs looked for in folders and archives
+	BuildLogName = "build-log.txt"
+
+	// maxLogSize bounds the decompressed size of a log
+	maxLogSize = 4 << 30
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zipMagic   = []byte("PK\x03\x04")
+	tarMagic   = []byte("ustar")
+	tarMagicAt = 257
+	// ginkgoMarker is found in the logs of the e2e step only
+	ginkgoMarker = []byte("> Enter [")
+	// ReportNames are the Ginkgo JSON reports looked for next to the build log
+	ReportNames = []string{"report.json", "ginkgo-report.json"}
+)
+
+// Source is a log found in the input
+type Source struct {
+	Name    string // location of the log, with its path inside the folder or archive
+	Content []byte
+	Report  *Source // Ginkgo JSON report found in the folder of the build log, nil when none
+}
+
+// ReportLocations returns the locations of the Ginkgo JSON reports that may
+// be written next to a build log, a file path or a URL
+func ReportLocations(logLocation string) []string {
+	folder := logLocation[:strings.LastIndex(logLocation, "/")+1]
+	locations := make([]string, 0, len(ReportNames))
+	for _, name := range ReportNames {
+		locations = append(locations, folder+name)
+	}
+	return locations
+}
+
+func isReport(name string) bool {
+	base := filepath.Base(name)
+	for _, reportName := range ReportNames {
+		if base == reportName {
+			return true
+		}
+	}
+	return false
+}
+
+// entry is a file found in a folder or an archive, its content is only read
+// once it is picked
+type entry struct {
+	name string // location of the file, with its path inside the folder or archive
+	size int64
+	read func() ([]byte, error)
+}
+
+func (e *entry) source() (*Source, error) {
+	if e.size > maxLogSize {
+		return nil, fmt.Errorf("error reading %s: content larger than 4 GiB", e.name)
+	}
+	content, err := e.read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", e.name, err)
+	}
+	return &Source{Name: e.name, Content: content}, nil
+}
+
+// withReport adds the report found in the folder of the picked log
+func withReport(source *Source, entries []entry) (*Source, error) {
+	for _, name := range ReportNames {
+		for i := range entries {
+			if filepath.Dir(entries[i].name) == filepath.Dir(source.Name) && filepath.Base(entries[i].name) == name {
+				report, err := entries[i].source()
+				if err != nil {
+					return nil, err
+				}
+				source.Report = report
+				return source, nil
+			}
+		}
+	}
+	return source, nil
+}
+
+// Read returns the log found at a local location.
+//
+// Parameters:
+//   - location: "-" for stdin, a folder, an archive (.gz, .tar.gz, .zip) or a log file.
+//   - stdin: the reader used for "-".
+//
+// Returns:
+//   - *Source with the build log, the one of the e2e step when several are found.
+//   - error if the location can not be read or holds no build log.
+func Read(location string, stdin io.Reader) (*Source, error) {
+	if location == Stdin {
+		content, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("error reading stdin: %v", err)
+		}
+		return FromBytes("stdin", content)
+	}
+
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	if info.IsDir() {
+		return readDir(location)
+	}
+
+	content, err := os.ReadFile(location) // #nosec G304 -- the file is given by the user
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	return FromBytes(location, content)
+}
+
+// FromBytes returns the log held in content, decompressing gzip content and
+// looking for the build log in tar and zip archives. Other content is the log.
+func FromBytes(name string, content []byte) (*Source, error) {
+	if bytes.HasPrefix(content, gzipMagic) {
+		decompressed, err := gunzip(content)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", name, err)
+		}
+		content = decompressed
+	}
+
+	switch {
+	case bytes.HasPrefix(content, zipMagic):
+		return readZip(name, content)
+	case len(content) > tarMagicAt+len(tarMagic) && bytes.Equal(content[tarMagicAt:tarMagicAt+len(tarMagic)], tarMagic):
+		return readTar(name, content)
+	default:
+		return &Source{Name: name, Content: content}, nil
+	}
+}
+
+func gunzip(content []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return readLimited(reader)
+}
+
+func readLimited(reader io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(reader, maxLogSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxLogSize {
+		return nil, errors.New("content larger than 4 GiB")
+	}
+	return content, nil
+}
+
+func readDir(dir string) (*Source, error) {
+	var entries []entry
+	err := filepath.WalkDir(dir, func(path string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dirEntry.IsDir() || (dirEntry.Name() != BuildLogName && !isReport(path)) {
+			return nil
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{
+			name: path,
+			size: info.Size(),
+			read: func() ([]byte, error) {
+				return os.ReadFile(path) // #nosec G304 -- files found in the folder given by the user
+			},
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading folder: %v", err)
+	}
+	return pick(dir, entries, false)
+}
+
+// readTar lists the regular files of a tar archive, the picked ones are read
+// by scanning the archive again up to them
+func readTar(name string, content []byte) (*Source, error) {
+	var entries []entry
+	reader := tar.NewReader(bytes.NewReader(content))
+	for index := 0; ; index++ {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", name, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		index := index
+		entries = append(entries, entry{
+			name: name + ":" + header.Name,
+			size: header.Size,
+			read: func() ([]byte, error) { return readTarFile(content, index) },
+		})
+	}
+	return pick(name, entries, true)
+}
+
+// readTarFile returns the content of the file at an index of a tar archive,
+// the content of the files before it is skipped
+func readTarFile(content []byte, index int) ([]byte, error) {
+	reader := tar.NewReader(bytes.NewReader(content))
+	for i := 0; i < index; i++ {
+		if _, err := reader.Next(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := reader.Next(); err != nil {
+		return nil, err
+	}
+	return readLimited(reader)
+}
+
+func readZip(name string, content []byte) (*Source, error) {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", name, err)
+	}
+	var entries []entry
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		file := file
+		entries = append(entries, entry{
+			name: name + ":" + file.Name,
+			size: int64(file.UncompressedSize64),
+			read: func() ([]byte, error) {
+				opened, err := file.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer opened.Close()
+				return readLimited(opened)
+			},
+		})
+	}
+	return pick(name, entries, true)
+}
+
+// pick reads the build logs among the entries and returns the one with
+// Ginkgo tests, the largest one first, with the report next to it. When
+// single is set, an archive without build log but holding a single file
+// returns that file.
+func pick(name string, entries []entry, single bool) (*Source, error) {
+	var candidates []Source
+	for i := range entries {
+		if filepath.Base(entries[i].name) != BuildLogName {
+			continue
+		}
+		candidate, err := entries[i].source()
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, *candidate)
+	}
+	if len(candidates) == 0 {
+		if single && len(entries) == 1 {
+			return entries[0].source()
+		}
+		return nil, fmt.Errorf("error reading %s: no %s found", name, BuildLogName)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		iTests := bytes.Contains(candidates[i].Content, ginkgoMarker)
+		jTests := bytes.Contains(candidates[j].Content, ginkgoMarker)
+		if iTests != jTests {
+			return iTests
+		}
+		return len(candidates[i].Content) > len(candidates[j].Content)
+	})
+	return withReport(&candidates[0], entries)
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package input
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/migtools/demystifier/internal/fixture"
+)
+
+const (
+	stepLogPath = "artifacts/e2e-test-aws/e2e/build-log.txt"
+	// ciOperatorLog is the top level build log of a job, without Ginkgo tests
+	ciOperatorLog = "INFO[2024-02-14T12:00:00Z] Running step e2e-test-aws-e2e.\n"
+)
+
+// tree is an artifacts folder as downloaded from gcsweb
+func tree(stepLog []byte) map[string][]byte {
+	return map[string][]byte{
+		"build-log.txt":              []byte(ciOperatorLog),
+		"artifacts/README.md":        []byte("artifacts\n"),
+		stepLogPath:                  stepLog,
+		"artifacts/e2e-test-aws/foo": []byte("bar\n"),
+	}
+}
+
+func tarGz(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("Error writing tar: %v", err)
+		}
+		if _, err := writer.Write(content); err != nil {
+			t.Fatalf("Error writing tar: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Error writing tar: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Error writing gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func zipped(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("Error writing zip: %v", err)
+		}
+		if _, err := file.Write(content); err != nil {
+			t.Fatalf("Error writing zip: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Error writing zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, content []byte) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(content); err != nil {
+		t.Fatalf("Error writing gzip: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Error writing gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func writeFiles(t *testing.T, dir string, files map[string][]byte) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatalf("Error creating folder: %v", err)
+		}
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatalf("Error writing file: %v", err)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	stepLog := fixture.Read(t)
+
+	dir := t.TempDir()
+	artifacts := filepath.Join(dir, "artifacts-tree")
+	writeFiles(t, artifacts, tree(stepLog))
+	writeFiles(t, dir, map[string][]byte{
+		"artifacts.tar.gz": tarGz(t, tree(stepLog)),
+		"artifacts.zip":    zipped(t, tree(stepLog)),
+		"build-log.txt.gz": gzipped(t, stepLog),
+		"single.tar.gz":    tarGz(t, map[string][]byte{"e2e.log": stepLog}),
+		"empty.zip":        zipped(t, map[string][]byte{"a.txt": []byte("a"), "b.txt": []byte("b")}),
+	})
+
+	tests := []struct {
+		name     string
+		location string
+		stdin    []byte
+		wantName string
+		wantErr  bool
+	}{
+		{name: "Log file", location: fixture.BuildLog, wantName: fixture.BuildLog},
+		{name: "Stdin", location: Stdin, stdin: stepLog, wantName: "stdin"},
+		{name: "Gzip stdin", location: Stdin, stdin: gzipped(t, stepLog), wantName: "stdin"},
+		{name: "Gzip log", location: filepath.Join(dir, "build-log.txt.gz"), wantName: filepath.Join(dir, "build-log.txt.gz")},
+		{name: "Folder prefers the e2e step log", location: artifacts, wantName: filepath.Join(artifacts, stepLogPath)},
+		{name: "Tar gz archive", location: filepath.Join(dir, "artifacts.tar.gz"), wantName: filepath.Join(dir, "artifacts.tar.gz") + ":" + stepLogPath},
+		{name: "Zip archive", location: filepath.Join(dir, "artifacts.zip"), wantName: filepath.Join(dir, "artifacts.zip") + ":" + stepLogPath},
+		{name: "Archive of a single log", location: filepath.Join(dir, "single.tar.gz"), wantName: filepath.Join(dir, "single.tar.gz") + ":e2e.log"},
+		{name: "Archive without build log", location: filepath.Join(dir, "empty.zip"), wantErr: true},
+		{name: "Missing file", location: filepath.Join(dir, "missing.txt"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := Read(tt.location, bytes.NewReader(tt.stdin))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if source.Name != tt.wantName {
+				t.Errorf("Name = %s, want %s", source.Name, tt.wantName)
+			}
+			if !bytes.Equal(source.Content, stepLog) {
+				t.Errorf("Expected the e2e step log, got %d bytes starting with %q", len(source.Content),
+					strings.SplitN(string(source.Content), "\n", 2)[0])
+			}
+		})
+	}
+}
+
+func TestReadOnlyPickedFiles(t *testing.T) {
+	stepLog := []byte("> Enter [It] Backup - /test.go:10 @ 02/14/24 12:00:00.000\n")
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range map[string][]byte{stepLogPath: stepLog, "artifacts/must-gather.txt": []byte("stored content\n")} {
+		file, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatalf("Error writing zip: %v", err)
+		}
+		if _, err := file.Write(content); err != nil {
+			t.Fatalf("Error writing zip: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Error writing zip: %v", err)
+	}
+	// the checksum of the other file no longer matches, reading it fails
+	archive := bytes.Replace(buf.Bytes(), []byte("stored content"), []byte("broken content"), 1)
+
+	source, err := FromBytes("artifacts.zip", archive)
+	if err != nil {
+		t.Fatalf("FromBytes() error = %v", err)
+	}
+	if !bytes.Equal(source.Content, stepLog) {
+		t.Errorf("FromBytes() = %q, want the e2e step log", source.Content)
+	}
+}
+
+func TestReadReport(t *testing.T) {
+	stepLog := []byte("> Enter [It] Backup - /test.go:10 @ 02/14/24 12:00:00.000\n")
+	report := []byte(`[{"SuiteDescription": "OADP E2E", "SpecReports": []}]`)
+	files := tree(stepLog)
+	files["artifacts/e2e-test-aws/e2e/report.json"] = report
+	// A report of another step is not the one of the build log
+	files["artifacts/e2e-test-aws-fips/e2e/report.json"] = []byte("[]")
+
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+	archive := filepath.Join(t.TempDir(), "artifacts.tar.gz")
+	if err := os.WriteFile(archive, tarGz(t, files), 0o600); err != nil {
+		t.Fatalf("Error writing archive: %v", err)
+	}
+	withoutReport := t.TempDir()
+	writeFiles(t, withoutReport, tree(stepLog))
+
+	tests := []struct {
+		name       string
+		location   string
+		wantReport bool
+	}{
+		{name: "Folder", location: dir, wantReport: true},
+		{name: "Archive", location: archive, wantReport: true},
+		{name: "Folder without report", location: withoutReport},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := Read(tt.location, nil)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if (source.Report != nil) != tt.wantReport {
+				t.Fatalf("Read() report = %v, want %v", source.Report, tt.wantReport)
+			}
+			if tt.wantReport && !bytes.Equal(source.Report.Content, report) {
+				t.Errorf("Read() found the report %s", source.Report.Name)
+			}
+		})
+	}
+}
+
+func TestReportLocations(t *testing.T) {
+	got := ReportLocations("https://gcsweb.example.com/gcs/results/logs/job/1/artifacts/e2e-test-aws/e2e/build-log.txt")
+	want := "https://gcsweb.example.com/gcs/results/logs/job/1/artifacts/e2e-test-aws/e2e/report.json"
+	if len(got) != len(ReportNames) || got[0] != want {
+		t.Errorf("ReportLocations() = %v, want %s first", got, want)
+	}
+}
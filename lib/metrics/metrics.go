@@ -0,0 +1,290 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics exposes the results of test runs as Prometheus metrics,
+// in the text exposition format read by the node exporter textfile collector
+// and by the Prometheus scrapes.
+//
+// The metrics are gauges counting over the observed runs rather than
+// counters: the metrics command observes a window of recent runs on each
+// invocation, and the values go down when old runs leave the window.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/migtools/demystifier/lib/summary"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// ContentType is the media type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds in seconds of the test duration
+// histogram, e2e tests take from seconds to an hour
+var DefaultBuckets = []float64{10, 30, 60, 120, 300, 600, 900, 1200, 1800, 3600}
+
+// Metric types
+const (
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// Options are the settings of a collector
+type Options struct {
+	// KnownFlakes returns the issues of the known flakes found in the logs of a failed attempt, nil to skip them
+	KnownFlakes func(logs string) []string
+	// Buckets are the upper bounds of the test duration histogram, DefaultBuckets when empty
+	Buckets []float64
+}
+
+// Collector accumulates the metrics of the runs it observes, each run once.
+// It is safe for concurrent use.
+type Collector struct {
+	opts Options
+
+	mu       sync.Mutex
+	observed map[string]bool
+	families []*family
+
+	runs         *family
+	suiteTests   *family
+	testRuns     *family
+	testFailures *family
+	testFlakes   *family
+	testAttempts *family
+	testDuration *family
+	flakeMatches *family
+}
+
+// family is a metric and its series, by their rendered labels
+type family struct {
+	name   string
+	help   string
+	kind   string
+	series map[string]*series
+}
+
+// series is the value of a gauge, or the buckets of a histogram
+type series struct {
+	value   float64
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// New returns a collector without any run
+func New(opts Options) *Collector {
+	if len(opts.Buckets) == 0 {
+		opts.Buckets = DefaultBuckets
+	}
+	c := &Collector{opts: opts, observed: map[string]bool{}}
+	c.runs = c.add("demystifier_runs", typeGauge, "Parsed runs.")
+	c.suiteTests = c.add("demystifier_suite_tests", typeGauge, "Tests of the parsed runs by suite and verdict.")
+	c.testRuns = c.add("demystifier_test_runs", typeGauge, "Parsed runs of a test.")
+	c.testFailures = c.add("demystifier_test_failures", typeGauge, "Parsed runs where a test failed.")
+	c.testFlakes = c.add("demystifier_test_flakes", typeGauge, "Parsed runs where a test passed on a retry.")
+	c.testAttempts = c.add("demystifier_test_attempts", typeGauge, "Attempts of a test in the parsed runs.")
+	c.testDuration = c.add("demystifier_test_duration_seconds", typeHistogram, "Duration of the attempts of a test in the parsed runs.")
+	c.flakeMatches = c.add("demystifier_known_flake_matches", typeGauge, "Failed attempts of the parsed runs matching a known flake, by issue.")
+	return c
+}
+
+func (c *Collector) add(name, kind, help string) *family {
+	f := &family{name: name, help: help, kind: kind, series: map[string]*series{}}
+	c.families = append(c.families, f)
+	return f
+}
+
+// Observe adds the results of a run, labelled by the job, platform and OCP
+// version of the job. A run already observed is skipped.
+//
+// Parameters:
+//   - job: the Prow job of the run, see utils.GetJobInfo.
+//   - data: the parsed run.
+//
+// Returns:
+//   - true when the run was added, false when it was already observed.
+func (c *Collector) Observe(job utils.JobInfo, data *utils.TestRunData) bool {
+	key := job.Location
+	if job.RunID != "" {
+		key = job.JobName + "/" + job.RunID
+	}
+	c.mu.Lock()
+	if c.observed[key] {
+		c.mu.Unlock()
+		return false
+	}
+	c.observed[key] = true
+	c.mu.Unlock()
+
+	// the patterns are matched before taking the lock, it can take a while
+	issues := map[string]int{}
+	if c.opts.KnownFlakes != nil {
+		for i := range data.TestRun {
+			for j := range data.TestRun[i].Attempt {
+				attempt := &data.TestRun[i].Attempt[j]
+				if attempt.Status.Status != utils.Failed {
+					continue
+				}
+				for _, issue := range c.opts.KnownFlakes(strings.Join(attempt.Logs, "\n")) {
+					issues[issue]++
+				}
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	jobLabels := []string{"job", job.JobName, "platform", job.Platform, "ocp_version", job.OCPVersion}
+	c.runs.inc(labels(jobLabels), 1)
+	for issue, matches := range issues {
+		c.flakeMatches.inc(labels(jobLabels, "issue", issue), float64(matches))
+	}
+	names := summary.DisplayNames(data)
+	for i := range data.TestRun {
+		test := &data.TestRun[i]
+		verdict := test.Verdict()
+		c.suiteTests.inc(labels(jobLabels, "suite", test.Suite, "verdict", strings.ToLower(verdict)), 1)
+
+		testLabels := labels(jobLabels, "suite", test.Suite, "test", names[i])
+		c.testRuns.inc(testLabels, 1)
+		c.testFailures.inc(testLabels, boolValue(verdict == utils.Failed))
+		c.testFlakes.inc(testLabels, boolValue(verdict == utils.Flaky))
+		c.testAttempts.inc(testLabels, float64(len(test.Attempt)))
+		for j := range test.Attempt {
+			if test.Attempt[j].Status.Status != utils.Skipped {
+				c.testDuration.observe(testLabels, c.opts.Buckets, test.Attempt[j].Duration.Seconds())
+			}
+		}
+	}
+	return true
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// labels renders label names and values, the base ones first
+func labels(base []string, pairs ...string) string {
+	all := append(append([]string(nil), base...), pairs...)
+	rendered := make([]string, 0, len(all)/2)
+	for i := 0; i+1 < len(all); i += 2 {
+		rendered = append(rendered, all[i]+`="`+escapeLabel(all[i+1])+`"`)
+	}
+	return strings.Join(rendered, ",")
+}
+
+// escapeLabel escapes a label value of the text format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// inc adds to a gauge, creating its series even when the value is 0 so that
+// the rates of the tests which never failed are 0 rather than missing
+func (f *family) inc(labels string, value float64) {
+	s, found := f.series[labels]
+	if !found {
+		s = &series{}
+		f.series[labels] = s
+	}
+	s.value += value
+}
+
+func (f *family) observe(labels string, buckets []float64, value float64) {
+	s, found := f.series[labels]
+	if !found {
+		s = &series{buckets: make([]uint64, len(buckets))}
+		f.series[labels] = s
+	}
+	for i, bound := range buckets {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// WriteText writes the metrics in the Prometheus text exposition format,
+// the series sorted by labels
+func (c *Collector) WriteText(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := bufio.NewWriter(w)
+	for _, f := range c.families {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != typeHistogram {
+				fmt.Fprintf(out, "%s{%s} %s\n", f.name, key, formatValue(s.value))
+				continue
+			}
+			for i, bound := range c.opts.Buckets {
+				fmt.Fprintf(out, "%s_bucket{%s,le=\"%s\"} %d\n", f.name, key, formatValue(bound), s.buckets[i])
+			}
+			fmt.Fprintf(out, "%s_bucket{%s,le=\"+Inf\"} %d\n", f.name, key, s.count)
+			fmt.Fprintf(out, "%s_sum{%s} %s\n", f.name, key, formatValue(s.sum))
+			fmt.Fprintf(out, "%s_count{%s} %d\n", f.name, key, s.count)
+		}
+	}
+	return out.Flush()
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// WriteFile writes the metrics to a file, through a temporary file renamed
+// over it so that the textfile collector never reads a partial file
+func (c *Collector) WriteFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error writing metrics: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := c.WriteText(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing metrics: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing metrics: %v", err)
+	}
+	// the node exporter runs as another user
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil { // #nosec G302 -- the metrics are not secret
+		return fmt.Errorf("error writing metrics: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing metrics: %v", err)
+	}
+	return nil
+}
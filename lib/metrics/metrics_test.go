@@ -0,0 +1,156 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+const (
+	jobURL = "https://prow.ci.openshift.org/view/gs/test-platform-results/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic/"
+	// jobLabels are the labels of the runs of jobURL
+	jobLabels = `job="periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic",platform="aws",ocp_version="4.14"`
+)
+
+// sampleLine is a sample of the text format, with a label set
+var sampleLine = regexp.MustCompile(`^[a-z_]+\{([a-z_]+="(?:[^"\\]|\\.)*",?)+\} [0-9.e+]+$`)
+
+func TestCollector(t *testing.T) {
+	collector := New(Options{KnownFlakes: func(logs string) []string {
+		if strings.Contains(logs, "velero pods not found") {
+			return []string{"https://issues.example.com/1"}
+		}
+		return nil
+	}})
+	data := fixture.Parse(t)
+	for i, id := range []string{"101", "102", "101"} {
+		if added := collector.Observe(utils.GetJobInfo(jobURL+id), data); added != (i < 2) {
+			t.Errorf("Observe() of run %s = %v", id, added)
+		}
+	}
+	// a local run, without job labels
+	collector.Observe(utils.GetJobInfo(fixture.BuildLog), data)
+
+	var text strings.Builder
+	if err := collector.WriteText(&text); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	output := text.String()
+	// the runs observed by each invocation change, the counters would reset
+	if strings.Contains(output, " counter\n") {
+		t.Errorf("WriteText() writes counters")
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		if !strings.HasPrefix(line, "# HELP demystifier_") && !strings.HasPrefix(line, "# TYPE demystifier_") && !sampleLine.MatchString(line) {
+			t.Errorf("Invalid line %q", line)
+		}
+	}
+
+	testLabels := func(name string) string {
+		return jobLabels + `,suite="/go/src/github.com/openshift/oadp-operator/tests/e2e/backup_restore_suite_test.go",test="` + name + `"`
+	}
+	wantLines := []string{
+		"# TYPE demystifier_runs gauge",
+		"demystifier_runs{" + jobLabels + "} 2",
+		`demystifier_runs{job="",platform="",ocp_version=""} 1`,
+		"demystifier_test_failures{" + testLabels("MySQL application two Vol CSI") + "} 2",
+		"demystifier_test_attempts{" + testLabels("MySQL application two Vol CSI") + "} 6",
+		"demystifier_test_flakes{" + testLabels("MySQL application CSI") + "} 2",
+		"demystifier_test_failures{" + testLabels("MySQL application CSI") + "} 0",
+		"demystifier_test_runs{" + testLabels("MySQL application CSI") + "} 2",
+		"demystifier_known_flake_matches{" + jobLabels + `,issue="https://issues.example.com/1"} 4`,
+		"# TYPE demystifier_test_duration_seconds histogram",
+		"demystifier_test_duration_seconds_bucket{" + testLabels("MySQL application CSI") + `,le="+Inf"} 4`,
+		"demystifier_test_duration_seconds_count{" + testLabels("MySQL application CSI") + "} 4",
+	}
+	for _, want := range wantLines {
+		if !strings.Contains(output, want+"\n") {
+			t.Errorf("WriteText() misses %q", want)
+		}
+	}
+
+	suiteTests := regexp.MustCompile(`demystifier_suite_tests\{` + regexp.QuoteMeta(jobLabels) + `,suite="[^"]*",verdict="([a-z]+)"\} (\d+)`)
+	total := 0
+	for _, match := range suiteTests.FindAllStringSubmatch(output, -1) {
+		count := 0
+		for _, digit := range match[2] {
+			count = count*10 + int(digit-'0')
+		}
+		total += count
+	}
+	if total != 2*32 {
+		t.Errorf("demystifier_suite_tests sums to %d, want %d", total, 2*32)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	collector := New(Options{Buckets: []float64{60, 300}})
+	data := &utils.TestRunData{TestRun: []utils.IndividualTestRunData{{
+		Name:      `[It] Backup "mysql"`,
+		ShortName: "Backup \"mysql\"\\\n",
+		Attempt: []utils.AttemptData{
+			{Duration: 30 * time.Second, Status: utils.EventStatus{Status: utils.Failed}},
+			{Duration: 90 * time.Second, Status: utils.EventStatus{Status: utils.Failed}},
+			{Duration: 10 * time.Minute, Status: utils.EventStatus{Status: utils.Passed}},
+			{Status: utils.EventStatus{Status: utils.Skipped}},
+		},
+	}}}
+	collector.Observe(utils.JobInfo{JobName: "job", RunID: "1"}, data)
+
+	var text strings.Builder
+	if err := collector.WriteText(&text); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	series := `job="job",platform="",ocp_version="",suite="",test="Backup \"mysql\"\\\n"`
+	want := "demystifier_test_duration_seconds_bucket{" + series + `,le="60"} 1` + "\n" +
+		"demystifier_test_duration_seconds_bucket{" + series + `,le="300"} 2` + "\n" +
+		"demystifier_test_duration_seconds_bucket{" + series + `,le="+Inf"} 3` + "\n" +
+		"demystifier_test_duration_seconds_sum{" + series + "} 720\n" +
+		"demystifier_test_duration_seconds_count{" + series + "} 3\n"
+	if !strings.Contains(text.String(), want) {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", text.String(), want)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "demystifier.prom")
+	collector := New(Options{})
+	collector.Observe(utils.JobInfo{JobName: "job", RunID: "1"}, &utils.TestRunData{})
+	if err := collector.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(content), `demystifier_runs{job="job",platform="",ocp_version=""} 1`) {
+		t.Errorf("WriteFile() wrote %s, error %v", content, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("WriteFile() left %d files", len(entries))
+	}
+	if err := collector.WriteFile(filepath.Join(dir, "missing", "demystifier.prom")); err == nil {
+		t.Errorf("WriteFile() in a missing folder did not fail")
+	}
+}
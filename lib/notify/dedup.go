@@ -0,0 +1,122 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// DefaultWindow is the time during which a failure is not notified again
+	DefaultWindow = 24 * time.Hour
+	stateDirPerm  = 0o750
+)
+
+// Dedup remembers when each failure signature was notified, in a JSON file
+type Dedup struct {
+	path string
+	// Window is the time during which a failure is not notified again
+	Window   time.Duration
+	notified map[string]time.Time
+}
+
+// DefaultStateFile returns the file used when no state file is configured
+func DefaultStateFile() string {
+	if stateHome := os.Getenv("XDG_STATE_HOME"); stateHome != "" {
+		return filepath.Join(stateHome, "demystifier", "notified.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "demystifier", "notified.json")
+	}
+	return filepath.Join(home, ".local", "state", "demystifier", "notified.json")
+}
+
+// OpenDedup reads the notified signatures, a missing file has none
+func OpenDedup(path string, window time.Duration) (*Dedup, error) {
+	dedup := &Dedup{path: path, Window: window, notified: map[string]time.Time{}}
+	content, err := os.ReadFile(path) // #nosec G304 -- the file is given by the user
+	if errors.Is(err, fs.ErrNotExist) {
+		return dedup, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading notified failures: %v", err)
+	}
+	if err := json.Unmarshal(content, &dedup.notified); err != nil {
+		return nil, fmt.Errorf("error decoding notified failures %s: %v", path, err)
+	}
+	return dedup, nil
+}
+
+// Filter removes from the report the failures notified less than the
+// window ago, and counts them in Suppressed
+func (d *Dedup) Filter(report *Report, now time.Time) {
+	fresh := report.Failures[:0]
+	for _, failure := range report.Failures {
+		if notified, found := d.notified[failure.Signature]; found && now.Sub(notified) < d.Window {
+			report.Suppressed++
+			continue
+		}
+		fresh = append(fresh, failure)
+	}
+	report.Failures = fresh
+}
+
+// Mark records the failures of a report as notified and saves the file, the
+// signatures older than the window are forgotten
+func (d *Dedup) Mark(report *Report, now time.Time) error {
+	for signature, notified := range d.notified {
+		if now.Sub(notified) >= d.Window {
+			delete(d.notified, signature)
+		}
+	}
+	for i := range report.Failures {
+		d.notified[report.Failures[i].Signature] = now
+	}
+
+	content, err := json.MarshalIndent(d.notified, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding notified failures: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), stateDirPerm); err != nil {
+		return fmt.Errorf("error writing notified failures: %v", err)
+	}
+	// a temporary file of its own, created with the 0600 mode, so that two
+	// notifiers never rename a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error writing notified failures: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing notified failures: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing notified failures: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), d.path); err != nil {
+		return fmt.Errorf("error writing notified failures: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify reports the failures of test runs to chat channels and
+// webhooks, without notifying the same failure twice in a time window
+package notify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/migtools/demystifier/lib/batch"
+	"github.com/migtools/demystifier/lib/dump"
+	"github.com/migtools/demystifier/lib/fetch"
+	"github.com/migtools/demystifier/lib/summary"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+const (
+	// signatureLength is the number of hexadecimal digits of a failure signature
+	signatureLength = 16
+	// maxErrorBody bounds the response body quoted in a send error
+	maxErrorBody = 512
+)
+
+// Report is the failures of one or several runs
+type Report struct {
+	Title string `json:"title"`
+	// Runs is the number of runs, Parsed the ones that could be parsed and
+	// Failing the ones with a failed test
+	Runs     int       `json:"runs"`
+	Parsed   int       `json:"parsed"`
+	Failing  int       `json:"failing"`
+	Failures []Failure `json:"failures"`
+	// Suppressed is the number of failures already notified in the window
+	Suppressed int `json:"suppressed"`
+}
+
+// Failure is a test failing the same way in one or more runs
+type Failure struct {
+	// Signature identifies the failure across the runs: the test and its
+	// normalized failure message and location
+	Signature string `json:"signature"`
+	Test      string `json:"test"`
+	Name      string `json:"name"`
+	// Verdict is FAILED, or FLAKY when the test passed on a retry in every run
+	Verdict string `json:"verdict"`
+	// Message is the first line of the failure details
+	Message string      `json:"message,omitempty"`
+	Runs    []FailedRun `json:"runs"`
+	Issues  []string    `json:"issues,omitempty"`
+}
+
+// FailedRun is a run where a failure happened
+type FailedRun struct {
+	Location string `json:"location"`
+	Job      string `json:"job,omitempty"`
+	RunID    string `json:"runId,omitempty"`
+}
+
+// Options select the failures of a report
+type Options struct {
+	Title string
+	// Flaky also reports the tests which passed on a retry
+	Flaky bool
+	// KnownFlakes returns the issues of the known flakes found in the logs of a failed attempt, nil to skip them
+	KnownFlakes func(logs string) []string
+}
+
+// Build groups the failed tests of the runs by failure signature, the
+// failures seen in the most runs first.
+//
+// Parameters:
+//   - results: the parsed runs, see batch.Run.
+//   - opts: the title and the failures reported.
+//
+// Returns:
+//   - *Report with the failures of the runs.
+func Build(results []batch.Result, opts Options) *Report {
+	report := &Report{Title: opts.Title, Runs: len(results), Failures: []Failure{}}
+	bySignature := map[string]int{}
+	for i := range results {
+		result := &results[i]
+		if result.Err != nil || result.Data == nil {
+			continue
+		}
+		report.Parsed++
+		failing := false
+		names := summary.DisplayNames(result.Data)
+		for j := range result.Data.TestRun {
+			test := &result.Data.TestRun[j]
+			verdict := test.Verdict()
+			if verdict == utils.Failed {
+				failing = true
+			} else if verdict != utils.Flaky || !opts.Flaky {
+				continue
+			}
+
+			attempt := lastFailedAttempt(test)
+			details := dump.FailureDetails(attempt.Logs)
+			signature := Signature(test.Name, details)
+			index, found := bySignature[signature]
+			if !found {
+				index = len(report.Failures)
+				bySignature[signature] = index
+				report.Failures = append(report.Failures, Failure{
+					Signature: signature,
+					Test:      names[j],
+					Name:      test.Name,
+					Verdict:   verdict,
+				})
+				if len(details) > 0 {
+					report.Failures[index].Message = strings.TrimSpace(details[0])
+				}
+			}
+			failure := &report.Failures[index]
+			if verdict == utils.Failed {
+				failure.Verdict = utils.Failed
+			}
+			failure.Runs = append(failure.Runs, FailedRun{Location: result.Location, Job: result.Job.JobName, RunID: result.Job.RunID})
+			if opts.KnownFlakes != nil {
+				failure.Issues = appendUnique(failure.Issues, opts.KnownFlakes(strings.Join(attempt.Logs, "\n"))...)
+			}
+		}
+		if failing {
+			report.Failing++
+		}
+	}
+
+	sortFailures(report.Failures)
+	return report
+}
+
+// lastFailedAttempt returns the attempt deciding the verdict of a failed
+// test, or the failed attempt of a flaky one
+func lastFailedAttempt(test *utils.IndividualTestRunData) *utils.AttemptData {
+	for i := len(test.Attempt) - 1; i >= 0; i-- {
+		if test.Attempt[i].Status.Status == utils.Failed {
+			return &test.Attempt[i]
+		}
+	}
+	return &utils.AttemptData{}
+}
+
+// Signature identifies a failure by the test and its failure details,
+// normalized so that the same failure has the same signature in every run
+func Signature(testName string, details []string) string {
+	parts := []string{testName}
+	for _, line := range details {
+		if line == "" {
+			break
+		}
+		parts = append(parts, utils.NormalizeLine(strings.TrimSpace(line)))
+	}
+	// the message and the location, the lines between them hold the values
+	if len(parts) > 3 {
+		parts = []string{parts[0], parts[1], parts[len(parts)-1]}
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])[:signatureLength]
+}
+
+// sortFailures puts the failures seen in the most runs first, the failed
+// tests before the flaky ones
+func sortFailures(failures []Failure) {
+	sort.SliceStable(failures, func(i, j int) bool {
+		if (failures[i].Verdict == utils.Failed) != (failures[j].Verdict == utils.Failed) {
+			return failures[i].Verdict == utils.Failed
+		}
+		return len(failures[i].Runs) > len(failures[j].Runs)
+	})
+}
+
+func appendUnique(values []string, added ...string) []string {
+	for _, value := range added {
+		found := false
+		for _, existing := range values {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Send posts a JSON payload to a webhook, such as a Slack incoming webhook
+func Send(client fetch.HTTPClient, url string, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error sending notification: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending notification: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("error sending notification: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
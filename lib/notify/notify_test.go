@@ -0,0 +1,201 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/batch"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+const (
+	jobURL = "https://prow.ci.openshift.org/view/gs/test-platform-results/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic/"
+)
+
+// fixtureResults are two runs of the fixture log and a run that could not be parsed
+func fixtureResults(t *testing.T) []batch.Result {
+	var results []batch.Result
+	for _, id := range []string{"101", "102"} {
+		results = append(results, batch.Result{Location: jobURL + id, Job: utils.GetJobInfo(jobURL + id), Data: fixture.Parse(t)})
+	}
+	return append(results, batch.Result{Location: jobURL + "103", Err: errors.New("not found")})
+}
+
+func TestBuild(t *testing.T) {
+	results := fixtureResults(t)
+	knownFlakes := func(logs string) []string {
+		if strings.Contains(logs, "backup=openshift-adp/mysql-csi-e2e") {
+			return []string{"https://issues.example.com/1"}
+		}
+		return nil
+	}
+
+	report := Build(results, Options{Title: "Periodic jobs", KnownFlakes: knownFlakes})
+	if report.Title != "Periodic jobs" || report.Runs != 3 || report.Parsed != 2 || report.Failing != 2 || len(report.Failures) != 1 {
+		t.Fatalf("Build() = %+v", report)
+	}
+	failure := report.Failures[0]
+	if failure.Test != "MySQL application two Vol CSI" || failure.Verdict != utils.Failed || len(failure.Runs) != 2 ||
+		failure.Runs[1].RunID != "102" || failure.Runs[1].Job != "periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic" ||
+		failure.Message != "[FAILED] No known FLAKE found in a previous run, marking test as failed." || len(failure.Issues) != 0 {
+		t.Errorf("Build() failure = %+v", failure)
+	}
+
+	report = Build(results, Options{Flaky: true, KnownFlakes: knownFlakes})
+	if len(report.Failures) != 2 {
+		t.Fatalf("Build() with the flaky tests has %d failures, want 2", len(report.Failures))
+	}
+	flaky := report.Failures[1]
+	if flaky.Test != "MySQL application CSI" || flaky.Verdict != utils.Flaky || len(flaky.Runs) != 2 ||
+		len(flaky.Issues) != 1 || flaky.Issues[0] != "https://issues.example.com/1" {
+		t.Errorf("Build() flaky failure = %+v", flaky)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	details := func(timestamp, uuid string) []string {
+		return []string{
+			"  [FAILED] Backup mysql-" + uuid + " failed",
+			"  Expected <bool>: false",
+			"  In [It] at: /tests/e2e/backup_restore_suite_test.go:287 @ " + timestamp,
+			"",
+			"  [FAILED] in [AfterEach] another failure",
+		}
+	}
+	base := details("02/14/24 20:07:03.8", "fc83d856-cb71-11ee-a3a2-0a580a813019")
+	first := Signature("[It] MySQL", base)
+	tests := []struct {
+		name     string
+		testName string
+		details  []string
+		wantSame bool
+	}{
+		{"Other run", "[It] MySQL", details("02/15/24 08:12:44.1", "0b1c2d3e-cb71-11ee-a3a2-0a580a813019"), true},
+		{"Other values", "[It] MySQL", []string{base[0], "  Expected <bool>: true", base[2]}, true},
+		{"Other test", "[It] Mongo", base, false},
+		{"Other location", "[It] MySQL", []string{base[0], "  In [It] at: /tests/e2e/backup_restore_suite_test.go:300 @ 02/14/24 20:07:03.8"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Signature(tt.testName, tt.details); (got == first) != tt.wantSame || len(got) != signatureLength {
+				t.Errorf("Signature() = %s, first %s, want same %v", got, first, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestDedup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "notified.json")
+	now := time.Date(2024, 2, 14, 8, 0, 0, 0, time.UTC)
+	newReport := func() *Report {
+		return &Report{Failures: []Failure{{Signature: "a"}, {Signature: "b"}}}
+	}
+
+	dedup, err := OpenDedup(path, DefaultWindow)
+	if err != nil {
+		t.Fatalf("OpenDedup() error = %v", err)
+	}
+	report := newReport()
+	dedup.Filter(report, now)
+	if len(report.Failures) != 2 || report.Suppressed != 0 {
+		t.Fatalf("Filter() without state = %+v", report)
+	}
+	report.Failures = report.Failures[:1]
+	if err := dedup.Mark(report, now); err != nil {
+		t.Fatalf("Mark() error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		at             time.Time
+		wantSignatures string
+		wantSuppressed int
+	}{
+		{"Within the window", now.Add(23 * time.Hour), "b", 1},
+		{"After the window", now.Add(24 * time.Hour), "a,b", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reopened, err := OpenDedup(path, DefaultWindow)
+			if err != nil {
+				t.Fatalf("OpenDedup() error = %v", err)
+			}
+			report := newReport()
+			reopened.Filter(report, tt.at)
+			var signatures []string
+			for _, failure := range report.Failures {
+				signatures = append(signatures, failure.Signature)
+			}
+			if strings.Join(signatures, ",") != tt.wantSignatures || report.Suppressed != tt.wantSuppressed {
+				t.Errorf("Filter() kept %v, suppressed %d", signatures, report.Suppressed)
+			}
+		})
+	}
+
+	// the expired signatures are forgotten
+	if err := dedup.Mark(&Report{Failures: []Failure{{Signature: "b"}}}, now.Add(48*time.Hour)); err != nil {
+		t.Fatalf("Mark() error = %v", err)
+	}
+	if content, _ := os.ReadFile(path); strings.Contains(string(content), `"a"`) {
+		t.Errorf("Mark() kept an expired signature: %s", content)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Mark() left %d files in the state folder", len(entries))
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenDedup(path, DefaultWindow); err == nil {
+		t.Errorf("OpenDedup() of a broken file did not fail")
+	}
+}
+
+func TestSend(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, r.Header.Get("Content-Type")+" "+string(body))
+		if strings.Contains(string(body), "broken") {
+			http.Error(w, "invalid_blocks", http.StatusBadRequest)
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	if err := Send(http.DefaultClient, server.URL, []byte(`{"text": "hello"}`)); err != nil {
+		t.Errorf("Send() error = %v", err)
+	}
+	err := Send(http.DefaultClient, server.URL, []byte(`{"text": "broken"}`))
+	if err == nil || !strings.Contains(err.Error(), "400 Bad Request: invalid_blocks") {
+		t.Errorf("Send() of a refused payload error = %v", err)
+	}
+	if len(received) != 2 || received[0] != `application/json {"text": "hello"}` {
+		t.Errorf("Received %q", received)
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// The payload formats
+const (
+	FormatSlack   = "slack"
+	FormatWebhook = "webhook"
+)
+
+// Slack limits, see https://api.slack.com/reference/block-kit/blocks
+const (
+	maxSlackBlocks      = 50
+	maxSlackHeaderText  = 150
+	maxSlackSectionText = 3000
+	// maxSlackFailures leaves room for the header, summary and overflow blocks
+	maxSlackFailures = maxSlackBlocks - 5
+	// maxSlackRunLinks bounds the runs linked for a failure
+	maxSlackRunLinks = 5
+)
+
+// Formats returns the payload formats
+func Formats() []string {
+	return []string{FormatSlack, FormatWebhook}
+}
+
+// Payload renders a report in a format
+func Payload(report *Report, format string) ([]byte, error) {
+	switch format {
+	case FormatSlack:
+		return Slack(report)
+	case FormatWebhook:
+		return Webhook(report)
+	default:
+		return nil, fmt.Errorf("unknown payload format %q, expected one of %s", format, strings.Join(Formats(), ", "))
+	}
+}
+
+// Webhook renders a report as the generic JSON payload, the report itself
+func Webhook(report *Report) ([]byte, error) {
+	return json.MarshalIndent(report, "", "  ")
+}
+
+// slackBlock is a Block Kit block
+type slackBlock map[string]interface{}
+
+// Slack renders a report as a Slack Block Kit message, with a plain text
+// fallback for the notifications
+func Slack(report *Report) ([]byte, error) {
+	blocks := []slackBlock{
+		{"type": "header", "text": slackText("plain_text", truncate(report.Title, maxSlackHeaderText))},
+		{"type": "section", "text": slackText("mrkdwn", summaryLine(report))},
+	}
+	if len(report.Failures) > 0 {
+		blocks = append(blocks, slackBlock{"type": "divider"})
+	}
+	for i := range report.Failures {
+		if i == maxSlackFailures {
+			blocks = append(blocks, slackBlock{"type": "context", "elements": []interface{}{
+				slackText("mrkdwn", fmt.Sprintf("and %d more failures", len(report.Failures)-maxSlackFailures)),
+			}})
+			break
+		}
+		blocks = append(blocks, slackBlock{"type": "section", "text": slackText("mrkdwn", slackFailure(&report.Failures[i]))})
+	}
+
+	message := map[string]interface{}{
+		"text":   report.Title + ": " + summaryLine(report),
+		"blocks": blocks,
+	}
+	return json.MarshalIndent(message, "", "  ")
+}
+
+func slackText(kind, text string) map[string]interface{} {
+	return map[string]interface{}{"type": kind, "text": text}
+}
+
+// summaryLine counts the failures and the runs
+func summaryLine(report *Report) string {
+	failed, flaky := 0, 0
+	for i := range report.Failures {
+		if report.Failures[i].Verdict == utils.Failed {
+			failed++
+		} else {
+			flaky++
+		}
+	}
+	line := fmt.Sprintf("%d failures and %d flakes in %d of %d runs", failed, flaky, report.Failing, report.Runs)
+	if report.Parsed < report.Runs {
+		line += fmt.Sprintf(", %d runs could not be parsed", report.Runs-report.Parsed)
+	}
+	if report.Suppressed > 0 {
+		line += fmt.Sprintf(", %d already notified", report.Suppressed)
+	}
+	return line
+}
+
+// slackFailure describes a failure in Slack mrkdwn
+func slackFailure(failure *Failure) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s* %s in %d runs", slackEscape(failure.Test), failure.Verdict, len(failure.Runs))
+	if failure.Message != "" {
+		fmt.Fprintf(&b, "\n`%s`", strings.ReplaceAll(slackEscape(truncate(failure.Message, 300)), "`", "'"))
+	}
+	var runs []string
+	for i, run := range failure.Runs {
+		if i == maxSlackRunLinks {
+			runs = append(runs, fmt.Sprintf("and %d more", len(failure.Runs)-maxSlackRunLinks))
+			break
+		}
+		label := run.RunID
+		if label == "" {
+			label = fmt.Sprintf("run %d", i+1)
+		}
+		runs = append(runs, slackLink(run.Location, label))
+	}
+	fmt.Fprintf(&b, "\nRuns: %s", strings.Join(runs, ", "))
+	if len(failure.Issues) > 0 {
+		var issues []string
+		for _, issue := range failure.Issues {
+			issues = append(issues, slackLink(issue, issue[strings.LastIndex(issue, "/")+1:]))
+		}
+		fmt.Fprintf(&b, "\nKnown issues: %s", strings.Join(issues, ", "))
+	}
+	return truncate(b.String(), maxSlackSectionText)
+}
+
+// slackLink links a URL, other locations are shown as they are
+func slackLink(location, label string) string {
+	if !strings.HasPrefix(location, "https://") && !strings.HasPrefix(location, "http://") {
+		return slackEscape(location)
+	}
+	return "<" + strings.NewReplacer("|", "%7C", ">", "%3E").Replace(location) + "|" + slackEscape(label) + ">"
+}
+
+// slackEscape escapes the control characters of Slack mrkdwn
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// truncate shortens a text to at most limit bytes, on a rune boundary
+func truncate(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	const ellipsis = "…"
+	cut := limit - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + ellipsis
+}
+
+// templateFuncs are the functions of the payload templates
+var templateFuncs = template.FuncMap{
+	// json writes a value as JSON, strings in templates must be written with it
+	"json": func(value interface{}) (string, error) {
+		content, err := json.Marshal(value)
+		return string(content), err
+	},
+	"join":     strings.Join,
+	"truncate": func(limit int, text string) string { return truncate(text, limit) },
+}
+
+// ParseTemplate reads a payload template, a Go text/template executed on
+// the Report with the json, join and truncate functions
+func ParseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// Render executes a payload template on a report, the payload must be JSON
+func Render(tmpl *template.Template, report *Report) ([]byte, error) {
+	var payload bytes.Buffer
+	if err := tmpl.Execute(&payload, report); err != nil {
+		return nil, fmt.Errorf("error executing template: %v", err)
+	}
+	if !json.Valid(payload.Bytes()) {
+		return nil, errors.New("error executing template: the payload is not valid JSON, write the strings with the json function")
+	}
+	return payload.Bytes(), nil
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// slackMessage is the part of a Block Kit message checked by the tests
+type slackMessage struct {
+	Text   string `json:"text"`
+	Blocks []struct {
+		Type string `json:"type"`
+		Text struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"text"`
+		Elements []struct {
+			Text string `json:"text"`
+		} `json:"elements"`
+	} `json:"blocks"`
+}
+
+func TestSlack(t *testing.T) {
+	report := &Report{
+		Title:   "Periodic jobs",
+		Runs:    3,
+		Parsed:  2,
+		Failing: 2,
+		Failures: []Failure{{
+			Test:    "Restore <mysql> & check",
+			Verdict: utils.Failed,
+			Message: "[FAILED] Expected `true`",
+			Runs: []FailedRun{
+				{Location: "https://prow.example.com/view/gs/logs/job/101", RunID: "101"},
+				{Location: "/tmp/build-log.txt"},
+			},
+			Issues: []string{"https://github.com/openshift/oadp-operator/issues/1234"},
+		}},
+		Suppressed: 1,
+	}
+
+	payload, err := Slack(report)
+	if err != nil {
+		t.Fatalf("Slack() error = %v", err)
+	}
+	var message slackMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		t.Fatalf("Slack() payload is not JSON: %v", err)
+	}
+	summary := "1 failures and 0 flakes in 2 of 3 runs, 1 runs could not be parsed, 1 already notified"
+	if message.Text != "Periodic jobs: "+summary {
+		t.Errorf("Slack() text = %q", message.Text)
+	}
+	var types []string
+	for _, block := range message.Blocks {
+		types = append(types, block.Type)
+	}
+	if want := []string{"header", "section", "divider", "section"}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("Slack() blocks = %v, want %v", types, want)
+	}
+	if message.Blocks[0].Text.Type != "plain_text" || message.Blocks[0].Text.Text != "Periodic jobs" || message.Blocks[1].Text.Text != summary {
+		t.Errorf("Slack() header and summary = %+v", message.Blocks[:2])
+	}
+	wantFailure := "*Restore &lt;mysql&gt; &amp; check* FAILED in 2 runs\n" +
+		"`[FAILED] Expected 'true'`\n" +
+		"Runs: <https://prow.example.com/view/gs/logs/job/101|101>, /tmp/build-log.txt\n" +
+		"Known issues: <https://github.com/openshift/oadp-operator/issues/1234|1234>"
+	if got := message.Blocks[3].Text.Text; got != wantFailure {
+		t.Errorf("Slack() failure =\n%s\nwant\n%s", got, wantFailure)
+	}
+
+	// the blocks stay below the limit of Slack
+	report.Title = strings.Repeat("é", 100)
+	report.Failures = nil
+	for i := 0; i < 60; i++ {
+		report.Failures = append(report.Failures, Failure{Test: fmt.Sprintf("test %d", i), Verdict: utils.Flaky, Runs: []FailedRun{{Location: "x"}}})
+	}
+	if payload, err = Slack(report); err != nil {
+		t.Fatalf("Slack() error = %v", err)
+	}
+	message = slackMessage{}
+	if err := json.Unmarshal(payload, &message); err != nil {
+		t.Fatalf("Slack() payload is not JSON: %v", err)
+	}
+	last := message.Blocks[len(message.Blocks)-1]
+	if len(message.Blocks) > maxSlackBlocks || last.Type != "context" || last.Elements[0].Text != "and 15 more failures" {
+		t.Errorf("Slack() of 60 failures has %d blocks, the last one %+v", len(message.Blocks), last)
+	}
+	if header := message.Blocks[0].Text.Text; len(header) > maxSlackHeaderText || !strings.HasSuffix(header, "é…") {
+		t.Errorf("Slack() header = %q", header)
+	}
+}
+
+func TestPayloads(t *testing.T) {
+	report := &Report{Title: "Nightly", Runs: 1, Parsed: 1, Failing: 1, Failures: []Failure{
+		{Signature: "0123456789abcdef", Test: `Backup "csi"`, Verdict: utils.Failed, Runs: []FailedRun{{Location: "a", RunID: "1"}}},
+	}}
+
+	payload, err := Payload(report, FormatWebhook)
+	if err != nil {
+		t.Fatalf("Payload() error = %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(payload, &decoded); err != nil || !reflect.DeepEqual(&decoded, report) {
+		t.Errorf("Payload() webhook = %s, error %v", payload, err)
+	}
+	if _, err := Payload(report, "teams"); err == nil || !strings.Contains(err.Error(), "expected one of slack, webhook") {
+		t.Errorf("Payload() of an unknown format error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  string
+	}{
+		{
+			name: "Teams card",
+			template: `{"title": {{json .Title}}, "text": {{json (printf "%d failures" (len .Failures))}}, "tests": [` +
+				`{{range $i, $f := .Failures}}{{if $i}}, {{end}}{{json $f.Test}}{{end}}]}`,
+			want: `{"title": "Nightly", "text": "1 failures", "tests": ["Backup \"csi\""]}`,
+		},
+		{
+			name:     "Truncated",
+			template: `{"text": {{json (truncate 9 (index .Failures 0).Test)}}}`,
+			want:     `{"text": "Backup…"}`,
+		},
+		{
+			name:     "Unquoted strings",
+			template: `{"text": "{{(index .Failures 0).Test}}"}`,
+			wantErr:  "the payload is not valid JSON",
+		},
+		{
+			name:     "Unknown field",
+			template: `{"text": {{json .Summary}}}`,
+			wantErr:  "error executing template",
+		},
+		{
+			name:     "Syntax error",
+			template: `{"text": {{json .Title}`,
+			wantErr:  "error parsing template",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tt.name, tt.template)
+			var payload []byte
+			if err == nil {
+				payload, err = Render(tmpl, report)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Render() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || string(payload) != tt.want {
+				t.Errorf("Render() = %s, error %v, want %s", payload, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oadp
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// Scopes of the velero describe warnings and errors
+const (
+	ScopeVelero     = "Velero"
+	ScopeCluster    = "Cluster"
+	ScopeNamespaces = "Namespaces"
+)
+
+const (
+	warningsSection = "Warnings"
+	errorsSection   = "Errors"
+	noneValue       = "<none>"
+)
+
+var (
+	// top level keys are indented by two spaces, nested ones by four and six
+	describeKeyRegex       = regexp.MustCompile(`^  ([A-Za-z][^:]*):(?:\s+(.*))?$`)
+	describeScopeRegex     = regexp.MustCompile(`^    (Velero|Cluster|Namespaces):(?:\s+(.*))?$`)
+	describeNamespaceRegex = regexp.MustCompile(`^      (\S+):\s+(.*)$`)
+	// the describe output ends with the next unindented line or Ginkgo marker
+	describeEndRegex = regexp.MustCompile(`^(\S|\s*[\[<>])`)
+	resourceRegex    = regexp.MustCompile(`\b([A-Z][A-Za-z0-9]*) "([^"]+)"`)
+)
+
+// ParseDescribe parses the velero describe output of the named Backup or
+// Restore found in the log lines.
+//
+// Parameters:
+//   - lines: log lines containing the describe output.
+//   - name: the name of the Backup or Restore, as printed on the "Name:" line.
+//
+// Returns:
+//   - *utils.DescribeData with the phase, the top level fields and the
+//     structured warnings and errors, or nil if no describe output was found.
+func ParseDescribe(lines []string, name string) *utils.DescribeData {
+	start := -1
+	for i, line := range lines {
+		if matches := describeNameRegex.FindStringSubmatch(line); matches != nil && matches[1] == name {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+
+	describe := &utils.DescribeData{
+		Name:   name,
+		Fields: make(map[string]string),
+	}
+
+	var (
+		section   string
+		scope     string
+		namespace string
+	)
+
+	addMessage := func(message string) {
+		message = strings.TrimSpace(message)
+		if message == "" || message == noneValue {
+			return
+		}
+		describeMessage := utils.DescribeMessage{
+			Scope:     scope,
+			Namespace: namespace,
+			Message:   message,
+		}
+		if matches := resourceRegex.FindStringSubmatch(message); matches != nil {
+			describeMessage.Kind = matches[1]
+			describeMessage.Resource = matches[2]
+		}
+		if section == warningsSection {
+			describe.Warnings = append(describe.Warnings, describeMessage)
+		} else {
+			describe.Errors = append(describe.Errors, describeMessage)
+		}
+	}
+
+	for _, line := range lines[start:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if describeEndRegex.MatchString(line) {
+			break
+		}
+
+		if matches := describeKeyRegex.FindStringSubmatch(line); matches != nil {
+			section, scope, namespace = "", "", ""
+			key, value := matches[1], strings.TrimSpace(matches[2])
+			describe.Fields[key] = value
+			switch key {
+			case "Phase":
+				if phase := strings.Fields(value); len(phase) > 0 {
+					describe.Phase = phase[0]
+				}
+			case warningsSection, errorsSection:
+				section = key
+			}
+			continue
+		}
+
+		if section == "" {
+			continue
+		}
+
+		if matches := describeScopeRegex.FindStringSubmatch(line); matches != nil {
+			scope, namespace = matches[1], ""
+			addMessage(matches[2])
+		} else if matches := describeNamespaceRegex.FindStringSubmatch(line); matches != nil && scope == ScopeNamespaces {
+			namespace = matches[1]
+			addMessage(matches[2])
+		} else {
+			// continuation of the previous scope or namespace
+			addMessage(line)
+		}
+	}
+
+	return describe
+}
+
+// GroupMessages groups the describe messages by namespace and resource kind.
+// Messages outside of a namespace are grouped under their scope.
+func GroupMessages(messages []utils.DescribeMessage) map[string]map[string][]utils.DescribeMessage {
+	groups := make(map[string]map[string][]utils.DescribeMessage)
+	for _, message := range messages {
+		namespace := message.Namespace
+		if namespace == "" {
+			namespace = message.Scope
+		}
+		if groups[namespace] == nil {
+			groups[namespace] = make(map[string][]utils.DescribeMessage)
+		}
+		groups[namespace][message.Kind] = append(groups[namespace][message.Kind], message)
+	}
+	return groups
+}
+
+// DiffMessages compares the describe messages of two events, typically
+// a failing attempt and its passing retry. Variable tokens such as UUIDs
+// are normalized before comparing.
+//
+// Returns:
+//   - onlyFirst: messages found only in the first list.
+//   - onlySecond: messages found only in the second list.
+func DiffMessages(first, second []utils.DescribeMessage) (onlyFirst, onlySecond []utils.DescribeMessage) {
+	firstKeys := make(map[string]bool)
+	secondKeys := make(map[string]bool)
+	for _, message := range first {
+		firstKeys[messageKey(message)] = true
+	}
+	for _, message := range second {
+		secondKeys[messageKey(message)] = true
+	}
+	for _, message := range first {
+		if !secondKeys[messageKey(message)] {
+			onlyFirst = append(onlyFirst, message)
+		}
+	}
+	for _, message := range second {
+		if !firstKeys[messageKey(message)] {
+			onlySecond = append(onlySecond, message)
+		}
+	}
+	return onlyFirst, onlySecond
+}
+
+func messageKey(message utils.DescribeMessage) string {
+	return strings.Join([]string{
+		message.Scope,
+		message.Namespace,
+		message.Kind,
+		utils.NormalizeLine(message.Message),
+	}, "\x00")
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oadp
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+const (
+	describeFile = "../../tests/testdata/velerodescribe/restore-describe.txt"
+	restoreName  = "mysql-csi-e2e-8964018f-cb72-11ee-a3a2-0a580a813019"
+)
+
+func readDescribeFixture(t *testing.T) []string {
+	t.Helper()
+	data, err := os.ReadFile(describeFile)
+	if err != nil {
+		t.Fatalf("Error reading describe file: %v", err)
+	}
+	return strings.Split(string(data), "\n")
+}
+
+func TestParseDescribe(t *testing.T) {
+	describe := ParseDescribe(readDescribeFixture(t), restoreName)
+	if describe == nil {
+		t.Fatal("Describe output not found")
+	}
+
+	if describe.Phase != PhasePartiallyFailed {
+		t.Errorf("Expected phase %s, got %s", PhasePartiallyFailed, describe.Phase)
+	}
+	if describe.Fields["Restore PVs"] != "auto" {
+		t.Errorf("Expected Restore PVs auto, got %q", describe.Fields["Restore PVs"])
+	}
+
+	wantWarnings := []utils.DescribeMessage{
+		{Scope: ScopeCluster, Kind: "VolumeSnapshotContent", Resource: "snapcontent-a2a24ab4-ff33-45e7-8585-eeeeaed57e7e"},
+		{Scope: ScopeNamespaces, Namespace: "mysql-persistent", Kind: "ConfigMap", Resource: "kube-root-ca.crt"},
+		{Scope: ScopeNamespaces, Namespace: "mysql-persistent", Kind: "ConfigMap", Resource: "openshift-service-ca.crt"},
+		{Scope: ScopeNamespaces, Namespace: "mysql-persistent", Kind: "RoleBinding", Resource: "system:deployers"},
+	}
+	wantErrors := []utils.DescribeMessage{
+		{Scope: ScopeVelero},
+		{Scope: ScopeNamespaces, Namespace: "mysql-persistent", Kind: "PersistentVolumeClaim", Resource: "mysql"},
+		{Scope: ScopeNamespaces, Namespace: "todolist", Kind: "Pod", Resource: "todolist-1-z9b4v"},
+	}
+
+	compare := func(kind string, got, want []utils.DescribeMessage) {
+		if len(got) != len(want) {
+			t.Fatalf("Expected %d %s, got %d: %v", len(want), kind, len(got), got)
+		}
+		for i := range want {
+			if got[i].Scope != want[i].Scope || got[i].Namespace != want[i].Namespace ||
+				got[i].Kind != want[i].Kind || got[i].Resource != want[i].Resource {
+				t.Errorf("Expected %s %d to be %+v, got %+v", kind, i, want[i], got[i])
+			}
+			if got[i].Message == "" {
+				t.Errorf("Expected %s %d to have a message", kind, i)
+			}
+		}
+	}
+	compare("warnings", describe.Warnings, wantWarnings)
+	compare("errors", describe.Errors, wantErrors)
+}
+
+func TestParseDescribeNotFound(t *testing.T) {
+	if describe := ParseDescribe(readDescribeFixture(t), "other-restore"); describe != nil {
+		t.Errorf("Expected no describe output, got %+v", describe)
+	}
+}
+
+func TestGroupMessages(t *testing.T) {
+	describe := ParseDescribe(readDescribeFixture(t), restoreName)
+	groups := GroupMessages(describe.Warnings)
+
+	if got := len(groups["mysql-persistent"]["ConfigMap"]); got != 2 {
+		t.Errorf("Expected 2 ConfigMap warnings in mysql-persistent, got %d", got)
+	}
+	if got := len(groups["mysql-persistent"]["RoleBinding"]); got != 1 {
+		t.Errorf("Expected 1 RoleBinding warning in mysql-persistent, got %d", got)
+	}
+	if got := len(groups[ScopeCluster]["VolumeSnapshotContent"]); got != 1 {
+		t.Errorf("Expected 1 cluster VolumeSnapshotContent warning, got %d", got)
+	}
+}
+
+func TestDiffMessages(t *testing.T) {
+	describe := ParseDescribe(readDescribeFixture(t), restoreName)
+
+	// The retry created a different snapshot content and no RoleBinding warning
+	retry := make([]utils.DescribeMessage, 0, len(describe.Warnings))
+	for _, warning := range describe.Warnings {
+		switch warning.Kind {
+		case "RoleBinding":
+			continue
+		case "VolumeSnapshotContent":
+			warning.Message = strings.ReplaceAll(warning.Message,
+				"a2a24ab4-ff33-45e7-8585-eeeeaed57e7e", "38180f6e-b566-49de-92df-a6bc731f0370")
+		}
+		retry = append(retry, warning)
+	}
+
+	onlyFailing, onlyPassing := DiffMessages(describe.Warnings, retry)
+	if len(onlyFailing) != 1 || onlyFailing[0].Kind != "RoleBinding" {
+		t.Errorf("Expected only the RoleBinding warning in the failing attempt, got %v", onlyFailing)
+	}
+	if len(onlyPassing) != 0 {
+		t.Errorf("Expected no warning only in the passing attempt, got %v", onlyPassing)
+	}
+}
+
+func TestEventDescribe(t *testing.T) {
+	testData := parseTestLog(t)
+	attempt := findAttempt(t, testData, "/go/src/github.com/openshift/oadp-operator/tests/e2e/must-gather_suite_test.go:76", 0)
+
+	restore := attempt.Events[1].Describe
+	if restore == nil {
+		t.Fatal("Expected the restore to have a describe output")
+	}
+	if restore.Phase != PhaseCompleted {
+		t.Errorf("Expected phase %s, got %s", PhaseCompleted, restore.Phase)
+	}
+	if len(restore.Warnings) != 5 || len(restore.Errors) != 0 {
+		t.Errorf("Expected 5 warnings and no errors, got %d and %d", len(restore.Warnings), len(restore.Errors))
+	}
+}
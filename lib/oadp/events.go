@@ -0,0 +1,203 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package oadp extracts OADP and Velero specific data from the test logs
+package oadp
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kinds of the Velero events
+const (
+	Backup  = "Backup"
+	Restore = "Restore"
+)
+
+// Velero phases that end a Backup or a Restore
+const (
+	PhaseCompleted        = "Completed"
+	PhaseFailed           = "Failed"
+	PhasePartiallyFailed  = "PartiallyFailed"
+	PhaseFailedValidation = "FailedValidation"
+)
+
+var (
+	createRegex = regexp.MustCompile(`Creating (backup|restore) (\S+) for case`)
+	phaseRegex  = regexp.MustCompile(`(backup|restore) phase: (\w+)`)
+	// velero describe output is indented by two spaces in the e2e logs
+	describeNameRegex  = regexp.MustCompile(`^  Name:\s+(\S+)`)
+	describePhaseRegex = regexp.MustCompile(`^  Phase:\s+(\w+)`)
+	itemsTotalRegex    = regexp.MustCompile(`^  Total items to be (?:backed up|restored):\s+(\d+)`)
+	itemsDoneRegex     = regexp.MustCompile(`^  Items (?:backed up|restored):\s+(\d+)`)
+	exitRegex          = regexp.MustCompile(`< Exit \[`)
+)
+
+// SetEventsFromTestRun extracts the Velero events of every attempt
+// in the test run and stores them in the attempt Events.
+func SetEventsFromTestRun(testRunData *utils.TestRunData) {
+	for i := range testRunData.TestRun {
+		thisTest := &testRunData.TestRun[i]
+		for j := range thisTest.Attempt {
+			thisAttempt := &thisTest.Attempt[j]
+			thisAttempt.Events = ExtractEvents(thisAttempt)
+		}
+	}
+}
+
+// ExtractEvents builds one EventData per Velero Backup or Restore created
+// inside the attempt.
+// An event starts with the "Creating backup/restore" line and collects the
+// following lines, including the velero describe output, until the next
+// event is created or a Ginkgo node exits.
+//
+// Parameters:
+//   - attempt: the attempt to extract the events from.
+//
+// Returns:
+//   - []utils.EventData with the name, phase transitions, start and end time,
+//     duration, item counts and final status of each event.
+func ExtractEvents(attempt *utils.AttemptData) []utils.EventData {
+	var events []utils.EventData
+	var current *utils.EventData
+
+	for i, line := range attempt.Logs {
+		lineTime := time.Time{}
+		if i < len(attempt.LogTimes) {
+			lineTime = attempt.LogTimes[i]
+		}
+
+		if matches := createRegex.FindStringSubmatch(line); matches != nil {
+			closeEvent(current)
+			events = append(events, utils.EventData{
+				Kind:      kindFromLog(matches[1]),
+				Name:      matches[2],
+				StartTime: lineTime,
+			})
+			current = &events[len(events)-1]
+			log.WithFields(log.Fields{
+				"Kind": current.Kind,
+				"Name": current.Name,
+			}).Debug("Found Velero event")
+		}
+
+		if current == nil {
+			continue
+		}
+
+		if exitRegex.MatchString(line) {
+			closeEvent(current)
+			current = nil
+			continue
+		}
+
+		current.Logs = append(current.Logs, line)
+		if !lineTime.IsZero() && !isFinished(current) {
+			current.EndTime = lineTime
+		}
+
+		if matches := phaseRegex.FindStringSubmatch(line); matches != nil && kindFromLog(matches[1]) == current.Kind {
+			setPhase(current, matches[2], lineTime)
+		} else if matches := describeNameRegex.FindStringSubmatch(line); matches != nil && matches[1] != current.Name {
+			// The describe output of another object, stop collecting
+			closeEvent(current)
+			current = nil
+		} else if matches := describePhaseRegex.FindStringSubmatch(line); matches != nil && !isFinished(current) {
+			setPhase(current, matches[1], current.EndTime)
+		} else if matches := itemsTotalRegex.FindStringSubmatch(line); matches != nil {
+			current.ItemsTotal, _ = strconv.Atoi(matches[1])
+		} else if matches := itemsDoneRegex.FindStringSubmatch(line); matches != nil {
+			current.ItemsDone, _ = strconv.Atoi(matches[1])
+		}
+	}
+	closeEvent(current)
+
+	return events
+}
+
+// PhaseDurations returns how long the event stayed in each of its phases.
+// The final phase of a finished event has no duration.
+func PhaseDurations(event *utils.EventData) map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+	for i := range event.Phases {
+		end := event.EndTime
+		if i+1 < len(event.Phases) {
+			end = event.Phases[i+1].Time
+		}
+		durations[event.Phases[i].Phase] += end.Sub(event.Phases[i].Time)
+	}
+	return durations
+}
+
+// IsTerminalPhase returns whether the Velero phase ends a Backup or a Restore
+func IsTerminalPhase(phase string) bool {
+	switch phase {
+	case PhaseCompleted, PhaseFailed, PhasePartiallyFailed, PhaseFailedValidation:
+		return true
+	}
+	return false
+}
+
+func setPhase(event *utils.EventData, phase string, phaseTime time.Time) {
+	if event.Phase == phase {
+		return
+	}
+	event.Phase = phase
+	event.Phases = append(event.Phases, utils.PhaseTransition{Phase: phase, Time: phaseTime})
+	if !phaseTime.IsZero() {
+		event.EndTime = phaseTime
+	}
+
+	switch phase {
+	case PhaseCompleted:
+		event.Status.SetPassing()
+	case PhaseFailed, PhasePartiallyFailed, PhaseFailedValidation:
+		event.Status.SetFailed()
+	}
+}
+
+// closeEvent computes the duration of the event and parses its describe
+// output, an event that never reached a terminal phase before the attempt
+// moved on is timed out
+func closeEvent(event *utils.EventData) {
+	if event == nil {
+		return
+	}
+	event.Describe = ParseDescribe(event.Logs, event.Name)
+	if !isFinished(event) {
+		event.Status.SetTimeout()
+	}
+	if !event.StartTime.IsZero() && !event.EndTime.IsZero() {
+		event.Duration = event.EndTime.Sub(event.StartTime)
+	}
+}
+
+func isFinished(event *utils.EventData) bool {
+	return IsTerminalPhase(event.Phase)
+}
+
+func kindFromLog(kind string) string {
+	if strings.EqualFold(kind, Restore) {
+		return Restore
+	}
+	return Backup
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oadp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+func parseTestLog(t *testing.T) *utils.TestRunData {
+	t.Helper()
+	testData := fixture.Parse(t)
+	if got := fixture.CountAttempts(testData); got != fixture.AttemptCount {
+		t.Fatalf("Expected %d attempts, got %d", fixture.AttemptCount, got)
+	}
+	SetEventsFromTestRun(testData)
+	return testData
+}
+
+func findAttempt(t *testing.T, testData *utils.TestRunData, name string, attemptNo int) *utils.AttemptData {
+	t.Helper()
+	for i := range testData.TestRun {
+		if testData.TestRun[i].Name == name {
+			return &testData.TestRun[i].Attempt[attemptNo]
+		}
+	}
+	t.Fatalf("Test %s not found", name)
+	return nil
+}
+
+func TestExtractEvents(t *testing.T) {
+	testData := parseTestLog(t)
+
+	type want struct {
+		kind       string
+		name       string
+		phases     []string
+		status     string
+		duration   time.Duration
+		itemsTotal int
+		itemsDone  int
+	}
+	tests := []struct {
+		name      string
+		testName  string
+		attemptNo int
+		want      []want
+	}{
+		{
+			name:      "Backup stuck waiting for plugin operations",
+			testName:  "/go/src/github.com/openshift/oadp-operator/tests/e2e/backup_restore_suite_test.go:307",
+			attemptNo: 0,
+			want: []want{
+				{
+					kind:       Backup,
+					name:       "mysql-twovol-csi-e2e-a9b96b14-cb73-11ee-a3a2-0a580a813019",
+					phases:     []string{"InProgress", "WaitingForPluginOperationsPartiallyFailed", PhasePartiallyFailed},
+					status:     utils.Failed,
+					duration:   4*time.Minute + 50*time.Second,
+					itemsTotal: 83,
+					itemsDone:  83,
+				},
+			},
+		},
+		{
+			name:      "Backup and restore completed",
+			testName:  "/go/src/github.com/openshift/oadp-operator/tests/e2e/must-gather_suite_test.go:76",
+			attemptNo: 0,
+			want: []want{
+				{
+					kind:       Backup,
+					name:       "mongo-datamover-e2e-51497f34-cb71-11ee-a3a2-0a580a813019",
+					phases:     []string{"InProgress", "WaitingForPluginOperations", PhaseCompleted},
+					status:     utils.Passed,
+					duration:   50 * time.Second,
+					itemsTotal: 75,
+					itemsDone:  75,
+				},
+				{
+					kind:       Restore,
+					name:       "mongo-datamover-e2e-514982c6-cb71-11ee-a3a2-0a580a813019",
+					phases:     []string{"WaitingForPluginOperations", PhaseCompleted},
+					status:     utils.Passed,
+					duration:   40 * time.Second,
+					itemsTotal: 40,
+					itemsDone:  40,
+				},
+			},
+		},
+		{
+			name:      "Retry without Velero events",
+			testName:  "/go/src/github.com/openshift/oadp-operator/tests/e2e/backup_restore_suite_test.go:307",
+			attemptNo: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempt := findAttempt(t, testData, tt.testName, tt.attemptNo)
+			if len(attempt.Events) != len(tt.want) {
+				t.Fatalf("Expected %d events, got %d", len(tt.want), len(attempt.Events))
+			}
+			for i, w := range tt.want {
+				event := attempt.Events[i]
+				if event.Kind != w.kind || event.Name != w.name {
+					t.Errorf("Expected %s %s, got %s %s", w.kind, w.name, event.Kind, event.Name)
+				}
+				if len(event.Phases) != len(w.phases) {
+					t.Fatalf("Expected phases %v, got %v", w.phases, event.Phases)
+				}
+				for j := range w.phases {
+					if event.Phases[j].Phase != w.phases[j] {
+						t.Errorf("Expected phase %s, got %s", w.phases[j], event.Phases[j].Phase)
+					}
+				}
+				if event.Status.Status != w.status {
+					t.Errorf("Expected status %s, got %s", w.status, event.Status.Status)
+				}
+				if event.Duration != w.duration {
+					t.Errorf("Expected duration %v, got %v", w.duration, event.Duration)
+				}
+				if event.ItemsTotal != w.itemsTotal || event.ItemsDone != w.itemsDone {
+					t.Errorf("Expected items %d/%d, got %d/%d", w.itemsDone, w.itemsTotal, event.ItemsDone, event.ItemsTotal)
+				}
+			}
+		})
+	}
+}
+
+func TestPhaseDurations(t *testing.T) {
+	testData := parseTestLog(t)
+	attempt := findAttempt(t, testData, "/go/src/github.com/openshift/oadp-operator/tests/e2e/backup_restore_suite_test.go:307", 0)
+
+	durations := PhaseDurations(&attempt.Events[0])
+	if got := durations["WaitingForPluginOperationsPartiallyFailed"]; got != 4*time.Minute+30*time.Second {
+		t.Errorf("Expected 4m30s waiting for plugin operations, got %v", got)
+	}
+	if got := durations[PhasePartiallyFailed]; got != 0 {
+		t.Errorf("Expected no time in the final phase, got %v", got)
+	}
+}
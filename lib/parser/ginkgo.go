@@ -0,0 +1,92 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// DefaultAnchorTag is the Ginkgo node delimiting the tests
+const DefaultAnchorTag = "It"
+
+// FormatGinkgo is the name of the Ginkgo v2 verbose output parser
+const FormatGinkgo = "ginkgo"
+
+var (
+	anchorTagRegex = regexp.MustCompile(`^[A-Za-z]+$`)
+	ginkgoMarkers  = [][]byte{[]byte("> Enter ["), []byte("Running Suite: ")}
+)
+
+// ginkgoParser parses the Ginkgo v2 verbose output, the tests are delimited
+// by the Enter and Exit lines of the anchor tags
+type ginkgoParser struct{}
+
+func (ginkgoParser) Name() string {
+	return FormatGinkgo
+}
+
+func (ginkgoParser) Sniff(head []byte) bool {
+	for _, marker := range ginkgoMarkers {
+		if bytes.Contains(head, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ginkgoParser) Parse(ctx context.Context, reader io.Reader, opts Options) (*TestRunData, error) {
+	anchorTag, err := AnchorPattern(opts.AnchorTags)
+	if err != nil {
+		return nil, err
+	}
+
+	testRunData := &TestRunData{}
+	logParser := utils.NewLogParser(testRunData, anchorTag)
+	logParser.SetLogger(opts.logger())
+	logParser.SetLocation(opts.location())
+
+	fullLogs, err := readLines(ctx, reader, opts, func(line string) error {
+		logParser.ParseLine(line)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	testRunData.FullLogs = fullLogs
+	applyRetention(testRunData, opts.Retention)
+	return testRunData, nil
+}
+
+// AnchorPattern returns the regular expression matching any of the anchor
+// tags, DefaultAnchorTag when there are none
+func AnchorPattern(tags []string) (string, error) {
+	if len(tags) == 0 {
+		return DefaultAnchorTag, nil
+	}
+	for _, tag := range tags {
+		if !anchorTagRegex.MatchString(tag) {
+			return "", &OptionError{Option: "AnchorTags", Reason: "invalid Ginkgo node " + tag}
+		}
+	}
+	return "(?:" + strings.Join(tags, "|") + ")", nil
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// FormatGinkgoJSON is the name of the Ginkgo --json-report parser
+const FormatGinkgoJSON = "ginkgo-json"
+
+// The Ginkgo v2 report, only the fields used are decoded
+type (
+	ginkgoReport struct {
+		SuiteDescription string
+		SpecReports      []ginkgoSpecReport
+	}
+
+	ginkgoSpecReport struct {
+		ContainerHierarchyTexts    []string
+		ContainerHierarchyLabels   [][]string
+		LeafNodeType               string
+		LeafNodeLocation           ginkgoCodeLocation
+		LeafNodeLabels             []string
+		LeafNodeText               string
+		State                      string
+		StartTime                  time.Time
+		EndTime                    time.Time
+		RunTime                    time.Duration
+		NumAttempts                int
+		Failure                    *ginkgoFailure
+		CapturedGinkgoWriterOutput string
+		CapturedStdOutErr          string
+		SpecEvents                 []ginkgoSpecEvent
+	}
+
+	ginkgoCodeLocation struct {
+		FileName   string
+		LineNumber int
+	}
+
+	ginkgoTimelineLocation struct {
+		// Offset is the length of CapturedGinkgoWriterOutput when the event happened
+		Offset int
+		Time   time.Time
+	}
+
+	ginkgoSpecEvent struct {
+		SpecEventType    string
+		TimelineLocation ginkgoTimelineLocation
+		Message          string
+		Duration         time.Duration
+		NodeType         string
+	}
+
+	ginkgoFailure struct {
+		Message         string
+		Location        ginkgoCodeLocation
+		FailureNodeType string
+	}
+)
+
+// The spec event types of the report
+const (
+	specEventByStart   = "By"
+	specEventNodeStart = "Node"
+	specEventNodeEnd   = "Node (End)"
+	specEventRetry     = "Retry"
+)
+
+// ginkgoStates maps the spec states to the attempt status, an interrupted
+// or timed out spec is a failed one
+var ginkgoStates = map[string]string{
+	"passed":      utils.Passed,
+	"skipped":     utils.Skipped,
+	"pending":     utils.Skipped,
+	"failed":      utils.Failed,
+	"aborted":     utils.Failed,
+	"panicked":    utils.Failed,
+	"interrupted": utils.Failed,
+	"timedout":    utils.Failed,
+}
+
+var ginkgoReportMarkers = [][]byte{[]byte(`"SpecReports"`), []byte(`"SuiteDescription"`)}
+
+// ginkgoJSONParser parses the reports written by ginkgo --json-report, with
+// the exact spec states, durations and retries
+type ginkgoJSONParser struct{}
+
+func (ginkgoJSONParser) Name() string {
+	return FormatGinkgoJSON
+}
+
+func (ginkgoJSONParser) Sniff(head []byte) bool {
+	if !bytes.HasPrefix(bytes.TrimSpace(head), []byte("[")) {
+		return false
+	}
+	for _, marker := range ginkgoReportMarkers {
+		if bytes.Contains(head, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse maps every spec of the anchor node types to a test, named after its
+// location like in the text output, with one attempt per retry
+func (ginkgoJSONParser) Parse(ctx context.Context, reader io.Reader, opts Options) (*TestRunData, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	anchorTags := opts.AnchorTags
+	if len(anchorTags) == 0 {
+		anchorTags = []string{DefaultAnchorTag}
+	}
+	if _, err := AnchorPattern(anchorTags); err != nil {
+		return nil, err
+	}
+
+	var reports []ginkgoReport
+	decoder := json.NewDecoder(reader)
+	if err := decoder.Decode(&reports); err != nil {
+		if err == io.EOF {
+			return nil, ErrEmptyLog
+		}
+		return nil, &ReadError{Line: 1, Err: fmt.Errorf("invalid Ginkgo JSON report: %v", err)}
+	}
+
+	testRunData := &TestRunData{}
+	for _, report := range reports {
+		for i := range report.SpecReports {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			spec := &report.SpecReports[i]
+			if !containsString(anchorTags, spec.LeafNodeType) {
+				continue
+			}
+			testRunData.TestRun = append(testRunData.TestRun, specTest(spec, opts.location()))
+		}
+	}
+	applyRetention(testRunData, opts.Retention)
+	return testRunData, nil
+}
+
+// specTest maps a spec report, the output is split between the attempts at
+// the offsets of the retry events
+func specTest(spec *ginkgoSpecReport, location *time.Location) IndividualTestRunData {
+	name := fmt.Sprintf("%s:%d", spec.LeafNodeLocation.FileName, spec.LeafNodeLocation.LineNumber)
+	test := IndividualTestRunData{
+		Name:       name,
+		ShortName:  spec.LeafNodeText,
+		Suite:      spec.LeafNodeLocation.FileName,
+		Containers: append([]string{}, spec.ContainerHierarchyTexts...),
+	}
+	for _, labels := range append(spec.ContainerHierarchyLabels, spec.LeafNodeLabels) {
+		for _, label := range labels {
+			if !containsString(test.Labels, label) {
+				test.Labels = append(test.Labels, label)
+			}
+		}
+	}
+	if spec.NumAttempts == 0 {
+		// Skipped and pending specs never ran
+		test.Attempt = []AttemptData{{Name: name, Status: utils.EventStatus{Status: ginkgoStates[spec.State]}}}
+		return test
+	}
+
+	output := spec.CapturedGinkgoWriterOutput + spec.CapturedStdOutErr
+	attempt := &AttemptData{Name: name}
+	cursor := 0
+	flush := func(offset int) {
+		if offset > len(output) || offset < cursor {
+			offset = len(output)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(output[cursor:offset], "\n"), "\n") {
+			if line != "" {
+				attempt.Logs = append(attempt.Logs, line)
+				attempt.LogTimes = append(attempt.LogTimes, utils.ParseLineTimeIn(line, location))
+			}
+		}
+		cursor = offset
+	}
+	for _, event := range spec.SpecEvents {
+		switch {
+		case event.SpecEventType == specEventRetry:
+			flush(event.TimelineLocation.Offset)
+			attempt.Status = utils.EventStatus{Status: utils.Failed}
+			test.Attempt = append(test.Attempt, *attempt)
+			attempt = &AttemptData{AttemptNo: len(test.Attempt), Name: name}
+		case event.SpecEventType == specEventByStart:
+			flush(event.TimelineLocation.Offset)
+			attempt.Logs = append(attempt.Logs, "STEP: "+event.Message)
+			attempt.LogTimes = append(attempt.LogTimes, event.TimelineLocation.Time)
+		case event.SpecEventType == specEventNodeStart && event.NodeType == spec.LeafNodeType:
+			attempt.StartTime = event.TimelineLocation.Time
+		case event.SpecEventType == specEventNodeEnd && event.NodeType == spec.LeafNodeType:
+			attempt.EndTime = event.TimelineLocation.Time
+			attempt.Duration = event.Duration
+		}
+	}
+	flush(len(output))
+	attempt.Status = utils.EventStatus{Status: ginkgoStates[spec.State]}
+	if spec.Failure != nil {
+		attempt.Logs = append(attempt.Logs,
+			"["+strings.ToUpper(spec.State)+"] "+spec.Failure.Message,
+			fmt.Sprintf("In [%s] at: %s:%d", spec.Failure.FailureNodeType, spec.Failure.Location.FileName, spec.Failure.Location.LineNumber))
+		attempt.LogTimes = append(attempt.LogTimes, time.Time{}, time.Time{})
+	}
+	test.Attempt = append(test.Attempt, *attempt)
+
+	// Reports without events only have the times of the whole spec
+	first, last := &test.Attempt[0], &test.Attempt[len(test.Attempt)-1]
+	if first.StartTime.IsZero() {
+		first.StartTime = spec.StartTime
+	}
+	if last.EndTime.IsZero() {
+		last.EndTime = spec.EndTime
+	}
+	if len(test.Attempt) == 1 && first.Duration == 0 {
+		first.Duration = spec.RunTime
+	}
+	return test
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+const reportFile = "../../tests/testdata/ginkgoreport/report.json"
+
+func parseFile(t *testing.T, file string, opts Options) *TestRunData {
+	t.Helper()
+	opened, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("Error opening %s: %v", file, err)
+	}
+	defer opened.Close()
+	run, err := Parse(context.Background(), opened, opts)
+	if err != nil {
+		t.Fatalf("Parse(%s) error = %v", file, err)
+	}
+	return run
+}
+
+func TestParseGinkgoJSON(t *testing.T) {
+	report := parseFile(t, reportFile, Options{})
+
+	// The BeforeSuite node is not a test, the skipped spec is
+	if len(report.TestRun) != 33 {
+		t.Fatalf("Parse() found %d tests, want 33", len(report.TestRun))
+	}
+	tests := []struct {
+		shortName string
+		verdict   string
+		attempts  []string
+		logLine   string
+	}{
+		{shortName: "MySQL application CSI", verdict: utils.Flaky, attempts: []string{utils.Failed, utils.Passed}},
+		{shortName: "MySQL application two Vol CSI", verdict: utils.Failed, attempts: []string{utils.Failed, utils.Failed, utils.Failed},
+			logLine: "[FAILED] No known FLAKE found in a previous run, marking test as failed."},
+		{shortName: "MySQL application VSL", verdict: utils.Skipped, attempts: []string{utils.Skipped}},
+		{shortName: "Default velero CR", verdict: utils.Passed, attempts: []string{utils.Passed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shortName, func(t *testing.T) {
+			var test *IndividualTestRunData
+			for i := range report.TestRun {
+				if report.TestRun[i].ShortName == tt.shortName {
+					test = &report.TestRun[i]
+				}
+			}
+			if test == nil {
+				t.Fatalf("Test %s not found", tt.shortName)
+			}
+			var attempts []string
+			for _, attempt := range test.Attempt {
+				attempts = append(attempts, attempt.Status.Status)
+			}
+			if test.Verdict() != tt.verdict || !reflect.DeepEqual(attempts, tt.attempts) {
+				t.Errorf("Test = %s with attempts %v, want %s with %v", test.Verdict(), attempts, tt.verdict, tt.attempts)
+			}
+			last := &test.Attempt[len(test.Attempt)-1]
+			if tt.logLine != "" && !strings.Contains(strings.Join(last.Logs, "\n"), tt.logLine) {
+				t.Errorf("Last attempt logs miss %q", tt.logLine)
+			}
+		})
+	}
+}
+
+func TestCompareReport(t *testing.T) {
+	report := parseFile(t, reportFile, Options{})
+	buildLog := parseFile(t, logFile, Options{})
+
+	if mismatches := CompareReport(report, buildLog); len(mismatches) != 0 {
+		t.Errorf("CompareReport() = %v, want the report and the log of the same run to agree", mismatches)
+	}
+
+	// The attempt times of the report match the ones of the log
+	merged := MergeReport(report, buildLog)
+	if merged.FullLogs != buildLog.FullLogs || len(merged.TestRun) != len(report.TestRun) {
+		t.Fatalf("MergeReport() kept %d tests, want %d", len(merged.TestRun), len(report.TestRun))
+	}
+	for i := range buildLog.TestRun {
+		logTest, mergedTest := &buildLog.TestRun[i], &merged.TestRun[i]
+		for j := range logTest.Attempt {
+			if !mergedTest.Attempt[j].StartTime.Equal(logTest.Attempt[j].StartTime) || mergedTest.Attempt[j].Duration != logTest.Attempt[j].Duration {
+				t.Errorf("Attempt %d of %s: report times differ from the log", j, logTest.ShortName)
+			}
+			if len(mergedTest.Attempt[j].Logs) != len(logTest.Attempt[j].Logs) {
+				t.Errorf("Attempt %d of %s: expected the logs of the build log", j, logTest.ShortName)
+			}
+		}
+	}
+
+	// A job whose report saw a timeout and a retry the log does not show
+	report.TestRun[0].Attempt[0].Status.Status = utils.Failed
+	report.TestRun[2].Attempt = append(report.TestRun[2].Attempt, report.TestRun[2].Attempt[0])
+	buildLog.TestRun = append(buildLog.TestRun, IndividualTestRunData{Name: "/e2e/extra_test.go:10", ShortName: "Extra"})
+	want := []Mismatch{
+		{Name: report.TestRun[0].Name, ShortName: report.TestRun[0].ShortName, Field: MismatchVerdict, Report: utils.Failed, Log: utils.Passed},
+		{Name: report.TestRun[2].Name, ShortName: report.TestRun[2].ShortName, Field: MismatchAttempts, Report: "2", Log: "1"},
+		{Name: "/e2e/extra_test.go:10", ShortName: "Extra", Field: MismatchTest, Report: "missing", Log: utils.Passed},
+	}
+	if got := CompareReport(report, buildLog); !reflect.DeepEqual(got, want) {
+		t.Errorf("CompareReport() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSpecHierarchy(t *testing.T) {
+	report := parseFile(t, reportFile, Options{})
+	buildLog := parseFile(t, logFile, Options{Format: FormatGinkgo})
+
+	reportTests := testsByName(report)
+	for i := range buildLog.TestRun {
+		logTest := &buildLog.TestRun[i]
+		reportTest, found := reportTests[logTest.Name]
+		if !found {
+			t.Errorf("Test %s is not in the report", logTest.Name)
+			continue
+		}
+		if logTest.Suite != reportTest.Suite || !reflect.DeepEqual(logTest.Containers, reportTest.Containers) ||
+			!reflect.DeepEqual(logTest.Labels, reportTest.Labels) {
+			t.Errorf("Test %s = %s %q %q in the build log, %s %q %q in the report", logTest.ShortName,
+				logTest.Suite, logTest.Containers, logTest.Labels, reportTest.Suite, reportTest.Containers, reportTest.Labels)
+		}
+	}
+
+	aws := reportTests["/go/src/github.com/openshift/oadp-operator/tests/e2e/dpa_deployment_suite_test.go:726"]
+	if aws == nil {
+		t.Fatalf("Labelled test not found")
+	}
+	want := "Configuration testing for DPA Custom Resource Updating custom resource with new configuration unsupportedOverrides should succeed"
+	if aws.FullText() != want || !reflect.DeepEqual(aws.Labels, []string{"aws", "ibmcloud"}) {
+		t.Errorf("Test %s = %q %q", aws.Name, aws.FullText(), aws.Labels)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// FormatGoTest is the name of the go test -v output parser
+const FormatGoTest = "gotest"
+
+var (
+	goTestSniffRegex   = regexp.MustCompile(`(?m)^(=== RUN   |\s*--- (PASS|FAIL|SKIP): )`)
+	goTestEventRegex   = regexp.MustCompile(`^=== (RUN|CONT|NAME|PAUSE)\s+(\S+)`)
+	goTestResultRegex  = regexp.MustCompile(`^\s*--- (PASS|FAIL|SKIP): (\S+) \((\d+(?:\.\d+)?)s\)`)
+	goTestPackageRegex = regexp.MustCompile(`^(?:ok|FAIL)\s+(\S+)\s+(?:\d|\(cached\))`)
+	goTestStatuses     = map[string]string{"PASS": utils.Passed, "FAIL": utils.Failed, "SKIP": utils.Skipped}
+)
+
+// goTestRun builds the tests of a go test output, each run of a test is an
+// attempt and the subtests are tests of their own. The tests are named after
+// their package when it is known.
+type goTestRun struct {
+	testRunData *TestRunData
+	// tests are the indexes in TestRun of the tests by full name
+	tests map[string]int
+}
+
+func goTestName(pkg, test string) string {
+	if pkg == "" {
+		return test
+	}
+	return pkg + "." + test
+}
+
+func newGoTestRun() *goTestRun {
+	return &goTestRun{testRunData: &TestRunData{}, tests: make(map[string]int)}
+}
+
+// start adds an attempt to a test
+func (r *goTestRun) start(pkg, test string, at time.Time) *AttemptData {
+	name := goTestName(pkg, test)
+	index, found := r.tests[name]
+	if !found {
+		index = len(r.testRunData.TestRun)
+		r.tests[name] = index
+		r.testRunData.TestRun = append(r.testRunData.TestRun, IndividualTestRunData{Name: name, ShortName: test, Suite: pkg})
+	}
+	testRun := &r.testRunData.TestRun[index]
+	testRun.Attempt = append(testRun.Attempt, AttemptData{
+		AttemptNo: len(testRun.Attempt),
+		Name:      name,
+		StartTime: at,
+	})
+	return &testRun.Attempt[len(testRun.Attempt)-1]
+}
+
+// attempt returns the last attempt of a test, the output of a test may come
+// without its run line
+func (r *goTestRun) attempt(pkg, test string) *AttemptData {
+	index, found := r.tests[goTestName(pkg, test)]
+	if !found {
+		return r.start(pkg, test, time.Time{})
+	}
+	testRun := &r.testRunData.TestRun[index]
+	return &testRun.Attempt[len(testRun.Attempt)-1]
+}
+
+func (r *goTestRun) log(pkg, test, line string, at time.Time) {
+	attempt := r.attempt(pkg, test)
+	attempt.Logs = append(attempt.Logs, line)
+	attempt.LogTimes = append(attempt.LogTimes, at)
+}
+
+func (r *goTestRun) end(pkg, test, status string, elapsed time.Duration, at time.Time) {
+	attempt := r.attempt(pkg, test)
+	attempt.Status = utils.EventStatus{Status: status}
+	attempt.Duration = elapsed
+	switch {
+	case !at.IsZero():
+		attempt.EndTime = at
+	case !attempt.StartTime.IsZero():
+		attempt.EndTime = attempt.StartTime.Add(elapsed)
+	}
+}
+
+// endPackage names the tests of the package that just ended after it, for
+// the go test -v output where the package is only printed at the end
+func (r *goTestRun) endPackage(pkg string) {
+	for _, index := range r.tests {
+		test := &r.testRunData.TestRun[index]
+		test.Name = goTestName(pkg, test.ShortName)
+		test.Suite = pkg
+		for i := range test.Attempt {
+			test.Attempt[i].Name = test.Name
+		}
+	}
+	r.tests = make(map[string]int)
+}
+
+// goTestParser parses the go test -v output, which has no timestamps
+type goTestParser struct{}
+
+func (goTestParser) Name() string {
+	return FormatGoTest
+}
+
+func (goTestParser) Sniff(head []byte) bool {
+	return goTestSniffRegex.Match(head)
+}
+
+func (goTestParser) Parse(ctx context.Context, reader io.Reader, opts Options) (*TestRunData, error) {
+	run := newGoTestRun()
+	// the output lines belong to the last test started or continued
+	current := ""
+	fullLogs, err := readLines(ctx, reader, opts, func(line string) error {
+		if matches := goTestEventRegex.FindStringSubmatch(line); matches != nil {
+			current = matches[2]
+			if matches[1] == "RUN" {
+				run.start("", current, time.Time{})
+			}
+			run.log("", current, line, time.Time{})
+			return nil
+		}
+		if matches := goTestResultRegex.FindStringSubmatch(line); matches != nil {
+			current = matches[2]
+			seconds, _ := strconv.ParseFloat(matches[3], 64)
+			run.log("", current, line, time.Time{})
+			run.end("", current, goTestStatuses[matches[1]], time.Duration(seconds*float64(time.Second)), time.Time{})
+			return nil
+		}
+		if matches := goTestPackageRegex.FindStringSubmatch(line); matches != nil {
+			run.endPackage(matches[1])
+			current = ""
+			return nil
+		}
+		if current != "" && line != "PASS" && line != "FAIL" {
+			run.log("", current, line, time.Time{})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	run.testRunData.FullLogs = fullLogs
+	applyRetention(run.testRunData, opts.Retention)
+	return run.testRunData, nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+func TestParseGoTest(t *testing.T) {
+	type wantTest struct {
+		name     string
+		verdict  string
+		duration time.Duration
+		logLine  string
+	}
+	want := []wantTest{
+		{name: "example.com/sample.TestBackup", verdict: utils.Passed, duration: 20 * time.Millisecond, logLine: "creating backup"},
+		{name: "example.com/sample.TestRestore", verdict: utils.Failed, logLine: "restore failed: phase PartiallyFailed"},
+		{name: "example.com/sample.TestSkipped", verdict: utils.Skipped, logLine: "no CSI driver"},
+		{name: "example.com/sample.TestSchedules", verdict: utils.Failed},
+		{name: "example.com/sample.TestSchedules/hourly", verdict: utils.Passed, logLine: "schedule hourly"},
+		{name: "example.com/sample.TestSchedules/daily", verdict: utils.Failed, logLine: "schedule not created"},
+	}
+
+	tests := []struct {
+		name      string
+		file      string
+		wantTimes bool
+	}{
+		{
+			name: "go test -v",
+			file: "../../tests/testdata/gotest/test-v.txt",
+		},
+		{
+			name:      "go test -json",
+			file:      "../../tests/testdata/gotest/test.json",
+			wantTimes: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.Open(tt.file)
+			if err != nil {
+				t.Fatalf("Error opening log file: %v", err)
+			}
+			defer file.Close()
+
+			got, err := Parse(context.Background(), file, Options{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if len(got.TestRun) != len(want) {
+				t.Fatalf("Parse() found %d tests, want %d", len(got.TestRun), len(want))
+			}
+			for i, wantTest := range want {
+				test := &got.TestRun[i]
+				if test.Name != wantTest.name || test.Verdict() != wantTest.verdict {
+					t.Errorf("Test %d = %s %s, want %s %s", i, test.Name, test.Verdict(), wantTest.name, wantTest.verdict)
+					continue
+				}
+				attempt := &test.Attempt[0]
+				if len(test.Attempt) != 1 || attempt.Duration != wantTest.duration {
+					t.Errorf("Test %s has %d attempts of %v, want 1 of %v", test.Name, len(test.Attempt), attempt.Duration, wantTest.duration)
+				}
+				if !strings.Contains(strings.Join(attempt.Logs, "\n"), wantTest.logLine) {
+					t.Errorf("Test %s logs miss %q: %v", test.Name, wantTest.logLine, attempt.Logs)
+				}
+				if attempt.StartTime.IsZero() == tt.wantTimes {
+					t.Errorf("Test %s start time = %v", test.Name, attempt.StartTime)
+				}
+			}
+			if strings.Contains(got.FullLogs, `"Action"`) || !strings.Contains(got.FullLogs, "--- FAIL: TestRestore") {
+				t.Errorf("Expected the full log to be the test output, got %q", got.FullLogs)
+			}
+		})
+	}
+}
+
+func TestParseGoTestRerun(t *testing.T) {
+	const run = "=== RUN   TestBackup\n" +
+		"    backup_test.go:10: timeout waiting for the backup\n" +
+		"--- FAIL: TestBackup (60.00s)\n" +
+		"=== RUN   TestBackup\n" +
+		"--- PASS: TestBackup (12.50s)\n" +
+		"PASS\n" +
+		"ok  \texample.com/backup\t72.512s\n" +
+		"=== RUN   TestBackup\n" +
+		"--- PASS: TestBackup (1.00s)\n" +
+		"ok  \texample.com/restore\t1.012s\n"
+
+	got, err := Parse(context.Background(), strings.NewReader(run), Options{Format: FormatGoTest})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(got.TestRun) != 2 {
+		t.Fatalf("Parse() found %d tests, want the same test name in 2 packages", len(got.TestRun))
+	}
+	backup := &got.TestRun[0]
+	if backup.Name != "example.com/backup.TestBackup" || backup.Verdict() != utils.Flaky || len(backup.Attempt) != 2 {
+		t.Errorf("Test %s = %s with %d attempts, want a flaky test", backup.Name, backup.Verdict(), len(backup.Attempt))
+	}
+	if backup.Attempt[1].AttemptNo != 1 || backup.Attempt[1].Duration != 12500*time.Millisecond {
+		t.Errorf("Second attempt = %+v", backup.Attempt[1])
+	}
+	if restore := &got.TestRun[1]; restore.Name != "example.com/restore.TestBackup" || restore.Verdict() != utils.Passed {
+		t.Errorf("Test %s = %s", restore.Name, restore.Verdict())
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// FormatGoTestJSON is the name of the go test -json output parser
+const FormatGoTestJSON = "gotest-json"
+
+// goTestEvent is a line of the go test -json output, see go doc test2json
+type goTestEvent struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+var goTestJSONStatuses = map[string]string{"pass": utils.Passed, "fail": utils.Failed, "skip": utils.Skipped}
+
+// goTestJSONParser parses the go test -json output, the log of the run is
+// rebuilt from the output events
+type goTestJSONParser struct{}
+
+func (goTestJSONParser) Name() string {
+	return FormatGoTestJSON
+}
+
+func (goTestJSONParser) Sniff(head []byte) bool {
+	for _, line := range bytes.Split(head, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var event goTestEvent
+		return json.Unmarshal(line, &event) == nil && event.Action != ""
+	}
+	return false
+}
+
+func (goTestJSONParser) Parse(ctx context.Context, reader io.Reader, opts Options) (*TestRunData, error) {
+	run := newGoTestRun()
+	logger := opts.logger()
+	var fullLogs strings.Builder
+	// The JSON lines are not kept, the output events are
+	readOpts := opts
+	readOpts.Retention = RetainAttempts
+	_, err := readLines(ctx, reader, readOpts, func(line string) error {
+		if strings.TrimSpace(line) == "" {
+			return nil
+		}
+		var event goTestEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			// go test prints the build errors as text
+			logger.WithFields(log.Fields{
+				"Line": line,
+			}).Debug("Skipping line that is not a test event")
+			return nil
+		}
+		if opts.Retention == RetainAll && event.Action == "output" {
+			fullLogs.WriteString(event.Output)
+		}
+		if event.Test == "" {
+			return nil
+		}
+		switch event.Action {
+		case "run":
+			run.start(event.Package, event.Test, event.Time)
+		case "output":
+			run.log(event.Package, event.Test, strings.TrimSuffix(event.Output, "\n"), event.Time)
+		case "pass", "fail", "skip":
+			elapsed := time.Duration(event.Elapsed * float64(time.Second))
+			run.end(event.Package, event.Test, goTestJSONStatuses[event.Action], elapsed, event.Time)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	run.testRunData.FullLogs = fullLogs.String()
+	applyRetention(run.testRunData, opts.Retention)
+	return run.testRunData, nil
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package parser turns the log of a test run into its tests and attempts,
+// with their status, timestamps and logs. Ginkgo text output and JSON reports,
+// go test -v and go test -json outputs are understood, other formats can be
+// registered.
+//
+// It only parses: fetching, caching and reading archives are left to the
+// caller, and nothing is logged unless a logger is given in the Options.
+//
+//	file, err := os.Open("build-log.txt")
+//	if err != nil {
+//		return err
+//	}
+//	defer file.Close()
+//	run, err := parser.Parse(ctx, file, parser.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	for _, test := range run.TestRun {
+//		fmt.Println(test.ShortName, test.Verdict())
+//	}
+package parser
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// TestRunData is a parsed test run
+type TestRunData = utils.TestRunData
+
+// IndividualTestRunData is a test of a run, with all its attempts
+type IndividualTestRunData = utils.IndividualTestRunData
+
+// AttemptData is a single attempt of a test
+type AttemptData = utils.AttemptData
+
+// Retention tells which logs are kept in the parsed run
+type Retention int
+
+const (
+	// RetainAll keeps the whole log and the logs of each attempt
+	RetainAll Retention = iota
+	// RetainAttempts only keeps the logs of each attempt
+	RetainAttempts
+	// RetainNone only keeps the tests, their status and timestamps
+	RetainNone
+)
+
+// checkEvery is the number of lines parsed between two checks of the context
+const checkEvery = 4096
+
+// Options of Parse, the zero value detects the format and keeps all the logs
+type Options struct {
+	// Format is the name of the parser to use, detected from the beginning of the log when empty
+	Format string
+	// AnchorTags are the Ginkgo nodes delimiting the tests, It by default
+	AnchorTags []string
+	// Location is the time zone of the log timestamps without one, UTC by default
+	Location *time.Location
+	// Retention tells which logs are kept, all of them by default
+	Retention Retention
+	// Logger receives the debug messages of the parser, they are dropped by default
+	Logger log.FieldLogger
+}
+
+// Parse reads a test log and returns the tests it holds.
+// The format is detected from the first SniffSize bytes unless opts.Format is set.
+// Lines have no maximum length and may end with \r\n.
+//
+// Parameters:
+//   - ctx: cancels the parsing of a long log.
+//   - reader: the content of the log.
+//   - opts: the format, anchor tags, time zone, logs retention and logger.
+//
+// Returns:
+//   - *TestRunData with the tests in the order they first appear.
+//   - error: ErrEmptyLog, a *ReadError, an *OptionError or the context error.
+func Parse(ctx context.Context, reader io.Reader, opts Options) (*TestRunData, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReaderSize(reader, SniffSize)
+
+	var logParser Parser
+	if opts.Format != "" {
+		var found bool
+		if logParser, found = Lookup(opts.Format); !found {
+			return nil, &OptionError{Option: "Format", Reason: "unknown format " + opts.Format}
+		}
+	} else {
+		head, err := buffered.Peek(SniffSize)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, &ReadError{Line: 1, Err: err}
+		}
+		logParser = Detect(head)
+		opts.logger().WithFields(log.Fields{
+			"Format": logParser.Name(),
+		}).Debug("Detected log format")
+	}
+	return logParser.Parse(ctx, buffered, opts)
+}
+
+func (opts *Options) validate() error {
+	if opts.Retention < RetainAll || opts.Retention > RetainNone {
+		return &OptionError{Option: "Retention", Reason: "unknown retention"}
+	}
+	return nil
+}
+
+func (opts *Options) logger() log.FieldLogger {
+	if opts.Logger != nil {
+		return opts.Logger
+	}
+	discard := log.New()
+	discard.SetOutput(io.Discard)
+	return discard
+}
+
+func (opts *Options) location() *time.Location {
+	if opts.Location != nil {
+		return opts.Location
+	}
+	return time.UTC
+}
+
+// readLines calls parseLine with each line of the log, without its line break,
+// and returns the whole log when it is retained
+func readLines(ctx context.Context, reader io.Reader, opts Options, parseLine func(line string) error) (string, error) {
+	if err := opts.validate(); err != nil {
+		return "", err
+	}
+	var (
+		fullLogs strings.Builder
+		lines    int
+	)
+	buffered := bufio.NewReader(reader)
+	for {
+		if lines%checkEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+		}
+		line, readErr := buffered.ReadString('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return "", &ReadError{Line: lines + 1, Err: readErr}
+		}
+		if line == "" && readErr != nil {
+			break
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		lines++
+		if opts.Retention == RetainAll {
+			fullLogs.WriteString(line + "\n")
+		}
+		if err := parseLine(line); err != nil {
+			return "", err
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	if lines == 0 {
+		return "", ErrEmptyLog
+	}
+	return fullLogs.String(), nil
+}
+
+// applyRetention drops the attempt logs that are not retained
+func applyRetention(testRunData *TestRunData, retention Retention) {
+	if retention != RetainNone {
+		return
+	}
+	for i := range testRunData.TestRun {
+		for j := range testRunData.TestRun[i].Attempt {
+			testRunData.TestRun[i].Attempt[j].Logs = nil
+			testRunData.TestRun[i].Attempt[j].LogTimes = nil
+			testRunData.TestRun[i].Attempt[j].SetupLogs = nil
+		}
+	}
+}
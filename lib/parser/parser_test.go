@@ -0,0 +1,235 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// logFile is the sample build log of internal/fixture, which imports parser
+const logFile = "../../tests/testdata/buildlog/build-log.txt"
+
+func TestParse(t *testing.T) {
+	content, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Error reading log file: %v", err)
+	}
+	want, err := utils.GetRunDataFromLog(logFile)
+	if err != nil {
+		t.Fatalf("Error reading log file: %v", err)
+	}
+	if err := utils.SetIndividualTestsFromLog(want, "It"); err != nil {
+		t.Fatalf("Error parsing log file: %v", err)
+	}
+
+	// Nothing goes to the global logger, even in debug mode
+	var global bytes.Buffer
+	log.SetOutput(&global)
+	log.SetLevel(log.DebugLevel)
+	defer log.SetOutput(os.Stderr)
+	defer log.SetLevel(log.InfoLevel)
+
+	got, err := Parse(context.Background(), bytes.NewReader(content), Options{})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if global.Len() != 0 {
+		t.Errorf("Parse() logged to the global logger: %s", global.String())
+	}
+	if got.FullLogs != want.FullLogs {
+		t.Errorf("Parse() kept %d bytes of logs, want %d", len(got.FullLogs), len(want.FullLogs))
+	}
+	if len(got.TestRun) != len(want.TestRun) {
+		t.Fatalf("Parse() found %d tests, want %d", len(got.TestRun), len(want.TestRun))
+	}
+	for i := range want.TestRun {
+		gotTest, wantTest := &got.TestRun[i], &want.TestRun[i]
+		if gotTest.Name != wantTest.Name || gotTest.Verdict() != wantTest.Verdict() || len(gotTest.Attempt) != len(wantTest.Attempt) {
+			t.Errorf("Test %s = %s with %d attempts, want %s with %d",
+				wantTest.ShortName, gotTest.Verdict(), len(gotTest.Attempt), wantTest.Verdict(), len(wantTest.Attempt))
+			continue
+		}
+		for j := range wantTest.Attempt {
+			if !gotTest.Attempt[j].StartTime.Equal(wantTest.Attempt[j].StartTime) || gotTest.Attempt[j].Duration != wantTest.Attempt[j].Duration {
+				t.Errorf("Attempt %d of %s has different times", j, wantTest.ShortName)
+			}
+		}
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	const run = "> Enter [BeforeEach] Backup - /test.go:10 @ 02/14/24 12:00:00.000\r\n" +
+		"setting up\r\n" +
+		"< Exit [BeforeEach] Backup - /test.go:10 @ 02/14/24 12:00:01.000 (1s)\r\n" +
+		"> Enter [It] Backup - /test.go:20 @ 02/14/24 12:00:01.000\r\n" +
+		"2024/02/14 12:00:02 Creating backup\r\n" +
+		"  [FAILED] backup failed\r\n" +
+		"< Exit [It] Backup - /test.go:20 @ 02/14/24 12:00:05.000 (4s)"
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("No time zone database: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		opts      Options
+		wantTests int
+		wantStart time.Time
+		wantLogs  int
+		wantSetup int
+		wantFull  bool
+	}{
+		{
+			name:      "Defaults",
+			wantTests: 1,
+			wantStart: time.Date(2024, 2, 14, 12, 0, 1, 0, time.UTC),
+			wantLogs:  4,
+			wantSetup: 3,
+			wantFull:  true,
+		},
+		{
+			name:      "Several anchor tags",
+			opts:      Options{AnchorTags: []string{"BeforeEach", "It"}},
+			wantTests: 2,
+			wantStart: time.Date(2024, 2, 14, 12, 0, 0, 0, time.UTC),
+			wantLogs:  3,
+			wantFull:  true,
+		},
+		{
+			name:      "Time zone",
+			opts:      Options{Location: paris},
+			wantTests: 1,
+			wantStart: time.Date(2024, 2, 14, 11, 0, 1, 0, time.UTC),
+			wantLogs:  4,
+			wantSetup: 3,
+			wantFull:  true,
+		},
+		{
+			name:      "Attempt logs only",
+			opts:      Options{Retention: RetainAttempts},
+			wantTests: 1,
+			wantStart: time.Date(2024, 2, 14, 12, 0, 1, 0, time.UTC),
+			wantLogs:  4,
+			wantSetup: 3,
+		},
+		{
+			name:      "No logs",
+			opts:      Options{Retention: RetainNone},
+			wantTests: 1,
+			wantStart: time.Date(2024, 2, 14, 12, 0, 1, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(context.Background(), strings.NewReader(run), tt.opts)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if len(got.TestRun) != tt.wantTests {
+				t.Fatalf("Parse() found %d tests, want %d", len(got.TestRun), tt.wantTests)
+			}
+			attempt := &got.TestRun[0].Attempt[0]
+			if !attempt.StartTime.Equal(tt.wantStart) {
+				t.Errorf("Start time = %v, want %v", attempt.StartTime, tt.wantStart)
+			}
+			if last := &got.TestRun[len(got.TestRun)-1]; last.Verdict() != utils.Failed {
+				t.Errorf("Verdict = %s, want %s", last.Verdict(), utils.Failed)
+			}
+			if len(attempt.Logs) != tt.wantLogs {
+				t.Errorf("Attempt kept %d log lines, want %d", len(attempt.Logs), tt.wantLogs)
+			}
+			if len(attempt.SetupLogs) != tt.wantSetup {
+				t.Errorf("Attempt kept %d setup log lines, want %d", len(attempt.SetupLogs), tt.wantSetup)
+			}
+			if (got.FullLogs != "") != tt.wantFull {
+				t.Errorf("Full logs kept = %v, want %v", got.FullLogs != "", tt.wantFull)
+			}
+			if strings.Contains(got.FullLogs, "\r") {
+				t.Errorf("Expected the line breaks to be normalized")
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var (
+		readErr   *ReadError
+		optionErr *OptionError
+	)
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		input string
+		opts  Options
+		check func(error) bool
+	}{
+		{
+			name:  "Empty log",
+			ctx:   context.Background(),
+			check: func(err error) bool { return errors.Is(err, ErrEmptyLog) },
+		},
+		{
+			name:  "Invalid anchor tag",
+			ctx:   context.Background(),
+			input: "line\n",
+			opts:  Options{AnchorTags: []string{"It]"}},
+			check: func(err error) bool { return errors.As(err, &optionErr) && optionErr.Option == "AnchorTags" },
+		},
+		{
+			name:  "Unknown retention",
+			ctx:   context.Background(),
+			input: "line\n",
+			opts:  Options{Retention: RetainNone + 1},
+			check: func(err error) bool { return errors.As(err, &optionErr) && optionErr.Option == "Retention" },
+		},
+		{
+			name:  "Canceled",
+			ctx:   canceled,
+			input: "line\n",
+			check: func(err error) bool { return errors.Is(err, context.Canceled) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.ctx, strings.NewReader(tt.input), tt.opts)
+			if !tt.check(err) {
+				t.Errorf("Parse() error = %v", err)
+			}
+		})
+	}
+
+	t.Run("Read error", func(t *testing.T) {
+		failing := iotest.TimeoutReader(strings.NewReader("first line\nsecond"))
+		_, err := Parse(context.Background(), iotest.OneByteReader(failing), Options{})
+		if !errors.As(err, &readErr) || !errors.Is(err, iotest.ErrTimeout) {
+			t.Errorf("Parse() error = %v, want a ReadError", err)
+		}
+	})
+}
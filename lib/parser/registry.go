@@ -0,0 +1,100 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// SniffSize is the number of bytes at the beginning of a log used to detect its format
+const SniffSize = 64 * 1024
+
+// Parser parses the logs of one test output format into the common model
+type Parser interface {
+	// Name is the format name, used by Options.Format
+	Name() string
+	// Sniff tells whether the beginning of a log, up to SniffSize bytes, is in this format
+	Sniff(head []byte) bool
+	// Parse reads the whole log
+	Parse(ctx context.Context, reader io.Reader, opts Options) (*TestRunData, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Parser
+)
+
+func init() {
+	// The stricter formats are sniffed first, Ginkgo logs start with a
+	// go test -v line when the suite is run with go test
+	Register(ginkgoJSONParser{})
+	Register(goTestJSONParser{})
+	Register(ginkgoParser{})
+	Register(goTestParser{})
+}
+
+// Register adds a parser, it is sniffed after the ones already registered.
+// A parser registered with the name of another one replaces it.
+func Register(parser Parser) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for i := range registry {
+		if registry[i].Name() == parser.Name() {
+			registry[i] = parser
+			return
+		}
+	}
+	registry = append(registry, parser)
+}
+
+// Lookup returns the parser registered with a name
+func Lookup(name string) (Parser, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for _, parser := range registry {
+		if parser.Name() == name {
+			return parser, true
+		}
+	}
+	return nil, false
+}
+
+// Formats returns the names of the registered parsers, in sniffing order
+func Formats() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for _, parser := range registry {
+		names = append(names, parser.Name())
+	}
+	return names
+}
+
+// Detect returns the first parser recognising the beginning of a log,
+// the Ginkgo one when none does
+func Detect(head []byte) Parser {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for _, parser := range registry {
+		if parser.Sniff(head) {
+			return parser
+		}
+	}
+	return ginkgoParser{}
+}
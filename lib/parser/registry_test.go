@@ -0,0 +1,109 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		head string
+		want string
+	}{
+		{name: "Ginkgo build log", file: logFile, want: FormatGinkgo},
+		{name: "go test -v", file: "../../tests/testdata/gotest/test-v.txt", want: FormatGoTest},
+		{name: "go test -json", file: "../../tests/testdata/gotest/test.json", want: FormatGoTestJSON},
+		{name: "Ginkgo JSON report", file: reportFile, want: FormatGinkgoJSON},
+		{name: "Ginkgo suite run by go test", head: "=== RUN   TestE2E\nRunning Suite: OADP E2E\n", want: FormatGinkgo},
+		{name: "Unknown format", head: "collected 3 items\n", want: FormatGinkgo},
+		{name: "Empty", want: FormatGinkgo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head := []byte(tt.head)
+			if tt.file != "" {
+				content, err := os.ReadFile(tt.file)
+				if err != nil {
+					t.Fatalf("Error reading log file: %v", err)
+				}
+				if len(content) > SniffSize {
+					content = content[:SniffSize]
+				}
+				head = content
+			}
+			if got := Detect(head).Name(); got != tt.want {
+				t.Errorf("Detect() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// lineCounter is a parser counting the lines of the logs starting with "lines"
+type lineCounter struct{}
+
+func (lineCounter) Name() string { return "lines" }
+
+func (lineCounter) Sniff(head []byte) bool { return bytes.HasPrefix(head, []byte("lines")) }
+
+func (lineCounter) Parse(_ context.Context, reader io.Reader, _ Options) (*TestRunData, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	run := &TestRunData{}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		run.TestRun = append(run.TestRun, IndividualTestRunData{Name: line, ShortName: line})
+	}
+	return run, nil
+}
+
+func TestRegister(t *testing.T) {
+	formats := Formats()
+	Register(lineCounter{})
+	defer func() {
+		registryMu.Lock()
+		registry = registry[:len(formats)]
+		registryMu.Unlock()
+	}()
+
+	if got := Formats(); !reflect.DeepEqual(got, append(formats, "lines")) {
+		t.Errorf("Formats() = %v", got)
+	}
+	if _, found := Lookup("lines"); !found {
+		t.Errorf("Lookup() did not find the registered parser")
+	}
+
+	got, err := Parse(context.Background(), strings.NewReader("lines\none\ntwo\n"), Options{})
+	if err != nil || len(got.TestRun) != 3 {
+		t.Errorf("Parse() = %v, %v, want the registered parser to be detected", got, err)
+	}
+
+	var optionErr *OptionError
+	if _, err := Parse(context.Background(), strings.NewReader("lines\n"), Options{Format: "pytest"}); !errors.As(err, &optionErr) {
+		t.Errorf("Parse() error = %v, want an unknown format error", err)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"strconv"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// The fields compared by CompareReport
+const (
+	MismatchTest     = "test"
+	MismatchVerdict  = "verdict"
+	MismatchAttempts = "attempts"
+)
+
+// missing is the value of a Mismatch side without the test
+const missing = "missing"
+
+// Mismatch is a difference between the JSON report and the build log of a run
+type Mismatch struct {
+	Name      string
+	ShortName string
+	Field     string
+	Report    string
+	Log       string
+}
+
+// CompareReport checks that the tests parsed from a Ginkgo JSON report and
+// from the build log of the same run agree. The skipped specs of the report
+// are not expected in the log.
+//
+// Parameters:
+//   - report: the run parsed from the JSON report.
+//   - log: the run parsed from the build log.
+//
+// Returns:
+//   - []Mismatch with the tests found in only one of them, or with another verdict or number of attempts.
+func CompareReport(report, log *TestRunData) []Mismatch {
+	var mismatches []Mismatch
+	logTests := testsByName(log)
+	reportTests := testsByName(report)
+
+	for i := range report.TestRun {
+		reportTest := &report.TestRun[i]
+		logTest, found := logTests[reportTest.Name]
+		switch {
+		case !found && reportTest.Verdict() == utils.Skipped:
+		case !found:
+			mismatches = append(mismatches, newMismatch(reportTest, MismatchTest, reportTest.Verdict(), missing))
+		case reportTest.Verdict() != logTest.Verdict():
+			mismatches = append(mismatches, newMismatch(reportTest, MismatchVerdict, reportTest.Verdict(), logTest.Verdict()))
+		case len(reportTest.Attempt) != len(logTest.Attempt):
+			mismatches = append(mismatches, newMismatch(reportTest, MismatchAttempts,
+				strconv.Itoa(len(reportTest.Attempt)), strconv.Itoa(len(logTest.Attempt))))
+		}
+	}
+	for i := range log.TestRun {
+		logTest := &log.TestRun[i]
+		if _, found := reportTests[logTest.Name]; !found {
+			mismatches = append(mismatches, newMismatch(logTest, MismatchTest, missing, logTest.Verdict()))
+		}
+	}
+	return mismatches
+}
+
+// MergeReport returns the run of the JSON report with the logs of the build
+// log, which has the whole output of each attempt. The tests only found in the
+// build log are added after the ones of the report.
+func MergeReport(report, log *TestRunData) *TestRunData {
+	merged := &TestRunData{FullLogs: log.FullLogs}
+	logTests := testsByName(log)
+	reportTests := testsByName(report)
+
+	for i := range report.TestRun {
+		test := report.TestRun[i]
+		test.Attempt = append([]AttemptData(nil), test.Attempt...)
+		if logTest, found := logTests[test.Name]; found {
+			for j := range test.Attempt {
+				if j < len(logTest.Attempt) {
+					test.Attempt[j].Logs = logTest.Attempt[j].Logs
+					test.Attempt[j].LogTimes = logTest.Attempt[j].LogTimes
+					test.Attempt[j].SetupLogs = logTest.Attempt[j].SetupLogs
+				}
+			}
+		}
+		merged.TestRun = append(merged.TestRun, test)
+	}
+	for i := range log.TestRun {
+		if _, found := reportTests[log.TestRun[i].Name]; !found {
+			merged.TestRun = append(merged.TestRun, log.TestRun[i])
+		}
+	}
+	return merged
+}
+
+func testsByName(testRunData *TestRunData) map[string]*IndividualTestRunData {
+	tests := make(map[string]*IndividualTestRunData, len(testRunData.TestRun))
+	for i := range testRunData.TestRun {
+		tests[testRunData.TestRun[i].Name] = &testRunData.TestRun[i]
+	}
+	return tests
+}
+
+func newMismatch(test *IndividualTestRunData, field, report, log string) Mismatch {
+	return Mismatch{Name: test.Name, ShortName: test.ShortName, Field: field, Report: report, Log: log}
+}
@@ -0,0 +1,722 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package server serves the analysis of test runs as a JSON API and a web page
+//
+// The API is:
+//
+//	POST /analyze {"url": URL}                        parses a run and returns it
+//	GET  /runs                                        lists the runs analyzed or recorded in the history
+//	GET  /runs/{id}                                   returns a run, its tests and attempts
+//	GET  /runs/{id}/tests/{name}/attempts/{n}/logs    returns the logs of an attempt as text
+//	GET  /tests/{name}/history                        returns the results of a test over the recorded runs
+//	GET  /metrics                                     returns the metrics of the analyzed runs for Prometheus
+//
+// Test names are the full names or the display names of the summary, escaped
+// as path segments.
+package server
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/migtools/demystifier/lib/fetch"
+	"github.com/migtools/demystifier/lib/history"
+	"github.com/migtools/demystifier/lib/metrics"
+	"github.com/migtools/demystifier/lib/summary"
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultMaxRuns is the number of parsed runs kept in memory
+	DefaultMaxRuns = 20
+	// DefaultHistoryRuns is the number of recorded runs a test history looks at
+	DefaultHistoryRuns = 20
+	// DefaultMaxAnalyses is the number of runs fetched and parsed at the same time
+	DefaultMaxAnalyses = 4
+	// maxRequestSize bounds the body of the POST requests
+	maxRequestSize = 1 << 20
+)
+
+// DefaultAllowedHosts are the hosts of the Prow results, the only ones the
+// clients can have the server fetch from by default
+var DefaultAllowedHosts = []string{
+	"prow.ci.openshift.org",
+	"gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com",
+	"storage.googleapis.com",
+}
+
+// indexPage is the web page, calling the API from the browser
+//
+//go:embed web/index.html
+var indexPage embed.FS
+
+// AnalyzeFunc fetches and parses the run found at a location, it stops when
+// the context of the request is done
+type AnalyzeFunc func(ctx context.Context, location string) (*utils.TestRunData, error)
+
+// Options are the settings of a server
+type Options struct {
+	// Analyze fetches and parses a run, it is called concurrently
+	Analyze AnalyzeFunc
+	// History records the analyzed runs and answers the test histories, nil to keep no history
+	History *history.Store
+	// KnownFlakes returns the issues of the known flakes found in the logs of a failed attempt, nil to skip them
+	KnownFlakes func(logs string) []string
+	// MaxRuns is the number of parsed runs kept in memory, DefaultMaxRuns when not positive
+	MaxRuns int
+	// AllowLocal lets the clients analyze the files of the server, only URLs are accepted otherwise
+	AllowLocal bool
+	// AllowedHosts are the hosts of the URLs the clients can analyze, DefaultAllowedHosts when empty
+	AllowedHosts []string
+	// MaxAnalyses is the number of runs fetched and parsed at the same time, DefaultMaxAnalyses when not positive
+	MaxAnalyses int
+	// Metrics counts the analyzed runs for GET /metrics, nil to disable the endpoint
+	Metrics *metrics.Collector
+}
+
+// Server answers the API and serves the web page
+type Server struct {
+	opts Options
+	// analyses holds a token during each call of opts.Analyze
+	analyses chan struct{}
+
+	mu sync.Mutex
+	// runs are the parsed runs by ID, order their IDs from the least recently used
+	runs  map[string]*loadedRun
+	order []string
+}
+
+// loadedRun is a parsed run kept in memory
+type loadedRun struct {
+	record *history.RunRecord
+	data   *utils.TestRunData
+	names  []string
+}
+
+// Job is the Prow job of a run, see utils.JobInfo, the fields are empty for
+// the local logs
+type Job struct {
+	JobName     string `json:"jobName"`
+	RunID       string `json:"runId"`
+	Platform    string `json:"platform"`
+	OCPVersion  string `json:"ocpVersion"`
+	PullRequest string `json:"pullRequest,omitempty"`
+}
+
+func newJob(job utils.JobInfo) Job {
+	return Job{
+		JobName:     job.JobName,
+		RunID:       job.RunID,
+		Platform:    job.Platform,
+		OCPVersion:  job.OCPVersion,
+		PullRequest: job.PullRequest,
+	}
+}
+
+// RunSummary is a run of the list
+type RunSummary struct {
+	ID        string    `json:"id"`
+	Job       Job       `json:"job"`
+	StartedAt time.Time `json:"startedAt"`
+	Tests     int       `json:"tests"`
+	Failed    int       `json:"failed"`
+	Flaky     int       `json:"flaky"`
+	// Loaded tells whether the logs of the run are in memory
+	Loaded bool `json:"loaded"`
+}
+
+// Run is a run with its tests
+type Run struct {
+	ID        string    `json:"id"`
+	Job       Job       `json:"job"`
+	StartedAt time.Time `json:"startedAt"`
+	Tests     []Test    `json:"tests"`
+}
+
+// Test is a test of a run
+type Test struct {
+	// DisplayName identifies the test in the paths of the API
+	DisplayName string    `json:"displayName"`
+	Name        string    `json:"name"`
+	ShortName   string    `json:"shortName"`
+	Suite       string    `json:"suite,omitempty"`
+	Verdict     string    `json:"verdict"`
+	Attempts    []Attempt `json:"attempts"`
+}
+
+// Attempt is an attempt of a test, without its logs
+type Attempt struct {
+	Number    int       `json:"number"`
+	Status    string    `json:"status"`
+	StartTime time.Time `json:"startTime"`
+	Duration  float64   `json:"durationSeconds"`
+	Lines     int       `json:"lines"`
+	// KnownFlakes are the issues of the known flakes found in the logs of a failed attempt
+	KnownFlakes []string `json:"knownFlakes,omitempty"`
+}
+
+// TestHistory is the result of a test over the recorded runs, most recent first
+type TestHistory struct {
+	Stats TestStats `json:"stats"`
+	Runs  []TestRun `json:"runs"`
+}
+
+// TestStats is the trend of a test over the recorded runs, see history.TestStats
+type TestStats struct {
+	Name             string     `json:"name"`
+	ShortName        string     `json:"shortName"`
+	Runs             int        `json:"runs"`
+	Passed           int        `json:"passed"`
+	Failed           int        `json:"failed"`
+	Flaky            int        `json:"flaky"`
+	Skipped          int        `json:"skipped"`
+	FailRate         float64    `json:"failRate"`
+	FlakeRate        float64    `json:"flakeRate"`
+	P50              float64    `json:"p50Seconds"`
+	P90              float64    `json:"p90Seconds"`
+	Max              float64    `json:"maxSeconds"`
+	FirstSeenFailing *time.Time `json:"firstSeenFailing,omitempty"`
+	LastSeen         time.Time  `json:"lastSeen"`
+}
+
+// TestRun is the result of a test in a recorded run
+type TestRun struct {
+	ID        string    `json:"id"`
+	Job       Job       `json:"job"`
+	StartedAt time.Time `json:"startedAt"`
+	Verdict   string    `json:"verdict"`
+	Attempts  int       `json:"attempts"`
+	Duration  float64   `json:"durationSeconds"`
+}
+
+// apiError is the body of the error responses
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// statusError is an error with the HTTP status of its response
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func errorf(status int, format string, args ...interface{}) error {
+	return &statusError{status: status, err: fmt.Errorf(format, args...)}
+}
+
+// New returns a server, opts.Analyze is required
+func New(opts Options) *Server {
+	if opts.MaxRuns <= 0 {
+		opts.MaxRuns = DefaultMaxRuns
+	}
+	if opts.MaxAnalyses <= 0 {
+		opts.MaxAnalyses = DefaultMaxAnalyses
+	}
+	if len(opts.AllowedHosts) == 0 {
+		opts.AllowedHosts = DefaultAllowedHosts
+	}
+	return &Server{
+		opts:     opts,
+		analyses: make(chan struct{}, opts.MaxAnalyses),
+		runs:     make(map[string]*loadedRun),
+	}
+}
+
+// ServeHTTP routes the requests of the API and the web page
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments, err := pathSegments(r.URL)
+	if err != nil {
+		writeError(w, errorf(http.StatusBadRequest, "invalid path: %v", err))
+		return
+	}
+
+	switch {
+	case len(segments) == 0:
+		s.route(w, r, http.MethodGet, s.serveIndex)
+	case len(segments) == 1 && segments[0] == "analyze":
+		s.route(w, r, http.MethodPost, s.analyze)
+	case len(segments) == 1 && segments[0] == "runs":
+		s.route(w, r, http.MethodGet, s.listRuns)
+	case len(segments) == 2 && segments[0] == "runs":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) error {
+			return s.getRun(w, r, segments[1])
+		})
+	case len(segments) == 7 && segments[0] == "runs" && segments[2] == "tests" && segments[4] == "attempts" && segments[6] == "logs":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) error {
+			return s.getLogs(w, r, segments[1], segments[3], segments[5])
+		})
+	case len(segments) == 1 && segments[0] == "metrics" && s.opts.Metrics != nil:
+		s.route(w, r, http.MethodGet, s.writeMetrics)
+	case len(segments) == 3 && segments[0] == "tests" && segments[2] == "history":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) error {
+			return s.testHistory(w, r, segments[1])
+		})
+	default:
+		writeError(w, errorf(http.StatusNotFound, "no such endpoint %s", r.URL.Path))
+	}
+}
+
+// route calls the handler of an endpoint, answering its errors
+func (s *Server) route(w http.ResponseWriter, r *http.Request, method string, handler func(http.ResponseWriter, *http.Request) error) {
+	if r.Method != method && !(method == http.MethodGet && r.Method == http.MethodHead) {
+		w.Header().Set("Allow", method)
+		writeError(w, errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method))
+		return
+	}
+	if err := handler(w, r); err != nil {
+		entry := log.WithFields(log.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"error":  err,
+		})
+		if status := writeError(w, err); status >= http.StatusInternalServerError {
+			entry.Warn("Request failed")
+		} else {
+			entry.Debug("Request refused")
+		}
+	}
+}
+
+// pathSegments splits the escaped path, so that the test names can hold slashes
+func pathSegments(u *url.URL) ([]string, error) {
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(u.EscapedPath(), "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, unescaped)
+	}
+	return segments, nil
+}
+
+func (s *Server) serveIndex(w http.ResponseWriter, _ *http.Request) error {
+	page, err := indexPage.ReadFile("web/index.html")
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err = w.Write(page)
+	return err
+}
+
+// analyze parses the run of the posted URL, records it and returns it
+func (s *Server) analyze(w http.ResponseWriter, r *http.Request) error {
+	var request struct {
+		URL string `json:"url"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err := decoder.Decode(&request); err != nil {
+		return errorf(http.StatusBadRequest, "error decoding request: %v", err)
+	}
+	location := strings.TrimSpace(request.URL)
+	if location == "" {
+		return errorf(http.StatusBadRequest, "missing url")
+	}
+	if err := s.checkLocation(location); err != nil {
+		return err
+	}
+
+	run, err := s.load(r.Context(), location)
+	if err != nil {
+		return err
+	}
+	if s.opts.History != nil {
+		if _, err := s.opts.History.Record(run.record.Job, run.data); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Warn("Could not record the run in the history")
+		}
+	}
+	if s.opts.Metrics != nil {
+		s.opts.Metrics.Observe(run.record.Job, run.data)
+	}
+	return writeJSON(w, s.newRun(run))
+}
+
+// checkLocation refuses the files of the server unless opts.AllowLocal, and
+// the URLs of the hosts not in opts.AllowedHosts, so that the clients cannot
+// have the server send requests to the internal services
+func (s *Server) checkLocation(location string) error {
+	if !fetch.IsRemote(location) {
+		if s.opts.AllowLocal {
+			return nil
+		}
+		return errorf(http.StatusBadRequest, "url must be an http or https URL, got %s", location)
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return errorf(http.StatusBadRequest, "invalid url %s: %v", location, err)
+	}
+	for _, host := range s.opts.AllowedHosts {
+		if strings.EqualFold(u.Hostname(), host) {
+			return nil
+		}
+	}
+	return errorf(http.StatusForbidden, "host %s is not allowed, the allowed hosts are %s", u.Hostname(), strings.Join(s.opts.AllowedHosts, ", "))
+}
+
+// writeMetrics returns the metrics of the runs analyzed since the start
+func (s *Server) writeMetrics(w http.ResponseWriter, _ *http.Request) error {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	return s.opts.Metrics.WriteText(w)
+}
+
+// load parses the run of a location and keeps it in memory, waiting for one
+// of the opts.MaxAnalyses analyses to end when they are all running
+func (s *Server) load(ctx context.Context, location string) (*loadedRun, error) {
+	select {
+	case s.analyses <- struct{}{}:
+	case <-ctx.Done():
+		return nil, errorf(http.StatusServiceUnavailable, "error analyzing %s: %v", location, ctx.Err())
+	}
+	data, err := s.opts.Analyze(ctx, location)
+	<-s.analyses
+	if err != nil {
+		return nil, errorf(http.StatusBadGateway, "error analyzing %s: %v", location, err)
+	}
+	run := &loadedRun{
+		record: history.NewRunRecord(utils.GetJobInfo(location), data),
+		data:   data,
+		names:  summary.DisplayNames(data),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := run.record.Job.RunID
+	s.runs[id] = run
+	s.touch(id)
+	for len(s.order) > s.opts.MaxRuns {
+		delete(s.runs, s.order[0])
+		s.order = s.order[1:]
+	}
+	return run, nil
+}
+
+// touch moves a run to the end of the order, s.mu is held
+func (s *Server) touch(id string) {
+	for i, other := range s.order {
+		if other == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	s.order = append(s.order, id)
+}
+
+// findRun returns a run kept in memory, or parses again a recorded run from
+// its location, which is cheap when its logs are in the cache
+func (s *Server) findRun(ctx context.Context, id string) (*loadedRun, error) {
+	s.mu.Lock()
+	run, found := s.runs[id]
+	if found {
+		s.touch(id)
+	}
+	s.mu.Unlock()
+	if found {
+		return run, nil
+	}
+
+	record, err := s.recordedRun(id)
+	if err != nil {
+		return nil, err
+	}
+	if record.Job.Location == "" {
+		return nil, errorf(http.StatusNotFound, "the logs of run %s are not known", id)
+	}
+	// the history is shared with the CLI, which records local logs and any host
+	if err := s.checkLocation(record.Job.Location); err != nil {
+		return nil, err
+	}
+	return s.load(ctx, record.Job.Location)
+}
+
+// recordedRun returns a run of the history
+func (s *Server) recordedRun(id string) (*history.RunRecord, error) {
+	if s.opts.History != nil {
+		runs, err := s.opts.History.Runs(history.Filter{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range runs {
+			if runs[i].Job.RunID == id {
+				return &runs[i], nil
+			}
+		}
+	}
+	return nil, errorf(http.StatusNotFound, "no run %s", id)
+}
+
+// listRuns returns the runs in memory and in the history, most recent first
+func (s *Server) listRuns(w http.ResponseWriter, _ *http.Request) error {
+	byID := map[string]RunSummary{}
+	if s.opts.History != nil {
+		recorded, err := s.opts.History.Runs(history.Filter{})
+		if err != nil {
+			return err
+		}
+		for i := range recorded {
+			byID[recorded[i].Job.RunID] = newRunSummary(&recorded[i], false)
+		}
+	}
+	s.mu.Lock()
+	for id, run := range s.runs {
+		byID[id] = newRunSummary(run.record, true)
+	}
+	s.mu.Unlock()
+
+	runs := make([]RunSummary, 0, len(byID))
+	for _, run := range byID {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].StartedAt.Equal(runs[j].StartedAt) {
+			return runs[i].StartedAt.After(runs[j].StartedAt)
+		}
+		return runs[i].ID < runs[j].ID
+	})
+	return writeJSON(w, runs)
+}
+
+func newRunSummary(record *history.RunRecord, loaded bool) RunSummary {
+	run := RunSummary{
+		ID:        record.Job.RunID,
+		Job:       newJob(record.Job),
+		StartedAt: record.StartedAt,
+		Tests:     len(record.Tests),
+		Loaded:    loaded,
+	}
+	for i := range record.Tests {
+		switch record.Tests[i].Verdict {
+		case utils.Failed:
+			run.Failed++
+		case utils.Flaky:
+			run.Flaky++
+		}
+	}
+	return run
+}
+
+func (s *Server) getRun(w http.ResponseWriter, r *http.Request, id string) error {
+	run, err := s.findRun(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, s.newRun(run))
+}
+
+// newRun returns a parsed run with the known flakes of its failed attempts
+func (s *Server) newRun(run *loadedRun) Run {
+	result := Run{
+		ID:        run.record.Job.RunID,
+		Job:       newJob(run.record.Job),
+		StartedAt: run.record.StartedAt,
+		Tests:     make([]Test, 0, len(run.data.TestRun)),
+	}
+	for i := range run.data.TestRun {
+		thisTest := &run.data.TestRun[i]
+		test := Test{
+			DisplayName: run.names[i],
+			Name:        thisTest.Name,
+			ShortName:   thisTest.ShortName,
+			Suite:       thisTest.Suite,
+			Verdict:     thisTest.Verdict(),
+			Attempts:    make([]Attempt, 0, len(thisTest.Attempt)),
+		}
+		for j := range thisTest.Attempt {
+			thisAttempt := &thisTest.Attempt[j]
+			attempt := Attempt{
+				Number:    thisAttempt.AttemptNo,
+				Status:    thisAttempt.Status.Status,
+				StartTime: thisAttempt.StartTime,
+				Duration:  thisAttempt.Duration.Seconds(),
+				Lines:     len(thisAttempt.Logs),
+			}
+			if attempt.Status == "" {
+				attempt.Status = utils.Passed
+			}
+			if attempt.Status == utils.Failed && s.opts.KnownFlakes != nil {
+				attempt.KnownFlakes = s.opts.KnownFlakes(strings.Join(thisAttempt.Logs, "\n"))
+			}
+			test.Attempts = append(test.Attempts, attempt)
+		}
+		result.Tests = append(result.Tests, test)
+	}
+	return result
+}
+
+// getLogs writes the logs of an attempt as text
+func (s *Server) getLogs(w http.ResponseWriter, r *http.Request, id, name, number string) error {
+	run, err := s.findRun(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	index := findTest(run, name)
+	if index < 0 {
+		return errorf(http.StatusNotFound, "no test %s in run %s", name, id)
+	}
+	attemptNo, err := strconv.Atoi(number)
+	if err != nil {
+		return errorf(http.StatusBadRequest, "invalid attempt number %s", number)
+	}
+
+	thisTest := &run.data.TestRun[index]
+	for i := range thisTest.Attempt {
+		if thisTest.Attempt[i].AttemptNo != attemptNo {
+			continue
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, line := range thisTest.Attempt[i].Logs {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errorf(http.StatusNotFound, "no attempt %d of test %s", attemptNo, name)
+}
+
+// findTest returns the index of the test with a display name or full name, or -1
+func findTest(run *loadedRun, name string) int {
+	for i, displayName := range run.names {
+		if displayName == name {
+			return i
+		}
+	}
+	for i := range run.data.TestRun {
+		if run.data.TestRun[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// testHistory returns the results of a test over the recorded runs matching
+// the job, platform, ocp and n query parameters
+func (s *Server) testHistory(w http.ResponseWriter, r *http.Request, name string) error {
+	if s.opts.History == nil {
+		return errorf(http.StatusNotFound, "no history is recorded")
+	}
+	query := r.URL.Query()
+	filter := history.Filter{
+		JobName:    query.Get("job"),
+		Platform:   query.Get("platform"),
+		OCPVersion: query.Get("ocp"),
+		Last:       DefaultHistoryRuns,
+	}
+	if last := query.Get("n"); last != "" {
+		var err error
+		if filter.Last, err = strconv.Atoi(last); err != nil || filter.Last < 0 {
+			return errorf(http.StatusBadRequest, "invalid number of runs %s", last)
+		}
+	}
+	runs, err := s.opts.History.Runs(filter)
+	if err != nil {
+		return err
+	}
+
+	// the runs where the test is found, by its full name or short name, the
+	// stats are keyed by the first full name found
+	var matching []history.RunRecord
+	fullName := ""
+	result := TestHistory{Runs: []TestRun{}}
+	for i := range runs {
+		for j := range runs[i].Tests {
+			test := &runs[i].Tests[j]
+			if test.Name != name && test.ShortName != name {
+				continue
+			}
+			if fullName == "" {
+				fullName = test.Name
+			}
+			found := *test
+			found.Name = fullName
+			matching = append(matching, history.RunRecord{Job: runs[i].Job, StartedAt: runs[i].StartedAt, Tests: []history.TestRecord{found}})
+			result.Runs = append(result.Runs, TestRun{
+				ID:        runs[i].Job.RunID,
+				Job:       newJob(runs[i].Job),
+				StartedAt: runs[i].StartedAt,
+				Verdict:   test.Verdict,
+				Attempts:  len(test.Attempts),
+				Duration:  test.Duration().Seconds(),
+			})
+			break
+		}
+	}
+	if len(matching) == 0 {
+		return errorf(http.StatusNotFound, "no test %s in the %d recorded runs", name, len(runs))
+	}
+	stats := history.Stats(matching)[0]
+	result.Stats = TestStats{
+		Name:      stats.Name,
+		ShortName: stats.ShortName,
+		Runs:      stats.Runs,
+		Passed:    stats.Passed,
+		Failed:    stats.Failed,
+		Flaky:     stats.Flaky,
+		Skipped:   stats.Skipped,
+		FailRate:  stats.FailRate(),
+		FlakeRate: stats.FlakeRate(),
+		P50:       stats.P50.Seconds(),
+		P90:       stats.P90.Seconds(),
+		Max:       stats.Max.Seconds(),
+		LastSeen:  stats.LastSeen,
+	}
+	if !stats.FirstSeenFailing.IsZero() {
+		result.Stats.FirstSeenFailing = &stats.FirstSeenFailing
+	}
+	return writeJSON(w, result)
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// writeError answers an error, with the status of a statusError or 500, and
+// returns the status
+func writeError(w http.ResponseWriter, err error) int {
+	status := http.StatusInternalServerError
+	var withStatus *statusError
+	if errors.As(err, &withStatus) {
+		status = withStatus.status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(apiError{Error: err.Error()})
+	return status
+}
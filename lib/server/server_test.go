@@ -0,0 +1,385 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/history"
+	"github.com/migtools/demystifier/lib/metrics"
+	"github.com/migtools/demystifier/lib/parser"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// parseFile parses a local log, like the analyze function of the CLI
+func parseFile(location string) (*utils.TestRunData, error) {
+	file, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parser.Parse(context.Background(), file, parser.Options{})
+}
+
+// call sends a request and decodes the JSON answer into result when not nil
+func call(t *testing.T, method, target, body string, result interface{}) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error calling %s %s: %v", method, target, err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading %s %s: %v", method, target, err)
+	}
+	if result != nil && resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(content, result); err != nil {
+			t.Fatalf("Error decoding %s %s: %v\n%s", method, target, err, content)
+		}
+	}
+	return resp.StatusCode, string(content)
+}
+
+func TestAPI(t *testing.T) {
+	store, err := history.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening history: %v", err)
+	}
+	analyzed := 0
+	opts := Options{
+		Analyze: func(_ context.Context, location string) (*utils.TestRunData, error) {
+			analyzed++
+			return parseFile(location)
+		},
+		History:    store,
+		AllowLocal: true,
+		Metrics:    metrics.New(metrics.Options{}),
+		KnownFlakes: func(logs string) []string {
+			if strings.Contains(logs, "velero pods not found") {
+				return []string{"https://issues.example.com/1"}
+			}
+			return nil
+		},
+	}
+	server := httptest.NewServer(New(opts))
+	defer server.Close()
+
+	var run Run
+	status, body := call(t, http.MethodPost, server.URL+"/analyze", `{"url": "`+fixture.BuildLog+`"}`, &run)
+	if status != http.StatusOK {
+		t.Fatalf("POST /analyze = %d %s", status, body)
+	}
+	if !strings.HasPrefix(run.ID, "local-") || len(run.Tests) != 32 {
+		t.Fatalf("POST /analyze returned run %q with %d tests", run.ID, len(run.Tests))
+	}
+	var flaky *Test
+	for i := range run.Tests {
+		if run.Tests[i].DisplayName == "MySQL application CSI" {
+			flaky = &run.Tests[i]
+		}
+	}
+	if flaky == nil || flaky.Verdict != utils.Flaky || len(flaky.Attempts) != 2 ||
+		flaky.Attempts[0].Status != utils.Failed || flaky.Attempts[1].Status != utils.Passed {
+		t.Fatalf("Flaky test = %+v", flaky)
+	}
+	if got := flaky.Attempts[0].KnownFlakes; len(got) != 1 || got[0] != "https://issues.example.com/1" {
+		t.Errorf("Known flakes of the failed attempt = %v", got)
+	}
+
+	var runs []RunSummary
+	if status, body = call(t, http.MethodGet, server.URL+"/runs", "", &runs); status != http.StatusOK {
+		t.Fatalf("GET /runs = %d %s", status, body)
+	}
+	if len(runs) != 1 || runs[0].ID != run.ID || !runs[0].Loaded || runs[0].Tests != 32 || runs[0].Failed == 0 || runs[0].Flaky == 0 {
+		t.Errorf("GET /runs = %+v", runs)
+	}
+
+	var got Run
+	if status, body = call(t, http.MethodGet, server.URL+"/runs/"+run.ID, "", &got); status != http.StatusOK || len(got.Tests) != 32 {
+		t.Fatalf("GET /runs/%s = %d %s", run.ID, status, body)
+	}
+
+	logsPath := server.URL + "/runs/" + run.ID + "/tests/" + url.PathEscape("MySQL application CSI") + "/attempts/1/logs"
+	status, body = call(t, http.MethodGet, logsPath, "", nil)
+	if status != http.StatusOK || strings.Count(body, "\n") != flaky.Attempts[1].Lines || !strings.Contains(body, "> Enter [It] MySQL application CSI") {
+		t.Errorf("GET logs = %d, %d lines: %.80q", status, strings.Count(body, "\n"), body)
+	}
+	if analyzed != 1 {
+		t.Errorf("Analyzed %d times, want once", analyzed)
+	}
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Error calling GET /metrics: %v", err)
+	}
+	content, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != metrics.ContentType ||
+		!strings.Contains(string(content), `demystifier_runs{job="",platform="",ocp_version=""} 1`) ||
+		!strings.Contains(string(content), `demystifier_test_flakes{job="",platform="",ocp_version="",suite="`) {
+		t.Errorf("GET /metrics = %d %s %.300s", resp.StatusCode, resp.Header.Get("Content-Type"), content)
+	}
+
+	// a new server finds the run in the history and parses it again
+	reloaded := httptest.NewServer(New(opts))
+	defer reloaded.Close()
+	if status, body = call(t, http.MethodGet, reloaded.URL+"/runs/"+run.ID, "", &got); status != http.StatusOK || len(got.Tests) != 32 || analyzed != 2 {
+		t.Errorf("GET /runs/%s from the history = %d %s, analyzed %d times", run.ID, status, body, analyzed)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"Web page", http.MethodGet, "/", "", http.StatusOK, "<title>Demystifier</title>"},
+		{"Unknown run", http.MethodGet, "/runs/1234", "", http.StatusNotFound, `{"error":"no run 1234"}`},
+		{"Unknown test", http.MethodGet, "/runs/" + run.ID + "/tests/Nope/attempts/0/logs", "", http.StatusNotFound, "no test Nope"},
+		{"Unknown attempt", http.MethodGet, "/runs/" + run.ID + "/tests/" + url.PathEscape("MySQL application CSI") + "/attempts/5/logs", "", http.StatusNotFound, "no attempt 5"},
+		{"Invalid attempt", http.MethodGet, "/runs/" + run.ID + "/tests/" + url.PathEscape("MySQL application CSI") + "/attempts/last/logs", "", http.StatusBadRequest, "invalid attempt number"},
+		{"Unknown endpoint", http.MethodGet, "/tests", "", http.StatusNotFound, "no such endpoint"},
+		{"Wrong method", http.MethodGet, "/analyze", "", http.StatusMethodNotAllowed, "method GET not allowed"},
+		{"Invalid request", http.MethodPost, "/analyze", "{", http.StatusBadRequest, "error decoding request"},
+		{"Missing URL", http.MethodPost, "/analyze", "{}", http.StatusBadRequest, "missing url"},
+		{"Analyze error", http.MethodPost, "/analyze", `{"url": "missing.txt"}`, http.StatusBadGateway, "error analyzing missing.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := call(t, tt.method, server.URL+tt.path, tt.body, nil)
+			if status != tt.wantStatus || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("%s %s = %d %s, want %d %s", tt.method, tt.path, status, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+// syntheticRun is a run of two tests, one of them failing when failed is set
+func syntheticRun(failed bool, start time.Time) *utils.TestRunData {
+	status := utils.EventStatus{}
+	if failed {
+		status.Status = utils.Failed
+	}
+	return &utils.TestRunData{TestRun: []utils.IndividualTestRunData{
+		{
+			Name:      "[It] Backup restore/CSI",
+			ShortName: "backup/CSI",
+			Attempt:   []utils.AttemptData{{StartTime: start, Duration: time.Minute, Status: status, Logs: []string{"csi"}}},
+		},
+		{
+			Name:      "[It] Backup restore/Restic",
+			ShortName: "Restic",
+			Attempt:   []utils.AttemptData{{StartTime: start, Duration: 2 * time.Minute, Logs: []string{"restic"}}},
+		},
+	}}
+}
+
+func TestTestHistoryAndLimits(t *testing.T) {
+	const job = "https://gcsweb.example.com/gcs/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws/"
+	start := time.Date(2024, 2, 14, 19, 0, 0, 0, time.UTC)
+	runs := map[string]*utils.TestRunData{
+		job + "101/build-log.txt": syntheticRun(true, start),
+		job + "102/build-log.txt": syntheticRun(false, start.Add(24*time.Hour)),
+	}
+	store, err := history.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening history: %v", err)
+	}
+	server := httptest.NewServer(New(Options{
+		Analyze: func(_ context.Context, location string) (*utils.TestRunData, error) {
+			if run, found := runs[location]; found {
+				return run, nil
+			}
+			return nil, errors.New("not found")
+		},
+		History:      store,
+		MaxRuns:      1,
+		AllowedHosts: []string{"gcsweb.example.com"},
+	}))
+	defer server.Close()
+
+	for location := range runs {
+		if status, body := call(t, http.MethodPost, server.URL+"/analyze", `{"url": "`+location+`"}`, nil); status != http.StatusOK {
+			t.Fatalf("POST /analyze %s = %d %s", location, status, body)
+		}
+	}
+	if status, body := call(t, http.MethodPost, server.URL+"/analyze", `{"url": "`+fixture.BuildLog+`"}`, nil); status != http.StatusBadRequest {
+		t.Errorf("POST /analyze of a local file = %d %s, want 400", status, body)
+	}
+	for _, location := range []string{"http://169.254.169.254/latest/meta-data/", "https://gcsweb.example.com.attacker.example/build-log.txt", "https://prow.ci.openshift.org/view/gs/"} {
+		if status, body := call(t, http.MethodPost, server.URL+"/analyze", `{"url": "`+location+`"}`, nil); status != http.StatusForbidden {
+			t.Errorf("POST /analyze %s = %d %s, want 403", location, status, body)
+		}
+	}
+
+	var summaries []RunSummary
+	status, body := call(t, http.MethodGet, server.URL+"/runs", "", &summaries)
+	if status != http.StatusOK || !strings.Contains(body, `"jobName": "periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws"`) ||
+		!strings.Contains(body, `"runId": "102"`) || !strings.Contains(body, `"ocpVersion": "4.14"`) {
+		t.Errorf("GET /runs = %d %s, want the jobs with camelCase fields", status, body)
+	}
+	loaded := 0
+	for _, run := range summaries {
+		if run.Loaded {
+			loaded++
+		}
+	}
+	if len(summaries) != 2 || summaries[0].ID != "102" || summaries[1].ID != "101" || summaries[1].Failed != 1 || loaded != 1 {
+		t.Errorf("GET /runs = %+v, want runs 102 and 101 with one of them in memory", summaries)
+	}
+
+	var result TestHistory
+	status, body = call(t, http.MethodGet, server.URL+"/tests/"+url.PathEscape("backup/CSI")+"/history", "", &result)
+	if status != http.StatusOK {
+		t.Fatalf("GET test history = %d %s", status, body)
+	}
+	if result.Stats.Name != "[It] Backup restore/CSI" || result.Stats.Runs != 2 || result.Stats.Failed != 1 || result.Stats.FailRate != 0.5 || result.Stats.FirstSeenFailing == nil || !result.Stats.FirstSeenFailing.Equal(start) {
+		t.Errorf("Test stats = %+v", result.Stats)
+	}
+	if len(result.Runs) != 2 || result.Runs[0].ID != "102" || result.Runs[0].Verdict != utils.Passed ||
+		result.Runs[1].Verdict != utils.Failed || result.Runs[1].Duration != 60 || result.Runs[1].Job.Platform != "aws" {
+		t.Errorf("Test runs = %+v", result.Runs)
+	}
+
+	status, _ = call(t, http.MethodGet, server.URL+"/tests/Restic/history?n=1&ocp=4.14", "", &result)
+	if status != http.StatusOK || len(result.Runs) != 1 || result.Runs[0].ID != "102" {
+		t.Errorf("GET history of the last run = %d %+v", status, result.Runs)
+	}
+	if status, body = call(t, http.MethodGet, server.URL+"/tests/Restic/history?ocp=4.15", "", nil); status != http.StatusNotFound {
+		t.Errorf("GET history of another OCP version = %d %s", status, body)
+	}
+	if status, body = call(t, http.MethodGet, server.URL+"/tests/Restic/history?n=-1", "", nil); status != http.StatusBadRequest {
+		t.Errorf("GET history with a negative number of runs = %d %s", status, body)
+	}
+	if status, body = call(t, http.MethodGet, server.URL+"/metrics", "", nil); status != http.StatusNotFound {
+		t.Errorf("GET /metrics without metrics = %d %s", status, body)
+	}
+
+	// the runs recorded by the CLI are checked like the analyzed ones
+	local, err := parseFile(fixture.BuildLog)
+	if err != nil {
+		t.Fatalf("Error parsing log: %v", err)
+	}
+	for location, want := range map[string]int{
+		fixture.BuildLog: http.StatusBadRequest,
+		"https://storage.example.com/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws/103/build-log.txt": http.StatusForbidden,
+	} {
+		record, err := store.Record(utils.GetJobInfo(location), local)
+		if err != nil {
+			t.Fatalf("Error recording %s: %v", location, err)
+		}
+		if status, body = call(t, http.MethodGet, server.URL+"/runs/"+record.Job.RunID, "", nil); status != want {
+			t.Errorf("GET recorded run of %s = %d %s, want %d", location, status, body, want)
+		}
+	}
+}
+
+func TestAnalyzeLimits(t *testing.T) {
+	const maxAnalyses = 2
+	var running, maxRunning int32
+	release := make(chan struct{})
+	server := httptest.NewServer(New(Options{
+		Analyze: func(ctx context.Context, location string) (*utils.TestRunData, error) {
+			now := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				previous := atomic.LoadInt32(&maxRunning)
+				if now <= previous || atomic.CompareAndSwapInt32(&maxRunning, previous, now) {
+					break
+				}
+			}
+			select {
+			case <-release:
+				return syntheticRun(false, time.Now()), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+		MaxAnalyses: maxAnalyses,
+	}))
+	defer server.Close()
+
+	// a request given up by its client stops its analysis
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/analyze", strings.NewReader(`{"url": "https://storage.googleapis.com/logs/1/build-log.txt"}`))
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+		t.Fatalf("POST /analyze with a timeout = %d, want an error", resp.StatusCode)
+	}
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt32(&running) != 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("The analysis of a canceled request did not stop")
+		}
+	}
+
+	var wg sync.WaitGroup
+	statuses := make([]int, 2*maxAnalyses+1)
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			location := "https://storage.googleapis.com/logs/" + strconv.Itoa(i) + "/build-log.txt"
+			// call cannot be used, it stops the test from another goroutine
+			resp, err := http.Post(server.URL+"/analyze", "application/json", strings.NewReader(`{"url": "`+location+`"}`))
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+			statuses[i] = resp.StatusCode
+		}(i)
+	}
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt32(&running) != maxAnalyses; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d analyses running, want %d", atomic.LoadInt32(&running), maxAnalyses)
+		}
+	}
+	close(release)
+	wg.Wait()
+	for i, status := range statuses {
+		if status != http.StatusOK {
+			t.Errorf("POST /analyze %d = %d", i, status)
+		}
+	}
+	if maxRunning != maxAnalyses {
+		t.Errorf("%d analyses ran at the same time, want %d", maxRunning, maxAnalyses)
+	}
+}
@@ -0,0 +1,391 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package summary builds the rows of the test summary table, with the
+// columns, order and grouping chosen by the user
+package summary
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// The columns of the summary
+const (
+	ColumnName     = "name"
+	ColumnFullName = "fullname"
+	ColumnLocation = "location"
+	ColumnSuite    = "suite"
+	ColumnVerdict  = "verdict"
+	ColumnAttempts = "attempts"
+	ColumnFailed   = "failed"
+	ColumnAverage  = "avg"
+	ColumnMin      = "min"
+	ColumnMax      = "max"
+	ColumnTotal    = "total"
+	ColumnIssue    = "issue"
+)
+
+// The groupings of the summary
+const (
+	GroupNone      = "none"
+	GroupSuite     = "suite"
+	GroupContainer = "container"
+)
+
+// headers are the titles of the columns, in the order of Columns
+var headers = []struct {
+	column string
+	header string
+}{
+	{ColumnName, "Test Name"},
+	{ColumnFullName, "Full Name"},
+	{ColumnLocation, "Location"},
+	{ColumnSuite, "Suite"},
+	{ColumnVerdict, "Verdict"},
+	{ColumnAttempts, "Num Attempts"},
+	{ColumnFailed, "Num Failed"},
+	{ColumnAverage, "Average Run Time"},
+	{ColumnMin, "Min Run Time"},
+	{ColumnMax, "Max Run Time"},
+	{ColumnTotal, "Total Run Time"},
+	{ColumnIssue, "Known Flake Issue"},
+}
+
+var (
+	// DefaultColumns are the columns printed when none are chosen
+	DefaultColumns = []string{ColumnName, ColumnAttempts, ColumnFailed, ColumnAverage}
+	// DefaultSort is the order of the rows when none is chosen, shortest tests first
+	DefaultSort = []string{ColumnAverage}
+)
+
+// Options are the columns, order and grouping of the summary
+type Options struct {
+	// Columns are the columns printed, DefaultColumns when empty
+	Columns []string
+	// SortBy are the columns sorting the rows, a - prefix sorts in
+	// descending order. DefaultSort when empty.
+	SortBy []string
+	// GroupBy splits the rows in one table per suite file or container
+	GroupBy string
+	// KnownFlakes returns the issues of the known flakes found in the logs
+	// of an attempt, for the issue column
+	KnownFlakes func(logs string) []string
+}
+
+// Row is the summary of a test
+type Row struct {
+	Test *utils.IndividualTestRunData
+	// Name is the short name of the test, followed by a container or its
+	// location when other tests have the same short name
+	Name     string
+	Verdict  string
+	Attempts int
+	Failed   int
+	Average  time.Duration
+	Min      time.Duration
+	Max      time.Duration
+	Total    time.Duration
+	Issues   []string
+}
+
+// Group is a table of the summary
+type Group struct {
+	// Title is the suite file or container of the rows, empty without grouping
+	Title string
+	Rows  []Row
+}
+
+// Columns returns the names of the columns, in the default order
+func Columns() []string {
+	columns := make([]string, 0, len(headers))
+	for _, column := range headers {
+		columns = append(columns, column.column)
+	}
+	return columns
+}
+
+// Header returns the title of a column
+func Header(column string) string {
+	for _, candidate := range headers {
+		if candidate.column == column {
+			return candidate.header
+		}
+	}
+	return column
+}
+
+// Validate checks the column, sort and grouping names
+func (o *Options) Validate() error {
+	for _, column := range o.Columns {
+		if !isColumn(column) {
+			return fmt.Errorf("unknown column %q, expected one of %s", column, strings.Join(Columns(), ", "))
+		}
+	}
+	for _, key := range o.SortBy {
+		if !isColumn(strings.TrimPrefix(key, "-")) {
+			return fmt.Errorf("unknown sort key %q, expected one of %s", key, strings.Join(Columns(), ", "))
+		}
+	}
+	switch o.GroupBy {
+	case "", GroupNone, GroupSuite, GroupContainer:
+		return nil
+	default:
+		return fmt.Errorf("unknown grouping %q, expected %s, %s or %s", o.GroupBy, GroupNone, GroupSuite, GroupContainer)
+	}
+}
+
+func isColumn(column string) bool {
+	for _, candidate := range headers {
+		if candidate.column == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Build returns the summary of a run.
+//
+// Parameters:
+//   - testData: the parsed run.
+//   - opts: the sort keys and grouping, the columns only matter for the known flakes.
+//
+// Returns:
+//   - []Group with the sorted rows of each group, in the order the groups first appear in the run.
+//   - error if an option is invalid.
+func Build(testData *utils.TestRunData, opts Options) ([]Group, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	names := DisplayNames(testData)
+	withIssues := opts.KnownFlakes != nil && (containsString(opts.Columns, ColumnIssue) || containsSortKey(opts.SortBy, ColumnIssue))
+
+	var groups []Group
+	groupIndex := map[string]int{}
+	for i := range testData.TestRun {
+		row := newRow(&testData.TestRun[i], names[i])
+		if withIssues {
+			row.Issues = issues(row.Test, opts.KnownFlakes)
+		}
+		title := groupTitle(row.Test, opts.GroupBy)
+		index, found := groupIndex[title]
+		if !found {
+			index = len(groups)
+			groupIndex[title] = index
+			groups = append(groups, Group{Title: title})
+		}
+		groups[index].Rows = append(groups[index].Rows, row)
+	}
+
+	sortKeys := opts.SortBy
+	if len(sortKeys) == 0 {
+		sortKeys = DefaultSort
+	}
+	for i := range groups {
+		rows := groups[i].Rows
+		sort.SliceStable(rows, func(a, b int) bool {
+			return less(&rows[a], &rows[b], sortKeys)
+		})
+	}
+	return groups, nil
+}
+
+func newRow(test *utils.IndividualTestRunData, name string) Row {
+	row := Row{Test: test, Name: name, Verdict: test.Verdict(), Attempts: len(test.Attempt)}
+	for j := range test.Attempt {
+		attempt := &test.Attempt[j]
+		if attempt.Status.Status == utils.Failed {
+			row.Failed++
+		}
+		row.Total += attempt.Duration
+		if j == 0 || attempt.Duration < row.Min {
+			row.Min = attempt.Duration
+		}
+		if attempt.Duration > row.Max {
+			row.Max = attempt.Duration
+		}
+	}
+	if row.Attempts > 0 {
+		row.Average = (row.Total / time.Duration(row.Attempts)).Round(time.Millisecond)
+	}
+	return row
+}
+
+// issues returns the known flake issues found in the failed attempts of a test
+func issues(test *utils.IndividualTestRunData, knownFlakes func(logs string) []string) []string {
+	var found []string
+	for j := range test.Attempt {
+		if test.Attempt[j].Status.Status != utils.Failed {
+			continue
+		}
+		for _, issue := range knownFlakes(strings.Join(test.Attempt[j].Logs, "\n")) {
+			if !containsString(found, issue) {
+				found = append(found, issue)
+			}
+		}
+	}
+	return found
+}
+
+func groupTitle(test *utils.IndividualTestRunData, groupBy string) string {
+	switch groupBy {
+	case GroupSuite:
+		return test.Suite
+	case GroupContainer:
+		return strings.Join(test.Containers, " / ")
+	default:
+		return ""
+	}
+}
+
+// DisplayNames returns the short names of the tests of a run, followed by
+// the innermost container only they are in, or by their location, when
+// other tests have the same short name
+func DisplayNames(testData *utils.TestRunData) []string {
+	byName := map[string][]int{}
+	for i := range testData.TestRun {
+		byName[testData.TestRun[i].ShortName] = append(byName[testData.TestRun[i].ShortName], i)
+	}
+
+	names := make([]string, len(testData.TestRun))
+	for i := range testData.TestRun {
+		test := &testData.TestRun[i]
+		names[i] = test.ShortName
+		if len(byName[test.ShortName]) > 1 {
+			names[i] = fmt.Sprintf("%s (%s)", test.ShortName, distinguisher(testData, i, byName[test.ShortName]))
+		}
+	}
+	return names
+}
+
+// distinguisher returns the innermost container of a test which none of the
+// tests with the same name is in, its location otherwise
+func distinguisher(testData *utils.TestRunData, index int, sameName []int) string {
+	test := &testData.TestRun[index]
+	for j := len(test.Containers) - 1; j >= 0; j-- {
+		unique := true
+		for _, other := range sameName {
+			if other != index && containsString(testData.TestRun[other].Containers, test.Containers[j]) {
+				unique = false
+				break
+			}
+		}
+		if unique {
+			return test.Containers[j]
+		}
+	}
+	if strings.Contains(test.Name, ":") {
+		return filepath.Base(test.Name)
+	}
+	if test.Suite != "" {
+		return test.Suite
+	}
+	return test.Name
+}
+
+// Value returns the cell of a column
+func (r *Row) Value(column string) interface{} {
+	switch column {
+	case ColumnName:
+		return r.Name
+	case ColumnFullName:
+		return r.Test.FullText()
+	case ColumnLocation:
+		return r.Test.Name
+	case ColumnSuite:
+		return r.Test.Suite
+	case ColumnVerdict:
+		return r.Verdict
+	case ColumnAttempts:
+		return r.Attempts
+	case ColumnFailed:
+		return r.Failed
+	case ColumnAverage:
+		return r.Average
+	case ColumnMin:
+		return r.Min
+	case ColumnMax:
+		return r.Max
+	case ColumnTotal:
+		return r.Total
+	case ColumnIssue:
+		return strings.Join(r.Issues, ", ")
+	default:
+		return ""
+	}
+}
+
+// less compares two rows on the sort keys in turn
+func less(a, b *Row, keys []string) bool {
+	for _, key := range keys {
+		descending := strings.HasPrefix(key, "-")
+		column := strings.TrimPrefix(key, "-")
+		cmp := compare(a.Value(column), b.Value(column))
+		if cmp == 0 {
+			continue
+		}
+		if descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+	return false
+}
+
+func compare(a, b interface{}) int {
+	switch a := a.(type) {
+	case int:
+		return compareOrdered(a, b.(int))
+	case time.Duration:
+		return compareOrdered(a, b.(time.Duration))
+	default:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	}
+}
+
+func compareOrdered[T int | time.Duration](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSortKey(keys []string, column string) bool {
+	for _, key := range keys {
+		if strings.TrimPrefix(key, "-") == column {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package summary
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+func TestDisplayNames(t *testing.T) {
+	run := &utils.TestRunData{TestRun: []utils.IndividualTestRunData{
+		{Name: "a_test.go:10", ShortName: "Should succeed", Containers: []string{"DPA", "Restic"}},
+		{Name: "a_test.go:20", ShortName: "Should succeed", Containers: []string{"DPA", "Kopia"}},
+		{Name: "a_test.go:30", ShortName: "Unique", Containers: []string{"DPA"}},
+		{Name: "/e2e/b_test.go:40", ShortName: "Entry", Containers: []string{"Table"}},
+		{Name: "/e2e/b_test.go:50", ShortName: "Entry", Containers: []string{"Table"}},
+		{Name: "backup.TestRun", ShortName: "TestRun", Suite: "example.com/backup"},
+		{Name: "restore.TestRun", ShortName: "TestRun", Suite: "example.com/restore"},
+	}}
+	want := []string{
+		"Should succeed (Restic)",
+		"Should succeed (Kopia)",
+		"Unique",
+		"Entry (b_test.go:40)",
+		"Entry (b_test.go:50)",
+		"TestRun (example.com/backup)",
+		"TestRun (example.com/restore)",
+	}
+	if got := DisplayNames(run); !reflect.DeepEqual(got, want) {
+		t.Errorf("DisplayNames() = %q, want %q", got, want)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	run := fixture.Parse(t)
+
+	tests := []struct {
+		name       string
+		opts       Options
+		wantTitles []string
+		// wantFirst are the names of the first rows of each group
+		wantFirst [][]string
+	}{
+		{
+			name:       "Default order",
+			wantTitles: []string{""},
+			wantFirst:  [][]string{{"Should succeed (DPA / Restic Deletion test)", "AWS Without Region And S3ForcePathStyle true should fail"}},
+		},
+		{
+			name:       "Failures first then names",
+			opts:       Options{SortBy: []string{"-failed", "name"}},
+			wantTitles: []string{""},
+			wantFirst:  [][]string{{"MySQL application two Vol CSI", "MySQL application CSI", "AWS With Region And S3ForcePathStyle should succeed"}},
+		},
+		{
+			name: "Grouped by suite file",
+			opts: Options{GroupBy: GroupSuite, SortBy: []string{"-total"}},
+			wantTitles: []string{
+				"/go/src/github.com/openshift/oadp-operator/tests/e2e/must-gather_suite_test.go",
+				"/go/src/github.com/openshift/oadp-operator/tests/e2e/backup_restore_suite_test.go",
+				"/go/src/github.com/openshift/oadp-operator/tests/e2e/dpa_deployment_suite_test.go",
+				"/go/src/github.com/openshift/oadp-operator/tests/e2e/subscription_suite_test.go",
+			},
+			wantFirst: [][]string{
+				{"Mongo application DATAMOVER (Backup and restore applications and run must-gather)"},
+				{"MySQL application CSI", "MySQL application two Vol CSI"},
+				{"Default velero CR with restic disabled"},
+				{"Config unset"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups, err := Build(run, tt.opts)
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			var titles []string
+			for _, group := range groups {
+				titles = append(titles, group.Title)
+			}
+			if !reflect.DeepEqual(titles, tt.wantTitles) {
+				t.Fatalf("Build() groups = %q, want %q", titles, tt.wantTitles)
+			}
+			for i, want := range tt.wantFirst {
+				var got []string
+				for _, row := range groups[i].Rows[:len(want)] {
+					got = append(got, row.Name)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Build() rows of %q = %q, want %q", tt.wantTitles[i], got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRow(t *testing.T) {
+	test := utils.IndividualTestRunData{
+		Name:       "backup_test.go:12",
+		ShortName:  "MySQL application CSI",
+		Containers: []string{"Backup and restore"},
+		Attempt: []utils.AttemptData{
+			{Duration: 3 * time.Minute, Status: utils.EventStatus{Status: utils.Failed}, Logs: []string{"quota exceeded"}},
+			{Duration: 500 * time.Millisecond, Status: utils.EventStatus{Status: utils.Failed}, Logs: []string{"timeout"}},
+			{Duration: time.Minute, Status: utils.EventStatus{Status: utils.Passed}, Logs: []string{"quota exceeded"}},
+		},
+	}
+	knownFlakes := func(logs string) []string {
+		if strings.Contains(logs, "quota") {
+			return []string{"https://issues.example.com/1"}
+		}
+		return nil
+	}
+	groups, err := Build(&utils.TestRunData{TestRun: []utils.IndividualTestRunData{test}},
+		Options{Columns: Columns(), KnownFlakes: knownFlakes})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	row := groups[0].Rows[0]
+	want := map[string]interface{}{
+		ColumnName:     "MySQL application CSI",
+		ColumnFullName: "Backup and restore MySQL application CSI",
+		ColumnLocation: "backup_test.go:12",
+		ColumnVerdict:  utils.Flaky,
+		ColumnAttempts: 3,
+		ColumnFailed:   2,
+		ColumnAverage:  80167 * time.Millisecond,
+		ColumnMin:      500 * time.Millisecond,
+		ColumnMax:      3 * time.Minute,
+		ColumnTotal:    4*time.Minute + 500*time.Millisecond,
+		ColumnIssue:    "https://issues.example.com/1",
+	}
+	for column, value := range want {
+		if got := row.Value(column); got != value {
+			t.Errorf("Value(%s) = %v, want %v", column, got, value)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{name: "Defaults"},
+		{name: "Every column", opts: Options{Columns: Columns(), SortBy: []string{"-issue", "location"}, GroupBy: GroupContainer}},
+		{name: "Unknown column", opts: Options{Columns: []string{"owner"}}, wantErr: true},
+		{name: "Unknown sort key", opts: Options{SortBy: []string{"-duration"}}, wantErr: true},
+		{name: "Unknown grouping", opts: Options{GroupBy: "label"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
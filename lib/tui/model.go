@@ -0,0 +1,502 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tui browses a parsed run in the terminal: a list of the tests and
+// of their attempts, next to the logs of the selected attempt.
+//
+// The Model holds the state of the screen and is driven by keys, Run
+// connects it to the terminal.
+package tui
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/migtools/demystifier/lib/flakechecker"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+// Key is a key pressed, the name of a special key or the character typed
+type Key string
+
+// The special keys
+const (
+	KeyUp        Key = "up"
+	KeyDown      Key = "down"
+	KeyPageUp    Key = "pgup"
+	KeyPageDown  Key = "pgdown"
+	KeyHome      Key = "home"
+	KeyEnd       Key = "end"
+	KeyTab       Key = "tab"
+	KeyEnter     Key = "enter"
+	KeyEscape    Key = "esc"
+	KeyBackspace Key = "backspace"
+	KeyCtrlC     Key = "ctrl+c"
+)
+
+// minFoldedLines is the number of similar lines in a row folded into one
+const minFoldedLines = 3
+
+// helpLine lists the keys in the status bar
+const helpLine = "↑↓ move  tab switch pane  / search  n/N next/previous  f failure  z fold  o open issue  q quit"
+
+// failureLineRegex is a failure reported by Ginkgo
+var failureLineRegex = regexp.MustCompile(`^\s*\[(FAILED|PANICKED|TIMEDOUT|INTERRUPTED)\]`)
+
+// verdictColors are the colors of the test verdicts and attempt statuses
+var verdictColors = map[string]text.Colors{
+	utils.Failed:  {text.FgRed},
+	utils.Timeout: {text.FgRed},
+	utils.Flaky:   {text.FgYellow},
+	utils.Passed:  {text.FgGreen},
+	utils.Skipped: {text.Faint},
+}
+
+// Options are the actions of the browser
+type Options struct {
+	// KnownFlakes returns the flake patterns found in the logs of an attempt
+	KnownFlakes func(logs string) []flakechecker.FlakePattern
+	// OpenURL opens the issue of a known flake in the browser
+	OpenURL func(url string) error
+}
+
+type pane int
+
+const (
+	paneList pane = iota
+	paneLogs
+)
+
+// item is a row of the list, a test or one of its attempts
+type item struct {
+	test int
+	// attempt is -1 for the row of the test
+	attempt int
+}
+
+// logLine is a line of the log pane
+type logLine struct {
+	text string
+	// folded is the number of similar lines hidden after this one
+	folded int
+}
+
+// Model is the state of the browser
+type Model struct {
+	run   *utils.TestRunData
+	opts  Options
+	items []item
+	// selected is the selected item, listTop the first item shown
+	selected int
+	listTop  int
+	focus    pane
+	// lines are the lines of the attempt shown, logTop the first one shown
+	// and mark the one found by the last search or jump, -1 without one
+	lines  []logLine
+	logTop int
+	mark   int
+	fold   bool
+	// searching is set while the query is typed
+	searching bool
+	query     string
+	status    string
+	quit      bool
+	width     int
+	height    int
+}
+
+// NewModel returns the browser of a run, with the first test selected and
+// the repeated lines folded
+func NewModel(run *utils.TestRunData, opts Options) *Model {
+	m := &Model{run: run, opts: opts, fold: true, mark: -1, width: 80, height: 24}
+	for i := range run.TestRun {
+		m.items = append(m.items, item{test: i, attempt: -1})
+		for j := range run.TestRun[i].Attempt {
+			m.items = append(m.items, item{test: i, attempt: j})
+		}
+	}
+	m.loadLines()
+	return m
+}
+
+// SetSize sets the size of the screen
+func (m *Model) SetSize(width, height int) {
+	m.width, m.height = width, height
+	m.scrollList()
+}
+
+// Quit tells whether the user asked to leave
+func (m *Model) Quit() bool {
+	return m.quit
+}
+
+// Update applies a key
+func (m *Model) Update(key Key) {
+	if m.searching {
+		m.updateSearch(key)
+		return
+	}
+	m.status = ""
+	switch key {
+	case "q", KeyCtrlC:
+		m.quit = true
+	case KeyTab:
+		m.focus = 1 - m.focus
+	case KeyEnter:
+		m.focus = paneLogs
+	case KeyEscape:
+		m.focus = paneList
+	case "/":
+		m.searching, m.query = true, ""
+	case "n":
+		m.find(m.query, 1)
+	case "N":
+		m.find(m.query, -1)
+	case "f":
+		m.findFailure()
+	case "z":
+		m.fold = !m.fold
+		m.loadLines()
+	case "o":
+		m.openIssue()
+	default:
+		if m.focus == paneList {
+			m.moveSelection(key)
+		} else {
+			m.scrollLogs(key)
+		}
+	}
+}
+
+func (m *Model) updateSearch(key Key) {
+	switch key {
+	case KeyEnter:
+		m.searching = false
+		m.find(m.query, 1)
+	case KeyEscape, KeyCtrlC:
+		m.searching, m.query = false, ""
+	case KeyBackspace:
+		if runes := []rune(m.query); len(runes) > 0 {
+			m.query = string(runes[:len(runes)-1])
+		}
+	default:
+		if len([]rune(string(key))) == 1 {
+			m.query += string(key)
+		}
+	}
+}
+
+// bodyHeight is the number of rows of the panes, without the title and status bars
+func (m *Model) bodyHeight() int {
+	if m.height < 3 {
+		return 1
+	}
+	return m.height - 2
+}
+
+func (m *Model) moveSelection(key Key) {
+	selected := m.selected
+	switch key {
+	case KeyUp, "k":
+		selected--
+	case KeyDown, "j":
+		selected++
+	case KeyPageUp:
+		selected -= m.bodyHeight()
+	case KeyPageDown, " ":
+		selected += m.bodyHeight()
+	case KeyHome, "g":
+		selected = 0
+	case KeyEnd, "G":
+		selected = len(m.items) - 1
+	default:
+		return
+	}
+	if selected >= len(m.items) {
+		selected = len(m.items) - 1
+	}
+	if selected < 0 {
+		selected = 0
+	}
+	if selected != m.selected {
+		m.selected = selected
+		m.loadLines()
+	}
+	m.scrollList()
+}
+
+func (m *Model) scrollList() {
+	if m.selected < m.listTop {
+		m.listTop = m.selected
+	}
+	if m.selected >= m.listTop+m.bodyHeight() {
+		m.listTop = m.selected - m.bodyHeight() + 1
+	}
+}
+
+func (m *Model) scrollLogs(key Key) {
+	switch key {
+	case KeyUp, "k":
+		m.logTop--
+	case KeyDown, "j":
+		m.logTop++
+	case KeyPageUp:
+		m.logTop -= m.bodyHeight()
+	case KeyPageDown, " ":
+		m.logTop += m.bodyHeight()
+	case KeyHome, "g":
+		m.logTop = 0
+	case KeyEnd, "G":
+		m.logTop = len(m.lines) - m.bodyHeight()
+	}
+	m.clampLogTop()
+}
+
+func (m *Model) clampLogTop() {
+	if m.logTop > len(m.lines)-m.bodyHeight() {
+		m.logTop = len(m.lines) - m.bodyHeight()
+	}
+	if m.logTop < 0 {
+		m.logTop = 0
+	}
+}
+
+// attempt returns the attempt shown: the selected one, or the first failed
+// attempt of the selected test, its last attempt otherwise
+func (m *Model) attempt() (*utils.IndividualTestRunData, *utils.AttemptData) {
+	if len(m.items) == 0 {
+		return nil, nil
+	}
+	selected := m.items[m.selected]
+	test := &m.run.TestRun[selected.test]
+	if selected.attempt >= 0 {
+		return test, &test.Attempt[selected.attempt]
+	}
+	if len(test.Attempt) == 0 {
+		return test, nil
+	}
+	for j := range test.Attempt {
+		if test.Attempt[j].Status.Status == utils.Failed {
+			return test, &test.Attempt[j]
+		}
+	}
+	return test, &test.Attempt[len(test.Attempt)-1]
+}
+
+// loadLines sets the lines of the attempt shown, folding the runs of
+// similar lines, such as the polling of a phase, when folding is on
+func (m *Model) loadLines() {
+	m.lines, m.logTop, m.mark = nil, 0, -1
+	_, attempt := m.attempt()
+	if attempt == nil {
+		return
+	}
+	for i := 0; i < len(attempt.Logs); {
+		end := i + 1
+		if m.fold {
+			normalized := utils.NormalizeLine(attempt.Logs[i])
+			for end < len(attempt.Logs) && utils.NormalizeLine(attempt.Logs[end]) == normalized {
+				end++
+			}
+			if end-i < minFoldedLines {
+				end = i + 1
+			}
+		}
+		m.lines = append(m.lines, logLine{text: attempt.Logs[i], folded: end - i - 1})
+		i = end
+	}
+}
+
+// find marks the next line containing the query, searching backwards when
+// direction is -1, and wrapping around
+func (m *Model) find(query string, direction int) {
+	if query == "" {
+		m.status = "No search, type / to search"
+		return
+	}
+	lower := strings.ToLower(query)
+	if !m.jump(direction, func(line string) bool { return strings.Contains(strings.ToLower(line), lower) }) {
+		m.status = fmt.Sprintf("%q not found", query)
+	}
+}
+
+// findFailure marks the next failure reported by Ginkgo
+func (m *Model) findFailure() {
+	if !m.jump(1, failureLineRegex.MatchString) {
+		m.status = "No failure in this attempt"
+	}
+}
+
+// jump marks the next line matching, from the marked line or the first line
+// shown, and scrolls the logs to show it
+func (m *Model) jump(direction int, match func(line string) bool) bool {
+	if len(m.lines) == 0 {
+		return false
+	}
+	start := m.mark
+	if start < 0 {
+		start = m.logTop - direction
+	}
+	for step := 1; step <= len(m.lines); step++ {
+		index := ((start+direction*step)%len(m.lines) + len(m.lines)) % len(m.lines)
+		if match(m.lines[index].text) {
+			m.mark = index
+			m.focus = paneLogs
+			if index < m.logTop || index >= m.logTop+m.bodyHeight() {
+				m.logTop = index - m.bodyHeight()/3
+				m.clampLogTop()
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// openIssue opens the issue of the first known flake found in the attempt shown
+func (m *Model) openIssue() {
+	_, attempt := m.attempt()
+	if attempt == nil || m.opts.KnownFlakes == nil {
+		m.status = "No known flake in this attempt"
+		return
+	}
+	flakes := m.opts.KnownFlakes(strings.Join(attempt.Logs, "\n"))
+	if len(flakes) == 0 {
+		m.status = "No known flake in this attempt"
+		return
+	}
+	flake := flakes[0]
+	if m.opts.OpenURL == nil || !strings.HasPrefix(flake.Issue, "http://") && !strings.HasPrefix(flake.Issue, "https://") {
+		m.status = fmt.Sprintf("Known flake: %s (%s)", flake.Description, flake.Issue)
+		return
+	}
+	if err := m.opts.OpenURL(flake.Issue); err != nil {
+		m.status = fmt.Sprintf("Error opening %s: %v", flake.Issue, err)
+		return
+	}
+	m.status = fmt.Sprintf("Opened %s: %s", flake.Issue, flake.Description)
+}
+
+// View returns the rows of the screen
+func (m *Model) View() []string {
+	listWidth := m.width * 2 / 5
+	if listWidth > 60 {
+		listWidth = 60
+	}
+	if listWidth < 20 {
+		listWidth = 20
+	}
+	logWidth := m.width - listWidth - 1
+	if logWidth < 1 {
+		logWidth = 1
+	}
+
+	rows := []string{m.title(listWidth, logWidth)}
+	for row := 0; row < m.bodyHeight(); row++ {
+		rows = append(rows, m.listRow(m.listTop+row, listWidth)+"│"+m.logRow(m.logTop+row, logWidth))
+	}
+	status := m.status
+	switch {
+	case m.searching:
+		status = "/" + m.query
+	case status == "":
+		status = helpLine
+	}
+	rows = append(rows, text.Faint.Sprint(fit(status, m.width)))
+	return rows
+}
+
+func (m *Model) title(listWidth, logWidth int) string {
+	listTitle := fmt.Sprintf("Tests (%d)", len(m.run.TestRun))
+	logTitle := "Logs"
+	if test, attempt := m.attempt(); attempt != nil {
+		logTitle = fmt.Sprintf("%s #%d %s %s", test.ShortName, attempt.AttemptNo, status(attempt), attempt.Duration)
+		if len(m.lines) > 0 {
+			logTitle += fmt.Sprintf("  %d-%d/%d", m.logTop+1, min(m.logTop+m.bodyHeight(), len(m.lines)), len(m.lines))
+		}
+	}
+	listStyle, logStyle := text.Colors{text.Bold, text.Underline}, text.Colors{text.Underline}
+	if m.focus == paneLogs {
+		listStyle, logStyle = logStyle, listStyle
+	}
+	return listStyle.Sprint(fit(listTitle, listWidth)) + " " + logStyle.Sprint(fit(logTitle, logWidth))
+}
+
+func (m *Model) listRow(index, width int) string {
+	if index >= len(m.items) {
+		return fit("", width)
+	}
+	entry := m.items[index]
+	test := &m.run.TestRun[entry.test]
+	var label, state string
+	if entry.attempt < 0 {
+		state = test.Verdict()
+		label = fmt.Sprintf("%-7s %s", state, test.ShortName)
+	} else {
+		attempt := &test.Attempt[entry.attempt]
+		state = status(attempt)
+		label = fmt.Sprintf("  #%d %-7s %s", attempt.AttemptNo, state, attempt.Duration.Round(time.Second))
+	}
+	row := fit(label, width)
+	if index == m.selected {
+		style := text.Colors{text.ReverseVideo}
+		if m.focus == paneList {
+			style = append(style, text.Bold)
+		}
+		return style.Sprint(row)
+	}
+	return verdictColors[state].Sprint(row)
+}
+
+func (m *Model) logRow(index, width int) string {
+	if index >= len(m.lines) {
+		return ""
+	}
+	line := m.lines[index]
+	row := fit(strings.ReplaceAll(line.text, "\t", "    "), width)
+	switch {
+	case index == m.mark:
+		row = text.ReverseVideo.Sprint(row)
+	case failureLineRegex.MatchString(line.text):
+		row = text.FgRed.Sprint(row)
+	}
+	if line.folded > 0 {
+		row = strings.TrimRight(row, " ")
+		row += text.Faint.Sprint(fit(fmt.Sprintf("  ⋯ %d similar lines folded", line.folded), width-text.RuneWidthWithoutEscSequences(row)))
+	}
+	return row
+}
+
+// status returns the status of an attempt, PASSED when it did not fail
+func status(attempt *utils.AttemptData) string {
+	if attempt.Status.Status == "" {
+		return utils.Passed
+	}
+	return attempt.Status.Status
+}
+
+// fit cuts or pads a text to a width
+func fit(line string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if text.RuneWidthWithoutEscSequences(line) > width {
+		line = text.Snip(line, width, "…")
+	}
+	return text.Pad(line, width, ' ')
+}
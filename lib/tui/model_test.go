@@ -0,0 +1,229 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tui
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/flakechecker"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+func press(m *Model, keys ...Key) {
+	for _, key := range keys {
+		m.Update(key)
+	}
+}
+
+// selectTest selects the row of a test
+func selectTest(t *testing.T, m *Model, shortName string) {
+	t.Helper()
+	press(m, KeyHome)
+	for m.run.TestRun[m.items[m.selected].test].ShortName != shortName || m.items[m.selected].attempt != -1 {
+		if m.selected == len(m.items)-1 {
+			t.Fatalf("No test %s", shortName)
+		}
+		press(m, KeyDown)
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	m := NewModel(fixture.Parse(t), Options{})
+	m.SetSize(120, 20)
+
+	selectTest(t, m, "MySQL application two Vol CSI")
+	test, attempt := m.attempt()
+	if test.ShortName != "MySQL application two Vol CSI" || attempt.AttemptNo != 0 {
+		t.Fatalf("Selected %s #%d, want the first failed attempt", test.ShortName, attempt.AttemptNo)
+	}
+	press(m, KeyDown, KeyDown)
+	if _, attempt = m.attempt(); attempt.AttemptNo != 1 || len(m.lines) == 0 || m.lines[0].text != attempt.Logs[0] {
+		t.Errorf("Selected attempt #%d, want #1 with its logs", attempt.AttemptNo)
+	}
+
+	press(m, KeyTab, KeyEnd)
+	if m.focus != paneLogs || m.logTop != max(len(m.lines)-m.bodyHeight(), 0) {
+		t.Errorf("End of the logs scrolled to %d of %d lines", m.logTop, len(m.lines))
+	}
+	press(m, KeyTab, KeyEnd)
+	if m.selected != len(m.items)-1 || m.listTop != len(m.items)-m.bodyHeight() {
+		t.Errorf("End of the list selected %d shown from %d", m.selected, m.listTop)
+	}
+
+	view := m.View()
+	if len(view) != 20 {
+		t.Fatalf("View() has %d rows, want 20", len(view))
+	}
+	for i, row := range view {
+		if width := text.RuneWidthWithoutEscSequences(row); width > 120 {
+			t.Errorf("Row %d is %d wide: %q", i, width, row)
+		}
+	}
+	if !strings.Contains(view[len(view)-1], "q quit") {
+		t.Errorf("View() status bar = %q", view[len(view)-1])
+	}
+
+	press(m, "q")
+	if !m.Quit() {
+		t.Errorf("q did not quit")
+	}
+}
+
+func TestSearchAndFailure(t *testing.T) {
+	m := NewModel(fixture.Parse(t), Options{})
+	m.SetSize(120, 20)
+	selectTest(t, m, "MySQL application CSI")
+
+	press(m, "f")
+	if m.mark < 0 || !strings.Contains(m.lines[m.mark].text, "[FAILED] Expected") || m.focus != paneLogs {
+		t.Fatalf("f marked line %d", m.mark)
+	}
+	if m.mark < m.logTop || m.mark >= m.logTop+m.bodyHeight() {
+		t.Errorf("Marked line %d not shown from %d", m.mark, m.logTop)
+	}
+
+	press(m, "/", "v", "e", "l", "e", "r", "x", KeyBackspace, "o", " ", "P", "O", "D", KeyEnter)
+	if m.searching || m.query != "velero POD" {
+		t.Fatalf("Search typed %q", m.query)
+	}
+	first := m.mark
+	if first < 0 || !strings.Contains(strings.ToLower(m.lines[first].text), "velero pod") {
+		t.Fatalf("Search marked line %d", first)
+	}
+	press(m, "n")
+	second := m.mark
+	press(m, "N")
+	if second == first || m.mark != first {
+		t.Errorf("n and N marked %d and %d, want another line then %d", second, m.mark, first)
+	}
+
+	press(m, "/", "n", "o", "t", " ", "l", "o", "g", "g", "e", "d", KeyEnter)
+	if !strings.Contains(m.status, "not found") || m.mark != first {
+		t.Errorf("Missing search status %q, marked %d", m.status, m.mark)
+	}
+	press(m, "/", "x", KeyEscape)
+	if m.searching || m.query != "" {
+		t.Errorf("Escape kept the search %q", m.query)
+	}
+}
+
+func TestFolding(t *testing.T) {
+	run := &utils.TestRunData{TestRun: []utils.IndividualTestRunData{{
+		ShortName: "Backup",
+		Attempt: []utils.AttemptData{{Logs: []string{
+			"> Enter [It] Backup",
+			"2024/02/14 20:21:56 backup phase: WaitingForPluginOperations",
+			"2024/02/14 20:22:06 backup phase: WaitingForPluginOperations",
+			"2024/02/14 20:22:16 backup phase: WaitingForPluginOperations",
+			"2024/02/14 20:22:26 backup phase: WaitingForPluginOperations",
+			"2024/02/14 20:22:36 backup phase: Completed",
+			"2024/02/14 20:22:37 checking",
+			"2024/02/14 20:22:38 checking",
+		}}},
+	}}}
+	m := NewModel(run, Options{})
+	var folded []int
+	for _, line := range m.lines {
+		folded = append(folded, line.folded)
+	}
+	if want := []int{0, 3, 0, 0, 0}; !reflect.DeepEqual(folded, want) {
+		t.Errorf("Folded lines = %v, want %v", folded, want)
+	}
+	if row := m.logRow(1, 100); !strings.Contains(row, "3 similar lines folded") {
+		t.Errorf("Folded row = %q", row)
+	}
+	press(m, "z")
+	if len(m.lines) != 8 {
+		t.Errorf("Unfolded %d lines, want 8", len(m.lines))
+	}
+}
+
+func TestOpenIssue(t *testing.T) {
+	run := &utils.TestRunData{TestRun: []utils.IndividualTestRunData{{
+		ShortName: "Backup",
+		Attempt: []utils.AttemptData{
+			{Status: utils.EventStatus{Status: utils.Failed}, Logs: []string{"quota exceeded"}},
+			{Logs: []string{"passed"}},
+		},
+	}}}
+	var opened []string
+	m := NewModel(run, Options{
+		KnownFlakes: func(logs string) []flakechecker.FlakePattern {
+			if strings.Contains(logs, "quota") {
+				return []flakechecker.FlakePattern{{Issue: "https://issues.example.com/1", Description: "Quota"}}
+			}
+			return nil
+		},
+		OpenURL: func(url string) error {
+			opened = append(opened, url)
+			return nil
+		},
+	})
+
+	press(m, "o")
+	if !reflect.DeepEqual(opened, []string{"https://issues.example.com/1"}) || !strings.HasPrefix(m.status, "Opened") {
+		t.Errorf("o opened %v with status %q", opened, m.status)
+	}
+	press(m, KeyDown, KeyDown, "o")
+	if len(opened) != 1 || m.status != "No known flake in this attempt" {
+		t.Errorf("o on the passing attempt opened %v with status %q", opened, m.status)
+	}
+}
+
+func TestDecodeKeys(t *testing.T) {
+	input := []byte("j\x1b[A\x1b[6~\x1bOB\t\r/é\x7f\x03\x1b\x1b[1;5C")
+	want := []Key{"j", KeyUp, KeyPageDown, KeyDown, KeyTab, KeyEnter, "/", "é", KeyBackspace, KeyCtrlC, KeyEscape}
+	if got := DecodeKeys(input); !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeKeys() = %q, want %q", got, want)
+	}
+}
+
+func TestReadKeys(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Error creating pipe: %v", err)
+	}
+	defer writer.Close()
+	keys := make(chan []Key)
+	done := make(chan struct{})
+	go readKeys(reader, keys, done)
+
+	if _, err := writer.Write([]byte("j")); err != nil {
+		t.Fatalf("Error writing keys: %v", err)
+	}
+	if got := <-keys; !reflect.DeepEqual(got, []Key{"j"}) {
+		t.Errorf("readKeys() sent %q", got)
+	}
+
+	// the pending read ends when the input is closed, the next keys are left unread
+	close(done)
+	reader.Close()
+	select {
+	case pressed, ok := <-keys:
+		if ok {
+			t.Errorf("readKeys() sent %q after being stopped", pressed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("readKeys() did not stop")
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/migtools/demystifier/lib/utils"
+	"golang.org/x/term"
+)
+
+// ErrNotTerminal is returned when the input or output is not a terminal
+var ErrNotTerminal = errors.New("the terminal UI needs an interactive terminal")
+
+// The escape sequences of the screen
+const (
+	enterScreen = "\x1b[?1049h\x1b[?25l"
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	cursorHome  = "\x1b[H"
+	clearLine   = "\x1b[K"
+)
+
+// escapeKeys are the escape sequences of the special keys
+var escapeKeys = map[string]Key{
+	"\x1b[A":  KeyUp,
+	"\x1b[B":  KeyDown,
+	"\x1bOA":  KeyUp,
+	"\x1bOB":  KeyDown,
+	"\x1b[5~": KeyPageUp,
+	"\x1b[6~": KeyPageDown,
+	"\x1b[H":  KeyHome,
+	"\x1b[F":  KeyEnd,
+	"\x1b[1~": KeyHome,
+	"\x1b[4~": KeyEnd,
+	"\x1bOH":  KeyHome,
+	"\x1bOF":  KeyEnd,
+}
+
+// Run browses a run until the user quits.
+//
+// Parameters:
+//   - in: the terminal read, put in raw mode while browsing.
+//   - out: the terminal drawn on, its alternate screen is used.
+//   - run: the parsed run.
+//   - opts: the actions of the browser.
+//
+// Returns:
+//   - ErrNotTerminal if in or out is not a terminal.
+//   - error if the terminal could not be set up.
+func Run(in, out *os.File, run *utils.TestRunData, opts Options) error {
+	if !term.IsTerminal(int(in.Fd())) || !term.IsTerminal(int(out.Fd())) {
+		return ErrNotTerminal
+	}
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return fmt.Errorf("error setting up the terminal: %v", err)
+	}
+	defer func() { _ = term.Restore(int(in.Fd()), state) }()
+	input, err := openInput(in)
+	if err != nil {
+		return fmt.Errorf("error setting up the terminal: %v", err)
+	}
+
+	screen := bufio.NewWriter(out)
+	fmt.Fprint(screen, enterScreen)
+	defer func() {
+		fmt.Fprint(screen, leaveScreen)
+		screen.Flush()
+	}()
+
+	keys := make(chan []Key)
+	done := make(chan struct{})
+	go readKeys(input, keys, done)
+	defer func() {
+		// the reader is stopped before returning, it would take the next keys
+		close(done)
+		input.Close()
+		for range keys {
+		}
+	}()
+	resized, stop := notifyResize()
+	defer stop()
+
+	model := NewModel(run, opts)
+	for {
+		if width, height, err := term.GetSize(int(out.Fd())); err == nil {
+			model.SetSize(width, height)
+		}
+		draw(screen, model.View())
+		if err := screen.Flush(); err != nil {
+			return fmt.Errorf("error drawing the terminal: %v", err)
+		}
+
+		select {
+		case pressed, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, key := range pressed {
+				model.Update(key)
+			}
+			if model.Quit() {
+				return nil
+			}
+		case <-resized:
+		}
+	}
+}
+
+// draw writes the rows of the screen from its top left corner, the
+// terminal in raw mode needs the carriage returns
+func draw(screen *bufio.Writer, rows []string) {
+	screen.WriteString(cursorHome)
+	screen.WriteString(strings.Join(rows, clearLine+"\r\n"))
+	screen.WriteString(clearLine)
+}
+
+// readKeys sends the keys read until the input is closed or done is
+func readKeys(in io.Reader, keys chan<- []Key, done <-chan struct{}) {
+	defer close(keys)
+	buffer := make([]byte, 256)
+	for {
+		n, err := in.Read(buffer)
+		if n > 0 {
+			select {
+			case keys <- DecodeKeys(buffer[:n]):
+			case <-done:
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// DecodeKeys returns the keys of the bytes read from a terminal in raw mode
+func DecodeKeys(input []byte) []Key {
+	var keys []Key
+	for len(input) > 0 {
+		if input[0] == '\x1b' {
+			matched := false
+			for sequence, key := range escapeKeys {
+				if strings.HasPrefix(string(input), sequence) {
+					keys = append(keys, key)
+					input = input[len(sequence):]
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				// an unknown sequence is dropped, a lone escape is the escape key
+				end := 1
+				if len(input) > 1 && (input[1] == '[' || input[1] == 'O') {
+					for end = 2; end < len(input) && (input[end] < 0x40 || input[end] > 0x7e); end++ {
+					}
+					end++
+				} else {
+					keys = append(keys, KeyEscape)
+				}
+				if end > len(input) {
+					end = len(input)
+				}
+				input = input[end:]
+			}
+			continue
+		}
+
+		switch input[0] {
+		case '\t':
+			keys = append(keys, KeyTab)
+		case '\r', '\n':
+			keys = append(keys, KeyEnter)
+		case 0x7f, '\b':
+			keys = append(keys, KeyBackspace)
+		case 0x03:
+			keys = append(keys, KeyCtrlC)
+		default:
+			char, size := utf8.DecodeRune(input)
+			if char >= ' ' && char != utf8.RuneError {
+				keys = append(keys, Key(string(char)))
+			}
+			input = input[size:]
+			continue
+		}
+		input = input[1:]
+	}
+	return keys
+}
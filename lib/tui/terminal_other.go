@@ -0,0 +1,36 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tui
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// errUnsupported is returned on the platforms without a pollable terminal input
+var errUnsupported = errors.New("the terminal UI is not supported on this platform")
+
+func openInput(in *os.File) (io.ReadCloser, error) {
+	return nil, errUnsupported
+}
+
+func notifyResize() (<-chan os.Signal, func()) {
+	return nil, func() {}
+}
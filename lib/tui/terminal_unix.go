@@ -0,0 +1,70 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tui
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// input reads a terminal through a non-blocking copy of its file
+// descriptor, closing it ends a pending read
+type input struct {
+	*os.File
+	fd    int
+	flags int
+}
+
+// openInput returns the reader of a terminal which can be closed while
+// reading, unlike the blocking standard input
+func openInput(in *os.File) (io.ReadCloser, error) {
+	fd := int(in.Fd())
+	flags, err := unix.FcntlInt(uintptr(fd), unix.F_GETFL, 0)
+	if err != nil {
+		return nil, err
+	}
+	copied, err := unix.Dup(fd)
+	if err != nil {
+		return nil, err
+	}
+	// the copy shares the flags of the terminal, they are restored on close
+	if err := unix.SetNonblock(copied, true); err != nil {
+		unix.Close(copied)
+		return nil, err
+	}
+	return &input{File: os.NewFile(uintptr(copied), in.Name()), fd: fd, flags: flags}, nil
+}
+
+func (i *input) Close() error {
+	err := i.File.Close()
+	_, _ = unix.FcntlInt(uintptr(i.fd), unix.F_SETFL, i.flags)
+	return err
+}
+
+// notifyResize returns a channel receiving the resizes of the terminal, and
+// the function to stop receiving them
+func notifyResize() (<-chan os.Signal, func()) {
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	return resized, func() { signal.Stop(resized) }
+}
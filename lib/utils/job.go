@@ -0,0 +1,94 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// JobInfo is the Prow job metadata found in a log location
+type JobInfo struct {
+	JobName     string
+	RunID       string
+	Platform    string
+	OCPVersion  string
+	PullRequest string
+	Location    string
+}
+
+var (
+	jobNameRegex     = regexp.MustCompile(`^(pull|periodic|branch|rehearse-\d+)-ci-`)
+	runIDRegex       = regexp.MustCompile(`^\d+$`)
+	ocpVersionRegex  = regexp.MustCompile(`-(\d+\.\d+)-`)
+	platformRegex    = regexp.MustCompile(`e2e-test-([a-z0-9]+)`)
+	knownPlatforms   = []string{"aws", "azure", "gcp", "ibmcloud", "vsphere", "openstack", "metal", "ovirt"}
+	pullRequestRegex = regexp.MustCompile(`/pull/[^/]+/(\d+)/`)
+	runFolderRegex   = regexp.MustCompile(`^(.*/(?:pull|periodic|branch|rehearse-\d+)-ci-[^/]+/\d+/)`)
+)
+
+// FinishedFile is written by Prow in the run folder when the job ends
+const FinishedFile = "finished.json"
+
+// GetJobInfo extracts the job name, run ID, platform, OCP version and pull
+// request number from a Prow or gcsweb location.
+// Fields that can not be found are left empty.
+func GetJobInfo(location string) JobInfo {
+	info := JobInfo{Location: location}
+
+	segments := strings.Split(location, "/")
+	for i, segment := range segments {
+		if !jobNameRegex.MatchString(segment) {
+			continue
+		}
+		info.JobName = segment
+		if i+1 < len(segments) && runIDRegex.MatchString(segments[i+1]) {
+			info.RunID = segments[i+1]
+		}
+	}
+
+	if matches := ocpVersionRegex.FindStringSubmatch(info.JobName); matches != nil {
+		info.OCPVersion = matches[1]
+	}
+
+	if matches := platformRegex.FindStringSubmatch(location); matches != nil {
+		info.Platform = matches[1]
+	} else {
+		for _, token := range strings.Split(info.JobName, "-") {
+			for _, platform := range knownPlatforms {
+				if token == platform {
+					info.Platform = platform
+				}
+			}
+		}
+	}
+
+	if matches := pullRequestRegex.FindStringSubmatch(location); matches != nil {
+		info.PullRequest = matches[1]
+	}
+
+	return info
+}
+
+// RunFolder returns the bucket folder of the Prow run holding an artifact URL,
+// with a trailing slash, or an empty string when the URL is not in a run folder.
+func RunFolder(location string) string {
+	if matches := runFolderRegex.FindStringSubmatch(location); matches != nil {
+		return matches[1]
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import "testing"
+
+func TestGetJobInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		want     JobInfo
+	}{
+		{
+			name:     "Prow URL of a pull request job",
+			location: "https://prow.ci.openshift.org/view/gs/test-platform-results/pr-logs/pull/openshift_oadp-operator/1330/pull-ci-openshift-oadp-operator-master-4.14-e2e-test-aws/1757841603164114944",
+			want: JobInfo{
+				JobName:     "pull-ci-openshift-oadp-operator-master-4.14-e2e-test-aws",
+				RunID:       "1757841603164114944",
+				Platform:    "aws",
+				OCPVersion:  "4.14",
+				PullRequest: "1330",
+			},
+		},
+		{
+			name:     "gcsweb build log of a periodic job",
+			location: "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/test-platform-results/logs/periodic-ci-openshift-oadp-operator-master-4.13-e2e-test-azure-periodic/1767186600720076800/artifacts/e2e-test-azure-periodic/e2e/build-log.txt",
+			want: JobInfo{
+				JobName:    "periodic-ci-openshift-oadp-operator-master-4.13-e2e-test-azure-periodic",
+				RunID:      "1767186600720076800",
+				Platform:   "azure",
+				OCPVersion: "4.13",
+			},
+		},
+		{
+			name:     "Local file",
+			location: "../../tests/testdata/buildlog/build-log.txt",
+			want:     JobInfo{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.want.Location = tt.location
+			if got := GetJobInfo(tt.location); got != tt.want {
+				t.Errorf("GetJobInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -14,7 +14,6 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Package utils for the demystifier CLI
 package utils
 
 import (
@@ -24,6 +23,9 @@ import (
 )
 
 // DumpLogsToFileWithPrefixes saves logs as files
+//
+// Deprecated: use dump.Write, which lays the logs of a run out by suite, test
+// and attempt with an index of the files.
 func (a *AttemptData) DumpLogsToFileWithPrefixes(attemptNo int, folder string, prefixes ...string) error {
 	// replace / in name
 	fileName := strings.ReplaceAll(a.Name, "/", "_")
@@ -0,0 +1,57 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The rules are applied in order, timestamps first so their digits
+// are not mistaken for identifiers
+var normalizeRules = []struct {
+	regex       *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}`), "<time>"},
+	{regexp.MustCompile(`\d{2}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(\.\d+)?`), "<time>"},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z| [+-]\d{4} \w+)?`), "<time>"},
+	{regexp.MustCompile(`\((\d+h)?(\d+m)?\d+(\.\d+)?(ms|s)\)`), "(<duration>)"},
+	{regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`), "<uuid>"},
+	{regexp.MustCompile(`\b[0-9a-f]{12,}\b`), "<hash>"},
+	// pods owned by a ReplicaSet or a ReplicationController
+	{regexp.MustCompile(`-[0-9a-f]{8,10}-[0-9a-z]{5}\b`), "-<pod>"},
+	{regexp.MustCompile(`-\d+-[0-9a-z]{5}\b`), "-<pod>"},
+}
+
+// generated names end with five random characters, at least one being a digit
+var generatedSuffixRegex = regexp.MustCompile(`-[0-9a-z]{5}\b`)
+
+// NormalizeLine replaces the tokens that change from one run to another,
+// such as timestamps, UUIDs and pod name suffixes, so lines from different
+// attempts can be compared.
+func NormalizeLine(line string) string {
+	for _, rule := range normalizeRules {
+		line = rule.regex.ReplaceAllString(line, rule.replacement)
+	}
+	return generatedSuffixRegex.ReplaceAllStringFunc(line, func(suffix string) string {
+		if strings.ContainsAny(suffix, "0123456789") {
+			return "-<suffix>"
+		}
+		return suffix
+	})
+}
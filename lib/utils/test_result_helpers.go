@@ -16,12 +16,17 @@ limitations under the License.
 
 package utils
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 const (
 	Failed  = "FAILED"
 	Passed  = "PASSED"
 	Timeout = "TIMEOUT"
+	Flaky   = "FLAKY"
+	Skipped = "SKIPPED"
 )
 
 type EventStatus struct {
@@ -38,14 +43,44 @@ func (s *EventStatus) SetTimeout() {
 	s.Status = Timeout
 }
 
+// PhaseTransition is the moment an Event entered a new phase
+type PhaseTransition struct {
+	Phase string
+	Time  time.Time
+}
+
+// DescribeMessage is a single warning or error reported by velero describe
+type DescribeMessage struct {
+	Scope     string // Velero, Cluster or Namespaces
+	Namespace string
+	Kind      string // kind of the affected resource, for example ConfigMap
+	Resource  string // name of the affected resource
+	Message   string
+}
+
+// DescribeData is the velero describe output of a Backup or Restore
+type DescribeData struct {
+	Name     string
+	Phase    string
+	Fields   map[string]string // top level "Key: value" pairs
+	Warnings []DescribeMessage
+	Errors   []DescribeMessage
+}
+
 // Event is for example Backup or Restore
 type EventData struct {
-	Name      string
-	StartTime time.Time
-	EndTime   time.Time
-	Duration  time.Duration
-	Status    EventStatus
-	Logs      []string
+	Kind       string // for example Backup or Restore
+	Name       string
+	StartTime  time.Time
+	EndTime    time.Time
+	Duration   time.Duration
+	Status     EventStatus
+	Phase      string // last known phase
+	Phases     []PhaseTransition
+	ItemsTotal int
+	ItemsDone  int
+	Describe   *DescribeData
+	Logs       []string
 }
 
 // Attempt is for a single Test run that may include
@@ -57,7 +92,15 @@ type AttemptData struct {
 	EndTime   time.Time
 	Duration  time.Duration
 	Status    EventStatus // Don't yet know if it is better to be here or in the EventData
-	Logs      []string
+	// Logs are the lines of the attempt, the [FAILED] lines of its failures
+	// included so that the flake patterns also match the failure messages
+	Logs []string
+	// LogTimes holds the timestamp of each line in Logs, zero when
+	// the line does not carry its own timestamp
+	LogTimes []time.Time
+	// SetupLogs are the lines of the setup nodes run before the attempt,
+	// BeforeEach for example. The teardown nodes are in Logs.
+	SetupLogs []string
 	Events    []EventData
 }
 
@@ -67,7 +110,40 @@ type AttemptData struct {
 type IndividualTestRunData struct {
 	Name      string
 	ShortName string
-	Attempt   []AttemptData
+	// Suite is the source file of a Ginkgo spec, the package of a go test
+	Suite string
+	// Containers are the texts of the Ginkgo containers of the spec, outermost first
+	Containers []string
+	// Labels are the Ginkgo labels of the spec and of its containers
+	Labels  []string
+	Attempt []AttemptData
+}
+
+// FullText returns the texts of the containers and of the test separated by
+// spaces, the text matched by the Ginkgo --focus option
+func (t *IndividualTestRunData) FullText() string {
+	return strings.Join(append(append([]string(nil), t.Containers...), t.ShortName), " ")
+}
+
+// Verdict returns the overall result of the test: FAILED when the last
+// attempt failed, SKIPPED when it was skipped, FLAKY when an earlier attempt
+// failed and PASSED otherwise
+func (t *IndividualTestRunData) Verdict() string {
+	if len(t.Attempt) == 0 {
+		return Passed
+	}
+	switch t.Attempt[len(t.Attempt)-1].Status.Status {
+	case Failed:
+		return Failed
+	case Skipped:
+		return Skipped
+	}
+	for i := range t.Attempt {
+		if t.Attempt[i].Status.Status == Failed {
+			return Flaky
+		}
+	}
+	return Passed
 }
 
 // This is representation of full run, it may not have tests itself
@@ -14,6 +14,7 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
+// Package utils for the demystifier CLI
 package utils
 
 import (
@@ -22,38 +23,32 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/migtools/demystifier/lib/fetch"
 	log "github.com/sirupsen/logrus"
 )
 
 // GetRunDataFromLog
+// Programs importing the parser should use parser.Parse, which neither fetches nor logs.
 // parameters:
 // - logFile string, the location of the log file, local or remote (prefixes: http:// or https://)
 // returns:
 // - *TestRunData, a pointer to TestRunData struct representing the test run data to be updated.
 func GetRunDataFromLog(logFile string) (*TestRunData, error) {
-	var testRunData TestRunData
-
 	var data []byte
 
 	if strings.HasPrefix(logFile, "http://") || strings.HasPrefix(logFile, "https://") {
 		log.WithFields(log.Fields{
 			"log location": logFile,
 		}).Debug("Using log from URL")
-		resp, err := http.Get(logFile)
-		if err != nil {
-			return nil, fmt.Errorf("error opening URL: %v", err)
-		}
-		defer resp.Body.Close()
-
-		data, err = io.ReadAll(resp.Body)
+		var err error
+		data, err = fetch.Default().Get(logFile)
 		if err != nil {
-			return nil, fmt.Errorf("error reading HTTP response body: %v", err)
+			return nil, err
 		}
 	} else {
 		log.WithFields(log.Fields{
@@ -71,7 +66,18 @@ func GetRunDataFromLog(logFile string) (*TestRunData, error) {
 		}
 	}
 
-	scanner := bufio.NewScanner(bytes.NewReader(data)) // Create scanner from data
+	return GetRunDataFromReader(bytes.NewReader(data))
+}
+
+// GetRunDataFromReader reads the logs of a test run, for example a cached log
+// parameters:
+// - reader io.Reader, the content of the log
+// returns:
+// - *TestRunData, a pointer to TestRunData struct holding the logs.
+func GetRunDataFromReader(reader io.Reader) (*TestRunData, error) {
+	var testRunData TestRunData
+
+	scanner := bufio.NewScanner(reader)
 
 	var fullLogs strings.Builder
 	for scanner.Scan() {
@@ -87,6 +93,9 @@ func GetRunDataFromLog(logFile string) (*TestRunData, error) {
 	return &testRunData, nil
 }
 
+// prowViewURL prefixes the Prow job URLs, as found in the GitHub PR comments
+const prowViewURL = "https://prow.ci.openshift.org/view/gs/"
+
 // GenerateLogURL generates a URL for the log file.
 // This function may be replaced with your actual URL generation logic.
 func GeneratesLogURL(originalURL string) string {
@@ -94,7 +103,11 @@ func GeneratesLogURL(originalURL string) string {
 	if strings.HasSuffix(originalURL, "/build-log.txt") {
 		return originalURL
 	}
-	parts := strings.Split(originalURL, "https://prow.ci.openshift.org/view/gs/")
+	// Local files, folders, archives, stdin and other URLs are used as they are
+	if !strings.HasPrefix(originalURL, prowViewURL) {
+		return originalURL
+	}
+	parts := strings.Split(originalURL, prowViewURL)
 
 	re := regexp.MustCompile(`e2e-test-(.*?)/`)
 	testType := re.FindString(originalURL)
@@ -122,66 +135,173 @@ func SetIndividualTestsFromLog(testRunData *TestRunData, anchorTag string) error
 		return errors.New("logs were not provided")
 	}
 
-	attempts := make(map[string]int)
-
-	lines := strings.Split(testRunData.FullLogs, "\n")
-	startRegex := regexp.MustCompile(fmt.Sprintf(`> Enter \[%s\] (.+) - (.+) @ (.+)`, anchorTag))
-	endRegex := regexp.MustCompile(fmt.Sprintf(`< Exit \[%s\] (.+?) - .+ @ (.+) \(.+\)`, anchorTag))
-	failureRegex := regexp.MustCompile(`^[\t ]*\[FAILED\].*`)
-
-	var currentAttempt *AttemptData
-
-	for _, line := range lines {
-		if matches := startRegex.FindStringSubmatch(line); matches != nil {
-			currentAttempt = handleStartTag(line, matches, attempts, testRunData)
-		} else if matches := endRegex.FindStringSubmatch(line); matches != nil {
-			handleEndTag(line, matches, currentAttempt)
-		} else if matches := failureRegex.FindStringSubmatch(line); matches != nil {
-			log.WithFields(log.Fields{
-				"Line":       currentAttempt.Name,
-				"Attempt no": currentAttempt.AttemptNo,
-			}).Debug("Marking attempt FAILED")
-			currentAttempt.Status = EventStatus{Status: Failed}
-		} else if currentAttempt != nil {
-			handleLogs(line, currentAttempt)
+	parser := NewLogParser(testRunData, anchorTag)
+	for _, line := range strings.Split(testRunData.FullLogs, "\n") {
+		parser.ParseLine(line)
+	}
+
+	return nil
+}
+
+// LogParser builds the tests and attempts of a run one log line at a time,
+// so a log can be parsed while it is still being written.
+type LogParser struct {
+	testRunData    *TestRunData
+	attempts       map[string]int
+	currentAttempt *AttemptData
+	startRegex     *regexp.Regexp
+	endRegex       *regexp.Regexp
+	failureRegex   *regexp.Regexp
+	partialLine    []byte
+	logger         log.FieldLogger
+	location       *time.Location
+	// header are the lines printed by Ginkgo before the nodes of a spec
+	header   []string
+	inHeader bool
+	// setup are the lines of the setup nodes of the next attempt
+	setup   []string
+	inSetup bool
+}
+
+// maxHeaderLines bounds the spec header kept, for deeply nested containers
+const maxHeaderLines = 64
+
+var (
+	// headerSeparatorRegex is the line printed by Ginkgo between specs
+	headerSeparatorRegex = regexp.MustCompile(`^-{30,}$`)
+	// headerLocationRegex is the source location of a header text
+	headerLocationRegex = regexp.MustCompile(`^\s*\S+:\d+$`)
+	// headerLabelsRegex is a header text followed by its labels
+	headerLabelsRegex = regexp.MustCompile(`^(.*\S) \[([^\[\]]+)\]$`)
+	// setupEnterRegex and setupExitRegex delimit the setup nodes run before a spec
+	setupEnterRegex = regexp.MustCompile(`> Enter \[(BeforeEach|JustBeforeEach|BeforeAll)\]`)
+	setupExitRegex  = regexp.MustCompile(`< Exit \[(BeforeEach|JustBeforeEach|BeforeAll)\]`)
+)
+
+// NewLogParser returns a parser adding the tests found to testRunData.
+// The anchorTag parameter specifies the tag used to identify the start and end of individual tests,
+// it is used as a regular expression.
+func NewLogParser(testRunData *TestRunData, anchorTag string) *LogParser {
+	return &LogParser{
+		testRunData:  testRunData,
+		attempts:     make(map[string]int),
+		startRegex:   regexp.MustCompile(fmt.Sprintf(`> Enter \[%s\] (.+) - (.+) @ (.+)`, anchorTag)),
+		endRegex:     regexp.MustCompile(fmt.Sprintf(`< Exit \[%s\] (.+?) - .+ @ (.+) \(.+\)`, anchorTag)),
+		failureRegex: regexp.MustCompile(`^[\t ]*\[FAILED\].*`),
+		logger:       log.StandardLogger(),
+		location:     time.UTC,
+	}
+}
+
+// SetLogger sets the logger of the parser, the standard logrus logger by default
+func (p *LogParser) SetLogger(logger log.FieldLogger) {
+	p.logger = logger
+}
+
+// SetLocation sets the time zone of the log timestamps, UTC by default
+func (p *LogParser) SetLocation(location *time.Location) {
+	p.location = location
+}
+
+// ParseLine parses a single log line, without its line break.
+// It returns the attempt when its first exit line was just parsed, nil otherwise.
+func (p *LogParser) ParseLine(line string) *AttemptData {
+	p.readHeader(line)
+	if matches := p.startRegex.FindStringSubmatch(line); matches != nil {
+		p.currentAttempt = p.handleStartTag(line, matches)
+	} else if matches := p.endRegex.FindStringSubmatch(line); matches != nil {
+		ended := p.currentAttempt != nil && p.currentAttempt.EndTime.IsZero()
+		p.handleEndTag(line, matches)
+		if ended {
+			return p.currentAttempt
+		}
+	} else if matches := p.failureRegex.FindStringSubmatch(line); matches != nil && p.currentAttempt != nil {
+		p.logger.WithFields(log.Fields{
+			"Line":       p.currentAttempt.Name,
+			"Attempt no": p.currentAttempt.AttemptNo,
+		}).Debug("Marking attempt FAILED")
+		p.currentAttempt.Status = EventStatus{Status: Failed}
+		p.readSetup(line)
+		p.appendLog(p.currentAttempt, line)
+	} else {
+		p.readSetup(line)
+		if p.currentAttempt != nil {
+			p.appendLog(p.currentAttempt, line)
+		}
+	}
+	return nil
+}
+
+// Feed parses the complete lines of a chunk of log, keeping the last partial
+// line until the next chunk. It returns the attempts that ended in the chunk.
+func (p *LogParser) Feed(chunk []byte) []*AttemptData {
+	var ended []*AttemptData
+	p.partialLine = append(p.partialLine, chunk...)
+	for {
+		end := bytes.IndexByte(p.partialLine, '\n')
+		if end < 0 {
+			break
+		}
+		if attempt := p.ParseLine(strings.TrimSuffix(string(p.partialLine[:end]), "\r")); attempt != nil {
+			ended = append(ended, attempt)
 		}
+		p.partialLine = p.partialLine[end+1:]
 	}
+	return ended
+}
 
+// Flush parses the last line when the log does not end with a line break
+func (p *LogParser) Flush() []*AttemptData {
+	if len(p.partialLine) == 0 {
+		return nil
+	}
+	line := string(p.partialLine)
+	p.partialLine = nil
+	if attempt := p.ParseLine(line); attempt != nil {
+		return []*AttemptData{attempt}
+	}
 	return nil
 }
 
 // handleStartTag add a new attempt data to a test run and returns current attempt
-func handleStartTag(line string, matches []string, attempts map[string]int, testRunsPtr *TestRunData) *AttemptData {
+func (p *LogParser) handleStartTag(line string, matches []string) *AttemptData {
 	eventName := matches[2]
 	shortEventName := matches[1]
-	log.WithFields(log.Fields{
+	p.logger.WithFields(log.Fields{
 		"Line":       line,
-		"Attempt no": attempts[eventName],
+		"Attempt no": p.attempts[eventName],
 	}).Debug("Found new Attempt")
 
-	currentTestRunPtr := getOrAddTestRun(testRunsPtr, eventName, shortEventName)
+	currentTestRunPtr := getOrAddTestRun(p.testRunData, eventName, shortEventName)
+	currentTestRunPtr.Suite = suiteFile(eventName)
+	if currentTestRunPtr.Containers == nil {
+		currentTestRunPtr.Containers, currentTestRunPtr.Labels = parseHeader(p.header, shortEventName)
+	}
+	p.header = nil
 
 	// Create a new instance of AttemptData
 	currentTestRunPtr.Attempt = append(currentTestRunPtr.Attempt, AttemptData{
-		AttemptNo: attempts[eventName],
+		AttemptNo: p.attempts[eventName],
 		Name:      eventName,
+		SetupLogs: p.setup,
 	})
+	p.setup, p.inSetup = nil, false
 	newAttempt := &currentTestRunPtr.Attempt[len(currentTestRunPtr.Attempt)-1]
 
-	attempts[eventName]++
+	p.attempts[eventName]++
 
 	// Add logs to the new attempt
-	newAttempt.Logs = append(newAttempt.Logs, line)
+	p.appendLog(newAttempt, line)
 
 	// Parse and set the start time for the new attempt
-	parsedTime, err := parseGingkoTime(matches[3])
+	parsedTime, err := parseGingkoTime(matches[3], p.location)
 	if err != nil {
-		log.Error("Error parsing time:", err)
+		p.logger.Error("Error parsing time:", err)
 		return newAttempt
 	}
 	newAttempt.StartTime = parsedTime
 
-	log.WithFields(log.Fields{
+	p.logger.WithFields(log.Fields{
 		"Test":         currentTestRunPtr.ShortName,
 		"Attempt no":   newAttempt.AttemptNo,
 		"Attempt name": newAttempt.Name,
@@ -190,6 +310,92 @@ func handleStartTag(line string, matches []string, attempts map[string]int, test
 	return newAttempt
 }
 
+// readHeader keeps the spec header printed by Ginkgo after the separator,
+// made of the texts and locations of the containers and of the spec
+func (p *LogParser) readHeader(line string) {
+	switch {
+	case headerSeparatorRegex.MatchString(line):
+		p.header, p.inHeader = nil, true
+	case p.inHeader && strings.Contains(line, "> Enter ["), len(p.header) >= maxHeaderLines:
+		p.inHeader = false
+	case p.inHeader:
+		p.header = append(p.header, line)
+	}
+}
+
+// readSetup keeps the lines of the setup nodes run since the last spec, they
+// are given to the next attempt
+func (p *LogParser) readSetup(line string) {
+	switch {
+	case headerSeparatorRegex.MatchString(line):
+		p.setup, p.inSetup = nil, false
+	case setupEnterRegex.MatchString(line):
+		p.setup, p.inSetup = append(p.setup, line), true
+	case p.inSetup:
+		p.setup = append(p.setup, line)
+		p.inSetup = !setupExitRegex.MatchString(line)
+	}
+}
+
+// parseHeader returns the containers and labels of a spec from its header,
+// nil when the header is not the one of the spec
+func parseHeader(header []string, shortName string) (containers, labels []string) {
+	var texts []string
+	for _, line := range header {
+		if text := strings.TrimSpace(line); text != "" && !headerLocationRegex.MatchString(line) {
+			texts = append(texts, text)
+		}
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	leaf, leafLabels := splitLabels(texts[len(texts)-1])
+	if leaf != shortName {
+		return nil, nil
+	}
+	containers = []string{}
+	for _, text := range texts[:len(texts)-1] {
+		container, containerLabels := splitLabels(text)
+		containers = append(containers, container)
+		labels = appendUnique(labels, containerLabels...)
+	}
+	return containers, appendUnique(labels, leafLabels...)
+}
+
+// splitLabels splits a header text from the labels Ginkgo prints after it
+func splitLabels(text string) (string, []string) {
+	matches := headerLabelsRegex.FindStringSubmatch(text)
+	if matches == nil {
+		return text, nil
+	}
+	var labels []string
+	for _, label := range strings.Split(matches[2], ",") {
+		labels = append(labels, strings.TrimSpace(label))
+	}
+	return matches[1], labels
+}
+
+func appendUnique(values []string, added ...string) []string {
+	for _, value := range added {
+		found := false
+		for _, existing := range values {
+			found = found || existing == value
+		}
+		if !found {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// suiteFile returns the source file of a test named after its location
+func suiteFile(location string) string {
+	if index := strings.LastIndex(location, ":"); index > 0 {
+		return location[:index]
+	}
+	return location
+}
+
 func getOrAddTestRun(testRunsPtr *TestRunData, eventName string, shortEventName string) *IndividualTestRunData {
 	// Ensure that the TestRun slice is initialized
 	if testRunsPtr.TestRun == nil {
@@ -211,33 +417,69 @@ func getOrAddTestRun(testRunsPtr *TestRunData, eventName string, shortEventName
 	return &testRunsPtr.TestRun[len(testRunsPtr.TestRun)-1]
 }
 
-func handleEndTag(line string, matches []string, currentAttempt *AttemptData) {
+func (p *LogParser) handleEndTag(line string, matches []string) {
+	currentAttempt := p.currentAttempt
 	if currentAttempt != nil {
-		log.WithFields(log.Fields{
+		p.logger.WithFields(log.Fields{
 			"Line":       line,
 			"Attempt no": currentAttempt.AttemptNo,
 		}).Debug("Found end Attempt")
-		endTime, err := parseGingkoTime(matches[2])
+		endTime, err := parseGingkoTime(matches[2], p.location)
 		if err != nil {
-			log.Error("Error parsing end time:", err)
+			p.logger.Error("Error parsing end time:", err)
 			return
 		}
 		currentAttempt.EndTime = endTime
 		currentAttempt.Duration = endTime.Sub(currentAttempt.StartTime)
-		log.WithFields(log.Fields{
+		p.logger.WithFields(log.Fields{
 			"StartTime": currentAttempt.StartTime,
 			"EndTime":   currentAttempt.EndTime,
 			"Duration":  currentAttempt.Duration,
 		}).Debug("Attempt times")
-		currentAttempt.Logs = append(currentAttempt.Logs, line)
+		p.appendLog(currentAttempt, line)
 	}
 }
 
-func handleLogs(line string, currentAttempt *AttemptData) {
-	currentAttempt.Logs = append(currentAttempt.Logs, line)
+func (p *LogParser) appendLog(attempt *AttemptData, line string) {
+	attempt.Logs = append(attempt.Logs, line)
+	attempt.LogTimes = append(attempt.LogTimes, ParseLineTimeIn(line, p.location))
+}
+
+// AppendLog adds a line to the attempt logs together with its timestamp
+func (a *AttemptData) AppendLog(line string) {
+	a.Logs = append(a.Logs, line)
+	a.LogTimes = append(a.LogTimes, ParseLineTime(line))
+}
+
+var (
+	goLogTimeRegex  = regexp.MustCompile(`^\s*(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) `)
+	ginkgoTimeRegex = regexp.MustCompile(` @ (\d{2}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?)`)
+)
+
+// ParseLineTime returns the timestamp carried by a single log line.
+// It understands the Go log prefix used by the e2e tests
+// (2024/02/14 20:00:07) and the Ginkgo node markers (@ 02/14/24 20:00:07.377).
+// A zero time is returned when the line has no timestamp.
+func ParseLineTime(line string) time.Time {
+	return ParseLineTimeIn(line, time.UTC)
+}
+
+// ParseLineTimeIn is ParseLineTime for the logs written in another time zone
+func ParseLineTimeIn(line string, location *time.Location) time.Time {
+	if matches := goLogTimeRegex.FindStringSubmatch(line); matches != nil {
+		if parsedTime, err := time.ParseInLocation("2006/01/02 15:04:05", matches[1], location); err == nil {
+			return parsedTime
+		}
+	}
+	if matches := ginkgoTimeRegex.FindStringSubmatch(line); matches != nil {
+		if parsedTime, err := parseGingkoTime(matches[1], location); err == nil {
+			return parsedTime
+		}
+	}
+	return time.Time{}
 }
 
-func parseGingkoTime(timeStr string) (time.Time, error) {
+func parseGingkoTime(timeStr string, location *time.Location) (time.Time, error) {
 	formats := []string{
 		"01/02/06 15:04:05.000",
 		"01/02/06 15:04:05.00",
@@ -247,7 +489,7 @@ func parseGingkoTime(timeStr string) (time.Time, error) {
 	var parsedTime time.Time
 	var err error
 	for _, format := range formats {
-		parsedTime, err = time.Parse(format, timeStr)
+		parsedTime, err = time.ParseInLocation(format, timeStr, location)
 		if err == nil {
 			break
 		}
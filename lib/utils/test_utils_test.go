@@ -16,7 +16,12 @@ limitations under the License.
 
 package utils
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
 
 func TestGenerateLogsURL(t *testing.T) {
 	type args struct {
@@ -50,3 +55,120 @@ func TestGenerateLogsURL(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{
+			name: "Go log timestamp and backup name",
+			line: "2024/02/14 20:01:32 Creating backup mysql-twovol-csi-e2e-a9b96b14-cb73-11ee-a3a2-0a580a813019 for case mysql-twovol-csi-e2e",
+			want: "<time> Creating backup mysql-twovol-csi-e2e-<uuid> for case mysql-twovol-csi-e2e",
+		},
+		{
+			name: "Ginkgo marker",
+			line: "  < Exit [It] MySQL application CSI - /go/src/github.com/openshift/oadp-operator/tests/e2e/backup_restore_suite_test.go:291 @ 02/14/24 19:51:18.351 (3m11.065s)",
+			want: "  < Exit [It] MySQL application CSI - /go/src/github.com/openshift/oadp-operator/tests/e2e/backup_restore_suite_test.go:291 @ <time> (<duration>)",
+		},
+		{
+			name: "Pod names",
+			line: "Pod mysql-84c486d897-64b7j not yet succeeded, todolist-1-z9b4v is running, velero-mysql-tvb4s created in e2e-test-azure",
+			want: "Pod mysql-<pod> not yet succeeded, todolist-<pod> is running, velero-mysql-<suffix> created in e2e-test-azure",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeLine(tt.line); got != tt.want {
+				t.Errorf("NormalizeLine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRunDataFromLogURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/build-log.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("> Enter [It] Backup - /test.go:10 @ 02/14/24 12:00:00.000\n"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "Log found", path: "/build-log.txt"},
+		{name: "Missing log is an error, not an empty run", path: "/missing/build-log.txt", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testData, err := GetRunDataFromLog(server.URL + tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetRunDataFromLog() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && testData.FullLogs == "" {
+				t.Errorf("Expected the log content")
+			}
+		})
+	}
+}
+
+func TestLogParserFeed(t *testing.T) {
+	content, err := os.ReadFile("../../tests/testdata/buildlog/build-log.txt")
+	if err != nil {
+		t.Fatalf("Error reading log file: %v", err)
+	}
+	want, err := GetRunDataFromLog("../../tests/testdata/buildlog/build-log.txt")
+	if err != nil {
+		t.Fatalf("Error reading log file: %v", err)
+	}
+	if err := SetIndividualTestsFromLog(want, "It"); err != nil {
+		t.Fatalf("Error parsing log file: %v", err)
+	}
+	wantAttempts := 0
+	for i := range want.TestRun {
+		wantAttempts += len(want.TestRun[i].Attempt)
+	}
+
+	for _, chunkSize := range []int{1, 7, 4096, len(content)} {
+		got := &TestRunData{}
+		parser := NewLogParser(got, "It")
+		ended := 0
+		for start := 0; start < len(content); start += chunkSize {
+			end := start + chunkSize
+			if end > len(content) {
+				end = len(content)
+			}
+			ended += len(parser.Feed(content[start:end]))
+		}
+		ended += len(parser.Flush())
+
+		if len(got.TestRun) != len(want.TestRun) {
+			t.Fatalf("chunk %d: got %d tests, want %d", chunkSize, len(got.TestRun), len(want.TestRun))
+		}
+		for i := range want.TestRun {
+			gotTest, wantTest := &got.TestRun[i], &want.TestRun[i]
+			if gotTest.Name != wantTest.Name || gotTest.Verdict() != wantTest.Verdict() || len(gotTest.Attempt) != len(wantTest.Attempt) {
+				t.Errorf("chunk %d: test %s = %s with %d attempts, want %s with %d",
+					chunkSize, gotTest.ShortName, gotTest.Verdict(), len(gotTest.Attempt), wantTest.Verdict(), len(wantTest.Attempt))
+				continue
+			}
+			for j := range wantTest.Attempt {
+				// The full parse adds the empty line after the last line break
+				gotLogs, wantLogs := len(gotTest.Attempt[j].Logs), len(wantTest.Attempt[j].Logs)
+				if gotTest.Attempt[j].Duration != wantTest.Attempt[j].Duration || (gotLogs != wantLogs && gotLogs != wantLogs-1) {
+					t.Errorf("chunk %d: attempt %d of %s differs", chunkSize, j, gotTest.ShortName)
+				}
+			}
+		}
+		// An attempt killed by the job timeout has no exit line
+		if ended > wantAttempts || ended < wantAttempts-1 {
+			t.Errorf("chunk %d: %d attempts ended, want about %d", chunkSize, ended, wantAttempts)
+		}
+	}
+}
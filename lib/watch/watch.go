@@ -0,0 +1,206 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package watch follows the build log of a running Prow job
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/migtools/demystifier/lib/fetch"
+	"github.com/migtools/demystifier/lib/parser"
+	"github.com/migtools/demystifier/lib/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultInterval is the time between two polls of the build log
+const DefaultInterval = 30 * time.Second
+
+// Watcher polls a growing build log and parses the new lines as they come
+type Watcher struct {
+	Client   fetch.HTTPClient
+	Interval time.Duration
+	// AnchorTags are the Ginkgo node types of the tests, parser.DefaultAnchorTag when empty
+	AnchorTags []string
+	// OnAttempt is called as soon as the exit line of an attempt is parsed
+	OnAttempt func(test *utils.IndividualTestRunData, attempt *utils.AttemptData)
+	sleep     func(ctx context.Context, d time.Duration) error
+}
+
+// New returns a Watcher using the default fetcher
+func New() *Watcher {
+	return &Watcher{
+		Client:   fetch.Default(),
+		Interval: DefaultInterval,
+		sleep:    sleepContext,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Watch follows a build log until the job writes its finished.json.
+// Only the new bytes are downloaded on each poll, with HTTP Range requests.
+// A log that is not in a Prow run folder is followed until ctx is done.
+//
+// Parameters:
+//   - ctx: stops the watch, the run parsed so far is returned with the context error.
+//   - logURL: the URL of the build log.
+//
+// Returns:
+//   - *utils.TestRunData with the whole log and the parsed tests.
+//   - error if an anchor tag is invalid, the log can not be fetched or ctx is done.
+func (w *Watcher) Watch(ctx context.Context, logURL string) (*utils.TestRunData, error) {
+	anchorTag, err := parser.AnchorPattern(w.AnchorTags)
+	if err != nil {
+		return nil, err
+	}
+	testRunData := &utils.TestRunData{}
+	logParser := utils.NewLogParser(testRunData, anchorTag)
+	var (
+		fullLogs strings.Builder
+		offset   int64
+	)
+	finishedURL := ""
+	if runFolder := utils.RunFolder(logURL); runFolder != "" {
+		finishedURL = runFolder + utils.FinishedFile
+	}
+
+	for {
+		// Checked before reading the log so the last read gets its end
+		finished, err := w.exists(ctx, finishedURL)
+		if err != nil {
+			return testRunData, err
+		}
+
+		chunk, err := w.readFrom(ctx, logURL, offset)
+		if err != nil {
+			return testRunData, err
+		}
+		offset += int64(len(chunk))
+		fullLogs.Write(chunk)
+		w.notify(testRunData, logParser.Feed(chunk))
+
+		if finished {
+			w.notify(testRunData, logParser.Flush())
+			testRunData.FullLogs = fullLogs.String()
+			return testRunData, nil
+		}
+
+		log.WithFields(log.Fields{
+			"bytes": offset,
+			"tests": len(testRunData.TestRun),
+		}).Debug("Waiting for the job")
+		if err := w.sleep(ctx, w.Interval); err != nil {
+			w.notify(testRunData, logParser.Flush())
+			testRunData.FullLogs = fullLogs.String()
+			return testRunData, err
+		}
+	}
+}
+
+func (w *Watcher) notify(testRunData *utils.TestRunData, attempts []*utils.AttemptData) {
+	if w.OnAttempt == nil {
+		return
+	}
+	for _, attempt := range attempts {
+		for i := range testRunData.TestRun {
+			if testRunData.TestRun[i].Name == attempt.Name {
+				w.OnAttempt(&testRunData.TestRun[i], attempt)
+				break
+			}
+		}
+	}
+}
+
+// readFrom returns the bytes of the log after offset, none when the log is
+// not written yet or did not grow
+func (w *Watcher) readFrom(ctx context.Context, logURL string, offset int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, logURL, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("error opening URL: %v", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusRequestedRangeNotSatisfiable:
+		return nil, nil
+	case http.StatusPartialContent:
+		return readBody(resp.Body)
+	case http.StatusOK:
+		// The server ignored the range, skip what was already parsed
+		body, err := readBody(resp.Body)
+		if err != nil || int64(len(body)) <= offset {
+			return nil, err
+		}
+		return body[offset:], nil
+	default:
+		return nil, &fetch.StatusError{URL: logURL, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+}
+
+func (w *Watcher) exists(ctx context.Context, location string) (bool, error) {
+	if location == "" {
+		return false, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, http.NoBody)
+	if err != nil {
+		return false, fmt.Errorf("error opening URL: %v", err)
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return true, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	default:
+		return false, &fetch.StatusError{URL: location, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+}
+
+func readBody(body io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading HTTP response body: %v", err)
+	}
+	return content, nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/migtools/demystifier/internal/fixture"
+	"github.com/migtools/demystifier/lib/utils"
+)
+
+const (
+	runPath  = "/logs/periodic-ci-openshift-oadp-operator-master-4.14-e2e-test-aws-periodic/1001/"
+	logPath  = runPath + "artifacts/e2e-test-aws-periodic/e2e/build-log.txt"
+	pollSize = 50000
+)
+
+// job serves a build log that grows by pollSize bytes on each poll
+type job struct {
+	mu          sync.Mutex
+	content     []byte
+	written     int
+	ignoreRange bool
+	sent        int
+}
+
+func (j *job) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch r.URL.Path {
+	case runPath + utils.FinishedFile:
+		if j.written < len(j.content) {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"passed":false}`))
+	case logPath:
+		visible := j.content[:j.written]
+		if j.ignoreRange {
+			r.Header.Del("Range")
+		}
+		recorder := httptest.NewRecorder()
+		http.ServeContent(recorder, r, "build-log.txt", time.Time{}, bytes.NewReader(visible))
+		j.sent += recorder.Body.Len()
+		for key, values := range recorder.Header() {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(recorder.Body.Bytes())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// grow is the sleep of the watcher, the job writes more logs meanwhile
+func (j *job) grow(context.Context, time.Duration) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.written += pollSize
+	if j.written > len(j.content) {
+		j.written = len(j.content)
+	}
+	return nil
+}
+
+func TestWatch(t *testing.T) {
+	content := fixture.Read(t)
+	want := fixture.Parse(t)
+	if got := fixture.CountAttempts(want); got != fixture.AttemptCount {
+		t.Fatalf("Expected %d attempts, got %d", fixture.AttemptCount, got)
+	}
+
+	for _, ignoreRange := range []bool{false, true} {
+		running := &job{content: content, ignoreRange: ignoreRange}
+		server := httptest.NewServer(running)
+
+		var notified []string
+		watcher := New()
+		watcher.Client = server.Client()
+		watcher.sleep = running.grow
+		watcher.OnAttempt = func(test *utils.IndividualTestRunData, attempt *utils.AttemptData) {
+			if attempt.EndTime.IsZero() {
+				t.Errorf("Attempt %s notified before its end", test.ShortName)
+			}
+			notified = append(notified, test.ShortName)
+		}
+
+		got, err := watcher.Watch(context.Background(), server.URL+logPath)
+		server.Close()
+		if err != nil {
+			t.Fatalf("Error watching the log: %v", err)
+		}
+
+		if got.FullLogs != string(content) {
+			t.Errorf("ignoreRange %v: expected the whole log, got %d bytes of %d", ignoreRange, len(got.FullLogs), len(content))
+		}
+		if len(got.TestRun) != len(want.TestRun) {
+			t.Fatalf("ignoreRange %v: got %d tests, want %d", ignoreRange, len(got.TestRun), len(want.TestRun))
+		}
+		for i := range want.TestRun {
+			if got.TestRun[i].Verdict() != want.TestRun[i].Verdict() || len(got.TestRun[i].Attempt) != len(want.TestRun[i].Attempt) {
+				t.Errorf("Test %s = %s with %d attempts, want %s with %d", want.TestRun[i].ShortName,
+					got.TestRun[i].Verdict(), len(got.TestRun[i].Attempt), want.TestRun[i].Verdict(), len(want.TestRun[i].Attempt))
+			}
+		}
+		if len(notified) != fixture.AttemptCount {
+			t.Errorf("ignoreRange %v: %d attempts notified, want %d", ignoreRange, len(notified), fixture.AttemptCount)
+		}
+		if len(notified) == 0 || notified[0] != want.TestRun[0].ShortName {
+			t.Errorf("Expected the attempts to be notified in order, got %v", notified)
+		}
+		if !ignoreRange && running.sent != len(content) {
+			t.Errorf("Expected each byte to be downloaded once with ranges, got %d bytes for %d", running.sent, len(content))
+		}
+	}
+}
+
+func TestWatchCanceled(t *testing.T) {
+	running := &job{content: []byte("> Enter [It] Backup - /test.go:10 @ 02/14/24 12:00:00.000\n"), written: 10}
+	server := httptest.NewServer(running)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watcher := New()
+	watcher.Client = server.Client()
+	watcher.sleep = func(ctx context.Context, d time.Duration) error {
+		cancel()
+		return sleepContext(ctx, d)
+	}
+	got, err := watcher.Watch(ctx, server.URL+logPath)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the watch to be canceled, got %v", err)
+	}
+	if got == nil || got.FullLogs != "> Enter [I" {
+		t.Errorf("Expected the log read so far, got %+v", got)
+	}
+}
+
+func TestWatchAnchorTags(t *testing.T) {
+	content := []byte(`> Enter [Entry] Backup - /test.go:10 @ 02/14/24 12:00:00.000
+< Exit [Entry] Backup - /test.go:10 @ 02/14/24 12:00:05.000 (5s)
+`)
+	tests := []struct {
+		name       string
+		anchorTags []string
+		wantTests  int
+		wantErr    bool
+	}{
+		{name: "Default", wantTests: 0},
+		{name: "Entry", anchorTags: []string{"It", "Entry"}, wantTests: 1},
+		{name: "Invalid", anchorTags: []string{"It|Entry"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			running := &job{content: content, written: len(content)}
+			server := httptest.NewServer(running)
+			defer server.Close()
+
+			watcher := New()
+			watcher.Client = server.Client()
+			watcher.sleep = running.grow
+			watcher.AnchorTags = tt.anchorTags
+			got, err := watcher.Watch(context.Background(), server.URL+logPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Watch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(got.TestRun) != tt.wantTests {
+				t.Errorf("Watch() got %d tests, want %d", len(got.TestRun), tt.wantTests)
+			}
+		})
+	}
+}